@@ -132,6 +132,16 @@ var CohereSafetySetting = GetEnvOrDefaultString("COHERE_SAFETY_SETTING", "NONE")
 
 const (
 	RequestIdKey = "X-Oneapi-Request-Id"
+	// AsyncRequestKey 请求头为 true 时以异步模式提交请求
+	AsyncRequestKey = "X-Oneapi-Async"
+	// AsyncCallbackKey 异步请求完成后回调的地址
+	AsyncCallbackKey = "X-Oneapi-Async-Callback"
+	// RetryRequestIdKey 异步请求提交后返回的请求 id，携带该请求头重试即可获取结果
+	RetryRequestIdKey = "Retry_request_id"
+	// TokenRotatedKey 使用已轮换、仍在宽限期内的旧令牌时返回，值为旧令牌失效的时间戳
+	TokenRotatedKey = "X-Oneapi-Token-Rotated"
+	// PriorityKey 请求被限流排队时的优先级，interactive 或 bulk，bulk 请求排在交互式请求之后
+	PriorityKey = "X-Oneapi-Priority"
 )
 
 const (
@@ -154,14 +164,17 @@ var (
 
 // All duration's unit is seconds
 // Shouldn't larger then RateLimitKeyExpirationDuration
+// Burst 为空闲时最多可以连续发出的请求数，为 0 时等于对应的请求次数限制
 var (
 	GlobalApiRateLimitEnable   = GetEnvOrDefaultBool("GLOBAL_API_RATE_LIMIT_ENABLE", true)
 	GlobalApiRateLimitNum      = GetEnvOrDefault("GLOBAL_API_RATE_LIMIT", 18000)
 	GlobalApiRateLimitDuration = int64(GetEnvOrDefault("GLOBAL_API_RATE_LIMIT_DURATION", 180))
+	GlobalApiRateLimitBurst    = GetEnvOrDefault("GLOBAL_API_RATE_LIMIT_BURST", 0)
 
 	GlobalWebRateLimitEnable   = GetEnvOrDefaultBool("GLOBAL_WEB_RATE_LIMIT_ENABLE", true)
 	GlobalWebRateLimitNum      = GetEnvOrDefault("GLOBAL_WEB_RATE_LIMIT", 6000)
 	GlobalWebRateLimitDuration = int64(GetEnvOrDefault("GLOBAL_WEB_RATE_LIMIT_DURATION", 180))
+	GlobalWebRateLimitBurst    = GetEnvOrDefault("GLOBAL_WEB_RATE_LIMIT_BURST", 0)
 
 	UploadRateLimitNum            = 10
 	UploadRateLimitDuration int64 = 60
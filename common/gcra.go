@@ -0,0 +1,146 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// GCRA（通用信元速率算法）限流：每个键只保存一个理论到达时间（TAT），内存和耗时与限制的大小无关。
+// 速率为 Period 内 Rate 次，即每隔 Period/Rate 恢复一次额度，空闲时最多可以连续突发 Burst 次，
+// Burst 为 0 时等于 Rate。被限流时可以直接算出下一次允许请求的时间，不需要轮询。
+type GCRALimit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining 当前还可以立即发出的请求数
+	Remaining int
+	// RetryAfter 被限流时距离下一次允许请求的时间
+	RetryAfter time.Duration
+}
+
+// 时间均以微秒为单位
+func (limit GCRALimit) emissionInterval() int64 {
+	return max(limit.Period.Microseconds()/int64(limit.Rate), 1)
+}
+
+func (limit GCRALimit) tolerance() int64 {
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = limit.Rate
+	}
+	return limit.emissionInterval() * int64(burst)
+}
+
+// gcraAllow 根据上一次的 TAT 判断当前请求是否允许，返回新的 TAT，与 gcraScript 的逻辑一致
+func gcraAllow(tat int64, now int64, limit GCRALimit) (int64, RateLimitResult) {
+	interval := limit.emissionInterval()
+	tolerance := limit.tolerance()
+	if tat < now {
+		tat = now
+	}
+	newTat := tat + interval
+	if newTat-now > tolerance {
+		return tat, RateLimitResult{RetryAfter: time.Duration(newTat-now-tolerance) * time.Microsecond}
+	}
+	return newTat, RateLimitResult{Allowed: true, Remaining: int((now + tolerance - newTat) / interval)}
+}
+
+// gcraScript 返回 {是否允许, 剩余次数, 需要等待的微秒数}，TAT 以整数字符串保存，过期时间即额度完全恢复的时间；
+// 当前时间使用 Redis 的 TIME，各节点的时钟偏差不会影响共用的限额。
+// Redis 5 之前调用 TIME 后写入需要先开启 replicate_commands，Redis 7 中该调用总是返回 true
+const gcraScript = `
+redis.replicate_commands()
+local key = KEYS[1]
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local tat = tonumber(redis.call('GET', key))
+if tat == nil or tat < now then
+	tat = now
+end
+local newTat = tat + interval
+if newTat - now > tolerance then
+	return {0, 0, newTat - now - tolerance}
+end
+redis.call('SET', key, string.format('%d', newTat), 'PX', math.ceil((newTat - now) / 1000))
+return {1, math.floor((now + tolerance - newTat) / interval), 0}
+`
+
+// RedisGCRAAllow 使用 Redis 保存 TAT 的 GCRA 限流，多个节点共用同一个限额
+func RedisGCRAAllow(ctx context.Context, key string, limit GCRALimit) (RateLimitResult, error) {
+	if limit.Rate <= 0 || limit.Period <= 0 {
+		return RateLimitResult{Allowed: true}, nil
+	}
+	result, err := RDB.Eval(ctx, gcraScript, []string{key},
+		limit.emissionInterval(), limit.tolerance()).Result()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 3 {
+		return RateLimitResult{}, errors.New("invalid gcra script result")
+	}
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	retryAfter, _ := values[2].(int64)
+	return RateLimitResult{
+		Allowed:    allowed == 1,
+		Remaining:  int(remaining),
+		RetryAfter: time.Duration(retryAfter) * time.Microsecond,
+	}, nil
+}
+
+// InMemoryGCRALimiter 未启用 Redis 时使用的 GCRA 限流，与 RedisGCRAAllow 的语义相同，只在当前节点生效
+type InMemoryGCRALimiter struct {
+	store map[string]int64
+	mutex sync.Mutex
+}
+
+func (l *InMemoryGCRALimiter) Init(cleanupInterval time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.store == nil {
+		l.store = make(map[string]int64)
+		if cleanupInterval > 0 {
+			go l.clearExpiredItems(cleanupInterval)
+		}
+	}
+}
+
+// clearExpiredItems TAT 早于当前时间的键额度已完全恢复，可以直接删除
+func (l *InMemoryGCRALimiter) clearExpiredItems(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		l.mutex.Lock()
+		now := time.Now().UnixMicro()
+		for key, tat := range l.store {
+			if tat <= now {
+				delete(l.store, key)
+			}
+		}
+		l.mutex.Unlock()
+	}
+}
+
+func (l *InMemoryGCRALimiter) Allow(key string, limit GCRALimit) RateLimitResult {
+	if limit.Rate <= 0 || limit.Period <= 0 {
+		return RateLimitResult{Allowed: true}
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.store == nil {
+		l.store = make(map[string]int64)
+	}
+	tat, result := gcraAllow(l.store[key], time.Now().UnixMicro(), limit)
+	if result.Allowed {
+		l.store[key] = tat
+	}
+	return result
+}
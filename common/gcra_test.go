@@ -0,0 +1,162 @@
+package common
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var benchmarkGCRALimit = GCRALimit{Rate: 1000000, Period: time.Second, Burst: 1000000}
+
+func TestGCRAAllowBurst(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      GCRALimit
+		allowed    int
+		retryAfter time.Duration
+	}{
+		{"burst defaults to rate", GCRALimit{Rate: 10, Period: time.Second}, 10, 100 * time.Millisecond},
+		{"burst smaller than rate", GCRALimit{Rate: 10, Period: time.Second, Burst: 3}, 3, 100 * time.Millisecond},
+		{"burst larger than rate", GCRALimit{Rate: 60, Period: time.Minute, Burst: 120}, 120, time.Second},
+		{"single request", GCRALimit{Rate: 1, Period: time.Minute}, 1, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now().UnixMicro()
+			var tat int64
+			allowed := 0
+			var result RateLimitResult
+			for i := 0; i < tt.allowed+1; i++ {
+				tat, result = gcraAllow(tat, now, tt.limit)
+				if !result.Allowed {
+					break
+				}
+				allowed++
+				if result.Remaining != tt.allowed-allowed {
+					t.Fatalf("request %d: remaining = %d, want %d", allowed, result.Remaining, tt.allowed-allowed)
+				}
+			}
+			if allowed != tt.allowed {
+				t.Fatalf("allowed = %d, want %d", allowed, tt.allowed)
+			}
+			if result.Allowed || result.RetryAfter != tt.retryAfter {
+				t.Fatalf("denied result = %+v, want retry after %s", result, tt.retryAfter)
+			}
+		})
+	}
+}
+
+func TestGCRAAllowRecovery(t *testing.T) {
+	limit := GCRALimit{Rate: 10, Period: time.Second, Burst: 2}
+	start := time.Now().UnixMicro()
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		allowed bool
+	}{
+		{"first", 0, true},
+		{"second within burst", 0, true},
+		{"third exceeds burst", 0, false},
+		{"before one interval", 99 * time.Millisecond, false},
+		{"after one interval", 100 * time.Millisecond, true},
+		{"again at the same instant", 100 * time.Millisecond, false},
+		{"idle recovers the full burst", 10 * time.Second, true},
+		{"second after idle", 10 * time.Second, true},
+		{"third after idle", 10 * time.Second, false},
+	}
+	var tat int64
+	for _, tt := range tests {
+		var result RateLimitResult
+		tat, result = gcraAllow(tat, start+tt.elapsed.Microseconds(), limit)
+		if result.Allowed != tt.allowed {
+			t.Fatalf("%s: allowed = %t, want %t", tt.name, result.Allowed, tt.allowed)
+		}
+	}
+}
+
+func TestInMemoryGCRALimiter(t *testing.T) {
+	var limiter InMemoryGCRALimiter
+	limiter.Init(0)
+	limit := GCRALimit{Rate: 2, Period: time.Hour}
+	tests := []struct {
+		key     string
+		allowed bool
+	}{
+		{"a", true},
+		{"a", true},
+		{"a", false},
+		{"b", true},
+		{"b", true},
+		{"b", false},
+	}
+	for i, tt := range tests {
+		result := limiter.Allow(tt.key, limit)
+		if result.Allowed != tt.allowed {
+			t.Fatalf("request %d on %s: allowed = %t, want %t", i, tt.key, result.Allowed, tt.allowed)
+		}
+		if !result.Allowed && (result.RetryAfter <= 0 || result.RetryAfter > 30*time.Minute) {
+			t.Fatalf("request %d on %s: retry after = %s", i, tt.key, result.RetryAfter)
+		}
+	}
+	if result := limiter.Allow("c", GCRALimit{}); !result.Allowed {
+		t.Fatalf("zero limit should not limit requests")
+	}
+}
+
+func BenchmarkInMemoryGCRAAllow(b *testing.B) {
+	var limiter InMemoryGCRALimiter
+	limiter.Init(0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		limiter.Allow("bench", benchmarkGCRALimit)
+	}
+}
+
+func BenchmarkInMemoryGCRAAllowParallel(b *testing.B) {
+	var limiter InMemoryGCRALimiter
+	limiter.Init(0)
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "bench:" + strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			limiter.Allow(keys[i%len(keys)], benchmarkGCRALimit)
+			i++
+		}
+	})
+}
+
+// BenchmarkRedisGCRAAllow 需要设置 REDIS_CONN_STRING 指向可以写入的 Redis，未设置时跳过
+func BenchmarkRedisGCRAAllow(b *testing.B) {
+	connString := os.Getenv("REDIS_CONN_STRING")
+	if connString == "" {
+		b.Skip("REDIS_CONN_STRING not set")
+	}
+	opt, err := redis.ParseURL(connString)
+	if err != nil {
+		b.Fatal(err)
+	}
+	origin := RDB
+	RDB = redis.NewClient(opt)
+	defer func() {
+		RDB.Close()
+		RDB = origin
+	}()
+	ctx := context.Background()
+	key := "benchmark:gcra:" + GetUUID()
+	defer RDB.Del(ctx, key)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := RedisGCRAAllow(ctx, key, benchmarkGCRALimit); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
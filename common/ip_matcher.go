@@ -0,0 +1,153 @@
+package common
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// ipTrieNode 按位展开的前缀树节点，terminal 表示从根到该节点的前缀是一条规则
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	terminal bool
+}
+
+func (n *ipTrieNode) insert(prefix netip.Prefix) {
+	addr := prefix.Addr().AsSlice()
+	node := n
+	for i := 0; i < prefix.Bits(); i++ {
+		if node.terminal {
+			// 已有更短的前缀覆盖了这条规则
+			return
+		}
+		bit := addr[i/8] >> (7 - i%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &ipTrieNode{}
+		}
+		node = node.children[bit]
+	}
+	node.terminal = true
+	node.children = [2]*ipTrieNode{}
+}
+
+func (n *ipTrieNode) contains(addr []byte) bool {
+	node := n
+	for i := 0; i < len(addr)*8; i++ {
+		if node.terminal {
+			return true
+		}
+		node = node.children[addr[i/8]>>(7-i%8)&1]
+		if node == nil {
+			return false
+		}
+	}
+	return node.terminal
+}
+
+// IPMatcher 由单个 IP 和 CIDR 组成的 IP 列表，IPv4 和 IPv6 分别保存在两棵前缀树中，
+// 匹配耗时只与地址长度有关，与列表大小无关
+type IPMatcher struct {
+	v4   *ipTrieNode
+	v6   *ipTrieNode
+	size int
+}
+
+// ParseIPMatcher 解析以换行、逗号或空格分隔的 IP 和 CIDR 列表，返回无法解析的条目
+func ParseIPMatcher(text string) (*IPMatcher, []string) {
+	matcher := &IPMatcher{v4: &ipTrieNode{}, v6: &ipTrieNode{}}
+	var invalid []string
+	entries := strings.FieldsFunc(text, func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ',' || r == ' ' || r == '\t'
+	})
+	for _, entry := range entries {
+		prefix, err := parseIPPrefix(entry)
+		if err != nil {
+			invalid = append(invalid, entry)
+			continue
+		}
+		if prefix.Addr().Is4() {
+			matcher.v4.insert(prefix)
+		} else {
+			matcher.v6.insert(prefix)
+		}
+		matcher.size++
+	}
+	return matcher, invalid
+}
+
+func parseIPPrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ValidateIPList 检查 IP 列表中的每一项都是合法的 IP 或 CIDR
+func ValidateIPList(text string) error {
+	_, invalid := ParseIPMatcher(text)
+	if len(invalid) > 0 {
+		return fmt.Errorf("无效的 IP 或 CIDR：%s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+func (m *IPMatcher) Empty() bool {
+	return m == nil || m.size == 0
+}
+
+func (m *IPMatcher) Contains(ip string) bool {
+	if m.Empty() {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	if addr.Is4() {
+		return m.v4.contains(addr.AsSlice())
+	}
+	return m.v6.contains(addr.AsSlice())
+}
+
+const ipMatcherCacheSize = 4096
+
+var (
+	ipMatcherCache     = make(map[string]*IPMatcher)
+	ipMatcherCacheLock sync.RWMutex
+)
+
+// GetIPMatcher 返回 IP 列表对应的前缀树，同一列表只构建一次，忽略无法解析的条目
+func GetIPMatcher(text string) *IPMatcher {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	ipMatcherCacheLock.RLock()
+	matcher, ok := ipMatcherCache[text]
+	ipMatcherCacheLock.RUnlock()
+	if ok {
+		return matcher
+	}
+	matcher, _ = ParseIPMatcher(text)
+	ipMatcherCacheLock.Lock()
+	if len(ipMatcherCache) >= ipMatcherCacheSize {
+		// 列表修改后旧的条目不再使用，超过上限时整体清空
+		ipMatcherCache = make(map[string]*IPMatcher)
+	}
+	ipMatcherCache[text] = matcher
+	ipMatcherCacheLock.Unlock()
+	return matcher
+}
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIPMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		size    int
+		invalid []string
+	}{
+		{"empty", "", 0, nil},
+		{"newline separated", "10.0.0.1\n192.168.0.0/16\r\n2001:db8::/32", 3, nil},
+		{"comma and space separated", "10.0.0.1, 10.0.0.2 10.0.0.3\t10.0.0.4", 4, nil},
+		{"invalid entries are reported", "10.0.0.1,not-an-ip,10.0.0.0/33,::1", 2, []string{"not-an-ip", "10.0.0.0/33"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, invalid := ParseIPMatcher(tt.text)
+			if matcher.size != tt.size {
+				t.Fatalf("size = %d, want %d", matcher.size, tt.size)
+			}
+			if !reflect.DeepEqual(invalid, tt.invalid) {
+				t.Fatalf("invalid = %v, want %v", invalid, tt.invalid)
+			}
+			if err := ValidateIPList(tt.text); (err != nil) != (len(tt.invalid) > 0) {
+				t.Fatalf("ValidateIPList error = %v", err)
+			}
+		})
+	}
+}
+
+func TestIPMatcherContains(t *testing.T) {
+	matcher, invalid := ParseIPMatcher(`
+10.0.0.0/8
+192.168.1.10
+172.16.0.0/12
+2001:db8::/32
+::ffff:203.0.113.0/120
+fe80::1%eth0
+`)
+	if len(invalid) > 0 {
+		t.Fatalf("unexpected invalid entries: %v", invalid)
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.0.0.1", true},
+		{"10.255.255.255", true},
+		{"11.0.0.1", false},
+		{"192.168.1.10", true},
+		{"192.168.1.11", false},
+		{"172.31.255.255", true},
+		{"172.32.0.0", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		// IPv4 映射的 IPv6 地址按 IPv4 匹配
+		{"::ffff:10.1.2.3", true},
+		{"203.0.113.7", true},
+		{"203.0.114.7", false},
+		// 规则中的 zone 被忽略
+		{"fe80::1", true},
+		{"fe80::2", false},
+		{"", false},
+		{"not-an-ip", false},
+	}
+	for _, tt := range tests {
+		if got := matcher.Contains(tt.ip); got != tt.want {
+			t.Errorf("Contains(%q) = %t, want %t", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestIPMatcherOverlappingPrefixes(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		ip   string
+		want bool
+	}{
+		{"shorter prefix first", "10.0.0.0/8,10.1.0.0/16", "10.2.0.1", true},
+		{"longer prefix first", "10.1.0.0/16,10.0.0.0/8", "10.2.0.1", true},
+		{"host inside prefix", "10.0.0.5,10.0.0.0/24", "10.0.0.200", true},
+		{"unmasked prefix", "10.0.0.77/24", "10.0.0.1", true},
+		{"match all v4", "0.0.0.0/0", "8.8.8.8", true},
+		{"v4 rules do not match v6", "0.0.0.0/0", "2001:db8::1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, _ := ParseIPMatcher(tt.text)
+			if got := matcher.Contains(tt.ip); got != tt.want {
+				t.Fatalf("Contains(%q) = %t, want %t", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIPMatcher(t *testing.T) {
+	if matcher := GetIPMatcher("  \n "); !matcher.Empty() || matcher.Contains("10.0.0.1") {
+		t.Fatalf("blank list should be empty")
+	}
+	first := GetIPMatcher("10.0.0.0/8")
+	if first != GetIPMatcher("10.0.0.0/8") {
+		t.Fatalf("matcher for the same list should be cached")
+	}
+	// 无法解析的条目被忽略，其他条目仍然生效
+	if matcher := GetIPMatcher("bad,10.0.0.1"); !matcher.Contains("10.0.0.1") {
+		t.Fatalf("valid entries should still match")
+	}
+}
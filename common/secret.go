@@ -0,0 +1,220 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 敏感字段使用信封加密：每个值使用随机生成的数据密钥（DEK）以 AES-256-GCM 加密，
+// 数据密钥再由密钥加密密钥（KEK）加密后与密文一起保存，格式为
+// enc:v1:<KEK 标识>:<加密后的 DEK>:<加密后的数据>，轮换 KEK 时只需要重新加密 DEK。
+// KEK 来自 CRYPTO_KEK_FILE 指定的文件，或显式设置的 CRYPTO_SECRET，两者都未设置时不加密；
+// 轮换期间旧的 KEK 通过 CRYPTO_PREVIOUS_KEK_FILES 或 CRYPTO_PREVIOUS_SECRETS（逗号分隔）提供。
+const secretPrefix = "enc:v1:"
+
+var (
+	secretKEK     []byte
+	secretKEKId   string
+	secretOldKEKs = make(map[string][]byte)
+)
+
+func deriveKEK(material []byte) []byte {
+	// 文件内容为 32 字节密钥的 base64 编码时直接使用，否则取 SHA-256
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(material))); err == nil && len(decoded) == 32 {
+		return decoded
+	}
+	sum := sha256.Sum256(material)
+	return sum[:]
+}
+
+func kekId(kek []byte) string {
+	sum := sha256.Sum256(kek)
+	return hex.EncodeToString(sum[:4])
+}
+
+func loadKEKFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key-encryption key file: %w", err)
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, errors.New("key-encryption key file is empty")
+	}
+	return deriveKEK([]byte(strings.TrimSpace(string(data)))), nil
+}
+
+// InitSecretEncryption 加载 KEK，在 LoadEnv 中调用
+func InitSecretEncryption() error {
+	if path := os.Getenv("CRYPTO_KEK_FILE"); path != "" {
+		kek, err := loadKEKFile(path)
+		if err != nil {
+			return err
+		}
+		secretKEK = kek
+	} else if secret := os.Getenv("CRYPTO_SECRET"); secret != "" {
+		secretKEK = deriveKEK([]byte(secret))
+	}
+	if secretKEK != nil {
+		secretKEKId = kekId(secretKEK)
+	}
+	for _, path := range strings.Split(os.Getenv("CRYPTO_PREVIOUS_KEK_FILES"), ",") {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		kek, err := loadKEKFile(path)
+		if err != nil {
+			return err
+		}
+		secretOldKEKs[kekId(kek)] = kek
+	}
+	for _, secret := range strings.Split(os.Getenv("CRYPTO_PREVIOUS_SECRETS"), ",") {
+		if secret == "" {
+			continue
+		}
+		kek := deriveKEK([]byte(secret))
+		secretOldKEKs[kekId(kek)] = kek
+	}
+	return nil
+}
+
+// SecretEncryptionEnabled 是否配置了 KEK，未配置时敏感字段以明文保存
+func SecretEncryptionEnabled() bool {
+	return secretKEK != nil
+}
+
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// IsSecretCurrentKey 密文是否由当前的 KEK 加密
+func IsSecretCurrentKey(value string) bool {
+	return IsEncryptedSecret(value) && strings.HasPrefix(value[len(secretPrefix):], secretKEKId+":")
+}
+
+func sealGCM(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openGCM(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// EncryptSecret 加密敏感字段，未配置 KEK、值为空或已加密时原样返回
+func EncryptSecret(plaintext string) (string, error) {
+	if !SecretEncryptionEnabled() || plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wrappedDEK, err := sealGCM(secretKEK, dek)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := sealGCM(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return secretPrefix + secretKEKId + ":" + base64.RawStdEncoding.EncodeToString(wrappedDEK) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+func parseSecret(value string) (kek []byte, wrappedDEK []byte, ciphertext []byte, err error) {
+	parts := strings.Split(value[len(secretPrefix):], ":")
+	if len(parts) != 3 {
+		return nil, nil, nil, errors.New("invalid encrypted secret")
+	}
+	if parts[0] == secretKEKId {
+		kek = secretKEK
+	} else {
+		kek = secretOldKEKs[parts[0]]
+	}
+	if kek == nil {
+		return nil, nil, nil, fmt.Errorf("key-encryption key %s not configured", parts[0])
+	}
+	if wrappedDEK, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return nil, nil, nil, err
+	}
+	if ciphertext, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return nil, nil, nil, err
+	}
+	return kek, wrappedDEK, ciphertext, nil
+}
+
+// DecryptSecret 解密敏感字段，未加密的值原样返回，便于兼容加密之前保存的数据
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	kek, wrappedDEK, ciphertext, err := parseSecret(value)
+	if err != nil {
+		return "", err
+	}
+	dek, err := openGCM(kek, wrappedDEK)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	plaintext, err := openGCM(dek, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// RewrapSecret 使用当前的 KEK 重新加密密文中的数据密钥，数据本身的密文不变；明文会被加密
+func RewrapSecret(value string) (string, error) {
+	if !SecretEncryptionEnabled() {
+		return "", errors.New("secret encryption is not configured")
+	}
+	if !IsEncryptedSecret(value) {
+		return EncryptSecret(value)
+	}
+	if IsSecretCurrentKey(value) {
+		return value, nil
+	}
+	kek, wrappedDEK, ciphertext, err := parseSecret(value)
+	if err != nil {
+		return "", err
+	}
+	dek, err := openGCM(kek, wrappedDEK)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	if wrappedDEK, err = sealGCM(secretKEK, dek); err != nil {
+		return "", err
+	}
+	return secretPrefix + secretKEKId + ":" + base64.RawStdEncoding.EncodeToString(wrappedDEK) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
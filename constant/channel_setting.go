@@ -6,4 +6,6 @@ var (
 	ChannelSettingThinkingToContent = "thinking_to_content" // ThinkingToContent
 	ChannelSettingFallbackChannel   = "fallback_channel"    // FallbackChannel 兜底渠道标识
 	ChannelSettingPassthroughBody   = "passthrough_body"    // PassthroughBody 直接转发body，不修改内容
+	ChannelSettingMaxConcurrency    = "max_concurrency"     // MaxConcurrency 渠道最大并发请求数，所有节点共享，0 为不限制
+	ChannelSettingKeyRotation       = "key_rotation"        // KeyRotation 号池密钥的选择方式：round_robin、random、least_used
 )
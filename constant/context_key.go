@@ -8,4 +8,18 @@ const (
 	ContextKeyUserEmail        = "user_email"
 	ContextKeyUserGroup        = "user_group"
 	ContextKeyUserName         = "username"
+	ContextKeyChannelSlot      = "channel_slot"
+	ContextKeyTokenRateLimit   = "token_rate_limit"
+
+	ContextKeyUserMaxConcurrentRequests  = "user_max_concurrent_requests"
+	ContextKeyUserMaxRealtimeSessions    = "user_max_realtime_sessions"
+	ContextKeyTokenMaxConcurrentRequests = "token_max_concurrent_requests"
+	ContextKeyTokenMaxRealtimeSessions   = "token_max_realtime_sessions"
+
+	ContextKeyClientTokenId        = "client_token_id"
+	ContextKeyClientTokenQuota     = "client_token_quota"
+	ContextKeyClientTokenExpiresAt = "client_token_expires_at"
+	ContextKeyEndUserId            = "end_user_id"
+
+	ContextKeyAdminPermissions = "admin_permissions"
 )
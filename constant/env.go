@@ -46,3 +46,136 @@ func InitEnv() {
 
 // GenerateDefaultToken 是否生成初始令牌，默认关闭。
 var GenerateDefaultToken = common.GetEnvOrDefaultBool("GENERATE_DEFAULT_TOKEN", false)
+
+// FileStorageDriver /v1/files 的存储驱动，可选 local 或 s3
+var FileStorageDriver = common.GetEnvOrDefaultString("FILE_STORAGE_DRIVER", "local")
+
+// FileStorageLocalDir local 驱动保存文件的目录
+var FileStorageLocalDir = common.GetEnvOrDefaultString("FILE_STORAGE_LOCAL_DIR", "./data/files")
+
+// FileStorageS3* s3 驱动的配置，兼容 AWS S3、腾讯云 COS、MinIO 等 S3 协议的对象存储
+var FileStorageS3Endpoint = common.GetEnvOrDefaultString("FILE_STORAGE_S3_ENDPOINT", "")
+var FileStorageS3Region = common.GetEnvOrDefaultString("FILE_STORAGE_S3_REGION", "us-east-1")
+var FileStorageS3Bucket = common.GetEnvOrDefaultString("FILE_STORAGE_S3_BUCKET", "")
+var FileStorageS3Prefix = common.GetEnvOrDefaultString("FILE_STORAGE_S3_PREFIX", "")
+var FileStorageS3AccessKey = common.GetEnvOrDefaultString("FILE_STORAGE_S3_ACCESS_KEY", "")
+var FileStorageS3SecretKey = common.GetEnvOrDefaultString("FILE_STORAGE_S3_SECRET_KEY", "")
+
+// FileStorageS3PathStyle 使用 endpoint/bucket/key 形式访问，MinIO 等自建存储通常需要开启
+var FileStorageS3PathStyle = common.GetEnvOrDefaultBool("FILE_STORAGE_S3_PATH_STYLE", false)
+
+// FileMaxUploadMB 单个文件的大小上限
+var FileMaxUploadMB = common.GetEnvOrDefault("FILE_MAX_UPLOAD_MB", 512)
+
+// FileStorageQuotaMB 每个用户默认的文件存储空间，可通过用户设置 file_storage_quota_mb 单独调整
+var FileStorageQuotaMB = common.GetEnvOrDefault("FILE_STORAGE_QUOTA_MB", 1024)
+
+// BatchPriceRatio /v1/batches 中每个请求的计费折扣，与分组倍率相乘
+var BatchPriceRatio = common.GetEnvOrDefaultFloat64("BATCH_PRICE_RATIO", 0.5)
+
+// BatchConcurrency 所有批处理任务共享的最大并发请求数
+var BatchConcurrency = common.GetEnvOrDefault("BATCH_CONCURRENCY", 8)
+
+// BatchMaxRequests 单个批处理任务允许的最大请求数
+var BatchMaxRequests = common.GetEnvOrDefault("BATCH_MAX_REQUESTS", 50000)
+
+// AsyncRequestConcurrency 每个节点同时执行的异步请求数
+var AsyncRequestConcurrency = common.GetEnvOrDefault("ASYNC_REQUEST_CONCURRENCY", 32)
+
+// AsyncRequestTimeout 异步请求执行超过该时间（秒）仍未完成时，视为节点已退出，由主节点重新执行
+var AsyncRequestTimeout = common.GetEnvOrDefault("ASYNC_REQUEST_TIMEOUT", 1800)
+
+// AsyncResultRetentionHours 异步请求结果的保留时间
+var AsyncResultRetentionHours = common.GetEnvOrDefault("ASYNC_RESULT_RETENTION_HOURS", 24)
+
+// AdaptiveChannelWindowSeconds adaptive 渠道选择策略统计延迟和错误率的时间窗口
+var AdaptiveChannelWindowSeconds = common.GetEnvOrDefault("ADAPTIVE_CHANNEL_WINDOW_SECONDS", 60)
+
+// AdaptiveChannelExploreRatio adaptive 策略下保留给所有渠道平均分配的流量比例，保证恢复中的渠道仍有少量请求
+var AdaptiveChannelExploreRatio = common.GetEnvOrDefaultFloat64("ADAPTIVE_CHANNEL_EXPLORE_RATIO", 0.05)
+
+// ChannelBreakerEnabled 是否启用按渠道和模型的熔断器，熔断中的渠道暂时不参与选择，冷却后放行少量探测请求，成功后自动恢复。
+// 默认关闭，启用后分组内所有渠道都熔断时请求直接返回 503
+var ChannelBreakerEnabled = common.GetEnvOrDefaultBool("CHANNEL_BREAKER_ENABLED", false)
+
+// ChannelBreakerFailureThreshold 连续失败多少次后熔断
+var ChannelBreakerFailureThreshold = common.GetEnvOrDefault("CHANNEL_BREAKER_FAILURE_THRESHOLD", 5)
+
+// ChannelBreakerErrorRate 统计窗口内错误率达到该值时熔断，请求数不少于 CHANNEL_BREAKER_MIN_REQUESTS 时才生效
+var ChannelBreakerErrorRate = common.GetEnvOrDefaultFloat64("CHANNEL_BREAKER_ERROR_RATE", 0.5)
+
+// ChannelBreakerMinRequests 按错误率熔断时统计窗口内的最少请求数
+var ChannelBreakerMinRequests = common.GetEnvOrDefault("CHANNEL_BREAKER_MIN_REQUESTS", 20)
+
+// ChannelBreakerWindowSeconds 统计错误率的时间窗口
+var ChannelBreakerWindowSeconds = common.GetEnvOrDefault("CHANNEL_BREAKER_WINDOW_SECONDS", 60)
+
+// ChannelBreakerCooldownSeconds 第一次熔断的冷却时间，之后每次连续熔断翻倍
+var ChannelBreakerCooldownSeconds = common.GetEnvOrDefault("CHANNEL_BREAKER_COOLDOWN_SECONDS", 10)
+
+// ChannelBreakerMaxCooldownSeconds 冷却时间上限，恢复后超过该时间未再熔断时冷却时间重新从初始值开始
+var ChannelBreakerMaxCooldownSeconds = common.GetEnvOrDefault("CHANNEL_BREAKER_MAX_COOLDOWN_SECONDS", 600)
+
+// ChannelBreakerHalfOpenProbes 冷却结束后放行的探测请求数，全部成功后恢复
+var ChannelBreakerHalfOpenProbes = common.GetEnvOrDefault("CHANNEL_BREAKER_HALF_OPEN_PROBES", 3)
+
+// ChannelQueueSize 渠道并发全部已满时每个节点允许排队等待的请求数
+var ChannelQueueSize = common.GetEnvOrDefault("CHANNEL_QUEUE_SIZE", 100)
+
+// ChannelQueueTimeout 渠道并发全部已满时请求排队等待的最长时间（秒）
+var ChannelQueueTimeout = common.GetEnvOrDefault("CHANNEL_QUEUE_TIMEOUT", 30)
+
+// TokenRotationGracePeriod 令牌轮换后旧令牌默认仍然可用的时间（秒）
+var TokenRotationGracePeriod = common.GetEnvOrDefault("TOKEN_ROTATION_GRACE_PERIOD", 86400)
+
+// TokenRotationMaxGracePeriod 轮换时可以指定的最长宽限期（秒）
+var TokenRotationMaxGracePeriod = common.GetEnvOrDefault("TOKEN_ROTATION_MAX_GRACE_PERIOD", 604800)
+
+// RateLimitBulkGroups 限流排队时按批量优先级处理的分组（逗号分隔），交互式请求优先于批量请求获得额度
+var RateLimitBulkGroups = common.GetEnvOrDefaultString("RATE_LIMIT_BULK_GROUPS", "")
+
+// RateLimitGroupWeights 限流排队时各分组令牌的权重，格式为 分组:权重（逗号分隔），未配置的分组权重为 1
+var RateLimitGroupWeights = common.GetEnvOrDefaultString("RATE_LIMIT_GROUP_WEIGHTS", "")
+
+// CentralSiteName 当前部署在中心控制库中的站点名，多个部署共用中心控制库时用于区分各自的限速配置
+var CentralSiteName = common.GetEnvOrDefaultString("CENTRAL_SITE_NAME", "newapi-prod-center")
+
+// AdaptiveRateLimitEnabled 是否根据上游 429、渠道并发饱和和用户占比自动调整中心控制库中启用的用户限速（AIMD）
+var AdaptiveRateLimitEnabled = common.GetEnvOrDefaultBool("ADAPTIVE_RATE_LIMIT_ENABLED", false)
+
+// AdaptiveRateLimitDryRun 只计算建议限速 suggested_rate_limit 并记录调整，不修改当前限速
+var AdaptiveRateLimitDryRun = common.GetEnvOrDefaultBool("ADAPTIVE_RATE_LIMIT_DRY_RUN", false)
+
+// AdaptiveRateLimitInterval 自适应限速的调整间隔（秒），统计窗口为该间隔向上取整的分钟数
+var AdaptiveRateLimitInterval = common.GetEnvOrDefault("ADAPTIVE_RATE_LIMIT_INTERVAL", 60)
+
+// AdaptiveRateLimitCongestionRatio 分组、模型的上游 429 和渠道并发已满的请求占比达到该值时视为拥塞
+var AdaptiveRateLimitCongestionRatio = common.GetEnvOrDefaultFloat64("ADAPTIVE_RATE_LIMIT_CONGESTION_RATIO", 0.05)
+
+// AdaptiveRateLimitIncreaseStep 未拥塞且用户请求接近限速时每次增加的限速（rpm）
+var AdaptiveRateLimitIncreaseStep = common.GetEnvOrDefault("ADAPTIVE_RATE_LIMIT_INCREASE_STEP", 5)
+
+// AdaptiveRateLimitDecreaseFactor 拥塞时请求占比不低于平均值的用户限速乘以该系数
+var AdaptiveRateLimitDecreaseFactor = common.GetEnvOrDefaultFloat64("ADAPTIVE_RATE_LIMIT_DECREASE_FACTOR", 0.7)
+
+// AdaptiveRateLimitMin 自动调整的限速下限（rpm），配置中的 min_rate_limit 大于 0 时以配置为准
+var AdaptiveRateLimitMin = common.GetEnvOrDefault("ADAPTIVE_RATE_LIMIT_MIN", 10)
+
+// AdaptiveRateLimitMax 自动调整的限速上限（rpm），配置中的 max_rate_limit 大于 0 时以配置为准
+var AdaptiveRateLimitMax = common.GetEnvOrDefault("ADAPTIVE_RATE_LIMIT_MAX", 1000)
+
+// SpendBudgetTimezone 周期预算按自然日、周、月重置时默认使用的时区，预算单独设置的时区优先
+var SpendBudgetTimezone = common.GetEnvOrDefaultString("SPEND_BUDGET_TIMEZONE", "Asia/Shanghai")
+
+// ClientTokenSecret 短期客户端令牌（JWT）的签名密钥，为空时不能签发和使用短期令牌，多节点部署时需保持一致。
+// 不复用 CRYPTO_SECRET，避免与会话和数据加密共用密钥
+var ClientTokenSecret = common.GetEnvOrDefaultString("CLIENT_TOKEN_SECRET", "")
+
+// ClientTokenDefaultTTL 短期客户端令牌未指定有效期时的默认有效期（秒）
+var ClientTokenDefaultTTL = common.GetEnvOrDefault("CLIENT_TOKEN_DEFAULT_TTL", 900)
+
+// ClientTokenMaxTTL 短期客户端令牌的最长有效期（秒）
+var ClientTokenMaxTTL = common.GetEnvOrDefault("CLIENT_TOKEN_MAX_TTL", 86400)
+
+// AuditLogJSONLEnabled 审计日志写入数据库的同时导出到 JSONL 日志（与请求日志共用 COS 上传）
+var AuditLogJSONLEnabled = common.GetEnvOrDefaultBool("AUDIT_LOG_JSONL_ENABLED", false)
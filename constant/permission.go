@@ -0,0 +1,55 @@
+package constant
+
+// 管理后台的权限，超级管理员拥有全部权限，自定义角色由超级管理员分配
+const (
+	PermissionChannelRead       = "channel.read"
+	PermissionChannelWrite      = "channel.write"
+	PermissionUserRead          = "user.read"
+	PermissionUserWrite         = "user.write"
+	PermissionUserQuotaWrite    = "user.quota.write"
+	PermissionBillingRead       = "billing.read"
+	PermissionLogWrite          = "log.write"
+	PermissionTaskRead          = "task.read"
+	PermissionRedemptionRead    = "redemption.read"
+	PermissionRedemptionWrite   = "redemption.write"
+	PermissionOrganizationRead  = "organization.read"
+	PermissionOrganizationWrite = "organization.write"
+	PermissionAuditRead         = "audit.read"
+	PermissionStatusRead        = "status.read"
+	PermissionOptionRead        = "option.read"
+	PermissionOptionWrite       = "option.write"
+)
+
+var Permissions = []string{
+	PermissionChannelRead,
+	PermissionChannelWrite,
+	PermissionUserRead,
+	PermissionUserWrite,
+	PermissionUserQuotaWrite,
+	PermissionBillingRead,
+	PermissionLogWrite,
+	PermissionTaskRead,
+	PermissionRedemptionRead,
+	PermissionRedemptionWrite,
+	PermissionOrganizationRead,
+	PermissionOrganizationWrite,
+	PermissionAuditRead,
+	PermissionStatusRead,
+	PermissionOptionRead,
+	PermissionOptionWrite,
+}
+
+// RootOnlyPermissions 未分配自定义角色的管理员不具备的权限，与之前只有超级管理员可以修改系统设置的行为保持一致
+var RootOnlyPermissions = []string{
+	PermissionOptionRead,
+	PermissionOptionWrite,
+}
+
+func IsValidPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package constant
+
+import "strings"
+
+// 令牌可访问的接口范围，令牌未设置范围时可以访问所有接口
+const (
+	TokenScopeChat          = "chat"
+	TokenScopeEmbeddings    = "embeddings"
+	TokenScopeRerank        = "rerank"
+	TokenScopeImages        = "images"
+	TokenScopeAudio         = "audio"
+	TokenScopeRealtime      = "realtime"
+	TokenScopeMidjourney    = "mj"
+	TokenScopeSuno          = "suno"
+	TokenScopeBatch         = "batch"
+	TokenScopeFiles         = "files"
+	TokenScopeGoogleStorage = "google-storage"
+)
+
+var TokenScopes = []string{
+	TokenScopeChat,
+	TokenScopeEmbeddings,
+	TokenScopeRerank,
+	TokenScopeImages,
+	TokenScopeAudio,
+	TokenScopeRealtime,
+	TokenScopeMidjourney,
+	TokenScopeSuno,
+	TokenScopeBatch,
+	TokenScopeFiles,
+	TokenScopeGoogleStorage,
+}
+
+func IsValidTokenScope(scope string) bool {
+	for _, s := range TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Path2TokenScope 返回请求路径所需的令牌范围，scope 为空字符串表示不需要范围（如模型列表、额度查询）；
+// known 为 false 表示路径未归类，设置了范围的令牌不能访问，新增接口时需要在这里归类
+func Path2TokenScope(path string) (scope string, known bool) {
+	switch {
+	case strings.HasPrefix(path, "/v1/models") || strings.HasPrefix(path, "/dashboard/") ||
+		strings.HasPrefix(path, "/v1/dashboard/") || strings.HasPrefix(path, "/v1/async/") ||
+		strings.HasPrefix(path, "/v1/client_tokens"):
+		return "", true
+	case strings.HasPrefix(path, "/v1/embeddings") || strings.HasPrefix(path, "/v1/engines/"):
+		return TokenScopeEmbeddings, true
+	case strings.HasPrefix(path, "/v1/rerank"):
+		return TokenScopeRerank, true
+	case strings.HasPrefix(path, "/v1/images/"):
+		return TokenScopeImages, true
+	case strings.HasPrefix(path, "/v1/audio/"):
+		return TokenScopeAudio, true
+	case strings.HasPrefix(path, "/v1/realtime"):
+		return TokenScopeRealtime, true
+	case strings.HasPrefix(path, "/v1/files"):
+		return TokenScopeFiles, true
+	case strings.HasPrefix(path, "/v1/batches") || strings.HasPrefix(path, "/batchjob/") || strings.HasPrefix(path, "/google/v1beta1/"):
+		return TokenScopeBatch, true
+	case strings.HasPrefix(path, "/google/"):
+		return TokenScopeGoogleStorage, true
+	case strings.HasPrefix(path, "/suno/"):
+		return TokenScopeSuno, true
+	case strings.HasPrefix(path, "/mj/") || strings.Contains(path, "/mj/") && !strings.HasPrefix(path, "/v1"):
+		return TokenScopeMidjourney, true
+	case strings.HasPrefix(path, "/v1beta/models/"):
+		// gemini 格式的 embedContent / batchEmbedContents 属于 embeddings
+		if strings.Contains(path, "embedContent") || strings.Contains(path, "EmbedContents") {
+			return TokenScopeEmbeddings, true
+		}
+		return TokenScopeChat, true
+	case strings.HasPrefix(path, "/v1/chat/") || strings.HasPrefix(path, "/v1/completions") ||
+		strings.HasPrefix(path, "/v1/responses") || strings.HasPrefix(path, "/v1/edits") ||
+		strings.HasPrefix(path, "/v1/messages") || strings.HasPrefix(path, "/v1/moderations"):
+		return TokenScopeChat, true
+	}
+	return "", false
+}
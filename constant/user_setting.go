@@ -6,6 +6,7 @@ var (
 	UserSettingWebhookUrl            = "webhook_url"             // WebhookUrl webhook地址
 	UserSettingWebhookSecret         = "webhook_secret"          // WebhookSecret webhook密钥
 	UserSettingNotificationEmail     = "notification_email"      // NotificationEmail 通知邮箱地址
+	UserSettingFileStorageQuotaMB    = "file_storage_quota_mb"   // FileStorageQuotaMB 文件存储空间上限（MB）
 )
 
 var (
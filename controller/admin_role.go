@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hasPermission 判断当前管理员是否拥有权限，路由经过 PermissionAuth 时直接使用其写入上下文的结果
+func hasPermission(c *gin.Context, permission string) bool {
+	if granted, ok := c.Get(constant.ContextKeyAdminPermissions); ok {
+		return granted.(map[string]bool)[permission]
+	}
+	granted, err := model.GetUserPermissions(c.GetInt("id"), c.GetInt("role"))
+	if err != nil {
+		return false
+	}
+	return granted[permission]
+}
+
+// GetPermissions 返回所有可分配的权限
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    constant.Permissions,
+	})
+}
+
+// GetSelfPermissions 返回当前用户拥有的管理权限，前端据此显示管理菜单
+func GetSelfPermissions(c *gin.Context) {
+	granted, err := model.GetUserPermissions(c.GetInt("id"), c.GetInt("role"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	permissions := make([]string, 0, len(granted))
+	for _, permission := range constant.Permissions {
+		if granted[permission] {
+			permissions = append(permissions, permission)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    permissions,
+	})
+}
+
+func GetAllAdminRoles(c *gin.Context) {
+	roles, err := model.GetAllAdminRoles()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    roles,
+	})
+}
+
+// bindAdminRole 读取并校验角色参数，校验失败时已写入响应
+func bindAdminRole(c *gin.Context) (*model.AdminRole, bool) {
+	var role model.AdminRole
+	if err := c.ShouldBindJSON(&role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return nil, false
+	}
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" || len(role.Name) > 64 || len(role.Description) > 255 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "角色名称不能为空且长度不能超过 64，描述长度不能超过 255",
+		})
+		return nil, false
+	}
+	permissions, err := model.NormalizePermissions(role.Permissions)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	role.Permissions = permissions
+	return &role, true
+}
+
+// CreateAdminRole 超级管理员创建自定义角色
+func CreateAdminRole(c *gin.Context) {
+	role, ok := bindAdminRole(c)
+	if !ok {
+		return
+	}
+	role.Id = 0
+	if err := role.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAuditLog(c, "admin_role.create", model.AuditTargetAdminRole, role.Id, nil, role)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    role,
+	})
+}
+
+func UpdateAdminRole(c *gin.Context) {
+	role, ok := bindAdminRole(c)
+	if !ok {
+		return
+	}
+	origin, err := model.GetAdminRoleById(role.Id)
+	if err == nil {
+		err = role.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	role.CreatedTime = origin.CreatedTime
+	model.RecordAuditLog(c, "admin_role.update", model.AuditTargetAdminRole, role.Id, origin, role)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    role,
+	})
+}
+
+func DeleteAdminRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	origin, err := model.GetAdminRoleById(id)
+	if err == nil {
+		err = model.DeleteAdminRoleById(id)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAuditLog(c, "admin_role.delete", model.AuditTargetAdminRole, id, origin, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+type UpdateUserAdminRoleRequest struct {
+	// AdminRoleId 为 0 时取消分配，管理员恢复默认权限
+	AdminRoleId int `json:"admin_role_id"`
+}
+
+// UpdateUserAdminRole 超级管理员为管理员分配自定义角色
+func UpdateUserAdminRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req UpdateUserAdminRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.AdminRoleId < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	originUser, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if originUser.Role >= common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "超级管理员拥有全部权限，无需分配角色",
+		})
+		return
+	}
+	if err := model.UpdateUserAdminRole(id, req.AdminRoleId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAuditLog(c, "user.admin_role", model.AuditTargetUser, id,
+		map[string]int{"admin_role_id": originUser.AdminRoleId}, map[string]int{"admin_role_id": req.AdminRoleId})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"one-api/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RetrieveAsyncRequest GET /v1/async/:id
+func RetrieveAsyncRequest(c *gin.Context) {
+	requestId := c.Param("id")
+	request, err := model.GetAsyncRequestById(requestId, c.GetInt("id"), c.GetInt("token_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "async_request_not_found", fmt.Sprintf("No such async request: %s", requestId))
+		} else {
+			common.LogError(c, "get async request failed: "+err.Error())
+			openAIErrorResponse(c, http.StatusInternalServerError, "get_async_request_failed", "get async request failed")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, service.AsyncRequest2Response(c.Request.Context(), request))
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// batchEndpoints 批处理支持的接口，每一行请求都按该接口经过正常的转发流程
+var batchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+}
+
+// batchCompletionWindows 批处理支持的完成时间窗口
+var batchCompletionWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+}
+
+// getRequestBatch 查询当前令牌的批处理任务，不存在时直接写出 404
+func getRequestBatch(c *gin.Context) *model.Batch {
+	batchId := c.Param("id")
+	batch, err := model.GetBatchById(batchId, c.GetInt("id"), c.GetInt("token_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", batchId))
+		} else {
+			common.LogError(c, "get batch failed: "+err.Error())
+			openAIErrorResponse(c, http.StatusInternalServerError, "get_batch_failed", "get batch failed")
+		}
+		return nil
+	}
+	return batch
+}
+
+// CreateBatch POST /v1/batches
+func CreateBatch(c *gin.Context) {
+	var request dto.CreateBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	if !batchEndpoints[request.Endpoint] {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("Unsupported endpoint: %s", request.Endpoint))
+		return
+	}
+	window, ok := batchCompletionWindows[request.CompletionWindow]
+	if !ok {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_completion_window", fmt.Sprintf("Unsupported completion_window: %s", request.CompletionWindow))
+		return
+	}
+	if len(request.Metadata) > 16 {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_metadata", "metadata can have at most 16 keys")
+		return
+	}
+	file, err := model.GetFileById(request.InputFileId, c.GetInt("id"), c.GetInt("token_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIErrorResponse(c, http.StatusBadRequest, "invalid_input_file", fmt.Sprintf("No such File object: %s", request.InputFileId))
+		} else {
+			common.LogError(c, "get file failed: "+err.Error())
+			openAIErrorResponse(c, http.StatusInternalServerError, "get_file_failed", "get file failed")
+		}
+		return
+	}
+	if file.Purpose != "batch" {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_input_file", fmt.Sprintf("File %s must be uploaded with purpose 'batch'", file.Id))
+		return
+	}
+	batch, err := service.CreateBatch(c.GetInt("id"), c.GetInt("token_id"), c.ClientIP(), &request, window)
+	if err != nil {
+		common.LogError(c, "create batch failed: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "create_batch_failed", "create batch failed")
+		return
+	}
+	c.JSON(http.StatusOK, service.Batch2OpenAIBatch(batch))
+}
+
+// ListBatches GET /v1/batches
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	// 多查一条用于判断是否还有下一页
+	batches, err := model.GetBatches(c.GetInt("id"), c.GetInt("token_id"), c.Query("after"), limit+1)
+	if err != nil {
+		common.LogError(c, "list batches failed: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "list_batches_failed", "list batches failed")
+		return
+	}
+	response := dto.OpenAIBatchList{
+		Object: "list",
+		Data:   make([]*dto.OpenAIBatch, 0, len(batches)),
+	}
+	if len(batches) > limit {
+		response.HasMore = true
+		batches = batches[:limit]
+	}
+	for _, batch := range batches {
+		response.Data = append(response.Data, service.Batch2OpenAIBatch(batch))
+	}
+	if len(batches) > 0 {
+		response.FirstId = batches[0].Id
+		response.LastId = batches[len(batches)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RetrieveBatch GET /v1/batches/:id
+func RetrieveBatch(c *gin.Context) {
+	batch := getRequestBatch(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, service.Batch2OpenAIBatch(batch))
+}
+
+// CancelBatch POST /v1/batches/:id/cancel
+func CancelBatch(c *gin.Context) {
+	batch := getRequestBatch(c)
+	if batch == nil {
+		return
+	}
+	if batch.Status != model.BatchStatusCancelling {
+		cancelled, err := model.CancelBatch(batch.Id, time.Now().Unix())
+		if err != nil {
+			common.LogError(c, "cancel batch failed: "+err.Error())
+			openAIErrorResponse(c, http.StatusInternalServerError, "cancel_batch_failed", "cancel batch failed")
+			return
+		}
+		if !cancelled {
+			openAIErrorResponse(c, http.StatusConflict, "invalid_batch_status", fmt.Sprintf("Cannot cancel a batch with status '%s'.", batch.Status))
+			return
+		}
+		service.WakeupBatchRunner()
+	}
+	batch = getRequestBatch(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, service.Batch2OpenAIBatch(batch))
+}
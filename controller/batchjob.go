@@ -22,11 +22,11 @@ import (
 // Presign 生成预签名URL
 func Presign(c *gin.Context) {
 	// 获取 token 信息
-	tokenKey := c.GetString("token_key")
+	tokenKeyPrefix := c.GetString("token_key_prefix")
 	tokenID := c.GetInt("token_id")
 	userID := c.GetInt("id")
 
-	if tokenKey == "" || tokenID == 0 {
+	if tokenKeyPrefix == "" || tokenID == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Token information not found",
@@ -69,7 +69,7 @@ func Presign(c *gin.Context) {
 	presign := batchjob.PresignRequest{}
 	err = json.Unmarshal([]byte(channel.Key), &presign)
 	if err != nil {
-		common.LogError(c, err.Error()+" channel.Key: "+channel.Key)
+		common.LogError(c, err.Error()+fmt.Sprintf(" channel: #%d", channel.Id))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": err.Error(),
@@ -96,7 +96,7 @@ func Presign(c *gin.Context) {
 		// 获取当前时间，格式为 YYYYMMDD
 		now := time.Now()
 		dateStr := now.Format("20060102")
-		userLocation := fmt.Sprintf("%d_%d_%s", userID, tokenID, tokenKey[:8])
+		userLocation := fmt.Sprintf("%d_%d_%s", userID, tokenID, tokenKeyPrefix)
 
 		// 生成完整的 objectKey
 		fullObjectKey := fmt.Sprintf("%s/%s/%s", dateStr, userLocation, objectKey)
@@ -170,7 +170,7 @@ func RegisterJob(c *gin.Context) {
 	job := &model.BatchJob{}
 	err = json.Unmarshal([]byte(channel.Key), job)
 	if err != nil {
-		common.LogError(c, err.Error()+" channel.Key: "+channel.Key)
+		common.LogError(c, err.Error()+fmt.Sprintf(" channel: #%d", channel.Id))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": err.Error(),
@@ -195,8 +195,8 @@ func RegisterJob(c *gin.Context) {
 	// 让 GORM 自动处理 CreatedAt 和 UpdatedAt
 	now := time.Now()
 	dateStr := now.Format("20060102")
-	tokenKey := c.GetString("token_key")
-	userLocation := fmt.Sprintf("%d_%d_%s", userID, tokenID, tokenKey[:8])
+	tokenKeyPrefix := c.GetString("token_key_prefix")
+	userLocation := fmt.Sprintf("%d_%d_%s", userID, tokenID, tokenKeyPrefix)
 
 	// 生成完整的 objectKey
 	job.InputPath = fmt.Sprintf("%s/%s", dateStr, userLocation)
@@ -220,7 +220,7 @@ func RegisterJob(c *gin.Context) {
 	presign := batchjob.PresignRequest{}
 	err = json.Unmarshal([]byte(channel.Key), &presign)
 	if err != nil {
-		common.LogError(c, err.Error()+" channel.Key: "+channel.Key)
+		common.LogError(c, err.Error()+fmt.Sprintf(" channel: #%d", channel.Id))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": err.Error(),
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AddChannelKeysRequest struct {
+	// Keys 多个密钥以换行分隔
+	Keys string `json:"keys"`
+}
+
+type UpdateChannelKeyRequest struct {
+	Status int `json:"status"`
+}
+
+func channelKeyError(c *gin.Context, err error) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
+func maskChannelKey(key string) string {
+	if len(key) <= 12 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:6] + "..." + key[len(key)-4:]
+}
+
+func GetChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	keys, err := model.GetChannelKeys(id)
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	for _, key := range keys {
+		key.Key = maskChannelKey(key.Key)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    keys,
+	})
+}
+
+func AddChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	var req AddChannelKeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	added, err := model.AddChannelKeys(channel, strings.Split(req.Keys, "\n"))
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    added,
+	})
+}
+
+func UpdateChannelKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	keyId, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	var req UpdateChannelKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	if req.Status != common.ChannelStatusEnabled && req.Status != common.ChannelStatusManuallyDisabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的状态",
+		})
+		return
+	}
+	if _, err := model.UpdateChannelKeyStatus(id, keyId, req.Status, "手动禁用"); err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func DeleteChannelKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	keyId, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	if err := model.DeleteChannelKey(id, keyId); err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
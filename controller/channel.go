@@ -380,6 +380,9 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	for i := range channels {
+		model.RecordAuditLog(c, "channel.create", model.AuditTargetChannel, channels[i].Id, nil, &channels[i])
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -389,6 +392,7 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetChannelById(id, true)
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
@@ -398,6 +402,7 @@ func DeleteChannel(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "channel.delete", model.AuditTargetChannel, id, origin, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -414,6 +419,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "channel.delete_disabled", model.AuditTargetChannel, "disabled", nil, map[string]any{"deleted": rows})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -450,6 +456,7 @@ func DisableTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "tag.disable", model.AuditTargetTag, channelTag.Tag, nil, map[string]any{"status": common.ChannelStatusManuallyDisabled})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -475,6 +482,7 @@ func EnableTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "tag.enable", model.AuditTargetTag, channelTag.Tag, nil, map[string]any{"status": common.ChannelStatusEnabled})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -507,6 +515,8 @@ func EditTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	// 标签批量编辑只记录本次提交的字段，未提交的字段为 null 不会出现在差异中
+	model.RecordAuditLog(c, "tag.update", model.AuditTargetTag, channelTag.Tag, nil, channelTag)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -537,6 +547,7 @@ func DeleteChannelBatch(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "channel.batch_delete", model.AuditTargetChannel, "batch", map[string]any{"ids": channelBatch.Ids}, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -576,6 +587,7 @@ func UpdateChannel(c *gin.Context) {
 			}
 		}
 	}
+	origin, _ := model.GetChannelById(channel.Id, true)
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -584,6 +596,9 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if updated, err := model.GetChannelById(channel.Id, true); err == nil {
+		model.RecordAuditLog(c, "channel.update", model.AuditTargetChannel, channel.Id, origin, updated)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -691,6 +706,7 @@ func BatchSetChannelTag(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "channel.batch_set_tag", model.AuditTargetChannel, "batch", nil, channelBatch)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -698,3 +714,28 @@ func BatchSetChannelTag(c *gin.Context) {
 	})
 	return
 }
+
+// GetChannelStats 返回当前节点各渠道的实时延迟、首字时间、错误率和 adaptive 策略下的得分
+func GetChannelStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetChannelStatsItems(),
+	})
+}
+
+func GetChannelBreakers(c *gin.Context) {
+	items, err := model.GetChannelBreakerItems()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    items,
+	})
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"one-api/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+type CreateClientTokenRequest struct {
+	// Models 可访问的模型，必须是父令牌可访问的模型，为空时与父令牌相同
+	Models []string `json:"models"`
+	// Quota 有效期内可使用的额度上限，0 表示只受父令牌额度限制
+	Quota int `json:"quota"`
+	// ExpiresIn 有效期（秒），不能超过父令牌的过期时间
+	ExpiresIn int64  `json:"expires_in"`
+	EndUserId string `json:"end_user"`
+}
+
+type ClientTokenResponse struct {
+	Object    string   `json:"object"`
+	Token     string   `json:"token"`
+	TokenType string   `json:"token_type"`
+	ExpiresAt int64    `json:"expires_at"`
+	Models    []string `json:"models,omitempty"`
+	Quota     int      `json:"quota,omitempty"`
+	EndUserId string   `json:"end_user,omitempty"`
+}
+
+// CreateClientToken 用普通令牌换取短期客户端令牌，供浏览器和移动端直接调用，不需要暴露 sk- 令牌
+func CreateClientToken(c *gin.Context) {
+	if c.GetString(constant.ContextKeyClientTokenId) != "" {
+		openAIErrorResponse(c, http.StatusForbidden, "client_token_not_allowed", "短期令牌不能签发新的短期令牌")
+		return
+	}
+	if !service.ClientTokenEnabled() {
+		openAIErrorResponse(c, http.StatusNotImplemented, "client_token_disabled", service.ErrClientTokenDisabled.Error())
+		return
+	}
+	var req CreateClientTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request", "无效的参数")
+		return
+	}
+	token, err := model.GetTokenById(c.GetInt("token_id"))
+	if err != nil {
+		openAIErrorResponse(c, http.StatusUnauthorized, "invalid_token", "无效的令牌")
+		return
+	}
+	if token.ModelLimitsEnabled {
+		parentLimits := token.GetModelLimitsMap()
+		for _, modelName := range req.Models {
+			if !parentLimits[modelName] {
+				openAIErrorResponse(c, http.StatusBadRequest, "invalid_models", fmt.Sprintf("该令牌无权访问模型 %s", modelName))
+				return
+			}
+		}
+	}
+	if req.Quota < 0 || (!token.UnlimitedQuota && req.Quota > token.RemainQuota) {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_quota", "额度上限不能为负数，也不能超过令牌的剩余额度")
+		return
+	}
+	if req.ExpiresIn == 0 {
+		req.ExpiresIn = int64(constant.ClientTokenDefaultTTL)
+	}
+	if req.ExpiresIn < 0 || req.ExpiresIn > int64(constant.ClientTokenMaxTTL) {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_expires_in", fmt.Sprintf("有效期必须在 1 到 %d 秒之间", constant.ClientTokenMaxTTL))
+		return
+	}
+	if len(req.EndUserId) > 64 {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_end_user", "终端用户 id 过长")
+		return
+	}
+	now := time.Now().Unix()
+	expiresAt := now + req.ExpiresIn
+	if token.ExpiredTime != -1 && token.ExpiredTime < expiresAt {
+		expiresAt = token.ExpiredTime
+	}
+	claims := &service.ClientTokenClaims{
+		TokenId:   token.Id,
+		UserId:    token.UserId,
+		Models:    req.Models,
+		Quota:     req.Quota,
+		EndUserId: req.EndUserId,
+		StandardClaims: jwt.StandardClaims{
+			Id:        common.GetUUID(),
+			IssuedAt:  now,
+			ExpiresAt: expiresAt,
+		},
+	}
+	signed, err := service.SignClientToken(claims)
+	if err != nil {
+		common.LogError(c, "sign client token failed: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "sign_client_token_failed", "签发短期令牌失败")
+		return
+	}
+	c.JSON(http.StatusOK, ClientTokenResponse{
+		Object:    "client_token",
+		Token:     signed,
+		TokenType: "Bearer",
+		ExpiresAt: expiresAt,
+		Models:    req.Models,
+		Quota:     req.Quota,
+		EndUserId: req.EndUserId,
+	})
+}
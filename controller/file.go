@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var filePurposes = map[string]bool{
+	"assistants": true,
+	"batch":      true,
+	"fine-tune":  true,
+	"vision":     true,
+	"user_data":  true,
+	"evals":      true,
+}
+
+func openAIErrorResponse(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dto.OpenAIError{
+			Message: common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+// getRequestFile 查询当前令牌的文件，不存在时直接写出 404
+func getRequestFile(c *gin.Context) *model.File {
+	fileId := c.Param("id")
+	file, err := model.GetFileById(fileId, c.GetInt("id"), c.GetInt("token_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", fileId))
+		} else {
+			common.LogError(c, "get file failed: "+err.Error())
+			openAIErrorResponse(c, http.StatusInternalServerError, "get_file_failed", "get file failed")
+		}
+		return nil
+	}
+	return file
+}
+
+// UploadFile POST /v1/files
+func UploadFile(c *gin.Context) {
+	purpose := c.PostForm("purpose")
+	if !filePurposes[purpose] {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_purpose", fmt.Sprintf("Invalid purpose: %s", purpose))
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_file", "field file is required")
+		return
+	}
+	if fileHeader.Size > int64(constant.FileMaxUploadMB)*1024*1024 {
+		openAIErrorResponse(c, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("file size exceeds the limit of %d MB", constant.FileMaxUploadMB))
+		return
+	}
+	mimeType := fileHeader.Header.Get("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(filepath.Ext(fileHeader.Filename)); byExt != "" {
+			mimeType = byExt
+		}
+	}
+	reader, err := fileHeader.Open()
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_file", "open uploaded file failed")
+		return
+	}
+	defer reader.Close()
+
+	quotaBytes := service.FileStorageQuotaBytes(c.GetStringMap(constant.ContextKeyUserSetting))
+	file, err := service.SaveFile(c, c.GetInt("id"), c.GetInt("token_id"), filepath.Base(fileHeader.Filename), purpose, mimeType,
+		reader, fileHeader.Size, quotaBytes)
+	if err != nil {
+		if errors.Is(err, service.ErrFileStorageQuotaExceeded) {
+			openAIErrorResponse(c, http.StatusForbidden, "storage_quota_exceeded", "文件存储空间不足，请删除不需要的文件后重试")
+			return
+		}
+		common.LogError(c, "save file failed: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "save_file_failed", "save file failed")
+		return
+	}
+	c.JSON(http.StatusOK, service.File2OpenAIFile(file))
+}
+
+// ListFiles GET /v1/files
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10000"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	order := c.DefaultQuery("order", "desc")
+	// 多查一条用于判断是否还有下一页
+	files, err := model.GetFiles(c.GetInt("id"), c.GetInt("token_id"), c.Query("purpose"), c.Query("after"), order, limit+1)
+	if err != nil {
+		common.LogError(c, "list files failed: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "list_files_failed", "list files failed")
+		return
+	}
+	response := dto.OpenAIFileList{
+		Object: "list",
+		Data:   make([]*dto.OpenAIFile, 0, len(files)),
+	}
+	if len(files) > limit {
+		response.HasMore = true
+		files = files[:limit]
+	}
+	for _, file := range files {
+		response.Data = append(response.Data, service.File2OpenAIFile(file))
+	}
+	if len(files) > 0 {
+		response.FirstId = files[0].Id
+		response.LastId = files[len(files)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RetrieveFile GET /v1/files/:id
+func RetrieveFile(c *gin.Context) {
+	file := getRequestFile(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, service.File2OpenAIFile(file))
+}
+
+// DeleteFile DELETE /v1/files/:id
+func DeleteFile(c *gin.Context) {
+	file := getRequestFile(c)
+	if file == nil {
+		return
+	}
+	if err := service.DeleteFile(c, file); err != nil {
+		common.LogError(c, "delete file failed: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "delete_file_failed", "delete file failed")
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleteResponse{
+		Id:      file.Id,
+		Object:  "file",
+		Deleted: true,
+	})
+}
+
+// RetrieveFileContent GET /v1/files/:id/content
+func RetrieveFileContent(c *gin.Context) {
+	file := getRequestFile(c)
+	if file == nil {
+		return
+	}
+	reader, err := service.OpenFile(c, file)
+	if err != nil {
+		if errors.Is(err, service.ErrFileNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("content of file %s not found", file.Id))
+			return
+		}
+		common.LogError(c, "open file failed: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "open_file_failed", "open file failed")
+		return
+	}
+	defer reader.Close()
+	contentType := file.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(http.StatusOK, file.Bytes, contentType, reader, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}),
+	})
+}
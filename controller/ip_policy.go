@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IpPolicyRequest struct {
+	AllowIps string `json:"allow_ips"`
+	DenyIps  string `json:"deny_ips"`
+}
+
+func bindIpPolicy(c *gin.Context) (*IpPolicyRequest, bool) {
+	var req IpPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return nil, false
+	}
+	err := common.ValidateIPList(req.AllowIps)
+	if err == nil {
+		err = common.ValidateIPList(req.DenyIps)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	return &req, true
+}
+
+// UpdateSelfIpPolicy 修改当前用户对所有令牌生效的 IP 策略，与管理员设置的策略同时生效，不能放宽管理员的限制
+func UpdateSelfIpPolicy(c *gin.Context) {
+	req, ok := bindIpPolicy(c)
+	if !ok {
+		return
+	}
+	if err := model.UpdateUserSelfIpPolicy(c.GetInt("id"), req.AllowIps, req.DenyIps); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// UpdateUserIpPolicy 管理员修改用户的 IP 策略
+func UpdateUserIpPolicy(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	req, ok := bindIpPolicy(c)
+	if !ok {
+		return
+	}
+	originUser, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	myRole := c.GetInt("role")
+	if myRole <= originUser.Role && myRole != common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权更新同权限等级或更高权限等级的用户信息",
+		})
+		return
+	}
+	if err := model.UpdateUserIpPolicy(id, req.AllowIps, req.DenyIps); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAuditLog(c, "user.ip_policy", model.AuditTargetUser, id,
+		map[string]string{"allow_ips": originUser.AllowIps, "deny_ips": originUser.DenyIps},
+		map[string]string{"allow_ips": req.AllowIps, "deny_ips": req.DenyIps})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
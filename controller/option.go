@@ -93,7 +93,28 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "GroupChannelSelectStrategy":
+		err = setting.CheckGroupChannelSelectStrategy(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "IPDenyList":
+		err = common.ValidateIPList(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
+	common.OptionMapRWMutex.RLock()
+	oldValue := common.OptionMap[option.Key]
+	common.OptionMapRWMutex.RUnlock()
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -102,6 +123,8 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "option.update", model.AuditTargetOption, option.Key,
+		map[string]string{option.Key: oldValue}, map[string]string{option.Key: option.Value})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
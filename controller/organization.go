@@ -0,0 +1,573 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAllOrganizations 管理员分页获取所有组织
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	orgs, total, err := model.GetAllOrganizations((p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     orgs,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+type CreateOrganizationRequest struct {
+	Name    string `json:"name"`
+	OwnerId int    `json:"owner_id"`
+	Quota   int    `json:"quota"`
+}
+
+// CreateOrganization 管理员创建组织并指定所有者和初始额度池
+func CreateOrganization(c *gin.Context) {
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || req.OwnerId == 0 || req.Quota < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if _, err := model.GetUserById(req.OwnerId, false); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+	org, err := model.CreateOrganization(req.Name, req.OwnerId, req.Quota)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(req.OwnerId, model.LogTypeManage, fmt.Sprintf("管理员创建组织「%s」，额度池 %s", org.Name, common.LogQuota(org.Quota)))
+	model.RecordAuditLog(c, "organization.create", model.AuditTargetOrganization, org.Id, nil, org)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org,
+	})
+}
+
+// UpdateOrganization 管理员修改组织的名称和状态
+func UpdateOrganization(c *gin.Context) {
+	var req model.Organization
+	if err := c.ShouldBindJSON(&req); err != nil || req.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	org, err := model.GetOrganizationById(req.Id)
+	var origin model.Organization
+	if err == nil {
+		origin = *org
+		if req.Name != "" {
+			org.Name = req.Name
+		}
+		if req.Status != 0 {
+			org.Status = req.Status
+		}
+		err = org.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAuditLog(c, "organization.update", model.AuditTargetOrganization, org.Id, &origin, org)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org,
+	})
+}
+
+type AdjustOrganizationQuotaRequest struct {
+	// Quota 为正数时增加额度池，为负数时扣减
+	Quota int `json:"quota"`
+}
+
+// AdjustOrganizationQuota 管理员调整组织的额度池
+func AdjustOrganizationQuota(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req AdjustOrganizationQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Quota == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	org, err := model.GetOrganizationById(id)
+	if err == nil {
+		err = model.IncreaseOrganizationQuota(id, req.Quota)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(org.OwnerId, model.LogTypeManage, fmt.Sprintf("管理员调整组织「%s」的额度池 %s", org.Name, common.LogQuota(req.Quota)))
+	model.RecordAuditLog(c, "organization.quota", model.AuditTargetOrganization, id,
+		map[string]int{"quota": org.Quota}, map[string]int{"quota": org.Quota + req.Quota})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func DeleteOrganization(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetOrganizationById(id)
+	if err := model.DeleteOrganization(id); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAuditLog(c, "organization.delete", model.AuditTargetOrganization, id, origin, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// getSelfOrganizationMember 获取当前用户在所属组织中的成员关系，角色低于 minRole 时返回错误
+func getSelfOrganizationMember(c *gin.Context, minRole int) (*model.OrganizationMember, error) {
+	member, err := model.GetOrganizationMember(c.GetInt("id"))
+	if err != nil {
+		return nil, errors.New("您不属于任何组织")
+	}
+	if member.Role < minRole {
+		return nil, errors.New("无权进行此操作")
+	}
+	return member, nil
+}
+
+// GetSelfOrganization 获取当前用户所属的组织和自己的成员关系
+func GetSelfOrganization(c *gin.Context) {
+	member, err := getSelfOrganizationMember(c, model.OrganizationRoleMember)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrganizationId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"organization": org,
+			"member":       member,
+		},
+	})
+}
+
+// TransferQuotaToOrganization 成员将自己的额度转入组织的额度池
+func TransferQuotaToOrganization(c *gin.Context) {
+	member, err := getSelfOrganizationMember(c, model.OrganizationRoleMember)
+	var req AdjustOrganizationQuotaRequest
+	if err == nil {
+		if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+			err = errors.New("无效的参数")
+		}
+	}
+	if err == nil {
+		err = model.TransferQuotaToOrganization(member.UserId, member.OrganizationId, req.Quota)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(member.UserId, model.LogTypeManage, fmt.Sprintf("将 %s 额度转入组织额度池", common.LogQuota(req.Quota)))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetOrganizationMembers 组织管理员获取所有成员及其子预算和已消耗的额度
+func GetOrganizationMembers(c *gin.Context) {
+	member, err := getSelfOrganizationMember(c, model.OrganizationRoleAdmin)
+	var members []*model.OrganizationMember
+	if err == nil {
+		members, err = model.GetOrganizationMembers(member.OrganizationId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    members,
+	})
+}
+
+type OrganizationMemberRequest struct {
+	Id         int    `json:"id"`
+	Username   string `json:"username"`
+	Role       int    `json:"role"`
+	QuotaLimit int    `json:"quota_limit"`
+	// ResetUsedQuota 修改成员时清零已消耗的额度，子预算重新开始计算
+	ResetUsedQuota bool `json:"reset_used_quota"`
+}
+
+// checkOrganizationRole 只有所有者可以设置管理员，所有者不能通过成员接口指定
+func checkOrganizationRole(operator *model.OrganizationMember, role int) error {
+	switch role {
+	case model.OrganizationRoleMember:
+		return nil
+	case model.OrganizationRoleAdmin:
+		if operator.Role != model.OrganizationRoleOwner {
+			return errors.New("只有组织所有者可以设置管理员")
+		}
+		return nil
+	default:
+		return errors.New("无效的角色")
+	}
+}
+
+// InviteOrganizationMember 组织管理员按用户名邀请用户，用户接受邀请后才成为成员
+func InviteOrganizationMember(c *gin.Context) {
+	operator, err := getSelfOrganizationMember(c, model.OrganizationRoleAdmin)
+	var req OrganizationMemberRequest
+	if err == nil {
+		if bindErr := c.ShouldBindJSON(&req); bindErr != nil || req.QuotaLimit < 0 {
+			err = errors.New("无效的参数")
+		}
+	}
+	if err == nil && req.Role == 0 {
+		req.Role = model.OrganizationRoleMember
+	}
+	if err == nil {
+		err = checkOrganizationRole(operator, req.Role)
+	}
+	var userId int
+	if err == nil {
+		userId, err = model.GetUserIdByUsername(req.Username)
+		if err != nil {
+			err = errors.New("用户不存在")
+		}
+	}
+	var invitation *model.OrganizationInvitation
+	if err == nil {
+		invitation, err = model.CreateOrganizationInvitation(operator.OrganizationId, operator.UserId, userId, req.Role, req.QuotaLimit)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    invitation,
+	})
+}
+
+// GetOrganizationInvitations 组织管理员获取待用户接受的邀请
+func GetOrganizationInvitations(c *gin.Context) {
+	operator, err := getSelfOrganizationMember(c, model.OrganizationRoleAdmin)
+	var invitations []*model.OrganizationInvitation
+	if err == nil {
+		invitations, err = model.GetOrganizationInvitations(operator.OrganizationId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    invitations,
+	})
+}
+
+// CancelOrganizationInvitation 组织管理员撤回邀请
+func CancelOrganizationInvitation(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	operator, err := getSelfOrganizationMember(c, model.OrganizationRoleAdmin)
+	if err == nil {
+		err = model.DeleteOrganizationInvitation(id, operator.OrganizationId, 0)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetSelfOrganizationInvitations 获取当前用户收到的组织邀请
+func GetSelfOrganizationInvitations(c *gin.Context) {
+	invitations, err := model.GetUserOrganizationInvitations(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    invitations,
+	})
+}
+
+// AcceptOrganizationInvitation 当前用户接受邀请加入组织，之后的请求从组织的额度池扣费
+func AcceptOrganizationInvitation(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	member, err := model.AcceptOrganizationInvitation(id, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if org, err := model.GetOrganizationById(member.OrganizationId); err == nil {
+		model.RecordLog(member.UserId, model.LogTypeManage, fmt.Sprintf("接受邀请加入组织「%s」", org.Name))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+}
+
+// DeclineOrganizationInvitation 当前用户拒绝邀请
+func DeclineOrganizationInvitation(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteOrganizationInvitation(id, 0, c.GetInt("id")); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// getManagedOrganizationMember 获取操作者可以管理的成员：不能管理所有者和自己，管理员只能管理普通成员，
+// 管理员的角色和子预算只能由所有者修改
+func getManagedOrganizationMember(operator *model.OrganizationMember, id int) (*model.OrganizationMember, error) {
+	var member *model.OrganizationMember
+	members, err := model.GetOrganizationMembers(operator.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if m.Id == id {
+			member = m
+		}
+	}
+	if member == nil {
+		return nil, errors.New("成员不存在")
+	}
+	if member.Role == model.OrganizationRoleOwner {
+		return nil, errors.New("不能修改组织所有者")
+	}
+	if member.Id == operator.Id {
+		return nil, errors.New("不能修改自己的角色和子预算")
+	}
+	if member.Role >= operator.Role {
+		return nil, errors.New("无权管理同等级或更高等级的成员")
+	}
+	return member, nil
+}
+
+// UpdateOrganizationMember 组织管理员修改成员的角色和子预算
+func UpdateOrganizationMember(c *gin.Context) {
+	operator, err := getSelfOrganizationMember(c, model.OrganizationRoleAdmin)
+	var req OrganizationMemberRequest
+	if err == nil {
+		if bindErr := c.ShouldBindJSON(&req); bindErr != nil || req.QuotaLimit < 0 {
+			err = errors.New("无效的参数")
+		}
+	}
+	var member *model.OrganizationMember
+	if err == nil {
+		member, err = getManagedOrganizationMember(operator, req.Id)
+	}
+	if err == nil && req.Role != 0 && req.Role != member.Role {
+		err = checkOrganizationRole(operator, req.Role)
+		member.Role = req.Role
+	}
+	if err == nil {
+		member.QuotaLimit = req.QuotaLimit
+		err = member.UpdateRoleAndQuotaLimit()
+	}
+	if err == nil && req.ResetUsedQuota {
+		err = member.ResetUsedQuota()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+}
+
+// RemoveOrganizationMember 组织管理员移除成员，成员之后使用自己的额度
+func RemoveOrganizationMember(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	operator, err := getSelfOrganizationMember(c, model.OrganizationRoleAdmin)
+	var member *model.OrganizationMember
+	if err == nil {
+		member, err = getManagedOrganizationMember(operator, id)
+	}
+	if err == nil {
+		err = member.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetOrganizationLogs 组织管理员查询所有成员加入组织之后的日志
+func GetOrganizationLogs(c *gin.Context) {
+	member, err := getSelfOrganizationMember(c, model.OrganizationRoleAdmin)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	logs, total, err := model.GetOrganizationLogs(member.OrganizationId, logType, startTimestamp, endTimestamp,
+		c.Query("model_name"), c.Query("username"), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     logs,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetOrganizationQuotaData 组织管理员查询所有成员加入组织之后的统计数据
+func GetOrganizationQuotaData(c *gin.Context) {
+	member, err := getSelfOrganizationMember(c, model.OrganizationRoleAdmin)
+	var quotaData []*model.QuotaData
+	if err == nil {
+		startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+		endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+		quotaData, err = model.GetOrganizationQuotaData(member.OrganizationId, startTimestamp, endTimestamp)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    quotaData,
+	})
+}
@@ -9,7 +9,6 @@ import (
 	"one-api/constant"
 	"one-api/dto"
 	"one-api/middleware"
-	"one-api/model"
 	"one-api/service"
 	"one-api/setting"
 	"time"
@@ -57,7 +56,8 @@ func Playground(c *gin.Context) {
 		c.Set("group", group)
 	}
 	c.Set("token_name", "playground-"+group)
-	channel, err := model.CacheGetRandomSatisfiedChannel(group, playgroundRequest.Model, 0)
+	channel, err := middleware.SelectChannel(c, group, playgroundRequest.Model, 0)
+	defer middleware.ReleaseChannelSlot(c)
 	if err != nil {
 		groupId := setting.GetGroupId(group)
 		message := fmt.Sprintf("当前分组id %d 下对于模型 %s 无可用渠道", groupId, playgroundRequest.Model)
@@ -147,6 +147,9 @@ func AddRedemption(c *gin.Context) {
 		}
 		keys = append(keys, key)
 	}
+	// 兑换码本身不写入审计日志，只记录批次信息
+	model.RecordAuditLog(c, "redemption.create", model.AuditTargetRedemption, redemption.Name, nil,
+		map[string]any{"name": redemption.Name, "count": len(keys), "quota": redemption.Quota})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -157,6 +160,7 @@ func AddRedemption(c *gin.Context) {
 
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetRedemptionById(id)
 	err := model.DeleteRedemptionById(id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -165,6 +169,7 @@ func DeleteRedemption(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "redemption.delete", model.AuditTargetRedemption, id, origin, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -191,6 +196,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	origin := *cleanRedemption
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
 	} else {
@@ -206,6 +212,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "redemption.update", model.AuditTargetRedemption, cleanRedemption.Id, &origin, cleanRedemption)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -62,6 +62,18 @@ func relayInfoHandler(c *gin.Context, relayMode int) (*relaycommon.RelayInfo, in
 			return nil, nil, "", err
 		}
 		return relayInfo, request, model, nil
+	case relayconstant.RelayModeResponses:
+		relayInfo, request, err := relay.ResponsesInfo(c)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return relayInfo, request, request.Model, nil
+	case relayconstant.RelayModeGemini:
+		relayInfo, request, err := relay.GeminiInfo(c)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return relayInfo, request, relayInfo.OriginModelName, nil
 	default:
 		relayInfo, request, err := relay.TextInfo(c)
 		if err != nil {
@@ -104,6 +116,18 @@ func relayExecuteHandler(c *gin.Context, relayMode int, relayInfo *relaycommon.R
 		err = relay.EmbeddingHelper(c, relayInfo, embeddingRequest)
 	case relayconstant.RelayModeProxy:
 		err = relay.ProxyHelper(c, relayInfo, request)
+	case relayconstant.RelayModeResponses:
+		responsesRequest, ok := request.(*dto.OpenAIResponsesRequest)
+		if !ok {
+			return service.OpenAIErrorWrapperLocal(fmt.Errorf("failed assert request: %d", relayMode), "invalid_request_type", http.StatusInternalServerError)
+		}
+		err = relay.ResponsesHelper(c, relayInfo, responsesRequest)
+	case relayconstant.RelayModeGemini:
+		geminiRequest, ok := request.(*relay.GeminiRelayRequest)
+		if !ok {
+			return service.OpenAIErrorWrapperLocal(fmt.Errorf("failed assert request: %d", relayMode), "invalid_request_type", http.StatusInternalServerError)
+		}
+		err = relay.GeminiHelper(c, relayInfo, geminiRequest)
 	default:
 		textRequest, ok := request.(*dto.GeneralOpenAIRequest)
 		if !ok {
@@ -120,7 +144,7 @@ func Relay(c *gin.Context) {
 	requestId := c.GetString(common.RequestIdKey)
 	group := c.GetString("group")
 	originalModel := c.GetString("original_model")
-	tokenKey := c.GetString("token_key")
+	tokenKeyPrefix := c.GetString("token_key_prefix")
 	tokenName := c.GetString("token_name")
 	userId := strconv.Itoa(c.GetInt("id"))
 	userName := c.GetString(constant.ContextKeyUserName)
@@ -146,11 +170,12 @@ func Relay(c *gin.Context) {
 			if strings.Contains(openaiErr.Error.Message, "write: connection timed out") && openaiErr.Error.Code == "copy_response_body_failed" {
 				code = "499"
 			}
-			common.LogInfo(c, fmt.Sprintf("id %s channel: %d,name %s, requestModel: %s, group: %s, tokenKey: %s, tokenName: %s, userId: %s, userName: %s", requestId, channel.Id, channel.Name, requestModel, group, tokenKey, tokenName, userId, userName))
-			metrics.IncrementRelayRequestE2EFailedCounter(strconv.Itoa(channel.Id), channel.Name, requestModel, group, code, tokenKey, tokenName, userId, userName, openaiErr.Error.Message, 1)
+			common.LogInfo(c, fmt.Sprintf("id %s channel: %d,name %s, requestModel: %s, group: %s, tokenKeyPrefix: %s, tokenName: %s, userId: %s, userName: %s", requestId, channel.Id, channel.Name, requestModel, group, tokenKeyPrefix, tokenName, userId, userName))
+			metrics.IncrementRelayRequestE2EFailedCounter(strconv.Itoa(channel.Id), channel.Name, requestModel, group, code, tokenKeyPrefix, tokenName, userId, userName, openaiErr.Error.Message, 1)
 		}
 		// 统计所有请求的耗时（成功和失败）
-		metrics.ObserveRelayRequestE2EDuration(strconv.Itoa(channel.Id), channel.Name, requestModel, group, tokenKey, tokenName, userId, userName, code, time.Since(startTime).Seconds())
+		metrics.ObserveRelayRequestE2EDuration(strconv.Itoa(channel.Id), channel.Name, requestModel, group, tokenKeyPrefix, tokenName, userId, userName, code, time.Since(startTime).Seconds())
+		service.RecordRateLimitStat(userName, group, c.GetString("original_model"), model.RateLimitStatRequests)
 	}()
 
 	for i := 0; i <= common.RetryTimes; i++ {
@@ -194,7 +219,7 @@ func Relay(c *gin.Context) {
 		relayInfo, request, requestModel, openaiErr = relayInfoHandler(c, relayMode)
 		if i == 0 {
 			// e2e 用户请求计数
-			metrics.IncrementRelayRequestE2ETotalCounter(strconv.Itoa(channel.Id), channel.Name, requestModel, group, tokenKey, tokenName, userId, userName, 1)
+			metrics.IncrementRelayRequestE2ETotalCounter(strconv.Itoa(channel.Id), channel.Name, requestModel, group, tokenKeyPrefix, tokenName, userId, userName, 1)
 		} else {
 			// 重试计数
 			channelTag := ""
@@ -204,11 +229,17 @@ func Relay(c *gin.Context) {
 			metrics.IncrementRelayRetryCounter(strconv.Itoa(channel.Id), channel.Name, channelTag, channel.GetBaseURL(), requestModel, group, userId, userName, 1)
 		}
 		if openaiErr == nil {
+			attemptStart := time.Now()
 			openaiErr = executeRelayRequest(c, relayMode, relayInfo, request)
+			recordChannelResult(channel.Id, originalModel, relayInfo, attemptStart, openaiErr)
+			if openaiErr != nil && openaiErr.StatusCode == http.StatusTooManyRequests && !openaiErr.LocalError {
+				service.RecordRateLimitStat(userName, group, c.GetString("original_model"), model.RateLimitStatThrottled)
+			}
+			recordChannelKeyResult(c.GetInt("channel_key_id"), openaiErr)
 			common.LogInfo(c, fmt.Sprintf("openaiErr: %+v", openaiErr))
 			if openaiErr == nil {
-				common.LogInfo(c, fmt.Sprintf("channel: %d,name %s, requestModel: %s, group: %s, tokenKey: %s, tokenName: %s, userId: %s, userName: %s", channel.Id, channel.Name, requestModel, group, tokenKey, tokenName, userId, userName))
-				metrics.IncrementRelayRequestE2ESuccessCounter(strconv.Itoa(channel.Id), channel.Name, requestModel, group, tokenKey, tokenName, userId, userName, 1)
+				common.LogInfo(c, fmt.Sprintf("channel: %d,name %s, requestModel: %s, group: %s, tokenKeyPrefix: %s, tokenName: %s, userId: %s, userName: %s", channel.Id, channel.Name, requestModel, group, tokenKeyPrefix, tokenName, userId, userName))
+				metrics.IncrementRelayRequestE2ESuccessCounter(strconv.Itoa(channel.Id), channel.Name, requestModel, group, tokenKeyPrefix, tokenName, userId, userName, 1)
 				return
 			}
 			if strings.Contains(openaiErr.Error.Message, "No candidates returned") && originalModel == "gemini-2.5-pro" {
@@ -216,7 +247,7 @@ func Relay(c *gin.Context) {
 			}
 		}
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+		go processChannelError(c, channel.Id, c.GetInt("channel_key_id"), channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
 
 		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
 
@@ -262,6 +293,24 @@ func Relay(c *gin.Context) {
 		}
 
 		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
+		relayErrorResponse(c, openaiErr)
+	}
+}
+
+// relayErrorResponse 按客户端使用的接口协议返回对应格式的错误
+func relayErrorResponse(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	switch relaycommon.GetRelayFormat(c.Request.URL.Path) {
+	case relaycommon.RelayFormatClaude:
+		claudeErr := service.OpenAIErrorToClaudeError(openaiErr)
+		c.JSON(claudeErr.StatusCode, gin.H{
+			"type":  "error",
+			"error": claudeErr.Error,
+		})
+	case relaycommon.RelayFormatGemini:
+		c.JSON(openaiErr.StatusCode, gin.H{
+			"error": service.OpenAIErrorToGeminiError(openaiErr),
+		})
+	default:
 		c.JSON(openaiErr.StatusCode, gin.H{
 			"error": openaiErr.Error,
 		})
@@ -293,7 +342,7 @@ func WssRelay(c *gin.Context) {
 	group := c.GetString("group")
 	//wss://api.openai.com/v1/realtime?model=gpt-4o-realtime-preview-2024-10-01
 	originalModel := c.GetString("original_model")
-	tokenKey := c.GetString("token_key")
+	tokenKeyPrefix := c.GetString("token_key_prefix")
 	tokenName := c.GetString("token_name")
 	userId := c.GetString("user_id")
 	userName := c.GetString("user_name")
@@ -318,7 +367,7 @@ func WssRelay(c *gin.Context) {
 			}
 		}
 		// 统计所有请求的耗时（成功和失败）
-		metrics.ObserveRelayRequestE2EDuration(strconv.Itoa(channel.Id), channel.Name, originalModel, group, tokenKey, tokenName, userId, userName, code, time.Since(startTime).Seconds())
+		metrics.ObserveRelayRequestE2EDuration(strconv.Itoa(channel.Id), channel.Name, originalModel, group, tokenKeyPrefix, tokenName, userId, userName, code, time.Since(startTime).Seconds())
 	}()
 
 	for i := 0; i <= common.RetryTimes; i++ {
@@ -331,17 +380,18 @@ func WssRelay(c *gin.Context) {
 
 		if i == 0 {
 			// e2e 用户请求计数
-			metrics.IncrementRelayRequestE2ETotalCounter(strconv.Itoa(channel.Id), channel.Name, originalModel, group, tokenKey, tokenName, userId, userName, 1)
+			metrics.IncrementRelayRequestE2ETotalCounter(strconv.Itoa(channel.Id), channel.Name, originalModel, group, tokenKeyPrefix, tokenName, userId, userName, 1)
 		}
 
 		openaiErr = wssRequest(c, ws, relayMode, channel)
+		recordChannelKeyResult(c.GetInt("channel_key_id"), openaiErr)
 
 		if openaiErr == nil {
-			metrics.IncrementRelayRequestE2ESuccessCounter(strconv.Itoa(channel.Id), channel.Name, originalModel, group, tokenKey, tokenName, userId, userName, 1)
+			metrics.IncrementRelayRequestE2ESuccessCounter(strconv.Itoa(channel.Id), channel.Name, originalModel, group, tokenKeyPrefix, tokenName, userId, userName, 1)
 			return // 成功处理请求，直接返回
 		}
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+		go processChannelError(c, channel.Id, c.GetInt("channel_key_id"), channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
 
 		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
 			break
@@ -388,7 +438,7 @@ func WssRelay(c *gin.Context) {
 			if strings.Contains(openaiErr.Error.Message, "write: connection timed out") && openaiErr.Error.Code == "copy_response_body_failed" {
 				code = "499"
 			}
-			metrics.IncrementRelayRequestE2EFailedCounter(strconv.Itoa(channel.Id), channel.Name, originalModel, group, code, tokenKey, tokenName, userId, userName, openaiErr.Error.Message, 1)
+			metrics.IncrementRelayRequestE2EFailedCounter(strconv.Itoa(channel.Id), channel.Name, originalModel, group, code, tokenKeyPrefix, tokenName, userId, userName, openaiErr.Error.Message, 1)
 		}
 		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
 		helper.WssError(c, ws, openaiErr.Error)
@@ -444,7 +494,7 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 			Setting: settingStr,
 		}, nil
 	}
-	channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, retryCount)
+	channel, err := middleware.SelectChannel(c, group, originalModel, retryCount)
 	if err != nil {
 		return nil, fmt.Errorf("获取重试渠道失败: %s", err.Error())
 	}
@@ -530,12 +580,43 @@ func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retry
 	return false
 }
 
-func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
+// recordChannelResult 记录渠道本次请求的耗时、首字时间和是否失败，供 adaptive 渠道选择策略和熔断器使用，
+// 只有 5xx（包括连接上游失败和超时）计入渠道的错误率，本地错误和 4xx（包括上游限流 429）不计入
+func recordChannelResult(channelId int, modelName string, relayInfo *relaycommon.RelayInfo, attemptStart time.Time, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	failed := false
+	if openaiErr != nil {
+		if openaiErr.LocalError || openaiErr.StatusCode < http.StatusInternalServerError {
+			return
+		}
+		failed = true
+	}
+	var ttft time.Duration
+	if relayInfo.IsStream && relayInfo.FirstResponseTime.After(attemptStart) {
+		ttft = relayInfo.FirstResponseTime.Sub(attemptStart)
+	}
+	model.RecordChannelResult(channelId, modelName, time.Since(attemptStart), ttft, failed)
+	model.RecordChannelBreakerResult(channelId, modelName, failed)
+}
+
+// recordChannelKeyResult 记录号池密钥的请求数和失败数，本地错误不计入
+func recordChannelKeyResult(keyId int, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	if keyId == 0 || (openaiErr != nil && openaiErr.LocalError) {
+		return
+	}
+	model.RecordChannelKeyResult(keyId, openaiErr != nil)
+}
+
+func processChannelError(c *gin.Context, channelId int, keyId int, channelType int, channelName string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	common.LogError(c, fmt.Sprintf("relay error (channel #%d, status code: %d): %s", channelId, err.StatusCode, err.Error.Message))
 	if service.ShouldDisableChannel(channelType, err) && autoBan {
-		service.DisableChannel(channelId, channelName, err.Error.Message)
+		// 号池中的密钥出错时只禁用该密钥，号池中没有启用的密钥时再禁用渠道
+		if keyId != 0 {
+			service.DisableChannelKey(channelId, keyId, channelName, err.Error.Message)
+		} else {
+			service.DisableChannel(channelId, channelName, err.Error.Message)
+		}
 	}
 }
 
@@ -608,9 +689,9 @@ func RelayTask(c *gin.Context) {
 		retryTimes = 0
 	}
 	for i := 0; shouldRetryTaskRelay(c, channelId, taskErr, retryTimes) && i < retryTimes; i++ {
-		channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, i)
+		channel, err := middleware.SelectChannel(c, group, originalModel, i)
 		if err != nil {
-			common.LogError(c, fmt.Sprintf("CacheGetRandomSatisfiedChannel failed: %s", err.Error()))
+			common.LogError(c, fmt.Sprintf("SelectChannel failed: %s", err.Error()))
 			break
 		}
 		channelId = channel.Id
@@ -0,0 +1,236 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errAdminManagedSpendBudget = errors.New("该预算由管理员设置，不能修改或删除")
+
+func respondSpendBudgets(c *gin.Context, userId int) {
+	budgets, err := model.GetUserSpendBudgets(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.FillSpendBudgetsUsage(budgets)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    budgets,
+	})
+}
+
+// GetSpendBudgets 获取当前用户的周期预算及当前窗口的消耗，包括管理员设置的预算
+func GetSpendBudgets(c *gin.Context) {
+	respondSpendBudgets(c, c.GetInt("id"))
+}
+
+// checkSpendBudgetToken token_id 不为 0 时必须是当前用户的令牌
+func checkSpendBudgetToken(tokenId int, userId int) error {
+	if tokenId == 0 {
+		return nil
+	}
+	token, err := model.GetTokenByIds(tokenId, userId)
+	if err != nil || token.UserId != userId {
+		return errors.New("令牌不存在")
+	}
+	return nil
+}
+
+// addSpendBudget 为用户创建预算，adminManaged 为 true 时用户不能修改或删除
+func addSpendBudget(c *gin.Context, userId int, adminManaged bool) (*model.SpendBudget, bool) {
+	budget := model.SpendBudget{}
+	if err := c.ShouldBindJSON(&budget); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	cleanBudget := model.SpendBudget{
+		UserId:       userId,
+		TokenId:      budget.TokenId,
+		Period:       budget.Period,
+		ResetMode:    budget.ResetMode,
+		Timezone:     budget.Timezone,
+		Quota:        budget.Quota,
+		Enabled:      true,
+		AdminManaged: adminManaged,
+	}
+	err := cleanBudget.Validate()
+	if err == nil {
+		err = checkSpendBudgetToken(cleanBudget.TokenId, userId)
+	}
+	if err == nil {
+		err = cleanBudget.Insert()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanBudget,
+	})
+	return &cleanBudget, true
+}
+
+// updateSpendBudget 修改预算的周期、重置方式、时区、额度和启用状态，不能修改所属的令牌，
+// byAdmin 为 false 时不能修改管理员设置的预算
+func updateSpendBudget(c *gin.Context, userId int, byAdmin bool) (origin *model.SpendBudget, updated *model.SpendBudget, ok bool) {
+	budget := model.SpendBudget{}
+	if err := c.ShouldBindJSON(&budget); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, nil, false
+	}
+	cleanBudget, err := model.GetSpendBudgetById(budget.Id, userId)
+	if err == nil && cleanBudget.AdminManaged && !byAdmin {
+		err = errAdminManagedSpendBudget
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, nil, false
+	}
+	originBudget := *cleanBudget
+	cleanBudget.Period = budget.Period
+	cleanBudget.ResetMode = budget.ResetMode
+	cleanBudget.Timezone = budget.Timezone
+	cleanBudget.Quota = budget.Quota
+	cleanBudget.Enabled = budget.Enabled
+	err = cleanBudget.Validate()
+	if err == nil {
+		err = cleanBudget.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, nil, false
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanBudget,
+	})
+	return &originBudget, cleanBudget, true
+}
+
+// deleteSpendBudget 删除预算，byAdmin 为 false 时不能删除管理员设置的预算
+func deleteSpendBudget(c *gin.Context, id int, userId int, byAdmin bool) (*model.SpendBudget, bool) {
+	budget, err := model.GetSpendBudgetById(id, userId)
+	if err == nil && budget.AdminManaged && !byAdmin {
+		err = errAdminManagedSpendBudget
+	}
+	if err == nil {
+		err = budget.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return budget, true
+}
+
+func AddSpendBudget(c *gin.Context) {
+	addSpendBudget(c, c.GetInt("id"), false)
+}
+
+func UpdateSpendBudget(c *gin.Context) {
+	updateSpendBudget(c, c.GetInt("id"), false)
+}
+
+func DeleteSpendBudget(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	deleteSpendBudget(c, id, c.GetInt("id"), false)
+}
+
+// getManagedSpendBudgetUser 读取路径中的用户，管理员不能管理同级或更高等级用户的预算，失败时已写入响应
+func getManagedSpendBudgetUser(c *gin.Context) (int, bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return 0, false
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权管理同权限等级或更高权限等级用户的预算",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetUserSpendBudgets 管理员获取用户的周期预算，包括用户自己设置的预算
+func GetUserSpendBudgets(c *gin.Context) {
+	userId, ok := getManagedSpendBudgetUser(c)
+	if !ok {
+		return
+	}
+	respondSpendBudgets(c, userId)
+}
+
+// AddUserSpendBudget 管理员为用户设置预算，用户只能查看，不能修改或删除
+func AddUserSpendBudget(c *gin.Context) {
+	userId, ok := getManagedSpendBudgetUser(c)
+	if !ok {
+		return
+	}
+	if budget, ok := addSpendBudget(c, userId, true); ok {
+		model.RecordAuditLog(c, "spend_budget.create", model.AuditTargetSpendBudget, budget.Id, nil, budget)
+	}
+}
+
+// UpdateUserSpendBudget 管理员修改用户的预算，包括用户自己设置的预算
+func UpdateUserSpendBudget(c *gin.Context) {
+	userId, ok := getManagedSpendBudgetUser(c)
+	if !ok {
+		return
+	}
+	if origin, budget, ok := updateSpendBudget(c, userId, true); ok {
+		model.RecordAuditLog(c, "spend_budget.update", model.AuditTargetSpendBudget, budget.Id, origin, budget)
+	}
+}
+
+func DeleteUserSpendBudget(c *gin.Context) {
+	userId, ok := getManagedSpendBudgetUser(c)
+	if !ok {
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("budget_id"))
+	if budget, ok := deleteSpendBudget(c, id, userId, true); ok {
+		model.RecordAuditLog(c, "spend_budget.delete", model.AuditTargetSpendBudget, id, budget, nil)
+	}
+}
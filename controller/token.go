@@ -1,12 +1,17 @@
 package controller
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"one-api/common"
+	"one-api/constant"
 	"one-api/model"
+	"one-api/service"
 	"strconv"
 	"strings"
 
+	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 )
 
@@ -43,6 +48,7 @@ func GetAllTokens(c *gin.Context) {
 		}
 		tokens = filteredTokens
 	}
+	model.FillTokensInFlight(tokens)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -71,6 +77,7 @@ func RootGetAllTokens(c *gin.Context) {
 		})
 		return
 	}
+	model.FillTokensInFlight(tokens)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -91,6 +98,7 @@ func SearchTokens(c *gin.Context) {
 		})
 		return
 	}
+	model.FillTokensInFlight(tokens)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -117,6 +125,7 @@ func GetToken(c *gin.Context) {
 		})
 		return
 	}
+	model.FillTokensInFlight([]*model.Token{token})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -125,6 +134,28 @@ func GetToken(c *gin.Context) {
 	return
 }
 
+// validateTokenIps 令牌的 IP 允许列表和禁止列表只能包含 IP 和 CIDR
+func validateTokenIps(token model.Token) error {
+	for _, ips := range []*string{token.AllowIps, token.DenyIps} {
+		if ips == nil {
+			continue
+		}
+		if err := common.ValidateIPList(*ips); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTokenScopes 获取令牌可设置的接口范围
+func GetTokenScopes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    constant.TokenScopes,
+	})
+}
+
 func GetTokenStatus(c *gin.Context) {
 	tokenId := c.GetInt("token_id")
 	userId := c.GetInt("id")
@@ -166,6 +197,29 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.MaxConcurrentRequests < 0 || token.MaxRealtimeSessions < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "并发数上限不能为负数",
+		})
+		return
+	}
+	err = validateTokenIps(token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	token.Scopes, err = model.NormalizeTokenScopes(token.Scopes)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -178,7 +232,6 @@ func AddToken(c *gin.Context) {
 	cleanToken := model.Token{
 		UserId:             c.GetInt("id"),
 		Name:               token.Name,
-		Key:                key,
 		CreatedTime:        common.GetTimestamp(),
 		AccessedTime:       common.GetTimestamp(),
 		ExpiredTime:        token.ExpiredTime,
@@ -187,8 +240,22 @@ func AddToken(c *gin.Context) {
 		ModelLimitsEnabled: token.ModelLimitsEnabled,
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
+		DenyIps:            token.DenyIps,
 		Group:              token.Group,
 		ModelNameMapping:   token.ModelNameMapping,
+		Scopes:             token.Scopes,
+
+		MaxConcurrentRequests: token.MaxConcurrentRequests,
+		MaxRealtimeSessions:   token.MaxRealtimeSessions,
+	}
+	err = cleanToken.SetKey(key)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "生成令牌失败",
+		})
+		common.SysError("failed to hash token key: " + err.Error())
+		return
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -198,13 +265,89 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	// 数据库中只保存令牌的哈希，完整的令牌只在这里返回一次
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data":    cleanToken,
 	})
 	return
 }
 
+type RotateTokenRequest struct {
+	// GracePeriod 旧令牌继续可用的时间（秒），为空时使用 TOKEN_ROTATION_GRACE_PERIOD，为 0 时旧令牌立即失效
+	GracePeriod *int64 `json:"grace_period"`
+}
+
+// RotateToken 为令牌生成新的密钥，令牌 id、额度和日志不变，旧密钥在宽限期内仍然可用
+func RotateToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var req RotateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	gracePeriod := int64(constant.TokenRotationGracePeriod)
+	if req.GracePeriod != nil {
+		gracePeriod = *req.GracePeriod
+	}
+	if gracePeriod < 0 || gracePeriod > int64(constant.TokenRotationMaxGracePeriod) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "宽限期超出允许的范围",
+		})
+		return
+	}
+	userId := c.GetInt("id")
+	token, err := model.GetTokenByIds(id, userId)
+	if err == nil && token.UserId != userId {
+		err = errors.New("令牌不存在")
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	key, err := common.GenerateKey()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "生成令牌失败",
+		})
+		common.SysError("failed to generate token key: " + err.Error())
+		return
+	}
+	previousKey := token.MaskedKey()
+	if err := token.RotateKey(key, gracePeriod); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	gopool.Go(func() {
+		service.NotifyTokenRotated(token, previousKey)
+	})
+	// 新的令牌只在这里返回一次
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    token,
+	})
+}
+
 func DeleteToken(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	userId := c.GetInt("id")
@@ -242,6 +385,29 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.MaxConcurrentRequests < 0 || token.MaxRealtimeSessions < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "并发数上限不能为负数",
+		})
+		return
+	}
+	err = validateTokenIps(token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	token.Scopes, err = model.NormalizeTokenScopes(token.Scopes)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -277,8 +443,12 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimitsEnabled = token.ModelLimitsEnabled
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
+		cleanToken.DenyIps = token.DenyIps
 		cleanToken.Group = token.Group
 		cleanToken.ModelNameMapping = token.ModelNameMapping
+		cleanToken.Scopes = token.Scopes
+		cleanToken.MaxConcurrentRequests = token.MaxConcurrentRequests
+		cleanToken.MaxRealtimeSessions = token.MaxRealtimeSessions
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -218,7 +218,6 @@ func Register(c *gin.Context) {
 		token := model.Token{
 			UserId:             insertedUser.Id, // 使用插入后的用户ID
 			Name:               cleanUser.Username + "的初始令牌",
-			Key:                key,
 			CreatedTime:        common.GetTimestamp(),
 			AccessedTime:       common.GetTimestamp(),
 			ExpiredTime:        -1,     // 永不过期
@@ -226,6 +225,14 @@ func Register(c *gin.Context) {
 			UnlimitedQuota:     true,
 			ModelLimitsEnabled: false,
 		}
+		if err := token.SetKey(key); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "生成默认令牌失败",
+			})
+			common.SysError("failed to hash token key: " + err.Error())
+			return
+		}
 		if err := token.Insert(); err != nil {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
@@ -543,6 +550,19 @@ func UpdateUser(c *gin.Context) {
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
+	// 只有额度权限时只修改额度，其他字段保持不变
+	if !hasPermission(c, constant.PermissionUserWrite) {
+		quota := updatedUser.Quota
+		updatedUser = *originUser
+		updatedUser.Quota = quota
+	}
+	if updatedUser.Quota != originUser.Quota && !hasPermission(c, constant.PermissionUserQuotaWrite) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权修改用户额度",
+		})
+		return
+	}
 	updatePassword := updatedUser.Password != ""
 	if err := updatedUser.Edit(updatePassword); err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -554,6 +574,12 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
+	if user, err := model.GetUserById(originUser.Id, false); err == nil {
+		model.RecordAuditLog(c, "user.update", model.AuditTargetUser, originUser.Id, originUser, user)
+	}
+	if updatePassword {
+		model.RecordAuditLog(c, "user.reset_password", model.AuditTargetUser, originUser.Id, nil, map[string]string{"password": updatedUser.Password})
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -641,6 +667,7 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "user.delete", model.AuditTargetUser, id, originUser, nil)
 }
 
 func DeleteSelf(c *gin.Context) {
@@ -712,6 +739,7 @@ func CreateUser(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "user.create", model.AuditTargetUser, cleanUser.Id, nil, &cleanUser)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -757,6 +785,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	before := map[string]int{"role": user.Role, "status": user.Status}
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -825,6 +854,8 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAuditLog(c, "user."+req.Action, model.AuditTargetUser, user.Id, before,
+		map[string]int{"role": user.Role, "status": user.Status})
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -2,7 +2,9 @@ package controller
 
 import (
 	"net/http"
+	"one-api/common"
 	"one-api/model"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -43,3 +45,33 @@ func GetSpecificUserRateLimitConfig(c *gin.Context) {
 		},
 	})
 }
+
+// GetUserRateLimitAdjustments 分页获取当前站点自适应限速的调整记录
+func GetUserRateLimitAdjustments(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	adjustments, total, err := model.GetUserRateLimitAdjustments(c.Query("username"), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     adjustments,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
@@ -0,0 +1,18 @@
+package dto
+
+import "encoding/json"
+
+// AsyncRequestResponse 是 /v1/async/:id 返回的异步请求对象，也是回调时发送的内容
+type AsyncRequestResponse struct {
+	Id          string              `json:"id"`
+	Object      string              `json:"object"`
+	Status      string              `json:"status"`
+	CreatedAt   int64               `json:"created_at"`
+	CompletedAt *int64              `json:"completed_at"`
+	Response    *AsyncRequestResult `json:"response,omitempty"`
+}
+
+type AsyncRequestResult struct {
+	StatusCode int             `json:"status_code"`
+	Body       json.RawMessage `json:"body"`
+}
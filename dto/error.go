@@ -13,6 +13,13 @@ type OpenAIErrorWithStatusCode struct {
 	LocalError bool
 }
 
+// GeminiError 是 Google API 风格的错误体，作为 {"error": GeminiError} 返回给 Gemini 原生接口的客户端
+type GeminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
 type GeneralErrorResponse struct {
 	Error    OpenAIError `json:"error"`
 	Message  string      `json:"message"`
@@ -243,6 +243,13 @@ func (m *Message) SetMediaContent(content []MediaContent) {
 	m.parsedStringContent = nil
 }
 
+// SetRawContent 直接替换原始 content，并清空解析缓存
+func (m *Message) SetRawContent(content json.RawMessage) {
+	m.Content = content
+	m.parsedContent = nil
+	m.parsedStringContent = nil
+}
+
 func (m *Message) IsStringContent() bool {
 	if m.parsedStringContent != nil {
 		return true
@@ -0,0 +1,207 @@
+package dto
+
+import "encoding/json"
+
+// OpenAIResponsesRequest https://platform.openai.com/docs/api-reference/responses/create
+type OpenAIResponsesRequest struct {
+	Model              string               `json:"model"`
+	Input              json.RawMessage      `json:"input,omitempty"`
+	Instructions       string               `json:"instructions,omitempty"`
+	MaxOutputTokens    uint                 `json:"max_output_tokens,omitempty"`
+	Temperature        *float64             `json:"temperature,omitempty"`
+	TopP               *float64             `json:"top_p,omitempty"`
+	Stream             bool                 `json:"stream,omitempty"`
+	Tools              []ResponsesTool      `json:"tools,omitempty"`
+	ToolChoice         json.RawMessage      `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool                `json:"parallel_tool_calls,omitempty"`
+	PreviousResponseId string               `json:"previous_response_id,omitempty"`
+	Store              *bool                `json:"store,omitempty"`
+	Reasoning          *ResponsesReasoning  `json:"reasoning,omitempty"`
+	Text               *ResponsesTextConfig `json:"text,omitempty"`
+	Include            []string             `json:"include,omitempty"`
+	Metadata           json.RawMessage      `json:"metadata,omitempty"`
+	Truncation         string               `json:"truncation,omitempty"`
+	User               string               `json:"user,omitempty"`
+}
+
+type ResponsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+	Strict      any    `json:"strict,omitempty"`
+}
+
+type ResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type ResponsesTextConfig struct {
+	Format *ResponsesTextFormat `json:"format,omitempty"`
+}
+
+type ResponsesTextFormat struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Schema      any    `json:"schema,omitempty"`
+	Strict      any    `json:"strict,omitempty"`
+}
+
+// ResponsesInputItem is one element of the array form of `input`. Messages,
+// function calls and function call outputs share the same shape.
+type ResponsesInputItem struct {
+	Type      string          `json:"type,omitempty"`
+	Id        string          `json:"id,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	CallId    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"`
+}
+
+type ResponsesInputContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageUrl string `json:"image_url,omitempty"`
+	FileId   string `json:"file_id,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+const (
+	ResponsesItemTypeMessage            = "message"
+	ResponsesItemTypeReasoning          = "reasoning"
+	ResponsesItemTypeFunctionCall       = "function_call"
+	ResponsesItemTypeFunctionCallOutput = "function_call_output"
+
+	ResponsesContentTypeInputText   = "input_text"
+	ResponsesContentTypeInputImage  = "input_image"
+	ResponsesContentTypeInputFile   = "input_file"
+	ResponsesContentTypeOutputText  = "output_text"
+	ResponsesContentTypeSummaryText = "summary_text"
+)
+
+type OpenAIResponsesResponse struct {
+	Id                 string                      `json:"id"`
+	Object             string                      `json:"object"`
+	CreatedAt          int64                       `json:"created_at"`
+	Status             string                      `json:"status"`
+	Model              string                      `json:"model"`
+	Output             []ResponsesOutput           `json:"output"`
+	Instructions       *string                     `json:"instructions"`
+	PreviousResponseId *string                     `json:"previous_response_id"`
+	IncompleteDetails  *ResponsesIncompleteDetails `json:"incomplete_details"`
+	Error              *OpenAIError                `json:"error"`
+	MaxOutputTokens    *uint                       `json:"max_output_tokens"`
+	Temperature        *float64                    `json:"temperature,omitempty"`
+	TopP               *float64                    `json:"top_p,omitempty"`
+	Tools              []ResponsesTool             `json:"tools"`
+	ToolChoice         json.RawMessage             `json:"tool_choice,omitempty"`
+	Metadata           json.RawMessage             `json:"metadata,omitempty"`
+	User               string                      `json:"user,omitempty"`
+	Usage              *ResponsesUsage             `json:"usage"`
+}
+
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type ResponsesOutput struct {
+	Type      string                   `json:"type"`
+	Id        string                   `json:"id"`
+	Status    string                   `json:"status,omitempty"`
+	Role      string                   `json:"role,omitempty"`
+	Content   []ResponsesOutputContent `json:"content,omitempty"`
+	Summary   []ResponsesSummaryPart   `json:"summary,omitempty"`
+	CallId    string                   `json:"call_id,omitempty"`
+	Name      string                   `json:"name,omitempty"`
+	Arguments string                   `json:"arguments,omitempty"`
+}
+
+type ResponsesOutputContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+type ResponsesSummaryPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type ResponsesUsage struct {
+	InputTokens         int                           `json:"input_tokens"`
+	OutputTokens        int                           `json:"output_tokens"`
+	TotalTokens         int                           `json:"total_tokens"`
+	InputTokensDetails  *ResponsesInputTokensDetails  `json:"input_tokens_details,omitempty"`
+	OutputTokensDetails *ResponsesOutputTokensDetails `json:"output_tokens_details,omitempty"`
+}
+
+type ResponsesInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type ResponsesOutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// ToUsage converts the Responses usage block into the gateway's billing usage.
+func (u *ResponsesUsage) ToUsage() *Usage {
+	usage := &Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		InputTokens:      u.InputTokens,
+		OutputTokens:     u.OutputTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = u.InputTokens + u.OutputTokens
+	}
+	if u.InputTokensDetails != nil {
+		usage.PromptTokensDetails.CachedTokens = u.InputTokensDetails.CachedTokens
+	}
+	if u.OutputTokensDetails != nil {
+		usage.CompletionTokenDetails.ReasoningTokens = u.OutputTokensDetails.ReasoningTokens
+	}
+	return usage
+}
+
+// ResponsesStreamResponse is a single typed SSE event, e.g. response.output_text.delta
+type ResponsesStreamResponse struct {
+	Type           string                   `json:"type"`
+	SequenceNumber int                      `json:"sequence_number"`
+	Response       *OpenAIResponsesResponse `json:"response,omitempty"`
+	OutputIndex    *int                     `json:"output_index,omitempty"`
+	ContentIndex   *int                     `json:"content_index,omitempty"`
+	SummaryIndex   *int                     `json:"summary_index,omitempty"`
+	ItemId         string                   `json:"item_id,omitempty"`
+	Item           *ResponsesOutput         `json:"item,omitempty"`
+	Part           any                      `json:"part,omitempty"`
+	Delta          string                   `json:"delta,omitempty"`
+	Text           string                   `json:"text,omitempty"`
+	Arguments      string                   `json:"arguments,omitempty"`
+}
+
+const (
+	ResponsesEventCreated                   = "response.created"
+	ResponsesEventInProgress                = "response.in_progress"
+	ResponsesEventCompleted                 = "response.completed"
+	ResponsesEventIncomplete                = "response.incomplete"
+	ResponsesEventFailed                    = "response.failed"
+	ResponsesEventOutputItemAdded           = "response.output_item.added"
+	ResponsesEventOutputItemDone            = "response.output_item.done"
+	ResponsesEventContentPartAdded          = "response.content_part.added"
+	ResponsesEventContentPartDone           = "response.content_part.done"
+	ResponsesEventOutputTextDelta           = "response.output_text.delta"
+	ResponsesEventOutputTextDone            = "response.output_text.done"
+	ResponsesEventReasoningSummaryPartAdded = "response.reasoning_summary_part.added"
+	ResponsesEventReasoningSummaryPartDone  = "response.reasoning_summary_part.done"
+	ResponsesEventReasoningSummaryDelta     = "response.reasoning_summary_text.delta"
+	ResponsesEventReasoningSummaryDone      = "response.reasoning_summary_text.done"
+	ResponsesEventFunctionCallArgsDelta     = "response.function_call_arguments.delta"
+	ResponsesEventFunctionCallArgsDone      = "response.function_call_arguments.done"
+)
@@ -99,6 +99,15 @@ func main() {
 	if err != nil {
 		common.FatalLog("failed to initialize database: " + err.Error())
 	}
+	if *common.EncryptSecrets || *common.RotateSecrets {
+		if err := model.MigrateSecrets(*common.RotateSecrets); err != nil {
+			common.FatalLog("failed to migrate secrets: " + err.Error())
+		}
+		return
+	}
+	if !common.SecretEncryptionEnabled() {
+		common.SysLog("CRYPTO_SECRET and CRYPTO_KEK_FILE not set, channel keys are stored in plaintext")
+	}
 	// Initialize SQL Database
 	err = model.InitLogDB()
 	if err != nil {
@@ -272,6 +281,13 @@ func main() {
 	server.Use(sessions.Sessions("session", store))
 
 	router.SetRouter(server, buildFS, indexPage)
+	// 批处理和异步请求都交给网关自身的路由执行
+	service.SetInternalRelayHandler(server)
+	if common.IsMasterNode {
+		service.StartBatchRunner()
+		service.StartAsyncRequestRunner()
+		service.StartAdaptiveRateLimitController()
+	}
 	var port = os.Getenv("PORT")
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
@@ -42,6 +42,9 @@ func RegisterMetrics(registry prometheus.Registerer) {
 	registry.MustRegister(consumeLogTrafficTotalCounter)
 	registry.MustRegister(consumeLogTrafficFailedCounter)
 	registry.MustRegister(consumeLogTrafficSuccessCounter)
+	// rate limit wait queue metrics
+	registry.MustRegister(rateLimitQueueDepthGauge)
+	registry.MustRegister(rateLimitQueueWaitObserver)
 }
 
 var (
@@ -215,8 +218,32 @@ var (
 			Name:      "consume_log_traffic_success_total",
 			Help:      "Total successful traffic count for consume logs",
 		}, []string{"channel", "channel_name", "model", "group", "user_id", "user_name", "token_name"})
+
+	// Rate limit wait queue metrics
+	rateLimitQueueDepthGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: Namespace,
+			Name:      "rate_limit_queue_depth",
+			Help:      "Number of rate limited requests waiting in queue on this node",
+		}, []string{"priority"})
+	rateLimitQueueWaitObserver = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: Namespace,
+			Name:      "rate_limit_queue_wait_duration",
+			Help:      "Time rate limited requests spent waiting in queue",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+		}, []string{"priority", "result"})
 )
 
+// Rate limit wait queue metrics functions
+func AddRateLimitQueueDepth(priority string, add float64) {
+	rateLimitQueueDepthGauge.WithLabelValues(priority).Add(add)
+}
+
+func ObserveRateLimitQueueWait(priority, result string, duration float64) {
+	rateLimitQueueWaitObserver.WithLabelValues(priority, result).Observe(duration)
+}
+
 func IncrementRelayRequestTotalCounter(channel, channelName, tag, baseURL, model, group, userId, userName string, add float64) {
 	relayRequestTotalCounter.WithLabelValues(channel, channelName, tag, baseURL, model, group, userId, userName).Add(add)
 }
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AsyncRequest 为所有渠道提供异步模式，需要放在 TokenAuth 之后、Distribute 之前：
+// 请求头 X-Oneapi-Async 为 true 时保存请求并立即返回 Retry_request_id，
+// 携带 Retry_request_id 重试同一接口时返回执行结果，未完成时返回 203
+func AsyncRequest() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if retryRequestId := c.GetHeader(common.RetryRequestIdKey); strings.HasPrefix(retryRequestId, service.AsyncRequestIdPrefix) {
+			writeAsyncRequestResult(c, retryRequestId)
+			c.Abort()
+			return
+		}
+		if c.GetHeader(common.AsyncRequestKey) != "true" {
+			c.Next()
+			return
+		}
+		submitAsyncRequest(c)
+		c.Abort()
+	}
+}
+
+func submitAsyncRequest(c *gin.Context) {
+	if c.GetString(constant.ContextKeyClientTokenId) != "" {
+		// 异步请求由网关以父令牌身份执行，无法保留短期令牌收窄的权限
+		abortWithOpenAiMessage(c, http.StatusForbidden, "短期令牌不支持异步请求")
+		return
+	}
+	callbackUrl := c.GetHeader(common.AsyncCallbackKey)
+	if callbackUrl != "" {
+		// 发送回调时还会在连接时再次检查，这里只是提前拒绝明显的内网地址
+		if err := service.ValidatePublicURL(c.Request.Context(), callbackUrl); err != nil {
+			abortWithOpenAiMessage(c, http.StatusBadRequest, "异步回调地址无效，只允许公网的 http/https 地址")
+			return
+		}
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusBadRequest, "读取请求体失败")
+		return
+	}
+	var streamRequest struct {
+		Stream bool `json:"stream"`
+	}
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		_ = json.Unmarshal(body, &streamRequest)
+	}
+	if streamRequest.Stream || strings.Contains(c.Request.URL.Path, ":streamGenerateContent") {
+		abortWithOpenAiMessage(c, http.StatusBadRequest, "异步模式不支持流式请求")
+		return
+	}
+	request, err := service.SubmitAsyncRequest(c.Request.Context(), c.GetInt("id"), c.GetInt("token_id"), c.ClientIP(),
+		c.Request.Method, c.Request.URL.RequestURI(), c.Request.Header, body, callbackUrl)
+	if err != nil {
+		common.LogError(c, "submit async request failed: "+err.Error())
+		abortWithOpenAiMessage(c, http.StatusInternalServerError, "提交异步请求失败")
+		return
+	}
+	c.Header(common.RetryRequestIdKey, request.Id)
+	c.JSON(dto.StatusNewAPIBatchAccepted, service.AsyncRequest2Response(c.Request.Context(), request))
+}
+
+// writeAsyncRequestResult 已完成时按原始状态码返回上游响应，未完成时返回 203 提示稍后重试
+func writeAsyncRequestResult(c *gin.Context, requestId string) {
+	request, err := model.GetAsyncRequestById(requestId, c.GetInt("id"), c.GetInt("token_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithOpenAiMessage(c, http.StatusNotFound, fmt.Sprintf("异步请求 %s 不存在或结果已过期", requestId))
+		} else {
+			common.LogError(c, "get async request failed: "+err.Error())
+			abortWithOpenAiMessage(c, http.StatusInternalServerError, "查询异步请求失败")
+		}
+		return
+	}
+	c.Header(common.RetryRequestIdKey, request.Id)
+	if request.CompletedAt == 0 {
+		c.JSON(dto.StatusNewAPIBatchSubmitted, gin.H{
+			"error": gin.H{
+				"message":    "Request is still being processed, please retry later",
+				"type":       "request_in_progress",
+				"code":       "request_still_processing",
+				"request_id": request.Id,
+			},
+		})
+		return
+	}
+	body, err := service.GetAsyncRequestResult(c.Request.Context(), request)
+	if err != nil {
+		common.LogError(c, "get async request result failed: "+err.Error())
+		abortWithOpenAiMessage(c, http.StatusInternalServerError, "读取异步请求结果失败")
+		return
+	}
+	contentType := request.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	c.Data(request.StatusCode, contentType, body)
+}
@@ -1,11 +1,13 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"one-api/common"
 	"one-api/constant"
 	"one-api/model"
+	"one-api/service"
 	"strconv"
 	"strings"
 
@@ -24,7 +26,7 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
-func authHelper(c *gin.Context, minRole int) {
+func authHelper(c *gin.Context, minRole int, permissions ...string) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -119,6 +121,9 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	if len(permissions) > 0 && !checkPermissions(c, id.(int), role.(int), permissions) {
+		return
+	}
 
 	// 添加日志打印
 	common.SysLog(fmt.Sprintf("[Auth Info] UserID: %v, Role: %v, Username: %v", id, role, username))
@@ -206,7 +211,16 @@ func TokenAuth() func(c *gin.Context) {
 		parts := make([]string, 0)
 		key = strings.TrimPrefix(key, "Bearer ")
 
-		if key == "" || key == "midjourney-proxy" {
+		var clientClaims *service.ClientTokenClaims
+		if service.IsClientToken(key) {
+			// 短期客户端令牌只校验签名，不能按 "-" 拆分指定渠道
+			var err error
+			clientClaims, err = service.ParseClientToken(key)
+			if err != nil {
+				abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
+				return
+			}
+		} else if key == "" || key == "midjourney-proxy" {
 			key = c.Request.Header.Get("mj-api-secret")
 			key = strings.TrimPrefix(key, "Bearer ")
 			key = strings.TrimPrefix(key, "sk-")
@@ -218,7 +232,19 @@ func TokenAuth() func(c *gin.Context) {
 			key = parts[0]
 		}
 
-		token, err := model.ValidateUserToken(key)
+		var token *model.Token
+		var err error
+		if tokenId := service.InternalRelayTokenId(c.Request.Context()); tokenId != 0 {
+			// 批处理和异步请求由网关以令牌身份在内部执行，没有完整令牌
+			token, err = model.ValidateUserTokenById(tokenId)
+		} else if clientClaims != nil {
+			token, err = model.ValidateUserTokenByIdWithCache(clientClaims.TokenId)
+			if err == nil && token.UserId != clientClaims.UserId {
+				err = errors.New("无效的短期令牌")
+			}
+		} else {
+			token, err = model.ValidateUserToken(key)
+		}
 		if token != nil {
 			id := c.GetInt("id")
 			if id == 0 {
@@ -245,7 +271,12 @@ func TokenAuth() func(c *gin.Context) {
 
 		c.Set("id", token.UserId)
 		c.Set("token_id", token.Id)
-		c.Set("token_key", token.Key)
+		c.Set("token_key_hash", token.KeyHash)
+		c.Set("token_key_prefix", token.KeyPrefix)
+		if token.UsingPreviousKey {
+			// 旧令牌只在宽限期内可用，提示客户端尽快更换
+			c.Header(common.TokenRotatedKey, strconv.FormatInt(token.PreviousKeyExpiredTime, 10))
+		}
 		c.Set("token_name", token.Name)
 		c.Set("token_unlimited_quota", token.UnlimitedQuota)
 		if !token.UnlimitedQuota {
@@ -257,9 +288,20 @@ func TokenAuth() func(c *gin.Context) {
 		} else {
 			c.Set("token_model_limit_enabled", false)
 		}
-		c.Set("allow_ips", token.GetIpLimitsMap())
 		c.Set("token_group", token.Group)
 		c.Set("token_model_name_mapping", token.ModelNameMapping)
+		c.Set(constant.ContextKeyTokenMaxConcurrentRequests, token.MaxConcurrentRequests)
+		c.Set(constant.ContextKeyTokenMaxRealtimeSessions, token.MaxRealtimeSessions)
+		if clientClaims != nil && !applyClientTokenClaims(c, token, clientClaims) {
+			return
+		}
+		if abortIfTokenScopeDenied(c, token) {
+			return
+		}
+		if err := checkIpPolicy(c, userCache, token); err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error())
+			return
+		}
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set("specific_channel_id", parts[1])
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"errors"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// channelQueuePollInterval 排队中的请求重试的间隔，其他节点释放的槽位无法通知到当前节点
+const channelQueuePollInterval = 200 * time.Millisecond
+
+var channelQueueLength atomic.Int64
+
+// SelectChannel 选择渠道并占用并发槽位，槽位保存在上下文中，并先释放本次请求之前占用的槽位；
+// 所有渠道并发已满时在有限长度的队列中等待，超过 CHANNEL_QUEUE_TIMEOUT 仍未等到时返回 model.ErrChannelsSaturated
+func SelectChannel(c *gin.Context, group string, modelName string, retry int) (*model.Channel, error) {
+	ReleaseChannelSlot(c)
+	return waitChannelSlot(c, func() (*model.Channel, *model.ChannelSlot, error) {
+		return model.CacheGetRandomSatisfiedChannel(group, modelName, retry)
+	})
+}
+
+// acquireSpecificChannelSlot 为指定的渠道占用并发槽位，并发已满时同样排队等待
+func acquireSpecificChannelSlot(c *gin.Context, channel *model.Channel) error {
+	ReleaseChannelSlot(c)
+	_, err := waitChannelSlot(c, func() (*model.Channel, *model.ChannelSlot, error) {
+		slot, ok := model.TryAcquireChannelSlot(channel)
+		if !ok {
+			return nil, nil, model.ErrChannelsSaturated
+		}
+		return channel, slot, nil
+	})
+	return err
+}
+
+// ReleaseChannelSlot 释放上下文中的并发槽位
+func ReleaseChannelSlot(c *gin.Context) {
+	if slot, ok := c.Get(constant.ContextKeyChannelSlot); ok {
+		slot.(*model.ChannelSlot).Release()
+		c.Set(constant.ContextKeyChannelSlot, (*model.ChannelSlot)(nil))
+	}
+}
+
+func waitChannelSlot(c *gin.Context, acquire func() (*model.Channel, *model.ChannelSlot, error)) (*model.Channel, error) {
+	released := model.ChannelSlotReleased()
+	channel, slot, err := acquire()
+	if !errors.Is(err, model.ErrChannelsSaturated) {
+		if err == nil {
+			c.Set(constant.ContextKeyChannelSlot, slot)
+		}
+		return channel, err
+	}
+	if channelQueueLength.Add(1) > int64(constant.ChannelQueueSize) {
+		channelQueueLength.Add(-1)
+		return nil, err
+	}
+	defer channelQueueLength.Add(-1)
+	common.LogInfo(c, "all channels are saturated, waiting in queue")
+
+	timer := time.NewTimer(time.Duration(constant.ChannelQueueTimeout) * time.Second)
+	defer timer.Stop()
+	ticker := time.NewTicker(channelQueuePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-released:
+		case <-ticker.C:
+		case <-timer.C:
+			return nil, err
+		case <-c.Request.Context().Done():
+			return nil, c.Request.Context().Err()
+		}
+		released = model.ChannelSlotReleased()
+		channel, slot, err = acquire()
+		if !errors.Is(err, model.ErrChannelsSaturated) {
+			if err == nil {
+				c.Set(constant.ContextKeyChannelSlot, slot)
+			}
+			return channel, err
+		}
+	}
+}
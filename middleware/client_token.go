@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"one-api/constant"
+	"one-api/model"
+	"one-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// applyClientTokenClaims 按短期客户端令牌的声明收窄父令牌的权限，用量仍计入父令牌
+func applyClientTokenClaims(c *gin.Context, token *model.Token, claims *service.ClientTokenClaims) bool {
+	switch scope, _ := constant.Path2TokenScope(c.Request.URL.Path); scope {
+	case constant.TokenScopeBatch, constant.TokenScopeFiles, constant.TokenScopeGoogleStorage:
+		abortWithOpenAiMessage(c, http.StatusForbidden, "短期令牌不能访问此接口")
+		return false
+	}
+	if len(claims.Models) > 0 {
+		// 父令牌的模型限制在签发后可能被修改，这里取两者的交集
+		parentLimits := token.GetModelLimitsMap()
+		tokenModelLimit := make(map[string]bool)
+		for _, modelName := range claims.Models {
+			if !token.ModelLimitsEnabled || parentLimits[modelName] {
+				tokenModelLimit[modelName] = true
+			}
+		}
+		c.Set("token_model_limit_enabled", true)
+		c.Set("token_model_limit", tokenModelLimit)
+	}
+	c.Set(constant.ContextKeyClientTokenId, claims.Id)
+	c.Set(constant.ContextKeyClientTokenQuota, claims.Quota)
+	c.Set(constant.ContextKeyClientTokenExpiresAt, claims.ExpiresAt)
+	c.Set(constant.ContextKeyEndUserId, claims.EndUserId)
+	return true
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -28,14 +29,6 @@ type ModelRequest struct {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		allowIpsMap := c.GetStringMap("allow_ips")
-		if len(allowIpsMap) != 0 {
-			clientIp := c.ClientIP()
-			if _, ok := allowIpsMap[clientIp]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中")
-				return
-			}
-		}
 		var channel *model.Channel
 		channelId, ok := c.Get("specific_channel_id")
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
@@ -76,6 +69,10 @@ func Distribute() func(c *gin.Context) {
 				abortWithOpenAiMessage(c, http.StatusForbidden, "该渠道已被禁用")
 				return
 			}
+			if err := acquireSpecificChannelSlot(c, channel); err != nil {
+				abortWithOpenAiMessage(c, http.StatusTooManyRequests, "该渠道并发已满，请稍后重试")
+				return
+			}
 		} else {
 			// Select a channel for the user
 			// check token model mapping
@@ -113,9 +110,21 @@ func Distribute() func(c *gin.Context) {
 
 			common.LogInfo(c, "userGroup: "+userGroup+" modelRequest.Model: "+modelRequest.Model)
 			if shouldSelectChannel {
-				channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0)
+				channel, err = SelectChannel(c, userGroup, modelRequest.Model, 0)
 				if err != nil {
 					userGroupId := setting.GetGroupId(userGroup)
+					if errors.Is(err, model.ErrChannelsSaturated) {
+						// 请求在进入 Relay 之前结束，请求数也在这里记录
+						username := c.GetString(constant.ContextKeyUserName)
+						service.RecordRateLimitStat(username, userGroup, modelRequest.Model, model.RateLimitStatRequests)
+						service.RecordRateLimitStat(username, userGroup, modelRequest.Model, model.RateLimitStatSaturated)
+						abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("当前分组id %d 下模型 %s 的渠道并发已满，请稍后重试", userGroupId, modelRequest.Model))
+						return
+					}
+					if errors.Is(err, model.ErrChannelBreakerOpen) {
+						abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("当前分组id %d 下模型 %s 的渠道均在熔断中，请稍后重试", userGroupId, modelRequest.Model))
+						return
+					}
 					message := fmt.Sprintf("当前分组id %d 下对于模型 %s 无可用渠道", userGroupId, modelRequest.Model)
 					// 如果错误，但是渠道不为空，说明是数据库一致性问题
 					if channel != nil {
@@ -135,6 +144,8 @@ func Distribute() func(c *gin.Context) {
 		}
 		c.Set(constant.ContextKeyRequestStartTime, time.Now())
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		// 处理请求时 panic 也要释放槽位
+		defer ReleaseChannelSlot(c)
 		c.Next()
 	}
 }
@@ -302,7 +313,13 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	c.Set("auto_ban", channel.GetAutoBan())
 	c.Set("model_mapping", channel.GetModelMapping())
 	c.Set("status_code_mapping", channel.GetStatusCodeMapping())
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	key := channel.Key
+	c.Set("channel_key_id", 0)
+	if channelKey := model.SelectChannelKey(channel); channelKey != nil {
+		key = channelKey.Key
+		c.Set("channel_key_id", channelKey.Id)
+	}
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	c.Set("base_url", channel.GetBaseURL())
 	c.Set("endpoint", channel.GetEndpoint())
 	// TODO: api_version统一
@@ -95,6 +95,20 @@ func GoogleOAuthAuth() func(c *gin.Context) {
 				return
 			}
 
+			// OAuth 绑定了令牌时，按令牌的接口范围检查
+			if oauth.TokenId > 0 {
+				token, err := model.GetTokenById(oauth.TokenId)
+				if err == nil {
+					if scope, denied := tokenScopeDenied(c, token); denied {
+						c.JSON(http.StatusForbidden, gin.H{
+							"error": tokenScopeDeniedMessage(scope),
+						})
+						c.Abort()
+						return
+					}
+				}
+			}
+
 			// 验证通过，将 oauth 信息存储到 context 中，供后续使用
 			c.Set("oauth", oauth)
 		}
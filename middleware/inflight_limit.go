@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConcurrencyLimit 限制令牌和用户同时进行中的请求数，请求结束后释放槽位
+func ConcurrencyLimit() gin.HandlerFunc {
+	return inFlightLimit(model.InFlightKindRequest, constant.ContextKeyTokenMaxConcurrentRequests, constant.ContextKeyUserMaxConcurrentRequests)
+}
+
+// RealtimeSessionLimit 限制令牌和用户同时打开的 realtime 会话数，连接关闭后释放槽位
+func RealtimeSessionLimit() gin.HandlerFunc {
+	return inFlightLimit(model.InFlightKindRealtime, constant.ContextKeyTokenMaxRealtimeSessions, constant.ContextKeyUserMaxRealtimeSessions)
+}
+
+func inFlightLimit(kind string, tokenKey string, userKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limits := []model.InFlightLimit{
+			{Scope: model.InFlightScopeToken, Id: c.GetInt("token_id"), Max: c.GetInt(tokenKey)},
+			{Scope: model.InFlightScopeUser, Id: c.GetInt("id"), Max: c.GetInt(userKey)},
+		}
+		lease, exceeded, err := model.AcquireInFlightLease(kind, limits)
+		if err != nil {
+			// Redis 不可用时不限制并发，避免请求全部失败
+			common.LogError(c, fmt.Sprintf("acquire inflight lease failed: %s", err.Error()))
+			c.Next()
+			return
+		}
+		if exceeded != nil {
+			what := "concurrent requests"
+			if kind == model.InFlightKindRealtime {
+				what = "concurrent realtime sessions"
+			}
+			abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf(
+				"Too many %s for this %s: limit %d. Please wait for in-progress requests to finish and try again.",
+				what, exceeded.Scope, exceeded.Max))
+			return
+		}
+		defer lease.Release()
+		c.Next()
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"errors"
+	"one-api/model"
+	"one-api/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkIpPolicy 依次检查全局禁止列表、用户（管理员设置的和用户自己设置的）和令牌的禁止列表，
+// 再检查用户和令牌的允许列表，IP 需要同时在所有非空的允许列表中。禁止列表优先于允许列表，允许列表为空表示不限制
+func checkIpPolicy(c *gin.Context, user *model.UserBase, token *model.Token) error {
+	clientIp := c.ClientIP()
+	if setting.GetIPDenyListMatcher().Contains(clientIp) {
+		return errors.New("您的 IP 已被禁止访问")
+	}
+	if user.GetDenyIpMatcher().Contains(clientIp) || user.GetSelfDenyIpMatcher().Contains(clientIp) {
+		return errors.New("您的 IP 在用户禁止访问的列表中")
+	}
+	if token.GetDenyIpMatcher().Contains(clientIp) {
+		return errors.New("您的 IP 在令牌禁止访问的列表中")
+	}
+	if userAllow := user.GetAllowIpMatcher(); !userAllow.Empty() && !userAllow.Contains(clientIp) {
+		return errors.New("您的 IP 不在用户允许访问的列表中")
+	}
+	if selfAllow := user.GetSelfAllowIpMatcher(); !selfAllow.Empty() && !selfAllow.Contains(clientIp) {
+		return errors.New("您的 IP 不在用户允许访问的列表中")
+	}
+	if tokenAllow := token.GetAllowIpMatcher(); !tokenAllow.Empty() && !tokenAllow.Contains(clientIp) {
+		return errors.New("您的 IP 不在令牌允许访问的列表中")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"one-api/model"
+	"one-api/setting"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckIpPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	origin := setting.IPDenyList
+	t.Cleanup(func() {
+		setting.IPDenyList = origin
+	})
+	ips := func(list string) *string {
+		return &list
+	}
+	tests := []struct {
+		name    string
+		ip      string
+		global  string
+		user    model.UserBase
+		token   model.Token
+		allowed bool
+	}{
+		{"no policy", "10.0.0.1", "", model.UserBase{}, model.Token{}, true},
+		{"global deny", "10.0.0.1", "10.0.0.0/8", model.UserBase{}, model.Token{}, false},
+		{"admin deny", "10.0.0.1", "", model.UserBase{DenyIps: "10.0.0.1"}, model.Token{}, false},
+		{"self deny", "10.0.0.1", "", model.UserBase{SelfDenyIps: "10.0.0.0/24"}, model.Token{}, false},
+		{"token deny", "10.0.0.1", "", model.UserBase{}, model.Token{DenyIps: ips("10.0.0.1")}, false},
+		{"deny wins over allow", "10.0.0.1", "", model.UserBase{AllowIps: "10.0.0.0/8", SelfDenyIps: "10.0.0.1"}, model.Token{}, false},
+		{"in admin allow", "10.0.0.1", "", model.UserBase{AllowIps: "10.0.0.0/8"}, model.Token{}, true},
+		{"outside admin allow", "11.0.0.1", "", model.UserBase{AllowIps: "10.0.0.0/8"}, model.Token{}, false},
+		{"in self allow", "10.0.0.1", "", model.UserBase{SelfAllowIps: "10.0.0.0/8"}, model.Token{}, true},
+		{"outside self allow", "11.0.0.1", "", model.UserBase{SelfAllowIps: "10.0.0.0/8"}, model.Token{}, false},
+		// 管理员和用户自己设置的允许列表都需要满足，用户不能放宽管理员的限制
+		{"in admin allow but outside self allow", "10.1.0.1", "", model.UserBase{AllowIps: "10.0.0.0/8", SelfAllowIps: "10.0.0.0/16"}, model.Token{}, false},
+		{"in self allow but outside admin allow", "11.0.0.1", "", model.UserBase{AllowIps: "10.0.0.0/8", SelfAllowIps: "11.0.0.0/8"}, model.Token{}, false},
+		{"in every allow list", "10.0.0.1", "", model.UserBase{AllowIps: "10.0.0.0/8", SelfAllowIps: "10.0.0.0/16"}, model.Token{AllowIps: ips("10.0.0.1")}, true},
+		{"outside token allow", "10.0.0.2", "", model.UserBase{AllowIps: "10.0.0.0/8"}, model.Token{AllowIps: ips("10.0.0.1")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setting.IPDenyList = tt.global
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+			c.Request.RemoteAddr = tt.ip + ":12345"
+			if err := checkIpPolicy(c, &tt.user, &tt.token); (err == nil) != tt.allowed {
+				t.Fatalf("error = %v, want allowed %t", err, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionAuth 要求管理员拥有 permissions 中的任意一个权限
+func PermissionAuth(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleAdminUser, permissions...)
+	}
+}
+
+// checkPermissions 检查失败时写入响应并中止请求，通过时把用户的全部权限写入上下文，供接口内部做更细的判断
+func checkPermissions(c *gin.Context, userId int, role int, permissions []string) bool {
+	granted, err := model.GetUserPermissions(userId, role)
+	if err != nil {
+		common.SysError("failed to get user permissions: " + err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作，获取权限失败",
+		})
+		c.Abort()
+		return false
+	}
+	for _, permission := range permissions {
+		if granted[permission] {
+			c.Set(constant.ContextKeyAdminPermissions, granted)
+			return true
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": "无权进行此操作，需要权限 " + strings.Join(permissions, " 或 "),
+	})
+	c.Abort()
+	return false
+}
@@ -3,10 +3,17 @@ package middleware
 import (
 	"context"
 	"fmt"
-	"math/rand"
+	"math"
 	"net/http"
 	"one-api/common"
+	"one-api/constant"
+	"one-api/metrics"
 	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,6 +23,8 @@ var timeFormat = "2006-01-02T15:04:05.000Z"
 
 var inMemoryRateLimiter common.InMemoryRateLimiter
 
+var inMemoryGCRALimiter common.InMemoryGCRALimiter
+
 // 返回限流错误（包括抢锁超时）
 func returnRateLimitError(c *gin.Context, message string) {
 	c.JSON(http.StatusTooManyRequests, gin.H{
@@ -28,271 +37,261 @@ func returnRateLimitError(c *gin.Context, message string) {
 	c.Abort()
 }
 
+// setRetryAfter 设置 Retry-After 响应头，单位为秒，向上取整
+func setRetryAfter(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+}
+
 var defNext = func(c *gin.Context) {
 	c.Next()
 }
 
-func redisRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark string) {
-	ctx := context.Background()
-	rdb := common.RDB
-	key := "rateLimit:" + mark + c.ClientIP()
-	listLength, err := rdb.LLen(ctx, key).Result()
+// allowRequest 启用 Redis 时在 Redis 中计算 GCRA 限流，否则使用当前节点的内存，两者语义相同
+func allowRequest(key string, limit common.GCRALimit) (common.RateLimitResult, error) {
+	if common.RedisEnabled {
+		return common.RedisGCRAAllow(context.Background(), "rateLimit:gcra:"+key, limit)
+	}
+	inMemoryGCRALimiter.Init(common.RateLimitKeyExpirationDuration)
+	return inMemoryGCRALimiter.Allow(key, limit), nil
+}
+
+func gcraRateLimiter(c *gin.Context, limit common.GCRALimit, mark string) {
+	result, err := allowRequest(mark+c.ClientIP(), limit)
 	if err != nil {
 		fmt.Println(err.Error())
 		c.Status(http.StatusInternalServerError)
 		c.Abort()
 		return
 	}
-	if listLength < int64(maxRequestNum) {
-		rdb.LPush(ctx, key, time.Now().Format(timeFormat))
-		rdb.Expire(ctx, key, common.RateLimitKeyExpirationDuration)
-	} else {
-		oldTimeStr, _ := rdb.LIndex(ctx, key, -1).Result()
-		oldTime, err := time.Parse(timeFormat, oldTimeStr)
-		if err != nil {
-			fmt.Println(err)
-			c.Status(http.StatusInternalServerError)
-			c.Abort()
-			return
-		}
-		nowTimeStr := time.Now().Format(timeFormat)
-		nowTime, err := time.Parse(timeFormat, nowTimeStr)
-		if err != nil {
-			fmt.Println(err)
-			c.Status(http.StatusInternalServerError)
-			c.Abort()
-			return
-		}
-		// time.Since will return negative number!
-		// See: https://stackoverflow.com/questions/50970900/why-is-time-since-returning-negative-durations-on-windows
-		if int64(nowTime.Sub(oldTime).Seconds()) < duration {
-			rdb.Expire(ctx, key, common.RateLimitKeyExpirationDuration)
-			c.Status(http.StatusTooManyRequests)
-			c.Abort()
-			return
-		} else {
-			rdb.LPush(ctx, key, time.Now().Format(timeFormat))
-			rdb.LTrim(ctx, key, 0, int64(maxRequestNum-1))
-			rdb.Expire(ctx, key, common.RateLimitKeyExpirationDuration)
-		}
-	}
-}
-
-func memoryRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark string) {
-	key := mark + c.ClientIP()
-	if !inMemoryRateLimiter.Request(key, maxRequestNum, duration) {
+	if !result.Allowed {
+		setRetryAfter(c, result.RetryAfter)
 		c.Status(http.StatusTooManyRequests)
 		c.Abort()
 		return
 	}
 }
 
-// redisRateLimiterWithWait 带等待机制的Redis限流器（使用Lua脚本保证原子性）
-func redisRateLimiterWithWait(c *gin.Context, userId int, tokenName, modelName string) {
-	// 构建限流标记：用户ID+token名+模型名
-	mark := fmt.Sprintf("UTM:%d:%s:%s:", userId, tokenName, modelName)
+// rateLimitQueuePollInterval 排队中的请求检查是否位于队首的间隔，其他节点的请求离开队列时无法通知到当前节点
+const rateLimitQueuePollInterval = 100 * time.Millisecond
 
-	// 尝试处理请求（每次都会重新获取最新的限流配置）
-	tryProcessRequest := func() bool {
-		// 每次重试都重新获取最新的限流配置
-		limit, err := model.GetUserTokenModelLimitWithCache(userId, tokenName, modelName)
-		if err != nil {
-			// 如果查询失败或没有配置，跳过限流
-			return true
-		}
+var (
+	rateLimitWaitClassOnce  sync.Once
+	rateLimitBulkGroups     map[string]bool
+	rateLimitGroupWeights   map[string]int
+	rateLimitPriorityLabels = map[int]string{model.WaitPriorityInteractive: "interactive", model.WaitPriorityBulk: "bulk"}
+)
 
-		// 检查是否启用限流
-		if !limit.RPMLimitEnabled {
-			return true
+// rateLimitWaitClass 返回请求排队时的优先级和权重：批处理任务、RATE_LIMIT_BULK_GROUPS 中的分组
+// 和请求头声明为 bulk 的请求为批量优先级，其余为交互式；权重按分组取自 RATE_LIMIT_GROUP_WEIGHTS
+func rateLimitWaitClass(c *gin.Context) (int, int) {
+	rateLimitWaitClassOnce.Do(func() {
+		rateLimitBulkGroups = make(map[string]bool)
+		for _, group := range strings.Split(constant.RateLimitBulkGroups, ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				rateLimitBulkGroups[group] = true
+			}
 		}
-
-		// 检查RPM限制是否大于0
-		if limit.RPMLimit <= 0 {
-			return true
+		rateLimitGroupWeights = make(map[string]int)
+		for _, pair := range strings.Split(constant.RateLimitGroupWeights, ",") {
+			group, weight, found := strings.Cut(pair, ":")
+			if !found {
+				continue
+			}
+			if w, err := strconv.Atoi(strings.TrimSpace(weight)); err == nil && w > 0 {
+				rateLimitGroupWeights[strings.TrimSpace(group)] = w
+			}
 		}
+	})
+	group := c.GetString("group")
+	priority := model.WaitPriorityInteractive
+	if relaycommon.IsBatchRequest(c.Request.Context()) || rateLimitBulkGroups[group] ||
+		strings.EqualFold(c.GetHeader(common.PriorityKey), "bulk") {
+		priority = model.WaitPriorityBulk
+	}
+	weight := rateLimitGroupWeights[group]
+	if weight <= 0 {
+		weight = 1
+	}
+	return priority, weight
+}
 
-		// 使用Lua脚本进行原子性限流检查
-		ctx := context.Background()
-		rdb := common.RDB
-		key := "rateLimit:" + mark
-
-		// Lua脚本：原子性地检查和处理限流
-		luaScript := `
-			local key = KEYS[1]
-			local maxRequestNum = tonumber(ARGV[1])
-			local duration = tonumber(ARGV[2])
-			local currentTime = tonumber(ARGV[3])
-			local expirationDuration = tonumber(ARGV[4])
-			
-			-- 获取当前列表长度
-			local listLength = redis.call('LLEN', key)
-			
-			if listLength < maxRequestNum then
-				-- 未达到限制，添加当前时间戳
-				redis.call('LPUSH', key, currentTime)
-				redis.call('EXPIRE', key, expirationDuration)
-				return {1, 0} -- {allowed, waitTime}
-			else
-				-- 已达到限制，检查最旧的时间戳
-				local oldestTimeStr = redis.call('LINDEX', key, -1)
-				if oldestTimeStr == false then
-					-- 列表为空，直接添加
-					redis.call('LPUSH', key, currentTime)
-					redis.call('EXPIRE', key, expirationDuration)
-					return {1, 0}
-				end
-				
-				-- 解析最旧时间戳
-				local oldestTime = tonumber(oldestTimeStr)
-				if oldestTime == nil then
-					-- 时间戳格式错误，清理列表并添加新记录
-					redis.call('DEL', key)
-					redis.call('LPUSH', key, currentTime)
-					redis.call('EXPIRE', key, expirationDuration)
-					return {1, 0}
-				end
-				
-				-- 计算时间差
-				local timeDiff = currentTime - oldestTime
-				
-				if timeDiff < duration then
-					-- 仍在时间窗口内，被限流
-					redis.call('EXPIRE', key, expirationDuration)
-					return {0, duration - timeDiff} -- {allowed, waitTime}
-				else
-					-- 时间窗口已过，移除最旧记录，添加新记录
-					redis.call('LPUSH', key, currentTime)
-					redis.call('LTRIM', key, 0, maxRequestNum - 1)
-					redis.call('EXPIRE', key, expirationDuration)
-					return {1, 0} -- {allowed, waitTime}
-				end
-			end
-		`
-
-		currentTime := time.Now().Unix()
-		result, err := rdb.Eval(ctx, luaScript, []string{key},
-			limit.RPMLimit, 60, currentTime, common.RateLimitKeyExpirationDuration.Seconds()).Result()
+// rpmLimit 对请求生效的 RPM 限流，mark 为限流额度和等待队列的键
+type rpmLimit struct {
+	gcra         common.GCRALimit
+	mark         string
+	waitDuration time.Duration
+}
 
+// getRPMLimit 获取对请求生效的 RPM 限流：用户+token名+模型名的限流配置，以及中心控制库中启用的用户限速
+// （自适应限速调整的当前限速）。两者都存在时使用较低的一个，用户限速较低时同一用户在该分组、模型下的所有令牌共用额度。
+// 没有生效的限流时返回 false
+func getRPMLimit(c *gin.Context, userId int, tokenName, modelName string) (rpmLimit, bool) {
+	group := c.GetString("group")
+	current := model.GetCurrentUserRateLimit(c.GetString(constant.ContextKeyUserName), group, modelName)
+	limit, err := model.GetUserTokenModelLimitWithCache(userId, tokenName, modelName)
+	if err == nil && limit.RPMLimitEnabled && limit.RPMLimit > 0 && (current <= 0 || limit.RPMLimit <= current) {
+		return rpmLimit{
+			gcra:         common.GCRALimit{Rate: limit.RPMLimit, Period: time.Minute, Burst: limit.RPMBurst},
+			mark:         fmt.Sprintf("UTM:%d:%s:%s", userId, tokenName, modelName),
+			waitDuration: time.Duration(limit.WaitDurationSeconds) * time.Second,
+		}, true
+	}
+	if current <= 0 {
+		return rpmLimit{}, false
+	}
+	result := rpmLimit{
+		gcra: common.GCRALimit{Rate: current, Period: time.Minute},
+		mark: fmt.Sprintf("UGM:%d:%s:%s", userId, group, modelName),
+	}
+	if err == nil {
+		result.waitDuration = time.Duration(limit.WaitDurationSeconds) * time.Second
+	}
+	return result, true
+}
+
+// userTokenModelRateLimiterWithWait 带等待机制的用户+token名+模型名限流器。
+// 被限流的请求进入等待队列，只有队首的请求按 GCRA 算出的时间等待后重试，
+// 超过配置的等待时间仍未获得额度时返回限流错误
+func userTokenModelRateLimiterWithWait(c *gin.Context, userId int, tokenName, modelName string) {
+	limit, ok := getRPMLimit(c, userId, tokenName, modelName)
+	if !ok {
+		return
+	}
+	mark := limit.mark
+
+	// 没有排队的请求时直接尝试，有排队的请求时先排队，避免插队
+	queued, err := model.WaitQueueLength(mark)
+	if err != nil || queued == 0 {
+		result, err := allowRequest(mark, limit.gcra)
 		if err != nil {
-			fmt.Printf("Lua script error: %v\n", err)
+			common.LogError(c, "rate limit check failed: "+err.Error())
 			c.Status(http.StatusInternalServerError)
 			c.Abort()
-			return false
+			return
 		}
-
-		// 解析结果
-		resultSlice, ok := result.([]interface{})
-		if !ok || len(resultSlice) != 2 {
-			fmt.Printf("Invalid Lua script result: %v\n", result)
-			c.Status(http.StatusInternalServerError)
-			c.Abort()
-			return false
+		if result.Allowed {
+			return
 		}
-
-		allowed, ok1 := resultSlice[0].(int64)
-		if !ok1 {
-			fmt.Printf("Invalid Lua script result types: %v\n", resultSlice)
-			c.Status(http.StatusInternalServerError)
-			c.Abort()
-			return false
+		if limit.waitDuration <= 0 || result.RetryAfter > limit.waitDuration {
+			setRetryAfter(c, result.RetryAfter)
+			returnRateLimitError(c, "Rate limit exceeded and failed to acquire RPM lock within timeout period")
+			return
 		}
-
-		return allowed == 1
-	}
-
-	// 如果立即成功处理，直接返回
-	if tryProcessRequest() {
-		return
 	}
 
-	// 被限流，开始等待和重试
+	priority, weight := rateLimitWaitClass(c)
+	priorityLabel := rateLimitPriorityLabels[priority]
 	startTime := time.Now()
-
-	// 获取等待时间配置
-	limit, err := model.GetUserTokenModelLimitWithCache(userId, tokenName, modelName)
+	deadline := startTime.Add(limit.waitDuration)
+	ticket, err := model.JoinWaitQueue(mark, c.GetInt("token_id"), weight, priority, deadline)
 	if err != nil {
-		// 如果无法获取配置，直接返回限流错误
-		c.Status(http.StatusTooManyRequests)
+		common.LogError(c, "join rate limit queue failed: "+err.Error())
+		c.Status(http.StatusInternalServerError)
 		c.Abort()
 		return
 	}
-
-	waitDuration := time.Duration(limit.WaitDurationSeconds) * time.Second
-
+	metrics.AddRateLimitQueueDepth(priorityLabel, 1)
+	result := "timeout"
+	defer func() {
+		metrics.AddRateLimitQueueDepth(priorityLabel, -1)
+		metrics.ObserveRateLimitQueueWait(priorityLabel, result, time.Since(startTime).Seconds())
+		ticket.Leave(result == "served")
+	}()
+
+	retryAfter := time.Duration(0)
 	for {
-		// 检查是否超过等待时间
-		if time.Since(startTime) > waitDuration {
-			// 返回抢锁超时错误
-			returnRateLimitError(c, "Rate limit exceeded and failed to acquire RPM lock within timeout period")
-			return
+		wait := rateLimitQueuePollInterval
+		head, ok, err := ticket.IsHead()
+		if err != nil {
+			common.LogError(c, "check rate limit queue failed: "+err.Error())
 		}
-
-		// 全局随机数生成器
-		var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
-		// 随机等待时间：1-60秒之间，避免雷群效应
-		waitSeconds := rng.Intn(60) + 1
-		time.Sleep(time.Duration(waitSeconds) * time.Second)
-
-		// 重新尝试处理请求（会重新获取最新的限流配置）
-		if tryProcessRequest() {
-			return // 成功处理
+		if !ok {
+			break
 		}
-	}
-}
-
-func rateLimitFactory(maxRequestNum int, duration int64, mark string) func(c *gin.Context) {
-	if common.RedisEnabled {
-		return func(c *gin.Context) {
-			redisRateLimiter(c, maxRequestNum, duration, mark)
+		if head {
+			// 每次重试都重新获取最新的限流配置，生效的限流变化时按新的额度重试，仍在原队列中排队
+			limit, ok = getRPMLimit(c, userId, tokenName, modelName)
+			if !ok {
+				result = "served"
+				return
+			}
+			allowed, err := allowRequest(limit.mark, limit.gcra)
+			if err != nil {
+				common.LogError(c, "rate limit check failed: "+err.Error())
+				result = "error"
+				c.Status(http.StatusInternalServerError)
+				c.Abort()
+				return
+			}
+			if allowed.Allowed {
+				result = "served"
+				return
+			}
+			retryAfter = allowed.RetryAfter
+			if time.Now().Add(retryAfter).After(deadline) {
+				break
+			}
+			wait = retryAfter
 		}
-	} else {
-		// It's safe to call multi times.
-		inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
-		return func(c *gin.Context) {
-			memoryRateLimiter(c, maxRequestNum, duration, mark)
+		if remaining := time.Until(deadline); remaining <= 0 {
+			break
+		} else if wait > remaining {
+			wait = remaining
 		}
-	}
-}
-
-// rateLimitFactoryWithWait 带等待机制的限流工厂函数（仅支持Redis）
-func rateLimitFactoryWithWait(userId int, tokenName, modelName string) func(c *gin.Context) {
-	if !common.RedisEnabled {
-		// 如果Redis未启用，直接返回错误
-		return func(c *gin.Context) {
-			c.Status(http.StatusInternalServerError)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-model.WaitQueueChanged():
+			timer.Stop()
+		case <-c.Request.Context().Done():
+			timer.Stop()
+			result = "canceled"
 			c.Abort()
+			return
 		}
 	}
+	// 等待时间内无法获得额度，返回限流错误
+	if retryAfter > 0 {
+		setRetryAfter(c, retryAfter)
+	}
+	returnRateLimitError(c, "Rate limit exceeded and failed to acquire RPM lock within timeout period")
+}
 
+func rateLimitFactory(maxRequestNum int, duration int64, burst int, mark string) func(c *gin.Context) {
+	limit := common.GCRALimit{
+		Rate:   maxRequestNum,
+		Period: time.Duration(duration) * time.Second,
+		Burst:  burst,
+	}
 	return func(c *gin.Context) {
-		redisRateLimiterWithWait(c, userId, tokenName, modelName)
+		gcraRateLimiter(c, limit, mark)
 	}
 }
 
 func GlobalWebRateLimit() func(c *gin.Context) {
 	if common.GlobalWebRateLimitEnable {
-		return rateLimitFactory(common.GlobalWebRateLimitNum, common.GlobalWebRateLimitDuration, "GW")
+		return rateLimitFactory(common.GlobalWebRateLimitNum, common.GlobalWebRateLimitDuration, common.GlobalWebRateLimitBurst, "GW")
 	}
 	return defNext
 }
 
 func GlobalAPIRateLimit() func(c *gin.Context) {
 	if common.GlobalApiRateLimitEnable {
-		return rateLimitFactory(common.GlobalApiRateLimitNum, common.GlobalApiRateLimitDuration, "GA")
+		return rateLimitFactory(common.GlobalApiRateLimitNum, common.GlobalApiRateLimitDuration, common.GlobalApiRateLimitBurst, "GA")
 	}
 	return defNext
 }
 
 func CriticalRateLimit() func(c *gin.Context) {
-	return rateLimitFactory(common.CriticalRateLimitNum, common.CriticalRateLimitDuration, "CT")
+	return rateLimitFactory(common.CriticalRateLimitNum, common.CriticalRateLimitDuration, 0, "CT")
 }
 
 func DownloadRateLimit() func(c *gin.Context) {
-	return rateLimitFactory(common.DownloadRateLimitNum, common.DownloadRateLimitDuration, "DW")
+	return rateLimitFactory(common.DownloadRateLimitNum, common.DownloadRateLimitDuration, 0, "DW")
 }
 
 func UploadRateLimit() func(c *gin.Context) {
-	return rateLimitFactory(common.UploadRateLimitNum, common.UploadRateLimitDuration, "UP")
+	return rateLimitFactory(common.UploadRateLimitNum, common.UploadRateLimitDuration, 0, "UP")
 }
 
 // UserTokenModelRateLimit 基于用户+token名+模型名的限流中间件
@@ -319,30 +318,53 @@ func UserTokenModelRateLimit() func(c *gin.Context) {
 			return
 		}
 
-		// 从数据库获取限流配置
-		limit, err := model.GetUserTokenModelLimitWithCache(userId, tokenName, modelName)
-		if err != nil {
-			// 如果查询失败或没有配置记录，默认不需要限流
+		// 使用带等待机制的限流器，没有生效的限流配置时直接放行，每次重试都会重新获取最新的限流配置
+		userTokenModelRateLimiterWithWait(c, userId, tokenName, modelName)
+	}
+}
+
+// TokenRateLimit 基于用户、令牌和模型的 TPM/TPD 限流中间件，请求前按预估的 token 数预占，
+// 响应后在计费时按实际用量修正，请求失败时退回预占的 token 数
+func TokenRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userId := c.GetInt("id")
+		tokenName := c.GetString("token_name")
+		modelName := c.GetString("original_model")
+		if !common.RedisEnabled || userId == 0 || modelName == "" {
 			c.Next()
 			return
 		}
 
-		// 检查是否启用限流（使用limit表中的RPMLimitEnabled字段）
-		if !limit.RPMLimitEnabled {
-			// 状态为false未开启，默认不需要限流
+		limits, err := model.GetTokenRateLimitsWithCache(userId, tokenName, modelName)
+		if err != nil || len(limits) == 0 {
 			c.Next()
 			return
 		}
 
-		// 检查RPM限制是否大于0（使用limit表中的RPMLimit字段）
-		if limit.RPMLimit <= 0 {
-			// RPMLimit为0或负数，不需要限流
+		estimate := service.EstimateRequestTokens(c, modelName)
+		reservation, status, err := service.ReserveTokenRateLimit(limits, estimate)
+		if err != nil {
+			// Redis 出错时不限流，避免影响正常请求
+			common.LogError(c, "token rate limit check failed: "+err.Error())
+			c.Next()
+			return
+		}
+		if status != nil {
+			status.SetHeaders(c)
+		}
+		if reservation == nil {
+			if status != nil {
+				abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf(
+					"Rate limit reached for %s on %s: Limit %d, Used %d, Requested %d. Please try again in %s.",
+					modelName, status.Name, status.Limit, status.Used, estimate, status.Reset))
+				return
+			}
 			c.Next()
 			return
 		}
 
-		// 使用带等待机制的限流工厂，每次重试都会重新获取最新的限流配置
-		rateLimitFunc := rateLimitFactoryWithWait(userId, tokenName, modelName)
-		rateLimitFunc(c)
+		c.Set(constant.ContextKeyTokenRateLimit, reservation)
+		defer reservation.Release()
+		c.Next()
 	}
 }
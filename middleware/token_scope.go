@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/constant"
+	"one-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// tokenScopeDenied 检查令牌是否有访问当前接口的范围，没有时记录日志并返回所需的范围；
+// 设置了范围的令牌不能访问未归类的接口，此时返回的范围为空字符串
+func tokenScopeDenied(c *gin.Context, token *model.Token) (string, bool) {
+	scope, known := constant.Path2TokenScope(c.Request.URL.Path)
+	if token.HasScope(scope, known) {
+		return "", false
+	}
+	logCtx := c.Copy()
+	userId, tokenId, tokenName := token.UserId, token.Id, token.Name
+	gopool.Go(func() {
+		model.RecordTokenScopeDeniedLog(logCtx, userId, tokenId, tokenName, scope)
+	})
+	return scope, true
+}
+
+func tokenScopeDeniedMessage(scope string) string {
+	if scope == "" {
+		return "该令牌设置了接口范围，无权访问此接口"
+	}
+	return fmt.Sprintf("该令牌无权访问此接口，需要 %s 范围", scope)
+}
+
+// abortIfTokenScopeDenied 在选择渠道之前拒绝超出令牌范围的请求
+func abortIfTokenScopeDenied(c *gin.Context, token *model.Token) bool {
+	scope, denied := tokenScopeDenied(c, token)
+	if denied {
+		abortWithOpenAiMessage(c, http.StatusForbidden, tokenScopeDeniedMessage(scope))
+	}
+	return denied
+}
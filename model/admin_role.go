@@ -0,0 +1,124 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"strings"
+)
+
+// AdminRole 超级管理员定义的管理员角色，分配了角色的管理员只拥有角色中的权限
+type AdminRole struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255);default:''"`
+	// Permissions 逗号分隔的权限列表，见 constant.Permissions
+	Permissions string `json:"permissions" gorm:"type:text"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+func (role *AdminRole) GetPermissions() []string {
+	if role.Permissions == "" {
+		return []string{}
+	}
+	return strings.Split(role.Permissions, ",")
+}
+
+func NormalizePermissions(permissions string) (string, error) {
+	normalized := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, permission := range strings.Split(permissions, ",") {
+		permission = strings.TrimSpace(permission)
+		if permission == "" || seen[permission] {
+			continue
+		}
+		if !constant.IsValidPermission(permission) {
+			return "", fmt.Errorf("无效的权限：%s", permission)
+		}
+		seen[permission] = true
+		normalized = append(normalized, permission)
+	}
+	return strings.Join(normalized, ","), nil
+}
+
+func GetAllAdminRoles() (roles []*AdminRole, err error) {
+	err = DB.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+func GetAdminRoleById(id int) (*AdminRole, error) {
+	var role AdminRole
+	if err := DB.First(&role, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (role *AdminRole) Insert() error {
+	role.CreatedTime = common.GetTimestamp()
+	return DB.Create(role).Error
+}
+
+func (role *AdminRole) Update() error {
+	return DB.Model(role).Select("name", "description", "permissions").Updates(role).Error
+}
+
+// DeleteAdminRoleById 角色仍分配给用户时不允许删除，否则这些管理员会变回拥有全部权限
+func DeleteAdminRoleById(id int) error {
+	var count int64
+	if err := DB.Model(&User{}).Where("admin_role_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("该角色仍分配给 %d 个用户，请先取消分配", count)
+	}
+	return DB.Delete(&AdminRole{}, "id = ?", id).Error
+}
+
+// UpdateUserAdminRole 为用户分配角色，roleId 为 0 时取消分配
+func UpdateUserAdminRole(userId int, roleId int) error {
+	if roleId != 0 {
+		if _, err := GetAdminRoleById(roleId); err != nil {
+			return errors.New("角色不存在")
+		}
+	}
+	return DB.Model(&User{}).Where("id = ?", userId).Update("admin_role_id", roleId).Error
+}
+
+// GetUserPermissions 返回用户拥有的管理权限：
+// 超级管理员拥有全部权限；未分配角色的管理员拥有除 RootOnlyPermissions 外的全部权限；
+// 分配了角色的管理员只拥有角色中的权限；普通用户没有管理权限
+func GetUserPermissions(userId int, role int) (map[string]bool, error) {
+	permissions := make(map[string]bool)
+	if role < common.RoleAdminUser {
+		return permissions, nil
+	}
+	if role >= common.RoleRootUser {
+		for _, permission := range constant.Permissions {
+			permissions[permission] = true
+		}
+		return permissions, nil
+	}
+	var roleId int
+	if err := DB.Model(&User{}).Where("id = ?", userId).Select("admin_role_id").Scan(&roleId).Error; err != nil {
+		return nil, err
+	}
+	if roleId == 0 {
+		for _, permission := range constant.Permissions {
+			permissions[permission] = true
+		}
+		for _, permission := range constant.RootOnlyPermissions {
+			delete(permissions, permission)
+		}
+		return permissions, nil
+	}
+	adminRole, err := GetAdminRoleById(roleId)
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range adminRole.GetPermissions() {
+		permissions[permission] = true
+	}
+	return permissions, nil
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"one-api/common"
+	"one-api/constant"
+	"testing"
+)
+
+func TestGetUserPermissions(t *testing.T) {
+	setupTestDB(t, &User{}, &AdminRole{})
+	role := &AdminRole{Name: "auditor", Permissions: constant.PermissionAuditRead + "," + constant.PermissionBillingRead}
+	if err := role.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	emptyRole := &AdminRole{Name: "empty"}
+	if err := emptyRole.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	users := []*User{
+		{Id: 1, Username: "root", AffCode: "1", Role: common.RoleRootUser, AdminRoleId: role.Id},
+		{Id: 2, Username: "admin", AffCode: "2", Role: common.RoleAdminUser},
+		{Id: 3, Username: "auditor", AffCode: "3", Role: common.RoleAdminUser, AdminRoleId: role.Id},
+		{Id: 4, Username: "empty", AffCode: "4", Role: common.RoleAdminUser, AdminRoleId: emptyRole.Id},
+		{Id: 5, Username: "common", AffCode: "5", Role: common.RoleCommonUser, AdminRoleId: role.Id},
+		{Id: 6, Username: "orphan", AffCode: "6", Role: common.RoleAdminUser, AdminRoleId: 999},
+	}
+	for _, user := range users {
+		if err := DB.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	allPermissions := constant.Permissions
+	adminPermissions := make([]string, 0)
+	for _, permission := range constant.Permissions {
+		if permission != constant.PermissionOptionRead && permission != constant.PermissionOptionWrite {
+			adminPermissions = append(adminPermissions, permission)
+		}
+	}
+	tests := []struct {
+		name    string
+		userId  int
+		role    int
+		want    []string
+		wantErr bool
+	}{
+		{"root has all permissions", 1, common.RoleRootUser, allPermissions, false},
+		{"admin without role has all but root only permissions", 2, common.RoleAdminUser, adminPermissions, false},
+		{"admin with role has the role's permissions", 3, common.RoleAdminUser, []string{constant.PermissionAuditRead, constant.PermissionBillingRead}, false},
+		{"admin with empty role has no permissions", 4, common.RoleAdminUser, nil, false},
+		{"common user has no permissions", 5, common.RoleCommonUser, nil, false},
+		{"missing role is an error", 6, common.RoleAdminUser, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetUserPermissions(tt.userId, tt.role)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("permissions = %v, want %v", got, tt.want)
+			}
+			for _, permission := range tt.want {
+				if !got[permission] {
+					t.Fatalf("permissions = %v, missing %s", got, permission)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizePermissions(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{" audit.read , billing.read,audit.read,", "audit.read,billing.read", false},
+		{"audit.read,unknown", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePermissions(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizePermissions(%q) = %q, %v, want %q, wantErr %t", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
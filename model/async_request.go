@@ -0,0 +1,94 @@
+package model
+
+import (
+	"errors"
+)
+
+const (
+	AsyncRequestStatusQueued     = "queued"
+	AsyncRequestStatusInProgress = "in_progress"
+	AsyncRequestStatusCompleted  = "completed"
+	AsyncRequestStatusFailed     = "failed"
+)
+
+// AsyncRequest 以异步模式提交的请求，请求体和响应体保存在 service.FileStorage 中
+type AsyncRequest struct {
+	Id          string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TokenId     int    `json:"token_id" gorm:"index"`
+	ClientIp    string `json:"-" gorm:"type:varchar(64)"`
+	Method      string `json:"method" gorm:"type:varchar(16)"`
+	Path        string `json:"path" gorm:"type:varchar(1024)"`
+	Header      string `json:"-" gorm:"type:text"`
+	CallbackUrl string `json:"callback_url" gorm:"type:varchar(1024)"`
+	Status      string `json:"status" gorm:"type:varchar(20);index"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type" gorm:"type:varchar(128)"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+	StartedAt   int64  `json:"started_at" gorm:"bigint"`
+	CompletedAt int64  `json:"completed_at" gorm:"bigint;index"`
+}
+
+func (request *AsyncRequest) Insert() error {
+	return DB.Create(request).Error
+}
+
+func (request *AsyncRequest) Delete() error {
+	return DB.Delete(request).Error
+}
+
+// Complete 保存执行结果，只在请求仍处于执行中时生效
+func (request *AsyncRequest) Complete(status string, statusCode int, contentType string, completedAt int64) error {
+	return DB.Model(&AsyncRequest{}).Where("id = ? AND status = ?", request.Id, AsyncRequestStatusInProgress).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"status_code":  statusCode,
+			"content_type": contentType,
+			"completed_at": completedAt,
+		}).Error
+}
+
+// ClaimAsyncRequest 把排队中的请求，或开始时间早于 startedBefore 的执行中请求标记为由当前节点执行，
+// 返回是否标记成功，多个节点同时标记时只有一个会成功
+func ClaimAsyncRequest(id string, startedAt int64, startedBefore int64) (bool, error) {
+	result := DB.Model(&AsyncRequest{}).
+		Where("id = ? AND (status = ? OR (status = ? AND started_at < ?))", id, AsyncRequestStatusQueued, AsyncRequestStatusInProgress, startedBefore).
+		Updates(map[string]interface{}{"status": AsyncRequestStatusInProgress, "started_at": startedAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetAsyncRequestById 按 id 查询异步请求，userId 为 0 时不校验归属
+func GetAsyncRequestById(id string, userId int, tokenId int) (*AsyncRequest, error) {
+	if id == "" {
+		return nil, errors.New("async request id is empty")
+	}
+	var request AsyncRequest
+	tx := DB.Where("id = ?", id)
+	if userId != 0 {
+		tx = tx.Where("user_id = ? AND token_id = ?", userId, tokenId)
+	}
+	if err := tx.First(&request).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// GetPendingAsyncRequests 查询提交时间早于 createdBefore 仍在排队的请求，以及开始时间早于 startedBefore 仍未完成的请求
+func GetPendingAsyncRequests(createdBefore int64, startedBefore int64, limit int) ([]*AsyncRequest, error) {
+	var requests []*AsyncRequest
+	err := DB.Where("(status = ? AND created_at < ?) OR (status = ? AND started_at < ?)",
+		AsyncRequestStatusQueued, createdBefore, AsyncRequestStatusInProgress, startedBefore).
+		Order("created_at asc").Limit(limit).Find(&requests).Error
+	return requests, err
+}
+
+// GetExpiredAsyncRequests 查询完成时间早于 completedBefore 的请求
+func GetExpiredAsyncRequests(completedBefore int64, limit int) ([]*AsyncRequest, error) {
+	var requests []*AsyncRequest
+	err := DB.Where("status IN ? AND completed_at < ?", []string{AsyncRequestStatusCompleted, AsyncRequestStatusFailed}, completedBefore).
+		Limit(limit).Find(&requests).Error
+	return requests, err
+}
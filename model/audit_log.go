@@ -0,0 +1,158 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"reflect"
+	"strings"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AuditTargetOption       = "option"
+	AuditTargetChannel      = "channel"
+	AuditTargetTag          = "tag"
+	AuditTargetUser         = "user"
+	AuditTargetRedemption   = "redemption"
+	AuditTargetOrganization = "organization"
+	AuditTargetAdminRole    = "admin_role"
+	AuditTargetSpendBudget  = "spend_budget"
+)
+
+const auditRedacted = "***"
+
+// AuditLog 管理员修改配置、渠道、用户和额度的审计记录
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	ActorId    int    `json:"actor_id" gorm:"index"`
+	ActorName  string `json:"actor_name" gorm:"type:varchar(64);default:''"`
+	ActorRole  int    `json:"actor_role" gorm:"default:0"`
+	Action     string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target,priority:1"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(128);index:idx_audit_target,priority:2"`
+	// Diff 修改前后的字段，格式为 {"字段": {"before": 旧值, "after": 新值}}，敏感字段以 *** 代替
+	Diff      string `json:"diff" gorm:"type:text"`
+	Ip        string `json:"ip" gorm:"type:varchar(64);default:''"`
+	RequestId string `json:"request_id" gorm:"type:varchar(64);default:''"`
+}
+
+type AuditLogFilter struct {
+	ActorId        int
+	Action         string
+	TargetType     string
+	TargetId       string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+// isAuditSecretField 配置项沿用 isSecretOption 的规则，结构体字段按 json 中的蛇形字段名判断
+func isAuditSecretField(name string) bool {
+	if isSecretOption(name) {
+		return true
+	}
+	lower := strings.ToLower(name)
+	return lower == "key" || strings.HasSuffix(lower, "password") || strings.HasSuffix(lower, "_key") ||
+		strings.HasSuffix(lower, "_secret") || strings.HasSuffix(lower, "_token")
+}
+
+func auditFields(v any) map[string]any {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return map[string]any{}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]any{}
+	}
+	fields := make(map[string]any)
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return map[string]any{"value": string(data)}
+	}
+	return fields
+}
+
+// NewAuditDiff 比较修改前后的对象并返回变化的字段，创建时 before 为 nil，删除时 after 为 nil
+func NewAuditDiff(before any, after any) string {
+	beforeFields, afterFields := auditFields(before), auditFields(after)
+	diff := make(map[string]map[string]any)
+	for _, fields := range []map[string]any{beforeFields, afterFields} {
+		for name := range fields {
+			if _, ok := diff[name]; ok {
+				continue
+			}
+			oldValue, newValue := beforeFields[name], afterFields[name]
+			if reflect.DeepEqual(oldValue, newValue) {
+				continue
+			}
+			if isAuditSecretField(name) {
+				if oldValue != nil {
+					oldValue = auditRedacted
+				}
+				if newValue != nil {
+					newValue = auditRedacted
+				}
+			}
+			diff[name] = map[string]any{"before": oldValue, "after": newValue}
+		}
+	}
+	return common.MapToJsonStr(map[string]any{"fields": diff})
+}
+
+// RecordAuditLog 记录当前管理员的操作，targetId 可以是数字 id、配置项名或标签名
+func RecordAuditLog(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	auditLog := &AuditLog{
+		CreatedAt:  common.GetTimestamp(),
+		ActorId:    c.GetInt("id"),
+		ActorName:  c.GetString(constant.ContextKeyUserName),
+		ActorRole:  c.GetInt("role"),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprint(targetId),
+		Diff:       NewAuditDiff(before, after),
+		Ip:         c.ClientIP(),
+		RequestId:  c.GetString(common.RequestIdKey),
+	}
+	gopool.Go(func() {
+		if err := LOG_DB.Create(auditLog).Error; err != nil {
+			common.SysError("failed to record audit log: " + err.Error())
+		}
+		if constant.AuditLogJSONLEnabled && common.Writer != nil {
+			common.Writer.Write(struct {
+				LogType string `json:"log_type"`
+				*AuditLog
+			}{LogType: "audit", AuditLog: auditLog})
+		}
+	})
+}
+
+func GetAuditLogs(filter AuditLogFilter, startIdx int, num int) (logs []*AuditLog, total int64, err error) {
+	tx := LOG_DB.Model(&AuditLog{})
+	if filter.ActorId != 0 {
+		tx = tx.Where("actor_id = ?", filter.ActorId)
+	}
+	if filter.Action != "" {
+		// 按前缀匹配，action=channel 可以查询所有渠道操作
+		tx = tx.Where("action LIKE ?", filter.Action+"%")
+	}
+	if filter.TargetType != "" {
+		tx = tx.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		tx = tx.Where("target_id = ?", filter.TargetId)
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
@@ -0,0 +1,153 @@
+package model
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// Batch /v1/batches 创建的批处理任务，由主节点在后台逐行执行输入文件中的请求
+type Batch struct {
+	Id               string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	ClientIp         string `json:"-" gorm:"type:varchar(64)"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status           string `json:"status" gorm:"type:varchar(20);index"`
+	Errors           string `json:"errors" gorm:"type:text"`
+	Metadata         string `json:"metadata" gorm:"type:text"`
+	RequestTotal     int    `json:"request_total"`
+	RequestCompleted int    `json:"request_completed"`
+	RequestFailed    int    `json:"request_failed"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+// BatchRequest 批处理任务中已执行完成的一行请求，任务结束生成输出文件后删除，
+// 服务重启后据此跳过已执行的行
+type BatchRequest struct {
+	Id        int    `json:"id"`
+	BatchId   string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex:idx_batch_line"`
+	LineIndex int    `json:"line_index" gorm:"uniqueIndex:idx_batch_line"`
+	Failed    bool   `json:"failed"`
+	Result    string `json:"result" gorm:"type:text"`
+}
+
+func (batch *Batch) Insert() error {
+	return DB.Create(batch).Error
+}
+
+// Update 更新任务的部分字段，只在当前状态仍为 fromStatus 时生效，返回是否更新成功
+func (batch *Batch) Update(fromStatus string, fields map[string]interface{}) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? AND status = ?", batch.Id, fromStatus).Updates(fields)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetBatchById 按 id 查询批处理任务，userId 为 0 时不校验归属
+func GetBatchById(id string, userId int, tokenId int) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("batch id is empty")
+	}
+	var batch Batch
+	tx := DB.Where("id = ?", id)
+	if userId != 0 {
+		tx = tx.Where("user_id = ? AND token_id = ?", userId, tokenId)
+	}
+	if err := tx.First(&batch).Error; err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetBatches 按创建时间倒序列出令牌的批处理任务，after 为上一页最后一个任务的 id
+func GetBatches(userId int, tokenId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	tx := DB.Where("user_id = ? AND token_id = ?", userId, tokenId)
+	if after != "" {
+		var cursor Batch
+		err := DB.Select("created_at").Where("id = ? AND user_id = ? AND token_id = ?", after, userId, tokenId).First(&cursor).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			tx = tx.Where("(created_at < ? OR (created_at = ? AND id < ?))", cursor.CreatedAt, cursor.CreatedAt, after)
+		}
+	}
+	err := tx.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetUnfinishedBatches 查询尚未结束的批处理任务，包括服务重启前正在执行的任务
+func GetUnfinishedBatches() ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status IN ?", []string{BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).
+		Order("created_at asc").Find(&batches).Error
+	return batches, err
+}
+
+// CancelBatch 把校验中或执行中的任务标记为取消中，返回是否标记成功
+func CancelBatch(id string, cancellingAt int64) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? AND status IN ?", id, []string{BatchStatusValidating, BatchStatusInProgress}).
+		Updates(map[string]interface{}{"status": BatchStatusCancelling, "cancelling_at": cancellingAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// SaveBatchRequest 保存一行请求的结果，并同步更新任务的请求计数
+func SaveBatchRequest(request *BatchRequest) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(request).Error; err != nil {
+			return err
+		}
+		column := "request_completed"
+		if request.Failed {
+			column = "request_failed"
+		}
+		return tx.Model(&Batch{}).Where("id = ?", request.BatchId).Update(column, gorm.Expr(column+" + ?", 1)).Error
+	})
+}
+
+// GetBatchRequestLineIndexes 返回任务中已执行完成的行号
+func GetBatchRequestLineIndexes(batchId string) ([]int, error) {
+	var lineIndexes []int
+	err := DB.Model(&BatchRequest{}).Where("batch_id = ?", batchId).Pluck("line_index", &lineIndexes).Error
+	return lineIndexes, err
+}
+
+// GetBatchRequests 按行号顺序分页读取成功或失败的结果，afterLine 为上一页最后一行的行号
+func GetBatchRequests(batchId string, failed bool, afterLine int, limit int) ([]*BatchRequest, error) {
+	var requests []*BatchRequest
+	err := DB.Where("batch_id = ? AND failed = ? AND line_index > ?", batchId, failed, afterLine).Order("line_index asc").Limit(limit).Find(&requests).Error
+	return requests, err
+}
+
+func DeleteBatchRequests(batchId string) error {
+	return DB.Where("batch_id = ?", batchId).Delete(&BatchRequest{}).Error
+}
@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"math/rand"
 	"one-api/common"
+	"one-api/setting"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
+// channelSmoothingFactor 按权重选择渠道时的平滑系数，避免低权重渠道完全没有流量
+const channelSmoothingFactor = 10
+
 var group2model2channels map[string]map[string][]*Channel
 var channelsIDM map[int]*Channel
 var channelSyncLock sync.RWMutex
@@ -61,6 +65,7 @@ func InitChannelCache() {
 	group2model2channels = newGroup2model2channels
 	channelsIDM = newChannelsIDM
 	channelSyncLock.Unlock()
+	initChannelKeyCache()
 	common.SysLog("channels synced from database")
 }
 
@@ -72,7 +77,10 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+// CacheGetRandomSatisfiedChannel 按优先级和权重选择渠道，并占用渠道的并发槽位，请求结束后需要释放返回的槽位；
+// 同一优先级的渠道并发全部已满时选择下一个优先级，所有渠道都已满时返回 ErrChannelsSaturated，
+// 所有渠道都在熔断中或探测名额已满时返回 ErrChannelBreakerOpen
+func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, *ChannelSlot, error) {
 	if strings.HasPrefix(model, "gpt-4-gizmo") {
 		model = "gpt-4-gizmo-*"
 	}
@@ -82,13 +90,21 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
-		return GetRandomSatisfiedChannel(group, model, retry)
+		channel, err := GetRandomSatisfiedChannel(group, model, retry)
+		if err != nil || channel == nil {
+			return channel, nil, err
+		}
+		slot, ok := TryAcquireChannelSlot(channel)
+		if !ok {
+			return nil, nil, ErrChannelsSaturated
+		}
+		return channel, slot, nil
 	}
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
 	channels := group2model2channels[group][model]
 	if len(channels) == 0 {
-		return nil, errors.New("channel not found")
+		return nil, nil, errors.New("channel not found")
 	}
 
 	if retry == common.RetryTimes {
@@ -99,11 +115,17 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 			}
 		}
 		if len(fallbackChannels) == 0 {
-			return nil, errors.New("channel not found, last fallback channel not exists")
+			return nil, nil, errors.New("channel not found, last fallback channel not exists")
 		}
 		channels = fallbackChannels
 	}
 
+	// 熔断中的渠道不参与选择，同一优先级的渠道全部熔断时会选择下一个优先级
+	channels = filterChannelsByBreaker(channels, model)
+	if len(channels) == 0 {
+		return nil, nil, ErrChannelBreakerOpen
+	}
+
 	uniquePriorities := make(map[int]bool)
 	for _, channel := range channels {
 		uniquePriorities[int(channel.GetPriority())] = true
@@ -117,35 +139,82 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 	if retry >= len(uniquePriorities) {
 		retry = len(uniquePriorities) - 1
 	}
-	targetPriority := int64(sortedUniquePriorities[retry])
 
-	// get the priority for the given retry number
-	var targetChannels []*Channel
-	for _, channel := range channels {
-		if channel.GetPriority() == targetPriority {
-			targetChannels = append(targetChannels, channel)
+	adaptive := setting.GetGroupChannelSelectStrategy(group) == setting.ChannelSelectStrategyAdaptive
+	saturated := false
+	for ; retry < len(sortedUniquePriorities); retry++ {
+		targetPriority := int64(sortedUniquePriorities[retry])
+
+		// get the priority for the given retry number
+		var targetChannels []*Channel
+		for _, channel := range channels {
+			if channel.GetPriority() == targetPriority {
+				targetChannels = append(targetChannels, channel)
+			}
+		}
+		channel, slot, prioritySaturated := pickChannel(targetChannels, model, adaptive)
+		if channel != nil {
+			return channel, slot, nil
 		}
+		saturated = saturated || prioritySaturated
+	}
+	// 有渠道并发已满时可以排队等待，否则是半开渠道的探测名额已满
+	if saturated {
+		return nil, nil, ErrChannelsSaturated
 	}
+	return nil, nil, ErrChannelBreakerOpen
+}
 
+// pickChannel 在同一优先级的渠道中选择并占用并发槽位，并发已满或探测名额已满的渠道从候选中移除后重新选择，
+// 未选中时 saturated 表示是否有渠道因为并发已满被跳过
+func pickChannel(channels []*Channel, model string, adaptive bool) (*Channel, *ChannelSlot, bool) {
+	saturated := false
+	for len(channels) > 0 {
+		var channel *Channel
+		if adaptive {
+			channel = pickAdaptiveChannel(channels, model)
+		} else {
+			channel = pickWeightedChannel(channels)
+		}
+		if slot, ok := TryAcquireChannelSlot(channel); ok {
+			// 冷却结束的渠道只放行有限的探测请求
+			if acquireChannelBreaker(channel.Id, model) {
+				return channel, slot, false
+			}
+			slot.Release()
+		} else {
+			saturated = true
+		}
+		remaining := make([]*Channel, 0, len(channels)-1)
+		for _, candidate := range channels {
+			if candidate != channel {
+				remaining = append(remaining, candidate)
+			}
+		}
+		channels = remaining
+	}
+	return nil, nil, saturated
+}
+
+func pickWeightedChannel(channels []*Channel) *Channel {
 	// 平滑系数
-	smoothingFactor := 10
+	smoothingFactor := channelSmoothingFactor
 	// Calculate the total weight of all channels up to endIdx
 	totalWeight := 0
-	for _, channel := range targetChannels {
+	for _, channel := range channels {
 		totalWeight += channel.GetWeight() + smoothingFactor
 	}
 	// Generate a random value in the range [0, totalWeight)
 	randomWeight := rand.Intn(totalWeight)
 
 	// Find a channel based on its weight
-	for _, channel := range targetChannels {
+	for _, channel := range channels {
 		randomWeight -= channel.GetWeight() + smoothingFactor
 		if randomWeight < 0 {
-			return channel, nil
+			return channel
 		}
 	}
-	// return null if no channel is not found
-	return nil, errors.New("channel not found")
+	return channels[len(channels)-1]
 }
 
 func CacheGetChannel(id int) (*Channel, error) {
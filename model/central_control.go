@@ -1,7 +1,13 @@
 package model
 
 import (
+	"one-api/common"
+	"one-api/constant"
+	"sync/atomic"
 	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
 )
 
 // UserRateLimitConfig 用户限速配置表
@@ -16,6 +22,8 @@ type UserRateLimitConfig struct {
 	SuggestedRateLimit int       `json:"suggested_rate_limit" gorm:"not null;default:60;comment:建议限速大小(rpm)"`
 	IsRateLimitEnabled bool      `json:"is_rate_limit_enabled" gorm:"not null;default:false;comment:是否启用限速(1:启用, 0:禁用)"`
 	CurrentRateLimit   int       `json:"current_rate_limit" gorm:"not null;default:60;comment:当前限速(rpm)"`
+	MinRateLimit       int       `json:"min_rate_limit" gorm:"not null;default:0;comment:自动调整的限速下限(rpm),0使用全局配置"`
+	MaxRateLimit       int       `json:"max_rate_limit" gorm:"not null;default:0;comment:自动调整的限速上限(rpm),0使用全局配置"`
 	CreatedAt          time.Time `json:"created_at" gorm:"autoCreateTime;comment:创建时间"`
 	UpdatedAt          time.Time `json:"updated_at" gorm:"autoUpdateTime;comment:更新时间"`
 }
@@ -25,12 +33,122 @@ func (UserRateLimitConfig) TableName() string {
 	return "user_rate_limit_config"
 }
 
+// UserRateLimitAdjustment 自适应限速的调整记录表
+type UserRateLimitAdjustment struct {
+	Id                int64     `json:"id" gorm:"primaryKey;autoIncrement;comment:主键ID"`
+	SiteName          string    `json:"site_name" gorm:"type:varchar(100);not null;index;comment:站点名"`
+	ConfigId          int64     `json:"config_id" gorm:"not null;index;comment:限速配置ID"`
+	Username          string    `json:"username" gorm:"type:varchar(100);not null;index;comment:用户名"`
+	GroupName         string    `json:"group_name" gorm:"type:varchar(100);not null;comment:分组名"`
+	ModelName         string    `json:"model_name" gorm:"type:varchar(100);not null;comment:模型名"`
+	PreviousRateLimit int       `json:"previous_rate_limit" gorm:"not null;comment:调整前限速(rpm)"`
+	NewRateLimit      int       `json:"new_rate_limit" gorm:"not null;comment:调整后限速(rpm)"`
+	Applied           bool      `json:"applied" gorm:"not null;default:false;comment:是否已应用到当前限速,试运行时为0"`
+	Reason            string    `json:"reason" gorm:"type:varchar(255);comment:调整原因"`
+	Requests          int64     `json:"requests" gorm:"not null;default:0;comment:统计窗口内用户的请求数"`
+	Throttled         int64     `json:"throttled" gorm:"not null;default:0;comment:统计窗口内分组模型的上游429次数"`
+	Saturated         int64     `json:"saturated" gorm:"not null;default:0;comment:统计窗口内分组模型的渠道并发已满次数"`
+	Share             float64   `json:"share" gorm:"not null;default:0;comment:统计窗口内用户请求占分组模型的比例"`
+	CreatedAt         time.Time `json:"created_at" gorm:"autoCreateTime;index;comment:创建时间"`
+}
+
+// TableName 指定表名
+func (UserRateLimitAdjustment) TableName() string {
+	return "user_rate_limit_adjustment"
+}
+
 // GetUserRateLimitConfig 获取用户限速配置
 func GetUserRateLimitConfig(username, groupName, modelName string) (*UserRateLimitConfig, error) {
 	var config UserRateLimitConfig
-	err := CENTRAL_DB.Where("site_name = ? AND username = ? AND group_name = ? AND model_name = ?", "newapi-prod-center", username, groupName, modelName).First(&config).Error
+	err := CENTRAL_DB.Where("site_name = ? AND username = ? AND group_name = ? AND model_name = ?", constant.CentralSiteName, username, groupName, modelName).First(&config).Error
 	if err != nil {
 		return nil, err
 	}
 	return &config, nil
 }
+
+// GetEnabledUserRateLimitConfigs 获取当前站点所有启用的用户限速配置
+func GetEnabledUserRateLimitConfigs() ([]*UserRateLimitConfig, error) {
+	var configs []*UserRateLimitConfig
+	err := CENTRAL_DB.Where("site_name = ? AND is_rate_limit_enabled = ?", constant.CentralSiteName, true).Find(&configs).Error
+	return configs, err
+}
+
+// ApplyUserRateLimitAdjustment 写入调整后的限速和调整记录，applied 为 false 时只修改建议限速
+func ApplyUserRateLimitAdjustment(config *UserRateLimitConfig, adjustment *UserRateLimitAdjustment) error {
+	return CENTRAL_DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"suggested_rate_limit": adjustment.NewRateLimit}
+		if adjustment.Applied {
+			updates["current_rate_limit"] = adjustment.NewRateLimit
+		}
+		if err := tx.Model(&UserRateLimitConfig{}).Where("id = ?", config.Id).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(adjustment).Error
+	})
+}
+
+// GetUserRateLimitAdjustments 分页获取当前站点的限速调整记录，username 为空时返回所有用户的记录
+func GetUserRateLimitAdjustments(username string, startIdx int, num int) (adjustments []*UserRateLimitAdjustment, total int64, err error) {
+	tx := CENTRAL_DB.Model(&UserRateLimitAdjustment{}).Where("site_name = ?", constant.CentralSiteName)
+	if username != "" {
+		tx = tx.Where("username = ?", username)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&adjustments).Error
+	return adjustments, total, err
+}
+
+// userRateLimitSnapshotTTL 启用的限速配置在内存中的缓存时间，自适应调整后最多延迟该时间生效
+const userRateLimitSnapshotTTL = 5 * time.Second
+
+type userRateLimitSnapshot struct {
+	limits   map[[3]string]int
+	loadedAt time.Time
+}
+
+var (
+	// currentUserRateLimits 保存 *userRateLimitSnapshot，请求只读取快照，不等待中心控制库
+	currentUserRateLimits   atomic.Value
+	userRateLimitsReloading atomic.Bool
+)
+
+// GetCurrentUserRateLimit 返回用户在分组、模型上启用的当前限速（rpm），没有启用的配置时返回 0。
+// 启用的配置由后台整体加载，快照过期时只触发一次异步加载，请求继续使用上一次的结果；首次加载完成前返回 0
+func GetCurrentUserRateLimit(username, groupName, modelName string) int {
+	if username == "" || modelName == "" {
+		return 0
+	}
+	snapshot, _ := currentUserRateLimits.Load().(*userRateLimitSnapshot)
+	if (snapshot == nil || time.Since(snapshot.loadedAt) >= userRateLimitSnapshotTTL) &&
+		userRateLimitsReloading.CompareAndSwap(false, true) {
+		gopool.Go(reloadUserRateLimitSnapshot)
+	}
+	if snapshot == nil {
+		return 0
+	}
+	return snapshot.limits[[3]string{username, groupName, modelName}]
+}
+
+// reloadUserRateLimitSnapshot 从中心控制库加载启用的限速配置，加载失败时保留上一次的结果，过期后再重试
+func reloadUserRateLimitSnapshot() {
+	defer userRateLimitsReloading.Store(false)
+	snapshot := &userRateLimitSnapshot{loadedAt: time.Now()}
+	configs, err := GetEnabledUserRateLimitConfigs()
+	if err != nil {
+		common.SysError("failed to load user rate limit configs: " + err.Error())
+		if previous, ok := currentUserRateLimits.Load().(*userRateLimitSnapshot); ok {
+			snapshot.limits = previous.limits
+		}
+	} else {
+		snapshot.limits = make(map[[3]string]int, len(configs))
+		for _, config := range configs {
+			if config.CurrentRateLimit > 0 {
+				snapshot.limits[[3]string{config.Username, config.GroupName, config.ModelName}] = config.CurrentRateLimit
+			}
+		}
+	}
+	currentUserRateLimits.Store(snapshot)
+}
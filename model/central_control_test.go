@@ -0,0 +1,89 @@
+package model
+
+import (
+	"one-api/constant"
+	"testing"
+	"time"
+)
+
+// waitUserRateLimitReload 等待后台加载限速配置完成
+func waitUserRateLimitReload(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for userRateLimitsReloading.Load() || currentUserRateLimits.Load() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("user rate limit snapshot was not reloaded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// expireUserRateLimitSnapshot 让当前快照过期，下一次读取时触发重新加载
+func expireUserRateLimitSnapshot() {
+	if snapshot, ok := currentUserRateLimits.Load().(*userRateLimitSnapshot); ok {
+		currentUserRateLimits.Store(&userRateLimitSnapshot{limits: snapshot.limits})
+	}
+}
+
+func TestGetCurrentUserRateLimit(t *testing.T) {
+	db := setupTestDB(t, &UserRateLimitConfig{})
+	originCentralDB := CENTRAL_DB
+	CENTRAL_DB = db
+	t.Cleanup(func() {
+		CENTRAL_DB = originCentralDB
+		currentUserRateLimits.Store(&userRateLimitSnapshot{})
+	})
+	configs := []*UserRateLimitConfig{
+		{SiteName: constant.CentralSiteName, Username: "alice", GroupName: "default", ModelName: "gpt-4o", IsRateLimitEnabled: true, CurrentRateLimit: 30},
+		{SiteName: constant.CentralSiteName, Username: "bob", GroupName: "default", ModelName: "gpt-4o", IsRateLimitEnabled: false, CurrentRateLimit: 10},
+		{SiteName: "other-site", Username: "carol", GroupName: "default", ModelName: "gpt-4o", IsRateLimitEnabled: true, CurrentRateLimit: 10},
+	}
+	if err := db.Create(&configs).Error; err != nil {
+		t.Fatal(err)
+	}
+	currentUserRateLimits.Store(&userRateLimitSnapshot{})
+	GetCurrentUserRateLimit("alice", "default", "gpt-4o")
+	waitUserRateLimitReload(t)
+	tests := []struct {
+		name     string
+		username string
+		group    string
+		model    string
+		want     int
+	}{
+		{"enabled config", "alice", "default", "gpt-4o", 30},
+		{"other group", "alice", "vip", "gpt-4o", 0},
+		{"disabled config", "bob", "default", "gpt-4o", 0},
+		{"other site", "carol", "default", "gpt-4o", 0},
+		{"empty username", "", "default", "gpt-4o", 0},
+	}
+	for _, tt := range tests {
+		if got := GetCurrentUserRateLimit(tt.username, tt.group, tt.model); got != tt.want {
+			t.Errorf("%s: GetCurrentUserRateLimit = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// 快照过期时先返回上一次的结果，后台加载完成后才生效
+	if err := db.Model(&UserRateLimitConfig{}).Where("username = ?", "alice").Update("current_rate_limit", 20).Error; err != nil {
+		t.Fatal(err)
+	}
+	expireUserRateLimitSnapshot()
+	if got := GetCurrentUserRateLimit("alice", "default", "gpt-4o"); got != 30 {
+		t.Fatalf("stale snapshot = %d, want 30", got)
+	}
+	waitUserRateLimitReload(t)
+	if got := GetCurrentUserRateLimit("alice", "default", "gpt-4o"); got != 20 {
+		t.Fatalf("reloaded snapshot = %d, want 20", got)
+	}
+
+	// 加载失败时保留上一次的结果
+	if err := db.Migrator().DropTable(&UserRateLimitConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	expireUserRateLimitSnapshot()
+	GetCurrentUserRateLimit("alice", "default", "gpt-4o")
+	waitUserRateLimitReload(t)
+	if got := GetCurrentUserRateLimit("alice", "default", "gpt-4o"); got != 20 {
+		t.Fatalf("snapshot after failed reload = %d, want 20", got)
+	}
+}
@@ -0,0 +1,491 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	ChannelBreakerClosed   = "closed"
+	ChannelBreakerOpen     = "open"
+	ChannelBreakerHalfOpen = "half_open"
+
+	channelBreakerKeyPrefix = "channel_breaker:"
+	// channelBreakerCacheTTL 启用 Redis 时本地缓存熔断状态的时间，选择渠道时不必每次访问 Redis
+	channelBreakerCacheTTL   = time.Second
+	channelBreakerMaxRetries = 5
+	channelBreakerScanCount  = 100
+)
+
+type channelBreakerKey struct {
+	ChannelId int
+	Model     string
+}
+
+func (key channelBreakerKey) redisKey() string {
+	return fmt.Sprintf("%s%d:%s", channelBreakerKeyPrefix, key.ChannelId, key.Model)
+}
+
+// channelBreakerState 熔断器状态，启用 Redis 时保存在 Redis 中由所有节点共享，时间均为毫秒时间戳
+type channelBreakerState struct {
+	ChannelId      int    `json:"channel_id"`
+	Model          string `json:"model"`
+	State          string `json:"state"`
+	OpenCount      int    `json:"open_count"`
+	OpenUntil      int64  `json:"open_until"`
+	HalfOpenAt     int64  `json:"half_open_at"`
+	Probes         int    `json:"probes"`
+	ProbeSuccesses int    `json:"probe_successes"`
+	ClosedAt       int64  `json:"closed_at"`
+}
+
+func newChannelBreakerState(key channelBreakerKey) *channelBreakerState {
+	return &channelBreakerState{ChannelId: key.ChannelId, Model: key.Model, State: ChannelBreakerClosed}
+}
+
+func channelBreakerProbes() int {
+	return max(constant.ChannelBreakerHalfOpenProbes, 1)
+}
+
+func channelBreakerMaxCooldown() int64 {
+	return int64(max(constant.ChannelBreakerMaxCooldownSeconds, 1)) * 1000
+}
+
+// channelBreakerCooldown 第 openCount 次连续熔断的冷却时间，按指数退避增长，不超过上限
+func channelBreakerCooldown(openCount int) int64 {
+	cooldown := int64(max(constant.ChannelBreakerCooldownSeconds, 1)) * 1000
+	maxCooldown := channelBreakerMaxCooldown()
+	for i := 1; i < openCount && cooldown < maxCooldown; i++ {
+		cooldown *= 2
+	}
+	return min(cooldown, maxCooldown)
+}
+
+// trip 熔断，恢复后超过最大冷却时间才再次熔断的，冷却时间重新从初始值开始
+func (s *channelBreakerState) trip(now int64) {
+	if s.State == ChannelBreakerClosed && s.ClosedAt != 0 && now-s.ClosedAt > channelBreakerMaxCooldown() {
+		s.OpenCount = 0
+	}
+	s.State = ChannelBreakerOpen
+	s.OpenCount++
+	s.OpenUntil = now + channelBreakerCooldown(s.OpenCount)
+	s.HalfOpenAt = 0
+	s.Probes = 0
+	s.ProbeSuccesses = 0
+}
+
+// available 渠道当前是否可能被选中，只读，用于选择渠道前的过滤
+func (s *channelBreakerState) available(now int64) bool {
+	switch s.State {
+	case ChannelBreakerOpen:
+		return now >= s.OpenUntil
+	case ChannelBreakerHalfOpen:
+		return s.Probes < channelBreakerProbes() || now-s.HalfOpenAt >= channelBreakerCooldown(s.OpenCount)
+	default:
+		return true
+	}
+}
+
+// acquire 占用一个探测名额，冷却结束的渠道进入半开状态；
+// 半开状态持续一个冷却时间仍未得出结果时（例如探测请求所在节点退出），重新开始一轮探测
+func (s *channelBreakerState) acquire(now int64) (allowed bool, changed bool) {
+	switch s.State {
+	case ChannelBreakerOpen:
+		if now < s.OpenUntil {
+			return false, false
+		}
+	case ChannelBreakerHalfOpen:
+		if now-s.HalfOpenAt < channelBreakerCooldown(s.OpenCount) {
+			if s.Probes >= channelBreakerProbes() {
+				return false, false
+			}
+			s.Probes++
+			return true, true
+		}
+	default:
+		return true, false
+	}
+	s.State = ChannelBreakerHalfOpen
+	s.HalfOpenAt = now
+	s.Probes = 1
+	s.ProbeSuccesses = 0
+	return true, true
+}
+
+// recordProbe 记录半开状态下的请求结果，任一失败立即重新熔断，成功数达到探测数后恢复
+func (s *channelBreakerState) recordProbe(now int64, failed bool) bool {
+	if s.State != ChannelBreakerHalfOpen {
+		return false
+	}
+	if failed {
+		s.trip(now)
+		return true
+	}
+	s.ProbeSuccesses++
+	if s.ProbeSuccesses >= channelBreakerProbes() {
+		s.State = ChannelBreakerClosed
+		s.ClosedAt = now
+		s.OpenUntil = 0
+		s.HalfOpenAt = 0
+		s.Probes = 0
+		s.ProbeSuccesses = 0
+	}
+	return true
+}
+
+// channelBreakerStore 熔断状态的存储，update 中的 fn 返回 false 表示状态没有变化
+type channelBreakerStore interface {
+	load(key channelBreakerKey) (*channelBreakerState, error)
+	update(key channelBreakerKey, fn func(state *channelBreakerState) bool) (*channelBreakerState, error)
+	list() ([]*channelBreakerState, error)
+}
+
+type memoryChannelBreakerStore struct {
+	mutex  sync.Mutex
+	states map[channelBreakerKey]*channelBreakerState
+}
+
+func (store *memoryChannelBreakerStore) load(key channelBreakerKey) (*channelBreakerState, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if state, ok := store.states[key]; ok {
+		copied := *state
+		return &copied, nil
+	}
+	return newChannelBreakerState(key), nil
+}
+
+func (store *memoryChannelBreakerStore) update(key channelBreakerKey, fn func(state *channelBreakerState) bool) (*channelBreakerState, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	state, ok := store.states[key]
+	if !ok {
+		state = newChannelBreakerState(key)
+	}
+	if fn(state) && !ok {
+		store.states[key] = state
+	}
+	copied := *state
+	return &copied, nil
+}
+
+func (store *memoryChannelBreakerStore) list() ([]*channelBreakerState, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	states := make([]*channelBreakerState, 0, len(store.states))
+	for _, state := range store.states {
+		copied := *state
+		states = append(states, &copied)
+	}
+	return states, nil
+}
+
+type cachedChannelBreakerState struct {
+	state    *channelBreakerState
+	expireAt time.Time
+}
+
+// redisChannelBreakerStore 状态以 JSON 保存在 Redis 中，通过 WATCH 乐观锁保证多个节点同时更新时的一致性，
+// 读取时使用短时间的本地缓存
+type redisChannelBreakerStore struct {
+	cache sync.Map
+}
+
+func (store *redisChannelBreakerStore) load(key channelBreakerKey) (*channelBreakerState, error) {
+	if cached, ok := store.cache.Load(key); ok && time.Now().Before(cached.(cachedChannelBreakerState).expireAt) {
+		copied := *cached.(cachedChannelBreakerState).state
+		return &copied, nil
+	}
+	state, err := store.get(common.RDB, key)
+	if err != nil {
+		return nil, err
+	}
+	store.setCache(key, state)
+	copied := *state
+	return &copied, nil
+}
+
+func (store *redisChannelBreakerStore) get(client redis.Cmdable, key channelBreakerKey) (*channelBreakerState, error) {
+	data, err := client.Get(context.Background(), key.redisKey()).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return newChannelBreakerState(key), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := newChannelBreakerState(key)
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (store *redisChannelBreakerStore) setCache(key channelBreakerKey, state *channelBreakerState) {
+	copied := *state
+	store.cache.Store(key, cachedChannelBreakerState{state: &copied, expireAt: time.Now().Add(channelBreakerCacheTTL)})
+}
+
+func (store *redisChannelBreakerStore) update(key channelBreakerKey, fn func(state *channelBreakerState) bool) (*channelBreakerState, error) {
+	ctx := context.Background()
+	var result *channelBreakerState
+	txf := func(tx *redis.Tx) error {
+		state, err := store.get(tx, key)
+		if err != nil {
+			return err
+		}
+		result = state
+		if !fn(state) {
+			return nil
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		// 恢复后保留一个最大冷却时间，用于判断是否继续指数退避，之后自动过期
+		expiration := time.Duration(channelBreakerMaxCooldown()) * time.Millisecond
+		if state.State != ChannelBreakerClosed {
+			expiration += time.Until(time.UnixMilli(max(state.OpenUntil, state.HalfOpenAt)))
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key.redisKey(), data, expiration)
+			return nil
+		})
+		return err
+	}
+	for i := 0; i < channelBreakerMaxRetries; i++ {
+		err := common.RDB.Watch(ctx, txf, key.redisKey())
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		store.setCache(key, result)
+		return result, nil
+	}
+	return nil, redis.TxFailedErr
+}
+
+func (store *redisChannelBreakerStore) list() ([]*channelBreakerState, error) {
+	ctx := context.Background()
+	var states []*channelBreakerState
+	iter := common.RDB.Scan(ctx, 0, channelBreakerKeyPrefix+"*", channelBreakerScanCount).Iterator()
+	for iter.Next(ctx) {
+		data, err := common.RDB.Get(ctx, iter.Val()).Bytes()
+		if err != nil {
+			continue
+		}
+		var state channelBreakerState
+		if err := json.Unmarshal(data, &state); err != nil {
+			continue
+		}
+		states = append(states, &state)
+	}
+	return states, iter.Err()
+}
+
+// channelBreakerCounter 熔断前的失败统计，只在当前节点内计数，任一节点达到阈值即熔断并同步到所有节点
+type channelBreakerCounter struct {
+	ConsecutiveFailures int
+	WindowStart         int64
+	Requests            int
+	Failures            int
+}
+
+// ErrChannelBreakerOpen 所有候选渠道都在熔断中，或者冷却结束的渠道探测名额已满
+var ErrChannelBreakerOpen = errors.New("all channels are circuit broken")
+
+var (
+	memoryBreakerStore = &memoryChannelBreakerStore{states: make(map[channelBreakerKey]*channelBreakerState)}
+	redisBreakerStore  = &redisChannelBreakerStore{}
+
+	channelBreakerCounters     = make(map[channelBreakerKey]*channelBreakerCounter)
+	channelBreakerCountersLock sync.Mutex
+)
+
+func getChannelBreakerStore() channelBreakerStore {
+	if common.RedisEnabled {
+		return redisBreakerStore
+	}
+	return memoryBreakerStore
+}
+
+// countChannelBreakerResult 计入当前节点的统计，返回是否达到熔断条件，达到时清空统计
+func countChannelBreakerResult(key channelBreakerKey, now int64, failed bool) bool {
+	channelBreakerCountersLock.Lock()
+	defer channelBreakerCountersLock.Unlock()
+	counter, ok := channelBreakerCounters[key]
+	if !ok {
+		counter = &channelBreakerCounter{WindowStart: now}
+		channelBreakerCounters[key] = counter
+	}
+	if now-counter.WindowStart > int64(max(constant.ChannelBreakerWindowSeconds, 1))*1000 {
+		counter.WindowStart = now
+		counter.Requests = 0
+		counter.Failures = 0
+	}
+	counter.Requests++
+	if failed {
+		counter.Failures++
+		counter.ConsecutiveFailures++
+	} else {
+		counter.ConsecutiveFailures = 0
+	}
+	tripped := counter.ConsecutiveFailures >= max(constant.ChannelBreakerFailureThreshold, 1) ||
+		(counter.Requests >= max(constant.ChannelBreakerMinRequests, 1) &&
+			float64(counter.Failures)/float64(counter.Requests) >= constant.ChannelBreakerErrorRate)
+	if tripped {
+		delete(channelBreakerCounters, key)
+	}
+	return tripped
+}
+
+// RecordChannelBreakerResult 记录渠道在某个模型上的一次请求结果，驱动熔断器状态变化
+func RecordChannelBreakerResult(channelId int, modelName string, failed bool) {
+	if !constant.ChannelBreakerEnabled {
+		return
+	}
+	key := channelBreakerKey{ChannelId: channelId, Model: modelName}
+	now := time.Now().UnixMilli()
+	store := getChannelBreakerStore()
+	state, err := store.load(key)
+	if err != nil {
+		common.SysError(fmt.Sprintf("load channel #%d breaker failed: %s", channelId, err.Error()))
+		return
+	}
+	switch state.State {
+	case ChannelBreakerOpen:
+		// 熔断前发出的请求的结果，不再计入
+		return
+	case ChannelBreakerHalfOpen:
+		state, err = store.update(key, func(state *channelBreakerState) bool {
+			return state.recordProbe(now, failed)
+		})
+	default:
+		if !countChannelBreakerResult(key, now, failed) {
+			return
+		}
+		state, err = store.update(key, func(state *channelBreakerState) bool {
+			// 其他节点已经熔断时不重复熔断
+			if state.State != ChannelBreakerClosed {
+				return false
+			}
+			state.trip(now)
+			return true
+		})
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("update channel #%d breaker failed: %s", channelId, err.Error()))
+		return
+	}
+	logChannelBreakerState(state, now)
+}
+
+func logChannelBreakerState(state *channelBreakerState, now int64) {
+	switch {
+	case state.State == ChannelBreakerOpen && state.OpenUntil > now:
+		common.SysLog(fmt.Sprintf("渠道 #%d 模型 %s 熔断，第 %d 次，%d 秒后开始探测", state.ChannelId, state.Model,
+			state.OpenCount, (state.OpenUntil-now)/1000))
+	case state.State == ChannelBreakerClosed && state.ClosedAt == now:
+		common.SysLog(fmt.Sprintf("渠道 #%d 模型 %s 探测成功，已恢复", state.ChannelId, state.Model))
+	}
+}
+
+// filterChannelsByBreaker 过滤掉熔断中的渠道，所有渠道都在熔断中时返回空列表，由调用方返回 ErrChannelBreakerOpen
+func filterChannelsByBreaker(channels []*Channel, modelName string) []*Channel {
+	if !constant.ChannelBreakerEnabled {
+		return channels
+	}
+	now := time.Now().UnixMilli()
+	store := getChannelBreakerStore()
+	available := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		state, err := store.load(channelBreakerKey{ChannelId: channel.Id, Model: modelName})
+		if err != nil || state.available(now) {
+			available = append(available, channel)
+		}
+	}
+	return available
+}
+
+// acquireChannelBreaker 选中渠道后调用，正常状态直接放行，冷却结束或半开状态的渠道需要占用探测名额
+func acquireChannelBreaker(channelId int, modelName string) bool {
+	if !constant.ChannelBreakerEnabled {
+		return true
+	}
+	key := channelBreakerKey{ChannelId: channelId, Model: modelName}
+	store := getChannelBreakerStore()
+	state, err := store.load(key)
+	if err != nil || state.State == ChannelBreakerClosed {
+		return true
+	}
+	allowed := false
+	_, err = store.update(key, func(state *channelBreakerState) bool {
+		var changed bool
+		allowed, changed = state.acquire(time.Now().UnixMilli())
+		return changed
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("acquire channel #%d breaker failed: %s", channelId, err.Error()))
+		return true
+	}
+	return allowed
+}
+
+// ChannelBreakerItem 熔断器状态，用于管理接口展示
+type ChannelBreakerItem struct {
+	ChannelId      int    `json:"channel_id"`
+	ChannelName    string `json:"channel_name"`
+	Model          string `json:"model"`
+	State          string `json:"state"`
+	OpenCount      int    `json:"open_count"`
+	OpenUntil      int64  `json:"open_until"`
+	Probes         int    `json:"probes"`
+	ProbeSuccesses int    `json:"probe_successes"`
+}
+
+// GetChannelBreakerItems 返回所有熔断中、半开以及近期恢复的渠道，open_until 为秒级时间戳
+func GetChannelBreakerItems() ([]*ChannelBreakerItem, error) {
+	states, err := getChannelBreakerStore().list()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	items := make([]*ChannelBreakerItem, 0, len(states))
+	channelSyncLock.RLock()
+	for _, state := range states {
+		if state.State == ChannelBreakerClosed && now-state.ClosedAt > channelBreakerMaxCooldown() {
+			continue
+		}
+		item := &ChannelBreakerItem{
+			ChannelId:      state.ChannelId,
+			Model:          state.Model,
+			State:          state.State,
+			OpenCount:      state.OpenCount,
+			OpenUntil:      state.OpenUntil / 1000,
+			Probes:         state.Probes,
+			ProbeSuccesses: state.ProbeSuccesses,
+		}
+		if channel, ok := channelsIDM[state.ChannelId]; ok {
+			item.ChannelName = channel.Name
+		}
+		items = append(items, item)
+	}
+	channelSyncLock.RUnlock()
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ChannelId != items[j].ChannelId {
+			return items[i].ChannelId < items[j].ChannelId
+		}
+		return items[i].Model < items[j].Model
+	})
+	return items, nil
+}
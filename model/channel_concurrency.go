@@ -0,0 +1,160 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrChannelsSaturated 所有候选渠道的并发数都已达到 max_concurrency
+var ErrChannelsSaturated = errors.New("all channels are saturated")
+
+const (
+	channelSlotKeyPrefix = "channel_concurrency:"
+	// channelSlotLease 并发槽位的租约时间，持有期间定期续期，节点退出后槽位在租约到期后自动释放
+	channelSlotLease = 60 * time.Second
+)
+
+// channelSlotAcquireScript 清理过期的槽位后，未达到上限时占用一个槽位，分数为租约到期时间
+var channelSlotAcquireScript = redis.NewScript(`
+	redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+	if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[2]) then
+		redis.call('ZADD', KEYS[1], ARGV[3], ARGV[4])
+		redis.call('PEXPIRE', KEYS[1], ARGV[5])
+		return 1
+	end
+	return 0
+`)
+
+var (
+	// channelSlotLeases 未启用 Redis 时各渠道占用中的槽位及租约到期时间（毫秒），与 Redis 中的有序集合一致
+	channelSlotLeases = make(map[int]map[string]int64)
+	channelSlotLock   sync.Mutex
+	// channelSlotReleased 当前节点释放槽位时关闭并替换，用于唤醒等待中的请求
+	channelSlotReleased = make(chan struct{})
+)
+
+// ChannelSlot 渠道的一个并发槽位，请求结束后必须调用 Release
+type ChannelSlot struct {
+	channelId int
+	member    string
+	once      sync.Once
+	stop      chan struct{}
+}
+
+func channelSlotKey(channelId int) string {
+	return fmt.Sprintf("%s%d", channelSlotKeyPrefix, channelId)
+}
+
+// TryAcquireChannelSlot 尝试占用渠道的一个并发槽位，渠道未设置 max_concurrency 时不占用槽位，返回 nil
+func TryAcquireChannelSlot(channel *Channel) (*ChannelSlot, bool) {
+	maxConcurrency := channel.GetMaxConcurrency()
+	if maxConcurrency <= 0 {
+		return nil, true
+	}
+	slot := &ChannelSlot{channelId: channel.Id, member: common.GetUUID(), stop: make(chan struct{})}
+	if !common.RedisEnabled {
+		if !acquireMemoryChannelSlot(slot, maxConcurrency) {
+			return nil, false
+		}
+		go slot.renew()
+		return slot, true
+	}
+	now := time.Now()
+	result, err := channelSlotAcquireScript.Run(context.Background(), common.RDB, []string{channelSlotKey(channel.Id)},
+		now.UnixMilli(), maxConcurrency, now.Add(channelSlotLease).UnixMilli(), slot.member, channelSlotLease.Milliseconds()).Int()
+	if err != nil {
+		// Redis 不可用时不限制并发，避免请求全部失败
+		common.SysError(fmt.Sprintf("acquire channel #%d slot failed: %s", channel.Id, err.Error()))
+		return nil, true
+	}
+	if result != 1 {
+		return nil, false
+	}
+	go slot.renew()
+	return slot, true
+}
+
+// acquireMemoryChannelSlot 清理租约到期的槽位后，未达到上限时占用一个槽位，
+// 请求所在的协程异常退出没有释放槽位时，槽位在租约到期后自动回收
+func acquireMemoryChannelSlot(slot *ChannelSlot, maxConcurrency int) bool {
+	channelSlotLock.Lock()
+	defer channelSlotLock.Unlock()
+	leases := channelSlotLeases[slot.channelId]
+	if leases == nil {
+		leases = make(map[string]int64)
+		channelSlotLeases[slot.channelId] = leases
+	}
+	now := time.Now()
+	for member, expireAt := range leases {
+		if expireAt <= now.UnixMilli() {
+			delete(leases, member)
+		}
+	}
+	if len(leases) >= maxConcurrency {
+		return false
+	}
+	leases[slot.member] = now.Add(channelSlotLease).UnixMilli()
+	return true
+}
+
+// renew 持有期间定期延长租约，长时间的流式请求不会因租约到期被其他请求占用槽位
+func (slot *ChannelSlot) renew() {
+	ticker := time.NewTicker(channelSlotLease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-slot.stop:
+			return
+		case <-ticker.C:
+			if !common.RedisEnabled {
+				channelSlotLock.Lock()
+				if leases := channelSlotLeases[slot.channelId]; leases != nil {
+					if _, ok := leases[slot.member]; ok {
+						leases[slot.member] = time.Now().Add(channelSlotLease).UnixMilli()
+					}
+				}
+				channelSlotLock.Unlock()
+				continue
+			}
+			ctx := context.Background()
+			expireAt := float64(time.Now().Add(channelSlotLease).UnixMilli())
+			common.RDB.ZAddXX(ctx, channelSlotKey(slot.channelId), &redis.Z{Score: expireAt, Member: slot.member})
+			common.RDB.PExpire(ctx, channelSlotKey(slot.channelId), channelSlotLease)
+		}
+	}
+}
+
+// Release 释放槽位并唤醒当前节点等待中的请求，可以重复调用
+func (slot *ChannelSlot) Release() {
+	if slot == nil {
+		return
+	}
+	slot.once.Do(func() {
+		close(slot.stop)
+		if common.RedisEnabled {
+			if err := common.RDB.ZRem(context.Background(), channelSlotKey(slot.channelId), slot.member).Err(); err != nil {
+				common.SysError(fmt.Sprintf("release channel #%d slot failed: %s", slot.channelId, err.Error()))
+			}
+		}
+		channelSlotLock.Lock()
+		defer channelSlotLock.Unlock()
+		if leases := channelSlotLeases[slot.channelId]; !common.RedisEnabled && leases != nil {
+			delete(leases, slot.member)
+		}
+		close(channelSlotReleased)
+		channelSlotReleased = make(chan struct{})
+	})
+}
+
+// ChannelSlotReleased 返回在当前节点下一次释放槽位时关闭的 channel，其他节点释放的槽位需要等待方自行定期重试
+func ChannelSlotReleased() <-chan struct{} {
+	channelSlotLock.Lock()
+	defer channelSlotLock.Unlock()
+	return channelSlotReleased
+}
@@ -0,0 +1,245 @@
+package model
+
+import (
+	"errors"
+	"math/rand"
+	"one-api/common"
+	"one-api/constant"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ChannelKeyRotationRoundRobin = "round_robin"
+	ChannelKeyRotationRandom     = "random"
+	ChannelKeyRotationLeastUsed  = "least_used"
+)
+
+// ChannelKey 渠道号池中的一个密钥，渠道有号池时请求使用号池中启用的密钥，没有时使用渠道本身的密钥
+type ChannelKey struct {
+	Id             int    `json:"id"`
+	ChannelId      int    `json:"channel_id" gorm:"index"`
+	Key            string `json:"key" gorm:"type:text;serializer:secret;not null"`
+	Status         int    `json:"status" gorm:"default:1"`
+	Requests       int64  `json:"requests" gorm:"bigint;default:0"`
+	Errors         int64  `json:"errors" gorm:"bigint;default:0"`
+	DisabledReason string `json:"disabled_reason" gorm:"type:text"`
+	DisabledTime   int64  `json:"disabled_time" gorm:"bigint"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+}
+
+var (
+	// channelKeyCache 启用内存缓存时各渠道启用中的密钥
+	channelKeyCache     map[int][]*ChannelKey
+	channelKeyCacheLock sync.RWMutex
+	// channelKeyRoundRobin 各渠道轮询的位置，channelKeyUsage 各密钥在当前节点被选中的次数，均只保存在当前节点
+	channelKeyRoundRobin sync.Map
+	channelKeyUsage      sync.Map
+)
+
+func initChannelKeyCache() {
+	var keys []*ChannelKey
+	DB.Where("status = ?", common.ChannelStatusEnabled).Order("id asc").Find(&keys)
+	newChannelKeyCache := make(map[int][]*ChannelKey)
+	for _, key := range keys {
+		newChannelKeyCache[key.ChannelId] = append(newChannelKeyCache[key.ChannelId], key)
+	}
+	channelKeyCacheLock.Lock()
+	channelKeyCache = newChannelKeyCache
+	channelKeyCacheLock.Unlock()
+}
+
+// refreshChannelKeyCache 号池变化后立即刷新当前节点中该渠道的缓存，其他节点在下次同步渠道时刷新
+func refreshChannelKeyCache(channelId int) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	keys, err := getEnabledChannelKeys(channelId)
+	if err != nil {
+		common.SysError("failed to refresh channel key cache: " + err.Error())
+		return
+	}
+	channelKeyCacheLock.Lock()
+	defer channelKeyCacheLock.Unlock()
+	if channelKeyCache == nil {
+		channelKeyCache = make(map[int][]*ChannelKey)
+	}
+	if len(keys) == 0 {
+		delete(channelKeyCache, channelId)
+	} else {
+		channelKeyCache[channelId] = keys
+	}
+}
+
+func getEnabledChannelKeys(channelId int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ? AND status = ?", channelId, common.ChannelStatusEnabled).Order("id asc").Find(&keys).Error
+	return keys, err
+}
+
+func (channel *Channel) GetKeyRotation() string {
+	setting := channel.GetSetting()
+	if rotation, ok := setting[constant.ChannelSettingKeyRotation].(string); ok {
+		return rotation
+	}
+	return ChannelKeyRotationRoundRobin
+}
+
+// SelectChannelKey 按渠道设置的 key_rotation 从号池中选择一个启用的密钥，号池为空时返回 nil
+func SelectChannelKey(channel *Channel) *ChannelKey {
+	var keys []*ChannelKey
+	if common.MemoryCacheEnabled {
+		channelKeyCacheLock.RLock()
+		keys = channelKeyCache[channel.Id]
+		channelKeyCacheLock.RUnlock()
+	} else {
+		var err error
+		keys, err = getEnabledChannelKeys(channel.Id)
+		if err != nil {
+			common.SysError("failed to get channel keys: " + err.Error())
+			return nil
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	var key *ChannelKey
+	switch channel.GetKeyRotation() {
+	case ChannelKeyRotationRandom:
+		key = keys[rand.Intn(len(keys))]
+	case ChannelKeyRotationLeastUsed:
+		var leastUsed int64
+		for _, candidate := range keys {
+			used := channelKeyUsed(candidate.Id).Load()
+			if key == nil || used < leastUsed {
+				key, leastUsed = candidate, used
+			}
+		}
+	default:
+		counter, _ := channelKeyRoundRobin.LoadOrStore(channel.Id, &atomic.Uint64{})
+		key = keys[(counter.(*atomic.Uint64).Add(1)-1)%uint64(len(keys))]
+	}
+	channelKeyUsed(key.Id).Add(1)
+	return key
+}
+
+func channelKeyUsed(keyId int) *atomic.Int64 {
+	used, _ := channelKeyUsage.LoadOrStore(keyId, &atomic.Int64{})
+	return used.(*atomic.Int64)
+}
+
+// RecordChannelKeyResult 记录号池密钥的请求数和失败数
+func RecordChannelKeyResult(keyId int, failed bool) {
+	errorCount := 0
+	if failed {
+		errorCount = 1
+	}
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeChannelKeyRequests, keyId, 1)
+		if failed {
+			addNewRecord(BatchUpdateTypeChannelKeyErrors, keyId, 1)
+		}
+		return
+	}
+	updateChannelKeyCount(keyId, 1, errorCount)
+}
+
+func updateChannelKeyCount(keyId int, requests int, errorCount int) {
+	err := DB.Model(&ChannelKey{}).Where("id = ?", keyId).Updates(map[string]interface{}{
+		"requests": gorm.Expr("requests + ?", requests),
+		"errors":   gorm.Expr("errors + ?", errorCount),
+	}).Error
+	if err != nil {
+		common.SysError("failed to update channel key count: " + err.Error())
+	}
+}
+
+func GetChannelKeys(channelId int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ?", channelId).Order("id asc").Find(&keys).Error
+	return keys, err
+}
+
+// AddChannelKeys 向渠道号池添加密钥，忽略已存在的密钥，号池为空时渠道本身的密钥会先加入号池，返回新增的数量
+func AddChannelKeys(channel *Channel, keys []string) (int, error) {
+	existing, err := GetChannelKeys(channel.Id)
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) == 0 && strings.TrimSpace(channel.Key) != "" {
+		keys = append([]string{channel.Key}, keys...)
+	}
+	seen := make(map[string]bool)
+	for _, key := range existing {
+		seen[key.Key] = true
+	}
+	now := common.GetTimestamp()
+	var newKeys []*ChannelKey
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		newKeys = append(newKeys, &ChannelKey{
+			ChannelId:   channel.Id,
+			Key:         key,
+			Status:      common.ChannelStatusEnabled,
+			CreatedTime: now,
+		})
+	}
+	if len(newKeys) == 0 {
+		return 0, nil
+	}
+	if err := DB.Create(&newKeys).Error; err != nil {
+		return 0, err
+	}
+	refreshChannelKeyCache(channel.Id)
+	return len(newKeys), nil
+}
+
+func DeleteChannelKey(channelId int, keyId int) error {
+	result := DB.Where("id = ? AND channel_id = ?", keyId, channelId).Delete(&ChannelKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("密钥不存在")
+	}
+	refreshChannelKeyCache(channelId)
+	return nil
+}
+
+func deleteChannelKeysByChannelIds(tx *gorm.DB, channelIds []int) error {
+	return tx.Where("channel_id in (?)", channelIds).Delete(&ChannelKey{}).Error
+}
+
+// UpdateChannelKeyStatus 启用或禁用号池中的密钥，状态没有变化时返回 false
+func UpdateChannelKeyStatus(channelId int, keyId int, status int, reason string) (bool, error) {
+	updates := map[string]interface{}{"status": status, "disabled_reason": "", "disabled_time": 0}
+	if status != common.ChannelStatusEnabled {
+		updates["disabled_reason"] = reason
+		updates["disabled_time"] = common.GetTimestamp()
+	}
+	result := DB.Model(&ChannelKey{}).Where("id = ? AND channel_id = ? AND status != ?", keyId, channelId, status).Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	refreshChannelKeyCache(channelId)
+	return true, nil
+}
+
+// CountEnabledChannelKeys 返回渠道号池中的密钥总数和启用的密钥数
+func CountEnabledChannelKeys(channelId int) (total int64, enabled int64, err error) {
+	if err = DB.Model(&ChannelKey{}).Where("channel_id = ?", channelId).Count(&total).Error; err != nil {
+		return
+	}
+	err = DB.Model(&ChannelKey{}).Where("channel_id = ? AND status = ?", channelId, common.ChannelStatusEnabled).Count(&enabled).Error
+	return
+}
@@ -0,0 +1,235 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"one-api/constant"
+	"sort"
+	"sync"
+	"time"
+)
+
+// channelStatsMinAlpha 同一时间窗口内大量请求时每个样本的最小权重，避免 EWMA 停止变化
+const channelStatsMinAlpha = 0.1
+
+// channelStats 单个渠道在单个模型上的实时统计，只保存在当前节点内存中
+type channelStats struct {
+	LatencyMs float64
+	TtftMs    float64
+	ErrorRate float64
+	Requests  int64
+	Errors    int64
+	UpdatedAt time.Time
+}
+
+type channelStatsKey struct {
+	ChannelId int
+	Model     string
+}
+
+var (
+	channelStatsMap  = make(map[channelStatsKey]*channelStats)
+	channelStatsLock sync.RWMutex
+)
+
+func channelStatsWindow() float64 {
+	return float64(max(constant.AdaptiveChannelWindowSeconds, 1))
+}
+
+// RecordChannelResult 记录一次上游请求的结果，latency 为整个请求耗时，ttft 为流式请求的首字时间，非流式时为 0
+func RecordChannelResult(channelId int, modelName string, latency time.Duration, ttft time.Duration, failed bool) {
+	now := time.Now()
+	key := channelStatsKey{ChannelId: channelId, Model: modelName}
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	stats, ok := channelStatsMap[key]
+	if !ok {
+		stats = &channelStats{}
+		channelStatsMap[key] = stats
+	}
+	// 按距上次更新的时间计算样本权重，时间越久旧数据的占比越小
+	alpha := 1.0
+	if stats.Requests > 0 {
+		alpha = math.Max(channelStatsMinAlpha, 1-math.Exp(-now.Sub(stats.UpdatedAt).Seconds()/channelStatsWindow()))
+	}
+	failure := 0.0
+	if failed {
+		failure = 1
+		stats.Errors++
+	}
+	stats.ErrorRate = ewma(stats.ErrorRate, failure, alpha, stats.Requests == 0)
+	if !failed {
+		latencyMs := float64(latency.Milliseconds())
+		stats.LatencyMs = ewma(stats.LatencyMs, latencyMs, alpha, stats.LatencyMs == 0)
+		if ttft > 0 {
+			stats.TtftMs = ewma(stats.TtftMs, float64(ttft.Milliseconds()), alpha, stats.TtftMs == 0)
+		}
+	}
+	stats.Requests++
+	stats.UpdatedAt = now
+}
+
+func ewma(old float64, sample float64, alpha float64, first bool) float64 {
+	if first {
+		return sample
+	}
+	return old + alpha*(sample-old)
+}
+
+// currentErrorRate 长时间没有请求的渠道错误率逐渐衰减，让已恢复的渠道重新获得流量
+func (stats *channelStats) currentErrorRate(now time.Time) float64 {
+	idle := now.Sub(stats.UpdatedAt).Seconds()
+	return stats.ErrorRate * math.Exp(-idle/channelStatsWindow())
+}
+
+func getChannelStats(channelId int, modelName string) (channelStats, bool) {
+	channelStatsLock.RLock()
+	defer channelStatsLock.RUnlock()
+	stats, ok := channelStatsMap[channelStatsKey{ChannelId: channelId, Model: modelName}]
+	if !ok {
+		return channelStats{}, false
+	}
+	return *stats, true
+}
+
+// adaptiveChannelScores 计算同一优先级内各渠道的得分：静态权重 × 延迟因子 × 健康因子，
+// 延迟因子为最快渠道的延迟与本渠道延迟之比，健康因子为 (1-错误率)²，
+// 最后保证每个渠道至少获得 ADAPTIVE_CHANNEL_EXPLORE_RATIO 平均分配的份额
+func adaptiveChannelScores(channels []*Channel, modelName string) []float64 {
+	now := time.Now()
+	stats := make([]*channelStats, len(channels))
+	// 所有有统计的渠道都有首字时间时按首字时间比较，否则按整体耗时比较
+	useTtft := true
+	for i, channel := range channels {
+		if s, ok := getChannelStats(channel.Id, modelName); ok {
+			stats[i] = &s
+			if s.LatencyMs > 0 && s.TtftMs == 0 {
+				useTtft = false
+			}
+		}
+	}
+	latencyOf := func(s *channelStats) float64 {
+		if useTtft {
+			return s.TtftMs
+		}
+		return s.LatencyMs
+	}
+	bestLatency := math.MaxFloat64
+	for _, s := range stats {
+		if s != nil && latencyOf(s) > 0 {
+			bestLatency = math.Min(bestLatency, latencyOf(s))
+		}
+	}
+
+	scores := make([]float64, len(channels))
+	total := 0.0
+	for i, channel := range channels {
+		score := float64(channel.GetWeight() + channelSmoothingFactor)
+		if s := stats[i]; s != nil {
+			if latency := latencyOf(s); latency > 0 {
+				score *= bestLatency / latency
+			}
+			health := 1 - s.currentErrorRate(now)
+			score *= health * health
+		}
+		scores[i] = score
+		total += score
+	}
+	floor := total * constant.AdaptiveChannelExploreRatio / float64(len(channels))
+	for i := range scores {
+		scores[i] = math.Max(scores[i], floor)
+	}
+	return scores
+}
+
+func pickAdaptiveChannel(channels []*Channel, modelName string) *Channel {
+	scores := adaptiveChannelScores(channels, modelName)
+	total := 0.0
+	for _, score := range scores {
+		total += score
+	}
+	if total <= 0 {
+		return channels[rand.Intn(len(channels))]
+	}
+	randomScore := rand.Float64() * total
+	for i, score := range scores {
+		randomScore -= score
+		if randomScore < 0 {
+			return channels[i]
+		}
+	}
+	return channels[len(channels)-1]
+}
+
+// ChannelStatsItem 渠道实时统计，用于管理接口展示
+type ChannelStatsItem struct {
+	ChannelId   int     `json:"channel_id"`
+	ChannelName string  `json:"channel_name"`
+	Model       string  `json:"model"`
+	LatencyMs   float64 `json:"latency_ms"`
+	TtftMs      float64 `json:"ttft_ms"`
+	ErrorRate   float64 `json:"error_rate"`
+	Requests    int64   `json:"requests"`
+	Errors      int64   `json:"errors"`
+	Score       float64 `json:"score"`
+	UpdatedAt   int64   `json:"updated_at"`
+}
+
+// GetChannelStatsItems 返回当前节点所有渠道的统计和得分，得分按同一分组、模型、优先级内的候选渠道计算，
+// 同一渠道在多个分组中时取最高得分
+func GetChannelStatsItems() []*ChannelStatsItem {
+	now := time.Now()
+	channelStatsLock.RLock()
+	items := make([]*ChannelStatsItem, 0, len(channelStatsMap))
+	for key, stats := range channelStatsMap {
+		items = append(items, &ChannelStatsItem{
+			ChannelId: key.ChannelId,
+			Model:     key.Model,
+			LatencyMs: stats.LatencyMs,
+			TtftMs:    stats.TtftMs,
+			ErrorRate: stats.currentErrorRate(now),
+			Requests:  stats.Requests,
+			Errors:    stats.Errors,
+			UpdatedAt: stats.UpdatedAt.Unix(),
+		})
+	}
+	channelStatsLock.RUnlock()
+
+	scores := make(map[channelStatsKey]float64)
+	channelSyncLock.RLock()
+	for _, model2channels := range group2model2channels {
+		for modelName, channels := range model2channels {
+			priority2channels := make(map[int64][]*Channel)
+			for _, channel := range channels {
+				priority2channels[channel.GetPriority()] = append(priority2channels[channel.GetPriority()], channel)
+			}
+			for _, candidates := range priority2channels {
+				total := 0.0
+				channelScores := adaptiveChannelScores(candidates, modelName)
+				for _, score := range channelScores {
+					total += score
+				}
+				for i, channel := range candidates {
+					key := channelStatsKey{ChannelId: channel.Id, Model: modelName}
+					// 得分归一化为该渠道在候选渠道中被选中的概率
+					scores[key] = math.Max(scores[key], channelScores[i]/total)
+				}
+			}
+		}
+	}
+	for _, item := range items {
+		item.Score = scores[channelStatsKey{ChannelId: item.ChannelId, Model: item.Model}]
+		if channel, ok := channelsIDM[item.ChannelId]; ok {
+			item.ChannelName = channel.Name
+		}
+	}
+	channelSyncLock.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Model != items[j].Model {
+			return items[i].Model < items[j].Model
+		}
+		return items[i].ChannelId < items[j].ChannelId
+	})
+	return items
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 短期客户端令牌的额度上限按 jti 统计已使用的额度，计数保留到令牌过期
+
+var (
+	memClientTokenUsed     = make(map[string][2]int64) // jti -> [已使用额度, 过期时间]
+	memClientTokenUsedLock sync.Mutex
+)
+
+func clientTokenUsedKey(jti string) string {
+	return fmt.Sprintf("client_token_used:%s", jti)
+}
+
+func GetClientTokenUsedQuota(jti string) (int64, error) {
+	if !common.RedisEnabled {
+		memClientTokenUsedLock.Lock()
+		defer memClientTokenUsedLock.Unlock()
+		value, ok := memClientTokenUsed[jti]
+		if !ok || value[1] <= time.Now().Unix() {
+			return 0, nil
+		}
+		return value[0], nil
+	}
+	used, err := common.RDB.Get(context.Background(), clientTokenUsedKey(jti)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return used, err
+}
+
+// AddClientTokenUsedQuota 增加短期客户端令牌已使用的额度，quota 为负数时退回
+func AddClientTokenUsedQuota(jti string, quota int, expiresAt int64) error {
+	now := time.Now().Unix()
+	// 计数多保留一分钟，过期前发起的请求结束时仍能正确记账
+	ttl := time.Duration(expiresAt-now+60) * time.Second
+	if ttl <= 0 {
+		return nil
+	}
+	if !common.RedisEnabled {
+		memClientTokenUsedLock.Lock()
+		defer memClientTokenUsedLock.Unlock()
+		for key, value := range memClientTokenUsed {
+			if value[1] <= now {
+				delete(memClientTokenUsed, key)
+			}
+		}
+		value := memClientTokenUsed[jti]
+		value[0] += int64(quota)
+		value[1] = expiresAt + 60
+		memClientTokenUsed[jti] = value
+		return nil
+	}
+	ctx := context.Background()
+	_, err := common.RDB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.IncrBy(ctx, clientTokenUsedKey(jti), int64(quota))
+		pipe.Expire(ctx, clientTokenUsedKey(jti), ttl)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+	FileStatusError     = "error"
+)
+
+var ErrFileStorageQuotaExceeded = errors.New("file storage quota exceeded")
+
+// File /v1/files 上传的文件元数据，文件内容由 service.FileStorage 保存，
+// 文件归属于上传它的用户和令牌，其他令牌不可见
+type File struct {
+	Id         string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	TokenId    int    `json:"token_id" gorm:"index"`
+	Filename   string `json:"filename" gorm:"type:varchar(255)"`
+	Purpose    string `json:"purpose" gorm:"type:varchar(32);index"`
+	Bytes      int64  `json:"bytes" gorm:"bigint"`
+	MimeType   string `json:"mime_type" gorm:"type:varchar(128)"`
+	StorageKey string `json:"-" gorm:"type:varchar(255)"`
+	Status     string `json:"status" gorm:"type:varchar(20)"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (file *File) Insert() error {
+	return DB.Create(file).Error
+}
+
+// InsertWithQuota 锁定用户行后统计已占用的空间再写入元数据，并发上传不会同时通过检查而超出 quotaBytes
+func (file *File) InsertWithQuota(quotaBytes int64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&User{}, file.UserId).Error; err != nil {
+			return err
+		}
+		var used int64
+		err := tx.Model(&File{}).Where("user_id = ?", file.UserId).Select("COALESCE(SUM(bytes), 0)").Scan(&used).Error
+		if err != nil {
+			return err
+		}
+		if used+file.Bytes > quotaBytes {
+			return ErrFileStorageQuotaExceeded
+		}
+		return tx.Create(file).Error
+	})
+}
+
+func (file *File) UpdateStatus(status string) error {
+	file.Status = status
+	return DB.Model(file).Update("status", status).Error
+}
+
+func (file *File) Delete() error {
+	return DB.Delete(file).Error
+}
+
+// GetFileById 按 id 查询文件，只返回属于该用户和令牌的文件
+func GetFileById(id string, userId int, tokenId int) (*File, error) {
+	if id == "" {
+		return nil, errors.New("file id is empty")
+	}
+	var file File
+	err := DB.Where("id = ? AND user_id = ? AND token_id = ?", id, userId, tokenId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetFiles 按创建时间倒序（order 为 asc 时正序）列出令牌的文件，after 为上一页最后一个文件的 id
+func GetFiles(userId int, tokenId int, purpose string, after string, order string, limit int) ([]*File, error) {
+	var files []*File
+	tx := DB.Where("user_id = ? AND token_id = ?", userId, tokenId)
+	if purpose != "" {
+		tx = tx.Where("purpose = ?", purpose)
+	}
+	ascending := order == "asc"
+	if after != "" {
+		var cursor File
+		err := DB.Select("created_at").Where("id = ? AND user_id = ? AND token_id = ?", after, userId, tokenId).First(&cursor).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			if ascending {
+				tx = tx.Where("(created_at > ? OR (created_at = ? AND id > ?))", cursor.CreatedAt, cursor.CreatedAt, after)
+			} else {
+				tx = tx.Where("(created_at < ? OR (created_at = ? AND id < ?))", cursor.CreatedAt, cursor.CreatedAt, after)
+			}
+		}
+	}
+	if ascending {
+		tx = tx.Order("created_at asc, id asc")
+	} else {
+		tx = tx.Order("created_at desc, id desc")
+	}
+	err := tx.Limit(limit).Find(&files).Error
+	return files, err
+}
@@ -0,0 +1,233 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"one-api/common"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 令牌和用户的并发限制：同时进行中的请求数和 realtime 会话数，每个进行中的请求持有一个带租约的槽位，
+// 与渠道并发槽位相同，启用 Redis 时所有节点共用，节点异常退出后槽位在租约到期后自动释放
+const (
+	InFlightKindRequest  = "request"
+	InFlightKindRealtime = "realtime"
+
+	InFlightScopeToken = "token"
+	InFlightScopeUser  = "user"
+
+	inFlightKeyPrefix = "inflight:"
+	inFlightLease     = 60 * time.Second
+)
+
+// InFlightLimit 一个并发限制，Max 小于等于 0 表示不限制
+type InFlightLimit struct {
+	Scope string
+	Id    int
+	Max   int
+}
+
+// inFlightAcquireScript 清理过期的槽位后，所有限制都未达到上限时在每个键中占用一个槽位，
+// 返回 0 表示成功，否则返回第一个已达到上限的限制的序号（从 1 开始）。
+// 槽位的分数是租约的到期时间，与 gcraScript 相同使用 Redis 的 TIME，各节点的时钟偏差不会提前清理其他节点的槽位
+var inFlightAcquireScript = redis.NewScript(`
+	redis.replicate_commands()
+	local time = redis.call('TIME')
+	local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+	for i, key in ipairs(KEYS) do
+		redis.call('ZREMRANGEBYSCORE', key, '-inf', now)
+		if redis.call('ZCARD', key) >= tonumber(ARGV[2 + i]) then
+			return i
+		end
+	end
+	for _, key in ipairs(KEYS) do
+		redis.call('ZADD', key, now + tonumber(ARGV[1]), ARGV[2])
+		redis.call('PEXPIRE', key, ARGV[1])
+	end
+	return 0
+`)
+
+// inFlightRenewScript 按 Redis 的 TIME 延长仍持有的槽位的租约，已释放的槽位不会被重新加入
+var inFlightRenewScript = redis.NewScript(`
+	redis.replicate_commands()
+	local time = redis.call('TIME')
+	local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+	for _, key in ipairs(KEYS) do
+		redis.call('ZADD', key, 'XX', now + tonumber(ARGV[1]), ARGV[2])
+		redis.call('PEXPIRE', key, ARGV[1])
+	end
+	return 0
+`)
+
+// inFlightCountScript 按 Redis 的 TIME 统计每个键中未过期的槽位数
+var inFlightCountScript = redis.NewScript(`
+	local time = redis.call('TIME')
+	local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+	local counts = {}
+	for i, key in ipairs(KEYS) do
+		counts[i] = redis.call('ZCOUNT', key, '(' .. now, '+inf')
+	end
+	return counts
+`)
+
+var (
+	inFlightCounts = make(map[string]int)
+	inFlightLock   sync.Mutex
+)
+
+func inFlightKey(kind string, scope string, id int) string {
+	return fmt.Sprintf("%s%s:%s:%d", inFlightKeyPrefix, kind, scope, id)
+}
+
+// InFlightLease 请求持有的并发槽位，请求结束后必须调用 Release
+type InFlightLease struct {
+	keys   []string
+	member string
+	once   sync.Once
+	stop   chan struct{}
+}
+
+// AcquireInFlightLease 按 kind 在所有限制中各占用一个槽位，任一限制已满时不占用并返回该限制
+func AcquireInFlightLease(kind string, limits []InFlightLimit) (*InFlightLease, *InFlightLimit, error) {
+	var active []InFlightLimit
+	for _, limit := range limits {
+		if limit.Max > 0 {
+			active = append(active, limit)
+		}
+	}
+	if len(active) == 0 {
+		return nil, nil, nil
+	}
+	lease := &InFlightLease{member: common.GetUUID(), stop: make(chan struct{})}
+	for _, limit := range active {
+		lease.keys = append(lease.keys, inFlightKey(kind, limit.Scope, limit.Id))
+	}
+	if !common.RedisEnabled {
+		inFlightLock.Lock()
+		defer inFlightLock.Unlock()
+		for i, key := range lease.keys {
+			if inFlightCounts[key] >= active[i].Max {
+				return nil, &active[i], nil
+			}
+		}
+		for _, key := range lease.keys {
+			inFlightCounts[key]++
+		}
+		return lease, nil, nil
+	}
+	args := []interface{}{inFlightLease.Milliseconds(), lease.member}
+	for _, limit := range active {
+		args = append(args, limit.Max)
+	}
+	result, err := inFlightAcquireScript.Run(context.Background(), common.RDB, lease.keys, args...).Int()
+	if err != nil {
+		return nil, nil, err
+	}
+	if result > 0 && result <= len(active) {
+		return nil, &active[result-1], nil
+	}
+	go lease.renew()
+	return lease, nil, nil
+}
+
+// renew 持有期间定期延长租约，长时间的流式请求和 realtime 会话不会因租约到期而被多算
+func (lease *InFlightLease) renew() {
+	ticker := time.NewTicker(inFlightLease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lease.stop:
+			return
+		case <-ticker.C:
+			err := inFlightRenewScript.Run(context.Background(), common.RDB, lease.keys,
+				inFlightLease.Milliseconds(), lease.member).Err()
+			if err != nil {
+				common.SysError("renew inflight lease failed: " + err.Error())
+			}
+		}
+	}
+}
+
+// Release 释放槽位，可以重复调用
+func (lease *InFlightLease) Release() {
+	if lease == nil {
+		return
+	}
+	lease.once.Do(func() {
+		close(lease.stop)
+		if !common.RedisEnabled {
+			inFlightLock.Lock()
+			defer inFlightLock.Unlock()
+			for _, key := range lease.keys {
+				if inFlightCounts[key] > 1 {
+					inFlightCounts[key]--
+				} else {
+					delete(inFlightCounts, key)
+				}
+			}
+			return
+		}
+		ctx := context.Background()
+		for _, key := range lease.keys {
+			if err := common.RDB.ZRem(ctx, key, lease.member).Err(); err != nil {
+				common.SysError(fmt.Sprintf("release inflight lease %s failed: %s", key, err.Error()))
+			}
+		}
+	})
+}
+
+// GetInFlightCounts 返回 ids 当前进行中的请求数，未启用 Redis 时只统计当前节点
+func GetInFlightCounts(kind string, scope string, ids []int) (map[int]int, error) {
+	counts := make(map[int]int, len(ids))
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	if !common.RedisEnabled {
+		inFlightLock.Lock()
+		defer inFlightLock.Unlock()
+		for _, id := range ids {
+			counts[id] = inFlightCounts[inFlightKey(kind, scope, id)]
+		}
+		return counts, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = inFlightKey(kind, scope, id)
+	}
+	values, err := inFlightCountScript.Run(context.Background(), common.RDB, keys).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(ids) {
+		return nil, fmt.Errorf("invalid inflight count result")
+	}
+	for i, id := range ids {
+		counts[id] = int(values[i])
+	}
+	return counts, nil
+}
+
+// FillTokensInFlight 填充令牌当前进行中的请求数和 realtime 会话数
+func FillTokensInFlight(tokens []*Token) {
+	ids := make([]int, 0, len(tokens))
+	for _, token := range tokens {
+		ids = append(ids, token.Id)
+	}
+	requests, err := GetInFlightCounts(InFlightKindRequest, InFlightScopeToken, ids)
+	if err != nil {
+		common.SysError("failed to get token inflight requests: " + err.Error())
+		return
+	}
+	sessions, err := GetInFlightCounts(InFlightKindRealtime, InFlightScopeToken, ids)
+	if err != nil {
+		common.SysError("failed to get token realtime sessions: " + err.Error())
+		return
+	}
+	for _, token := range tokens {
+		token.InFlightRequests = requests[token.Id]
+		token.RealtimeSessions = sessions[token.Id]
+	}
+}
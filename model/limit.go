@@ -17,12 +17,20 @@ type Limit struct {
 	TokenID   int    `json:"token_id" gorm:"index;not null;type:int"`
 	TokenName string `json:"token_name" gorm:"index;type:varchar(100);not null"`
 
-	RPMLimit            int   `json:"rpm_limit" gorm:"default:0;not null;type:int"`
-	RPMLimitEnabled     bool  `json:"rpm_limit_enabled" gorm:"default:false;not null;type:tinyint(1)"`
+	RPMLimit        int  `json:"rpm_limit" gorm:"default:0;not null;type:int"`
+	RPMLimitEnabled bool `json:"rpm_limit_enabled" gorm:"default:false;not null;type:tinyint(1)"`
+	// RPMBurst 空闲时最多可以连续发出的请求数，为 0 时等于 RPMLimit
+	RPMBurst            int   `json:"rpm_burst" gorm:"default:0;not null;type:int"`
 	WaitDurationSeconds int64 `json:"wait_duration_seconds" gorm:"default:0;not null;type:bigint"`
 	RelayTimeoutSeconds int64 `json:"relay_timeout_seconds" gorm:"default:0;not null;type:bigint"`
-	CreatedAt           int64 `json:"created_at" gorm:"autoCreateTime;index;type:bigint"`
-	UpdatedAt           int64 `json:"updated_at" gorm:"autoUpdateTime;type:bigint"`
+	// TPM/TPD 限制按 token 数计算；token_name、model_name 为 * 时对该用户所有令牌、所有模型生效，
+	// user_id 为 0 时为全局限制，所有匹配的请求共用同一个计数
+	TPMLimit        int64 `json:"tpm_limit" gorm:"default:0;not null;type:bigint"`
+	TPMLimitEnabled bool  `json:"tpm_limit_enabled" gorm:"default:false;not null;type:tinyint(1)"`
+	TPDLimit        int64 `json:"tpd_limit" gorm:"default:0;not null;type:bigint"`
+	TPDLimitEnabled bool  `json:"tpd_limit_enabled" gorm:"default:false;not null;type:tinyint(1)"`
+	CreatedAt       int64 `json:"created_at" gorm:"autoCreateTime;index;type:bigint"`
+	UpdatedAt       int64 `json:"updated_at" gorm:"autoUpdateTime;type:bigint"`
 }
 
 // TableName 指定表名
@@ -86,3 +94,40 @@ func GetUserTokenModelLimitWithCache(userId int, tokenName, modelName string) (*
 
 	return limit, nil
 }
+
+// LimitWildcard TPM/TPD 限制的 token_name、model_name 为该值时匹配所有令牌、所有模型
+const LimitWildcard = "*"
+
+// GetTokenRateLimits 获取对用户、令牌和模型生效的 TPM/TPD 限制，包括通配和全局的限制
+func GetTokenRateLimits(userId int, tokenName, modelName string) ([]*Limit, error) {
+	var limits []*Limit
+	err := DB.Where("user_id IN ? AND token_name IN ? AND model_name IN ?",
+		[]int{userId, 0}, []string{tokenName, LimitWildcard}, []string{modelName, LimitWildcard}).
+		Where("(tpm_limit_enabled = ? AND tpm_limit > 0) OR (tpd_limit_enabled = ? AND tpd_limit > 0)", true, true).
+		Order("id asc").Find(&limits).Error
+	return limits, err
+}
+
+// GetTokenRateLimitsWithCache 带缓存的获取 TPM/TPD 限制（1秒过期）
+func GetTokenRateLimitsWithCache(userId int, tokenName, modelName string) ([]*Limit, error) {
+	if !common.RedisEnabled {
+		return GetTokenRateLimits(userId, tokenName, modelName)
+	}
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("token_rate_limit_cache:%d:%s:%s", userId, tokenName, modelName)
+	cachedData, err := common.RDB.Get(ctx, cacheKey).Result()
+	if err == nil && cachedData != "" {
+		var limits []*Limit
+		if err := json.Unmarshal([]byte(cachedData), &limits); err == nil {
+			return limits, nil
+		}
+	}
+	limits, err := GetTokenRateLimits(userId, tokenName, modelName)
+	if err != nil {
+		return nil, err
+	}
+	if limitsJson, err := json.Marshal(limits); err == nil {
+		common.RDB.Set(ctx, cacheKey, limitsJson, time.Second)
+	}
+	return limits, nil
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"one-api/common"
 	"one-api/metrics"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -65,15 +64,12 @@ func formatUserLogs(logs []*Log) {
 }
 
 func GetLogByKey(key string) (logs []*Log, err error) {
-	if os.Getenv("LOG_SQL_DSN") != "" {
-		var tk Token
-		if err = DB.Model(&Token{}).Where(keyCol+"=?", strings.TrimPrefix(key, "sk-")).First(&tk).Error; err != nil {
-			return nil, err
-		}
-		err = LOG_DB.Model(&Log{}).Where("token_id=?", tk.Id).Find(&logs).Error
-	} else {
-		err = LOG_DB.Joins("left join tokens on tokens.id = logs.token_id").Where("tokens.key = ?", strings.TrimPrefix(key, "sk-")).Find(&logs).Error
+	// 令牌只保存哈希，先找到令牌再按 token_id 查询日志
+	token, err := GetTokenByKey(strings.TrimPrefix(key, "sk-"), true)
+	if err != nil {
+		return nil, err
 	}
+	err = LOG_DB.Model(&Log{}).Where("token_id=?", token.Id).Find(&logs).Error
 	formatUserLogs(logs)
 	return logs, err
 }
@@ -96,6 +92,34 @@ func RecordLog(userId int, logType int, content string) {
 	}
 }
 
+// RecordTokenScopeDeniedLog 记录令牌因接口范围不足被拒绝的请求
+func RecordTokenScopeDeniedLog(c *gin.Context, userId int, tokenId int, tokenName string, scope string) {
+	username, _ := GetUsernameById(userId, false)
+	content := fmt.Sprintf("令牌「%s」没有 %s 范围，拒绝访问 %s %s", tokenName, scope, c.Request.Method, c.Request.URL.Path)
+	if scope == "" {
+		content = fmt.Sprintf("令牌「%s」设置了接口范围，拒绝访问未归类的接口 %s %s", tokenName, c.Request.Method, c.Request.URL.Path)
+	}
+	log := &Log{
+		UserId:    userId,
+		RequestID: c.GetString(common.RequestIdKey),
+		Username:  username,
+		CreatedAt: common.GetBeijingTimestamp(),
+		Type:      LogTypeSystem,
+		Content:   content,
+		TokenName: tokenName,
+		TokenId:   tokenId,
+		Other: common.MapToJsonStr(map[string]interface{}{
+			"scope":     scope,
+			"path":      c.Request.URL.Path,
+			"client_ip": c.ClientIP(),
+		}),
+	}
+	err := LOG_DB.Create(log).Error
+	if err != nil {
+		common.LogError(c, "failed to record token scope denied log: "+err.Error())
+	}
+}
+
 // 添加新的全局变量
 var (
 	currentLogTable  atomic.Value
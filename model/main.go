@@ -217,6 +217,10 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
+	err = MigrateTokenKeys()
+	if err != nil {
+		return err
+	}
 	err = DB.AutoMigrate(&User{})
 	if err != nil {
 		return err
@@ -237,6 +241,14 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
+	err = DB.AutoMigrate(&AuditLog{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&AdminRole{})
+	if err != nil {
+		return err
+	}
 	err = DB.AutoMigrate(&Midjourney{})
 	if err != nil {
 		return err
@@ -269,6 +281,42 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
+	err = DB.AutoMigrate(&File{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&Batch{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&BatchRequest{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&AsyncRequest{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&ChannelKey{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&SpendBudget{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&Organization{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&OrganizationMember{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&OrganizationInvitation{})
+	if err != nil {
+		return err
+	}
 	common.SysLog("database migrated")
 	err = createRootAccountIfNeed()
 	return err
@@ -279,6 +327,9 @@ func migrateLOGDB() error {
 	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = LOG_DB.AutoMigrate(&AuditLog{}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -288,6 +339,11 @@ func migrateCentralDB() error {
 	if err != nil {
 		return err
 	}
+	// 迁移自适应限速调整记录表
+	err = CENTRAL_DB.AutoMigrate(&UserRateLimitAdjustment{})
+	if err != nil {
+		return err
+	}
 
 	common.SysLog("central control database migrated")
 	return nil
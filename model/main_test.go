@@ -0,0 +1,35 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB 使用内存中的 SQLite 作为 DB 和 LOG_DB，测试结束后恢复
+func setupTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个连接都是独立的内存数据库，只保留一个连接
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	originDB, originLogDB, originRedisEnabled := DB, LOG_DB, common.RedisEnabled
+	DB, LOG_DB, common.RedisEnabled = db, db, false
+	t.Cleanup(func() {
+		DB, LOG_DB, common.RedisEnabled = originDB, originLogDB, originRedisEnabled
+		sqlDB.Close()
+	})
+	return db
+}
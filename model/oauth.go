@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"one-api/common"
 
 	"gorm.io/gorm"
 )
@@ -11,7 +12,7 @@ type OAuth struct {
 	Type                    string `json:"type" gorm:"type:varchar(64);not null;default:'service_account'"`
 	ProjectId               string `json:"project_id" gorm:"type:varchar(255);index"`
 	PrivateKeyId            string `json:"private_key_id" gorm:"type:varchar(255);uniqueIndex"`
-	PrivateKey              string `json:"private_key" gorm:"type:text;not null"`
+	PrivateKey              string `json:"private_key" gorm:"type:text;serializer:secret;not null"`
 	PublicKey               string `json:"public_key" gorm:"type:text"`
 	ClientEmail             string `json:"client_email" gorm:"type:varchar(255);index"`
 	ClientId                string `json:"client_id" gorm:"type:varchar(255)"`
@@ -22,7 +23,7 @@ type OAuth struct {
 	UniverseDomain          string `json:"universe_domain" gorm:"type:varchar(255);default:'googleapis.com'"`
 	Name                    string `json:"name" gorm:"type:varchar(255);index"`
 	Status                  int    `json:"status" gorm:"type:int;default:1"`
-	AccessToken             string `json:"access_token" gorm:"type:text"`
+	AccessToken             string `json:"access_token" gorm:"type:text;serializer:secret"`
 	ClientAccessToken       string `json:"client_access_token" gorm:"type:text"`
 	ExpiresIn               int    `json:"expires_in" gorm:"type:int;default:3599"`
 	ChannelId               int    `json:"channel_id" gorm:"type:int;index"`
@@ -53,10 +54,14 @@ func GetOAuthByPrivateKeyIdAndPrivateKey(privateKeyId, privateKey string) (*OAut
 		return nil, nil
 	}
 	var oauth OAuth
-	err := DB.First(&oauth, "private_key_id = ? AND private_key = ?", privateKeyId, privateKey).Error
+	err := DB.First(&oauth, "private_key_id = ?", privateKeyId).Error
 	if err != nil {
 		return nil, err
 	}
+	// private_key 加密保存，无法在数据库中比较
+	if oauth.PrivateKey != privateKey {
+		return nil, gorm.ErrRecordNotFound
+	}
 	return &oauth, nil
 }
 
@@ -74,8 +79,12 @@ func SetOAuthAccessToken(oauth *OAuth, accessToken string, expiresIn int) error
 	oauth.ExpiresIn = expiresIn
 
 	// 更新数据库
+	encryptedAccessToken, err := common.EncryptSecret(accessToken)
+	if err != nil {
+		return err
+	}
 	return DB.Model(oauth).Updates(map[string]interface{}{
-		"access_token": accessToken,
+		"access_token": encryptedAccessToken,
 		"expires_in":   expiresIn,
 	}).Error
 }
@@ -110,6 +110,7 @@ func InitOptionMap() {
 	common.OptionMap["ModelPrice"] = operation_setting.ModelPrice2JSONString()
 	common.OptionMap["CacheRatio"] = operation_setting.CacheRatio2JSONString()
 	common.OptionMap["GroupRatio"] = setting.GroupRatio2JSONString()
+	common.OptionMap["GroupChannelSelectStrategy"] = setting.GroupChannelSelectStrategy2JSONString()
 	common.OptionMap["UserUsableGroups"] = setting.UserUsableGroups2JSONString()
 	common.OptionMap["CompletionRatio"] = operation_setting.CompletionRatio2JSONString()
 	common.OptionMap["TopUpLink"] = common.TopUpLink
@@ -132,6 +133,7 @@ func InitOptionMap() {
 	common.OptionMap["CheckSensitiveOnPromptEnabled"] = strconv.FormatBool(setting.CheckSensitiveOnPromptEnabled)
 	common.OptionMap["StopOnSensitiveEnabled"] = strconv.FormatBool(setting.StopOnSensitiveEnabled)
 	common.OptionMap["SensitiveWords"] = setting.SensitiveWordsToString()
+	common.OptionMap["IPDenyList"] = setting.IPDenyList
 	common.OptionMap["StreamCacheQueueLength"] = strconv.Itoa(setting.StreamCacheQueueLength)
 	common.OptionMap["AutomaticDisableKeywords"] = operation_setting.AutomaticDisableKeywordsToString()
 
@@ -148,7 +150,16 @@ func InitOptionMap() {
 func loadOptionsFromDatabase() {
 	options, _ := AllOption()
 	for _, option := range options {
-		err := updateOptionMap(option.Key, option.Value)
+		value := option.Value
+		if isSecretOption(option.Key) {
+			var err error
+			value, err = common.DecryptSecret(value)
+			if err != nil {
+				common.SysError("failed to decrypt option " + option.Key + ": " + err.Error())
+				continue
+			}
+		}
+		err := updateOptionMap(option.Key, value)
 		if err != nil {
 			common.SysError("failed to update option map: " + err.Error())
 		}
@@ -171,13 +182,20 @@ func UpdateOption(key string, value string) error {
 	// https://gorm.io/docs/update.html#Save-All-Fields
 	DB.FirstOrCreate(&option, Option{Key: key})
 	option.Value = value
+	if isSecretOption(key) {
+		encrypted, err := common.EncryptSecret(value)
+		if err != nil {
+			return err
+		}
+		option.Value = encrypted
+	}
 	// Save is a combination function.
 	// If save value does not contain primary key, it will execute Create,
 	// otherwise it will execute Update (with all fields).
 	DB.Save(&option)
 	if key == "GroupRatio" {
 		groups := make(map[string]int)
-		err := json.Unmarshal([]byte(option.Value), &groups)
+		err := json.Unmarshal([]byte(value), &groups)
 		if err != nil {
 			return err
 		}
@@ -387,6 +405,8 @@ func updateOptionMap(key string, value string) (err error) {
 		err = operation_setting.UpdateModelRatioByJSONString(value)
 	case "GroupRatio":
 		err = setting.UpdateGroupRatioByJSONString(value)
+	case "GroupChannelSelectStrategy":
+		err = setting.UpdateGroupChannelSelectStrategyByJSONString(value)
 	case "UserUsableGroups":
 		err = setting.UpdateUserUsableGroupsByJSONString(value)
 	case "CompletionRatio":
@@ -407,6 +427,8 @@ func updateOptionMap(key string, value string) (err error) {
 		common.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
 	case "SensitiveWords":
 		setting.SensitiveWordsFromString(value)
+	case "IPDenyList":
+		setting.IPDenyList = value
 	case "AutomaticDisableKeywords":
 		operation_setting.AutomaticDisableKeywordsFromString(value)
 	case "StreamCacheQueueLength":
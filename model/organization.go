@@ -0,0 +1,562 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 组织：成员的请求从组织的共享额度池扣费，令牌、日志和统计数据仍属于成员自己。
+// 每个成员可以设置子预算，成员从额度池累计消耗的额度不能超过子预算，子预算为 0 时不限制。
+// 一个用户最多属于一个组织，充值仍然进入用户自己的额度。组织管理员只能邀请用户，用户接受邀请后才成为成员，
+// 组织只能查看成员加入之后的日志和统计数据
+const (
+	OrganizationRoleMember = 1
+	OrganizationRoleAdmin  = 10
+	OrganizationRoleOwner  = 100
+)
+
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);index"`
+	OwnerId     int    `json:"owner_id" gorm:"index"`
+	Quota       int    `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"type:int;default:0"`
+	Status      int    `json:"status" gorm:"type:int;default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+type OrganizationMember struct {
+	Id             int `json:"id"`
+	OrganizationId int `json:"organization_id" gorm:"index"`
+	UserId         int `json:"user_id" gorm:"uniqueIndex"`
+	Role           int `json:"role" gorm:"type:int;default:1"`
+	// QuotaLimit 成员的子预算，为 0 时不限制；UsedQuota 为成员从额度池累计消耗的额度
+	QuotaLimit  int   `json:"quota_limit" gorm:"type:int;default:0"`
+	UsedQuota   int   `json:"used_quota" gorm:"type:int;default:0"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+	// Username 只在接口中返回
+	Username string `json:"username" gorm:"-"`
+}
+
+// OrganizationInvitation 待用户接受的组织邀请，接受后按邀请中的角色和子预算成为成员
+type OrganizationInvitation struct {
+	Id             int   `json:"id"`
+	OrganizationId int   `json:"organization_id" gorm:"uniqueIndex:idx_org_invitation"`
+	UserId         int   `json:"user_id" gorm:"uniqueIndex:idx_org_invitation;index"`
+	InviterId      int   `json:"inviter_id"`
+	Role           int   `json:"role" gorm:"type:int;default:1"`
+	QuotaLimit     int   `json:"quota_limit" gorm:"type:int;default:0"`
+	CreatedTime    int64 `json:"created_time" gorm:"bigint"`
+	// Username 被邀请的用户名，OrganizationName 组织名，只在接口中返回
+	Username         string `json:"username" gorm:"-"`
+	OrganizationName string `json:"organization_name" gorm:"-"`
+}
+
+var (
+	ErrOrganizationMemberExists     = errors.New("该用户已属于一个组织")
+	ErrOrganizationInvitationExists = errors.New("已邀请过该用户")
+)
+
+func GetOrganizationById(id int) (*Organization, error) {
+	var org Organization
+	err := DB.First(&org, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	tx := DB.Model(&Organization{})
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+// CreateOrganization 创建组织，owner 同时成为组织的成员
+func CreateOrganization(name string, ownerId int, quota int) (*Organization, error) {
+	org := &Organization{
+		Name:        name,
+		OwnerId:     ownerId,
+		Quota:       quota,
+		Status:      common.UserStatusEnabled,
+		CreatedTime: common.GetTimestamp(),
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&OrganizationMember{}).Where("user_id = ?", ownerId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOrganizationMemberExists
+		}
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrganizationId: org.Id,
+			UserId:         ownerId,
+			Role:           OrganizationRoleOwner,
+			CreatedTime:    org.CreatedTime,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidateOrganizationMemberCache(ownerId)
+	return org, nil
+}
+
+// UpdateOrganization 修改组织的名称和状态
+func (org *Organization) Update() error {
+	return DB.Model(org).Select("name", "status").Updates(org).Error
+}
+
+// DeleteOrganization 删除组织和所有成员关系，额度池中剩余的额度不退回
+func DeleteOrganization(id int) error {
+	var userIds []int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&OrganizationMember{}).Where("organization_id = ?", id).Pluck("user_id", &userIds).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&OrganizationInvitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Organization{}, "id = ?", id).Error
+	})
+	for _, userId := range userIds {
+		invalidateOrganizationMemberCache(userId)
+	}
+	return err
+}
+
+// IncreaseOrganizationQuota 调整额度池，quota 为负数时扣减，扣减后不能小于 0
+func IncreaseOrganizationQuota(id int, quota int) error {
+	tx := DB.Model(&Organization{}).Where("id = ?", id)
+	if quota < 0 {
+		tx = tx.Where("quota >= ?", -quota)
+	}
+	result := tx.Update("quota", gorm.Expr("quota + ?", quota))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("组织额度池余额不足")
+	}
+	return nil
+}
+
+// TransferQuotaToOrganization 将用户自己的额度转入所属组织的额度池
+func TransferQuotaToOrganization(userId int, orgId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("转入额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用户额度不足")
+		}
+		return tx.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := cacheDecrUserQuota(userId, int64(quota)); err != nil {
+		common.SysError("failed to decrease user quota cache: " + err.Error())
+	}
+	return nil
+}
+
+func GetOrganizationMembers(orgId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	err := DB.Where("organization_id = ?", orgId).Order("role desc, id asc").Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	userIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserId)
+	}
+	var users []*User
+	if err := DB.Select("id", "username").Where("id IN ?", userIds).Find(&users).Error; err == nil {
+		usernames := make(map[int]string, len(users))
+		for _, user := range users {
+			usernames[user.Id] = user.Username
+		}
+		for _, member := range members {
+			member.Username = usernames[member.UserId]
+		}
+	}
+	return members, nil
+}
+
+// CreateOrganizationInvitation 邀请用户加入组织，用户已属于组织或已被该组织邀请时返回错误
+func CreateOrganizationInvitation(orgId int, inviterId int, userId int, role int, quotaLimit int) (*OrganizationInvitation, error) {
+	invitation := &OrganizationInvitation{
+		OrganizationId: orgId,
+		UserId:         userId,
+		InviterId:      inviterId,
+		Role:           role,
+		QuotaLimit:     quotaLimit,
+		CreatedTime:    common.GetTimestamp(),
+	}
+	var count int64
+	if err := DB.Model(&OrganizationMember{}).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrOrganizationMemberExists
+	}
+	if err := DB.Model(&OrganizationInvitation{}).Where("organization_id = ? AND user_id = ?", orgId, userId).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrOrganizationInvitationExists
+	}
+	if err := DB.Create(invitation).Error; err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// GetOrganizationInvitations 获取组织发出的待接受邀请
+func GetOrganizationInvitations(orgId int) ([]*OrganizationInvitation, error) {
+	var invitations []*OrganizationInvitation
+	err := DB.Where("organization_id = ?", orgId).Order("id desc").Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+	userIds := make([]int, 0, len(invitations))
+	for _, invitation := range invitations {
+		userIds = append(userIds, invitation.UserId)
+	}
+	var users []*User
+	if err := DB.Select("id", "username").Where("id IN ?", userIds).Find(&users).Error; err == nil {
+		usernames := make(map[int]string, len(users))
+		for _, user := range users {
+			usernames[user.Id] = user.Username
+		}
+		for _, invitation := range invitations {
+			invitation.Username = usernames[invitation.UserId]
+		}
+	}
+	return invitations, nil
+}
+
+// GetUserOrganizationInvitations 获取用户收到的待接受邀请
+func GetUserOrganizationInvitations(userId int) ([]*OrganizationInvitation, error) {
+	var invitations []*OrganizationInvitation
+	err := DB.Where("user_id = ?", userId).Order("id desc").Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+	orgIds := make([]int, 0, len(invitations))
+	for _, invitation := range invitations {
+		orgIds = append(orgIds, invitation.OrganizationId)
+	}
+	var orgs []*Organization
+	if err := DB.Select("id", "name").Where("id IN ?", orgIds).Find(&orgs).Error; err == nil {
+		names := make(map[int]string, len(orgs))
+		for _, org := range orgs {
+			names[org.Id] = org.Name
+		}
+		for _, invitation := range invitations {
+			invitation.OrganizationName = names[invitation.OrganizationId]
+		}
+	}
+	return invitations, nil
+}
+
+// DeleteOrganizationInvitation 删除邀请，orgId 不为 0 时只删除该组织发出的邀请，userId 不为 0 时只删除该用户收到的邀请
+func DeleteOrganizationInvitation(id int, orgId int, userId int) error {
+	tx := DB.Where("id = ?", id)
+	if orgId != 0 {
+		tx = tx.Where("organization_id = ?", orgId)
+	}
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	result := tx.Delete(&OrganizationInvitation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("邀请不存在")
+	}
+	return nil
+}
+
+// AcceptOrganizationInvitation 用户接受邀请成为组织成员，加入时间为接受的时间，用户收到的其他邀请随之删除
+func AcceptOrganizationInvitation(id int, userId int) (*OrganizationMember, error) {
+	var member *OrganizationMember
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var invitation OrganizationInvitation
+		if err := tx.Where("id = ? AND user_id = ?", id, userId).First(&invitation).Error; err != nil {
+			return errors.New("邀请不存在")
+		}
+		var org Organization
+		if err := tx.Select("id", "status").First(&org, "id = ?", invitation.OrganizationId).Error; err != nil {
+			return errors.New("组织不存在")
+		}
+		if org.Status != common.UserStatusEnabled {
+			return errors.New("组织已被禁用")
+		}
+		var count int64
+		if err := tx.Model(&OrganizationMember{}).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOrganizationMemberExists
+		}
+		member = &OrganizationMember{
+			OrganizationId: invitation.OrganizationId,
+			UserId:         userId,
+			Role:           invitation.Role,
+			QuotaLimit:     invitation.QuotaLimit,
+			CreatedTime:    common.GetTimestamp(),
+		}
+		if err := tx.Create(member).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userId).Delete(&OrganizationInvitation{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidateOrganizationMemberCache(userId)
+	return member, nil
+}
+
+// GetOrganizationMember 获取用户所属组织的成员关系，用户不属于任何组织时返回 gorm.ErrRecordNotFound
+func GetOrganizationMember(userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := DB.First(&member, "user_id = ?", userId).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// UpdateRoleAndQuotaLimit 修改成员的角色和子预算
+func (member *OrganizationMember) UpdateRoleAndQuotaLimit() error {
+	err := DB.Model(member).Select("role", "quota_limit").Updates(member).Error
+	invalidateOrganizationMemberCache(member.UserId)
+	return err
+}
+
+// ResetUsedQuota 清零成员已消耗的额度，子预算重新开始计算
+func (member *OrganizationMember) ResetUsedQuota() error {
+	member.UsedQuota = 0
+	err := DB.Model(member).Update("used_quota", 0).Error
+	invalidateOrganizationMemberCache(member.UserId)
+	return err
+}
+
+func (member *OrganizationMember) Delete() error {
+	err := DB.Delete(member).Error
+	invalidateOrganizationMemberCache(member.UserId)
+	return err
+}
+
+func organizationMemberCacheKey(userId int) string {
+	return fmt.Sprintf("org_member_cache:%d", userId)
+}
+
+func invalidateOrganizationMemberCache(userId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	if err := common.RedisDel(organizationMemberCacheKey(userId)); err != nil {
+		common.SysError("failed to invalidate organization member cache: " + err.Error())
+	}
+}
+
+// getBillingMember 获取扣费使用的成员关系（1秒缓存），用户不属于组织或组织已停用时返回 nil
+func getBillingMember(userId int) (*OrganizationMember, error) {
+	var member *OrganizationMember
+	ctx := context.Background()
+	if common.RedisEnabled {
+		cachedData, err := common.RDB.Get(ctx, organizationMemberCacheKey(userId)).Result()
+		if err == nil && cachedData != "" {
+			if err := json.Unmarshal([]byte(cachedData), &member); err == nil {
+				return member, nil
+			}
+		}
+	}
+	var members []*OrganizationMember
+	err := DB.Table("organization_members").
+		Select("organization_members.*").
+		Joins("JOIN organizations ON organizations.id = organization_members.organization_id").
+		Where("organization_members.user_id = ? AND organizations.status = ?", userId, common.UserStatusEnabled).
+		Limit(1).Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(members) > 0 {
+		member = members[0]
+	}
+	if common.RedisEnabled {
+		if memberJson, err := json.Marshal(member); err == nil {
+			common.RDB.Set(ctx, organizationMemberCacheKey(userId), memberJson, time.Second)
+		}
+	}
+	return member, nil
+}
+
+// GetBillingQuota 获取用户可用于请求的额度：组织成员为额度池余额和剩余子预算中较小的一个，其他用户为自己的额度
+func GetBillingQuota(userId int) (int, error) {
+	member, err := getBillingMember(userId)
+	if err != nil {
+		return 0, err
+	}
+	if member == nil {
+		return GetUserQuota(userId, false)
+	}
+	var org Organization
+	if err := DB.Select("quota").First(&org, "id = ?", member.OrganizationId).Error; err != nil {
+		return 0, err
+	}
+	quota := org.Quota
+	if member.QuotaLimit > 0 {
+		quota = min(quota, member.QuotaLimit-member.UsedQuota)
+	}
+	return quota, nil
+}
+
+// DecreaseBillingQuota 扣减用户的额度，组织成员从额度池扣减并累计到成员已消耗的额度
+func DecreaseBillingQuota(userId int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return deltaUpdateBillingQuota(userId, -quota)
+}
+
+// IncreaseBillingQuota 退回用户的额度，组织成员退回到额度池
+func IncreaseBillingQuota(userId int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return deltaUpdateBillingQuota(userId, quota)
+}
+
+func deltaUpdateBillingQuota(userId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	member, err := getBillingMember(userId)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		if delta > 0 {
+			return IncreaseUserQuota(userId, delta, false)
+		}
+		return DecreaseUserQuota(userId, -delta)
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Organization{}).Where("id = ?", member.OrganizationId).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota + ?", delta),
+			"used_quota": gorm.Expr("used_quota - ?", delta),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&OrganizationMember{}).Where("id = ?", member.Id).
+			Update("used_quota", gorm.Expr("used_quota - ?", delta)).Error
+	})
+	if err == nil && member.QuotaLimit > 0 {
+		// 缓存中的 used_quota 用于子预算检查，变化后立即失效
+		invalidateOrganizationMemberCache(userId)
+	}
+	return err
+}
+
+// organizationMemberScope 限定为组织成员加入组织之后的记录，成员加入之前的记录不属于组织
+func organizationMemberScope(db *gorm.DB, orgId int) (*gorm.DB, error) {
+	var members []*OrganizationMember
+	if err := DB.Select("user_id", "created_time").Where("organization_id = ?", orgId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	scope := db.Where("user_id = ? AND created_at >= ?", members[0].UserId, members[0].CreatedTime)
+	for _, member := range members[1:] {
+		scope = scope.Or("user_id = ? AND created_at >= ?", member.UserId, member.CreatedTime)
+	}
+	return scope, nil
+}
+
+// GetOrganizationLogs 分页获取组织所有成员加入组织之后的日志，username 不为空时只查询该成员
+func GetOrganizationLogs(orgId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, startIdx int, num int) (logs []*Log, total int64, err error) {
+	scope, err := organizationMemberScope(LOG_DB, orgId)
+	if err != nil || scope == nil {
+		return nil, 0, err
+	}
+	tableNames := getTableNamesByTimeRange(startTimestamp, endTimestamp)
+	allLogs := make([]*Log, 0)
+	for _, tableName := range tableNames {
+		var tempTotal int64
+		var tempLogs []*Log
+		tx := LOG_DB.Table(tableName).Where(scope)
+		if logType != LogTypeUnknown {
+			tx = tx.Where("type = ?", logType)
+		}
+		if modelName != "" {
+			tx = tx.Where("model_name like ?", modelName)
+		}
+		if username != "" {
+			tx = tx.Where("username = ?", username)
+		}
+		if startTimestamp != 0 {
+			tx = tx.Where("created_at >= ?", startTimestamp)
+		}
+		if endTimestamp != 0 {
+			tx = tx.Where("created_at <= ?", endTimestamp)
+		}
+		if err = tx.Count(&tempTotal).Error; err != nil {
+			return nil, 0, err
+		}
+		total += tempTotal
+		if err = tx.Order("id desc").Limit(startIdx + num).Find(&tempLogs).Error; err != nil {
+			return nil, 0, err
+		}
+		allLogs = append(allLogs, tempLogs...)
+	}
+	sort.Slice(allLogs, func(i, j int) bool {
+		return allLogs[i].CreatedAt > allLogs[j].CreatedAt
+	})
+	end := min(startIdx+num, len(allLogs))
+	if startIdx < len(allLogs) {
+		logs = allLogs[startIdx:end]
+	}
+	formatUserLogs(logs)
+	return logs, total, nil
+}
+
+// GetOrganizationQuotaData 获取组织所有成员加入组织之后的统计数据，统计数据按小时汇总，不包括成员加入时所在的小时
+func GetOrganizationQuotaData(orgId int, startTime int64, endTime int64) ([]*QuotaData, error) {
+	scope, err := organizationMemberScope(DB, orgId)
+	if err != nil || scope == nil {
+		return nil, err
+	}
+	var quotaDatas []*QuotaData
+	err = DB.Table("quota_data").Where(scope).Where("created_at >= ? and created_at <= ?", startTime, endTime).
+		Find(&quotaDatas).Error
+	return quotaDatas, err
+}
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 自适应限速使用的请求统计：按分钟记录每个用户在每个分组、模型上的请求数、上游 429 次数和渠道并发已满的次数，
+// 启用 Redis 时所有节点写入同一份统计，未启用时只统计当前节点
+const (
+	RateLimitStatRequests  = "requests"
+	RateLimitStatThrottled = "throttled"
+	RateLimitStatSaturated = "saturated"
+
+	rateLimitStatsKeyPrefix = "rate_limit_stats:"
+	rateLimitStatsRetention = time.Hour
+)
+
+// RateLimitSample 一个用户在一个分组、模型上一段时间内的请求统计
+type RateLimitSample struct {
+	Username  string
+	Group     string
+	Model     string
+	Requests  int64
+	Throttled int64
+	Saturated int64
+}
+
+var (
+	// memRateLimitStats 未启用 Redis 时的统计，按分钟保存
+	memRateLimitStats     = make(map[int64]map[string]int64)
+	memRateLimitStatsLock sync.Mutex
+)
+
+func rateLimitStatsField(username, group, modelName, stat string) string {
+	field, _ := json.Marshal([]string{username, group, modelName, stat})
+	return string(field)
+}
+
+// RecordRateLimitStat 记录一次请求统计，stat 为 RateLimitStat* 之一
+func RecordRateLimitStat(username, group, modelName, stat string) {
+	minute := time.Now().Unix() / 60
+	field := rateLimitStatsField(username, group, modelName, stat)
+	if !common.RedisEnabled {
+		memRateLimitStatsLock.Lock()
+		defer memRateLimitStatsLock.Unlock()
+		for m := range memRateLimitStats {
+			if m < minute-int64(rateLimitStatsRetention/time.Minute) {
+				delete(memRateLimitStats, m)
+			}
+		}
+		if memRateLimitStats[minute] == nil {
+			memRateLimitStats[minute] = make(map[string]int64)
+		}
+		memRateLimitStats[minute][field]++
+		return
+	}
+	ctx := context.Background()
+	key := fmt.Sprintf("%s%d", rateLimitStatsKeyPrefix, minute)
+	pipe := common.RDB.Pipeline()
+	pipe.HIncrBy(ctx, key, field, 1)
+	pipe.Expire(ctx, key, rateLimitStatsRetention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		common.SysError("failed to record rate limit stats: " + err.Error())
+	}
+}
+
+// GetRateLimitSamples 汇总最近 minutes 个完整分钟内的请求统计
+func GetRateLimitSamples(minutes int) ([]*RateLimitSample, error) {
+	current := time.Now().Unix() / 60
+	samples := make(map[[3]string]*RateLimitSample)
+	add := func(field string, count int64) {
+		var parts []string
+		if err := json.Unmarshal([]byte(field), &parts); err != nil || len(parts) != 4 {
+			return
+		}
+		key := [3]string{parts[0], parts[1], parts[2]}
+		sample := samples[key]
+		if sample == nil {
+			sample = &RateLimitSample{Username: parts[0], Group: parts[1], Model: parts[2]}
+			samples[key] = sample
+		}
+		switch parts[3] {
+		case RateLimitStatRequests:
+			sample.Requests += count
+		case RateLimitStatThrottled:
+			sample.Throttled += count
+		case RateLimitStatSaturated:
+			sample.Saturated += count
+		}
+	}
+	for minute := current - int64(minutes); minute < current; minute++ {
+		if !common.RedisEnabled {
+			memRateLimitStatsLock.Lock()
+			for field, count := range memRateLimitStats[minute] {
+				add(field, count)
+			}
+			memRateLimitStatsLock.Unlock()
+			continue
+		}
+		values, err := common.RDB.HGetAll(context.Background(), fmt.Sprintf("%s%d", rateLimitStatsKeyPrefix, minute)).Result()
+		if err != nil {
+			return nil, err
+		}
+		for field, value := range values {
+			count, _ := strconv.ParseInt(value, 10, 64)
+			add(field, count)
+		}
+	}
+	result := make([]*RateLimitSample, 0, len(samples))
+	for _, sample := range samples {
+		result = append(result, sample)
+	}
+	return result, nil
+}
@@ -0,0 +1,158 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"one-api/common"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// SecretSerializer 字段标签 serializer:secret 的字段写入数据库前加密、读取后解密，
+// 只对 Create、Save 和以结构体为参数的 Updates 生效，以 map 或列名更新时需要自行调用 common.EncryptSecret
+type SecretSerializer struct{}
+
+func init() {
+	schema.RegisterSerializer("secret", SecretSerializer{})
+}
+
+func (SecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("unsupported secret value type %T", dbValue)
+	}
+	plaintext, err := common.DecryptSecret(value)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s.%s: %w", field.Schema.Table, field.DBName, err)
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+func (SecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported secret field type %T", fieldValue)
+	}
+	return common.EncryptSecret(value)
+}
+
+// isSecretOption 与 GetOptions 中不返回给前端的配置项一致
+func isSecretOption(key string) bool {
+	return strings.HasSuffix(key, "Token") || strings.HasSuffix(key, "Secret") || strings.HasSuffix(key, "Key")
+}
+
+type secretColumn struct {
+	Table  string
+	Key    string
+	Column string
+}
+
+// secretColumns 需要加密的数据库字段
+var secretColumns = []secretColumn{
+	{Table: "channels", Key: "id", Column: "key"},
+	{Table: "channel_keys", Key: "id", Column: "key"},
+	{Table: "oauth", Key: "id", Column: "private_key"},
+	{Table: "oauth", Key: "id", Column: "access_token"},
+	{Table: "options", Key: "key", Column: "value"},
+}
+
+func quoteColumn(name string) string {
+	if common.UsingPostgreSQL {
+		return `"` + name + `"`
+	}
+	return "`" + name + "`"
+}
+
+// secretRow 和 optionSecretRow 用于按主键分批读取需要加密的字段，字段值统一以 value 读出
+type secretRow struct {
+	Id    int
+	Value string
+}
+
+type optionSecretRow struct {
+	Key   string `gorm:"primaryKey"`
+	Value string
+}
+
+const secretMigrationBatchSize = 500
+
+// migrateSecretValue 加密或重新加密一个字段，返回是否更新了数据库
+func migrateSecretValue(column secretColumn, key interface{}, value string, rotate bool) (bool, error) {
+	var err error
+	switch {
+	case value == "":
+		return false, nil
+	case !common.IsEncryptedSecret(value):
+		value, err = common.EncryptSecret(value)
+	case rotate && !common.IsSecretCurrentKey(value):
+		value, err = common.RewrapSecret(value)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to encrypt %s.%s of %v: %w", column.Table, column.Column, key, err)
+	}
+	err = DB.Table(column.Table).Where(quoteColumn(column.Key)+" = ?", key).Update(column.Column, value).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to update %s.%s of %v: %w", column.Table, column.Column, key, err)
+	}
+	return true, nil
+}
+
+// MigrateSecrets 加密数据库中以明文保存的敏感字段；rotate 为 true 时同时使用当前的 KEK 重新加密由旧 KEK 加密的字段
+func MigrateSecrets(rotate bool) error {
+	if !common.SecretEncryptionEnabled() {
+		return fmt.Errorf("secret encryption is not configured, set CRYPTO_SECRET or CRYPTO_KEK_FILE")
+	}
+	for _, column := range secretColumns {
+		updated := 0
+		migrate := func(key interface{}, value string) error {
+			ok, err := migrateSecretValue(column, key, value, rotate)
+			if ok {
+				updated++
+			}
+			return err
+		}
+		query := DB.Table(column.Table).
+			Select(fmt.Sprintf("%s, %s AS value", quoteColumn(column.Key), quoteColumn(column.Column)))
+		var err error
+		if column.Key == "id" {
+			var rows []secretRow
+			err = query.FindInBatches(&rows, secretMigrationBatchSize, func(tx *gorm.DB, batch int) error {
+				for _, row := range rows {
+					if err := migrate(row.Id, row.Value); err != nil {
+						return err
+					}
+				}
+				return nil
+			}).Error
+		} else {
+			var rows []optionSecretRow
+			err = query.FindInBatches(&rows, secretMigrationBatchSize, func(tx *gorm.DB, batch int) error {
+				for _, row := range rows {
+					if !isSecretOption(row.Key) {
+						continue
+					}
+					if err := migrate(row.Key, row.Value); err != nil {
+						return err
+					}
+				}
+				return nil
+			}).Error
+		}
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s.%s: %w", column.Table, column.Column, err)
+		}
+		common.SysLog(fmt.Sprintf("secrets migrated: %s.%s, %d rows updated", column.Table, column.Column, updated))
+	}
+	return nil
+}
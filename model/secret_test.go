@@ -0,0 +1,216 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"strings"
+	"testing"
+)
+
+func setSecretEncryption(t *testing.T, secret string, previousSecrets string) {
+	t.Helper()
+	t.Setenv("CRYPTO_KEK_FILE", "")
+	t.Setenv("CRYPTO_PREVIOUS_KEK_FILES", "")
+	t.Setenv("CRYPTO_SECRET", secret)
+	t.Setenv("CRYPTO_PREVIOUS_SECRETS", previousSecrets)
+	if err := common.InitSecretEncryption(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rawColumn(t *testing.T, table string, column string, key string, id interface{}) string {
+	t.Helper()
+	var value string
+	if err := DB.Table(table).Select(quoteColumn(column)).Where(quoteColumn(key)+" = ?", id).Row().Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestSecretSerializer(t *testing.T) {
+	setSecretEncryption(t, "secret-a", "")
+	setupTestDB(t, &ChannelKey{})
+	tests := []struct {
+		name      string
+		key       string
+		encrypted bool
+	}{
+		{"plain key", "sk-test", true},
+		{"multi-line key", "{\n  \"type\": \"service_account\"\n}", true},
+		{"empty key", "", false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := &ChannelKey{Id: i + 1, ChannelId: 1, Key: tt.key}
+			if err := DB.Create(key).Error; err != nil {
+				t.Fatal(err)
+			}
+			if raw := rawColumn(t, "channel_keys", "key", "id", key.Id); common.IsEncryptedSecret(raw) != tt.encrypted || strings.Contains(raw, "sk-test") {
+				t.Fatalf("raw value %q, want encrypted %t", raw, tt.encrypted)
+			}
+			var got ChannelKey
+			if err := DB.First(&got, key.Id).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.Key != tt.key {
+				t.Fatalf("key = %q, want %q", got.Key, tt.key)
+			}
+		})
+	}
+	// 加密前以明文保存的数据原样读取
+	if err := DB.Table("channel_keys").Create(map[string]interface{}{"id": 100, "channel_id": 1, "key": "sk-legacy"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var legacy ChannelKey
+	if err := DB.First(&legacy, 100).Error; err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Key != "sk-legacy" {
+		t.Fatalf("legacy key = %q, want %q", legacy.Key, "sk-legacy")
+	}
+}
+
+func TestSecretEncryptDecrypt(t *testing.T) {
+	setSecretEncryption(t, "secret-a", "")
+	encrypted, err := common.EncryptSecret("sk-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := common.EncryptSecret("sk-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted == other {
+		t.Fatalf("the same plaintext should encrypt to different values")
+	}
+	tampered := encrypted[:len(encrypted)-2] + "AA"
+	if tampered == encrypted {
+		tampered = encrypted[:len(encrypted)-2] + "BB"
+	}
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"encrypted", encrypted, "sk-test", false},
+		{"plaintext", "sk-plain", "sk-plain", false},
+		{"empty", "", "", false},
+		{"tampered", tampered, "", true},
+		{"malformed", "enc:v1:bad", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := common.DecryptSecret(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Fatalf("DecryptSecret = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	// 使用其他 KEK 时无法解密
+	setSecretEncryption(t, "secret-b", "")
+	if _, err := common.DecryptSecret(encrypted); err == nil {
+		t.Fatalf("value encrypted with an unknown key should not decrypt")
+	}
+}
+
+func TestMigrateSecrets(t *testing.T) {
+	setSecretEncryption(t, "secret-a", "")
+	setupTestDB(t, &Channel{}, &ChannelKey{}, &OAuth{}, &Option{})
+	if err := DB.Table("channel_keys").Create(map[string]interface{}{"id": 1, "channel_id": 1, "key": "sk-legacy"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Create(&ChannelKey{Id: 2, ChannelId: 1, Key: "sk-encrypted"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 超过一批的数据需要分多批处理
+	legacyKeys := make([]map[string]interface{}, 0, secretMigrationBatchSize*2)
+	for i := 0; i < secretMigrationBatchSize*2; i++ {
+		legacyKeys = append(legacyKeys, map[string]interface{}{"id": 1000 + i, "channel_id": 2, "key": fmt.Sprintf("sk-batch-%d", i)})
+	}
+	if err := DB.Table("channel_keys").CreateInBatches(legacyKeys, 100).Error; err != nil {
+		t.Fatal(err)
+	}
+	options := []Option{
+		{Key: "GitHubClientSecret", Value: "github-secret"},
+		{Key: "SystemName", Value: "New API"},
+		{Key: "TurnstileSiteKey", Value: ""},
+	}
+	if err := DB.Create(&options).Error; err != nil {
+		t.Fatal(err)
+	}
+	encryptedBefore := rawColumn(t, "channel_keys", "key", "id", 2)
+	if err := MigrateSecrets(false); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		table     string
+		column    string
+		key       string
+		id        interface{}
+		want      string
+		encrypted bool
+	}{
+		{"plaintext channel key", "channel_keys", "key", "id", 1, "sk-legacy", true},
+		{"encrypted channel key", "channel_keys", "key", "id", 2, "sk-encrypted", true},
+		{"secret option", "options", "value", "key", "GitHubClientSecret", "github-secret", true},
+		{"other option", "options", "value", "key", "SystemName", "New API", false},
+		{"empty secret option", "options", "value", "key", "TurnstileSiteKey", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := rawColumn(t, tt.table, tt.column, tt.key, tt.id)
+			if common.IsEncryptedSecret(raw) != tt.encrypted {
+				t.Fatalf("raw value %q, want encrypted %t", raw, tt.encrypted)
+			}
+			got, err := common.DecryptSecret(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("value = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if raw := rawColumn(t, "channel_keys", "key", "id", 2); raw != encryptedBefore {
+		t.Fatalf("already encrypted value should not be re-encrypted without rotate")
+	}
+	var plaintextCount int64
+	if err := DB.Table("channel_keys").Where("`key` NOT LIKE ?", "enc:v1:%").Count(&plaintextCount).Error; err != nil {
+		t.Fatal(err)
+	}
+	if plaintextCount != 0 {
+		t.Fatalf("%d channel keys are still plaintext", plaintextCount)
+	}
+
+	// 轮换 KEK：旧 KEK 加密的数据仍可读取，rotate 后改由新 KEK 加密
+	setSecretEncryption(t, "secret-b", "secret-a")
+	if common.IsSecretCurrentKey(encryptedBefore) {
+		t.Fatalf("value encrypted with the previous key should not be current")
+	}
+	if err := MigrateSecrets(false); err != nil {
+		t.Fatal(err)
+	}
+	if raw := rawColumn(t, "channel_keys", "key", "id", 2); raw != encryptedBefore {
+		t.Fatalf("value should not be rewrapped without rotate")
+	}
+	if err := MigrateSecrets(true); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{1, 2, 1000 + secretMigrationBatchSize*2 - 1} {
+		if raw := rawColumn(t, "channel_keys", "key", "id", id); !common.IsSecretCurrentKey(raw) {
+			t.Fatalf("channel key %d is not encrypted with the current key: %q", id, raw)
+		}
+	}
+	var key ChannelKey
+	if err := DB.First(&key, 2).Error; err != nil {
+		t.Fatal(err)
+	}
+	if key.Key != "sk-encrypted" {
+		t.Fatalf("key = %q, want %q", key.Key, "sk-encrypted")
+	}
+}
@@ -0,0 +1,326 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 周期预算：令牌或用户在每天、每周、每月内最多可以消耗的额度，与令牌余额和用户余额同时生效。
+// calendar 按所在时区的自然日、自然周（周一开始）、自然月重置；rolling 统计最近 24 小时、7 天或 30 天，
+// 按天的滚动窗口以小时为粒度、按周和月的以天为粒度。消耗按时间分桶记录，启用 Redis 时所有节点共用
+const (
+	SpendBudgetPeriodDay   = "day"
+	SpendBudgetPeriodWeek  = "week"
+	SpendBudgetPeriodMonth = "month"
+
+	SpendBudgetResetCalendar = "calendar"
+	SpendBudgetResetRolling  = "rolling"
+
+	spendBudgetKeyPrefix = "spend_budget:"
+)
+
+type SpendBudget struct {
+	Id     int `json:"id"`
+	UserId int `json:"user_id" gorm:"index"`
+	// TokenId 为 0 时是用户预算，对用户所有令牌的消耗生效
+	TokenId   int    `json:"token_id" gorm:"index;default:0"`
+	Period    string `json:"period" gorm:"type:varchar(16)"`
+	ResetMode string `json:"reset_mode" gorm:"type:varchar(16);default:'calendar'"`
+	// Timezone 自然日、周、月使用的时区，为空时使用 SPEND_BUDGET_TIMEZONE
+	Timezone string `json:"timezone" gorm:"type:varchar(64);default:''"`
+	Quota    int    `json:"quota" gorm:"default:0"`
+	Enabled  bool   `json:"enabled" gorm:"default:true"`
+	// AdminManaged 由管理员设置的预算，用户只能查看，不能修改或删除
+	AdminManaged bool  `json:"admin_managed" gorm:"default:false"`
+	CreatedTime  int64 `json:"created_time" gorm:"bigint"`
+	UpdatedTime  int64 `json:"updated_time" gorm:"bigint"`
+	// 当前窗口已消耗的额度和下一次重置的时间，只在接口中返回
+	Used      int64 `json:"used" gorm:"-"`
+	ResetTime int64 `json:"reset_time" gorm:"-"`
+}
+
+var spendBudgetLocations sync.Map
+
+func loadSpendBudgetLocation(name string) (*time.Location, error) {
+	if loc, ok := spendBudgetLocations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	spendBudgetLocations.Store(name, loc)
+	return loc, nil
+}
+
+func (budget *SpendBudget) Location() *time.Location {
+	name := budget.Timezone
+	if name == "" {
+		name = constant.SpendBudgetTimezone
+	}
+	loc, err := loadSpendBudgetLocation(name)
+	if err != nil {
+		return common.BeijingLocation
+	}
+	return loc
+}
+
+func (budget *SpendBudget) Validate() error {
+	switch budget.Period {
+	case SpendBudgetPeriodDay, SpendBudgetPeriodWeek, SpendBudgetPeriodMonth:
+	default:
+		return errors.New("预算周期必须为 day、week 或 month")
+	}
+	if budget.ResetMode == "" {
+		budget.ResetMode = SpendBudgetResetCalendar
+	}
+	if budget.ResetMode != SpendBudgetResetCalendar && budget.ResetMode != SpendBudgetResetRolling {
+		return errors.New("重置方式必须为 calendar 或 rolling")
+	}
+	if budget.Timezone != "" {
+		if _, err := loadSpendBudgetLocation(budget.Timezone); err != nil {
+			return fmt.Errorf("无效的时区 %s", budget.Timezone)
+		}
+	}
+	if budget.Quota <= 0 {
+		return errors.New("预算额度必须大于 0")
+	}
+	return nil
+}
+
+// IsUserBudget 是否为用户预算
+func (budget *SpendBudget) IsUserBudget() bool {
+	return budget.TokenId == 0
+}
+
+// periodLength 周期的大致长度，用于滚动窗口和通知去重
+func (budget *SpendBudget) periodLength() time.Duration {
+	switch budget.Period {
+	case SpendBudgetPeriodWeek:
+		return 7 * 24 * time.Hour
+	case SpendBudgetPeriodMonth:
+		return 30 * 24 * time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// window 返回当前窗口包含的分桶（第一个为当前分桶）、窗口开始时间和下一次重置的时间
+func (budget *SpendBudget) window(now time.Time) (buckets []int64, start time.Time, reset time.Time) {
+	if budget.ResetMode == SpendBudgetResetRolling {
+		granularity := 24 * time.Hour
+		if budget.Period == SpendBudgetPeriodDay {
+			granularity = time.Hour
+		}
+		n := int(budget.periodLength() / granularity)
+		current := now.Truncate(granularity)
+		for i := 0; i < n; i++ {
+			buckets = append(buckets, current.Add(-time.Duration(i)*granularity).Unix())
+		}
+		// 滚动窗口没有固定的重置时间，下一个分桶开始时最早的分桶移出窗口
+		return buckets, current.Add(-time.Duration(n-1) * granularity), current.Add(granularity)
+	}
+	local := now.In(budget.Location())
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	switch budget.Period {
+	case SpendBudgetPeriodWeek:
+		start = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		reset = start.AddDate(0, 0, 7)
+	case SpendBudgetPeriodMonth:
+		start = time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, local.Location())
+		reset = start.AddDate(0, 1, 0)
+	default:
+		start = day
+		reset = start.AddDate(0, 0, 1)
+	}
+	return []int64{start.Unix()}, start, reset
+}
+
+// WindowKey 标识当前窗口，滚动窗口按周期长度划分，用于同一窗口内的通知去重
+func (budget *SpendBudget) WindowKey(now time.Time) int64 {
+	if budget.ResetMode == SpendBudgetResetRolling {
+		return now.Truncate(budget.periodLength()).Unix()
+	}
+	_, start, _ := budget.window(now)
+	return start.Unix()
+}
+
+func spendBudgetBucketKey(budgetId int, bucket int64) string {
+	return fmt.Sprintf("%s%d:%d", spendBudgetKeyPrefix, budgetId, bucket)
+}
+
+var (
+	// memSpendBudgetBuckets 未启用 Redis 时的分桶消耗，值为 {消耗, 过期时间}
+	memSpendBudgetBuckets = make(map[string][2]int64)
+	memSpendBudgetLock    sync.Mutex
+)
+
+// GetUsage 返回当前窗口已消耗的额度和下一次重置的时间
+func (budget *SpendBudget) GetUsage(now time.Time) (used int64, reset time.Time, err error) {
+	buckets, _, reset := budget.window(now)
+	keys := make([]string, len(buckets))
+	for i, bucket := range buckets {
+		keys[i] = spendBudgetBucketKey(budget.Id, bucket)
+	}
+	if !common.RedisEnabled {
+		memSpendBudgetLock.Lock()
+		defer memSpendBudgetLock.Unlock()
+		for _, key := range keys {
+			if value, ok := memSpendBudgetBuckets[key]; ok && value[1] > now.Unix() {
+				used += value[0]
+			}
+		}
+		return used, reset, nil
+	}
+	values, err := common.RDB.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		return 0, reset, err
+	}
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			n, _ := strconv.ParseInt(s, 10, 64)
+			used += n
+		}
+	}
+	return used, reset, nil
+}
+
+// AddSpendBudgetUsage 在预算当前的分桶中记录消耗，quota 为负数时退回
+func AddSpendBudgetUsage(budgets []*SpendBudget, quota int, now time.Time) error {
+	if quota == 0 || len(budgets) == 0 {
+		return nil
+	}
+	if !common.RedisEnabled {
+		memSpendBudgetLock.Lock()
+		defer memSpendBudgetLock.Unlock()
+		for key, value := range memSpendBudgetBuckets {
+			if value[1] <= now.Unix() {
+				delete(memSpendBudgetBuckets, key)
+			}
+		}
+		for _, budget := range budgets {
+			buckets, _, _ := budget.window(now)
+			key := spendBudgetBucketKey(budget.Id, buckets[0])
+			value := memSpendBudgetBuckets[key]
+			value[0] += int64(quota)
+			value[1] = now.Add(budget.periodLength() + 48*time.Hour).Unix()
+			memSpendBudgetBuckets[key] = value
+		}
+		return nil
+	}
+	ctx := context.Background()
+	_, err := common.RDB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, budget := range budgets {
+			buckets, _, _ := budget.window(now)
+			key := spendBudgetBucketKey(budget.Id, buckets[0])
+			pipe.IncrBy(ctx, key, int64(quota))
+			// 自然月最长 31 天，分桶保留到窗口结束之后
+			pipe.Expire(ctx, key, budget.periodLength()+48*time.Hour)
+		}
+		return nil
+	})
+	return err
+}
+
+// MarkSpendBudgetNotified 标记预算在当前窗口已发送 threshold 的通知，已标记过时返回 false
+func MarkSpendBudgetNotified(budget *SpendBudget, threshold int, now time.Time) (bool, error) {
+	key := fmt.Sprintf("%snotified:%d:%d:%d", spendBudgetKeyPrefix, budget.Id, budget.WindowKey(now), threshold)
+	ttl := budget.periodLength() + 48*time.Hour
+	if !common.RedisEnabled {
+		memSpendBudgetLock.Lock()
+		defer memSpendBudgetLock.Unlock()
+		if value, ok := memSpendBudgetBuckets[key]; ok && value[1] > now.Unix() {
+			return false, nil
+		}
+		memSpendBudgetBuckets[key] = [2]int64{1, now.Add(ttl).Unix()}
+		return true, nil
+	}
+	return common.RDB.SetNX(context.Background(), key, 1, ttl).Result()
+}
+
+// GetSpendBudgets 获取对令牌生效的预算，包括令牌所属用户的预算
+func GetSpendBudgets(userId int, tokenId int) ([]*SpendBudget, error) {
+	var budgets []*SpendBudget
+	err := DB.Where("user_id = ? AND token_id IN ? AND enabled = ?", userId, []int{0, tokenId}, true).
+		Order("id asc").Find(&budgets).Error
+	return budgets, err
+}
+
+// GetSpendBudgetsWithCache 带缓存的获取预算（1秒过期）
+func GetSpendBudgetsWithCache(userId int, tokenId int) ([]*SpendBudget, error) {
+	if !common.RedisEnabled {
+		return GetSpendBudgets(userId, tokenId)
+	}
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("spend_budget_cache:%d:%d", userId, tokenId)
+	cachedData, err := common.RDB.Get(ctx, cacheKey).Result()
+	if err == nil && cachedData != "" {
+		var budgets []*SpendBudget
+		if err := json.Unmarshal([]byte(cachedData), &budgets); err == nil {
+			return budgets, nil
+		}
+	}
+	budgets, err := GetSpendBudgets(userId, tokenId)
+	if err != nil {
+		return nil, err
+	}
+	if budgetsJson, err := json.Marshal(budgets); err == nil {
+		common.RDB.Set(ctx, cacheKey, budgetsJson, time.Second)
+	}
+	return budgets, nil
+}
+
+// GetUserSpendBudgets 获取用户的所有预算，包括已停用的
+func GetUserSpendBudgets(userId int) ([]*SpendBudget, error) {
+	var budgets []*SpendBudget
+	err := DB.Where("user_id = ?", userId).Order("id asc").Find(&budgets).Error
+	return budgets, err
+}
+
+// GetSpendBudgetById 获取用户的预算，包括管理员设置的预算
+func GetSpendBudgetById(id int, userId int) (*SpendBudget, error) {
+	var budget SpendBudget
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&budget).Error
+	if err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+func (budget *SpendBudget) Insert() error {
+	budget.CreatedTime = common.GetTimestamp()
+	budget.UpdatedTime = budget.CreatedTime
+	return DB.Create(budget).Error
+}
+
+func (budget *SpendBudget) Update() error {
+	budget.UpdatedTime = common.GetTimestamp()
+	return DB.Model(budget).Select("period", "reset_mode", "timezone", "quota", "enabled", "updated_time").Updates(budget).Error
+}
+
+func (budget *SpendBudget) Delete() error {
+	return DB.Delete(budget).Error
+}
+
+// FillSpendBudgetsUsage 填充预算当前窗口的消耗和重置时间
+func FillSpendBudgetsUsage(budgets []*SpendBudget) {
+	now := time.Now()
+	for _, budget := range budgets {
+		used, reset, err := budget.GetUsage(now)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get spend budget #%d usage: %s", budget.Id, err.Error()))
+			continue
+		}
+		budget.Used = used
+		budget.ResetTime = reset.Unix()
+	}
+}
@@ -1,60 +1,132 @@
 package model
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"one-api/common"
+	"one-api/constant"
 	"strings"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
 )
 
+// TokenKeyPrefixLength 令牌中明文保存、用于查找和展示的前缀长度
+const TokenKeyPrefixLength = 8
+
 type Token struct {
-	Id                 int            `json:"id"`
-	UserId             int            `json:"user_id" gorm:"index"`
-	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`
-	Status             int            `json:"status" gorm:"default:1"`
-	Name               string         `json:"name" gorm:"index" `
-	User               string         `json:"user"`
-	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
-	AccessedTime       int64          `json:"accessed_time" gorm:"bigint"`
-	ExpiredTime        int64          `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
-	RemainQuota        int            `json:"remain_quota" gorm:"default:0"`
-	UnlimitedQuota     bool           `json:"unlimited_quota" gorm:"default:false"`
-	ModelLimitsEnabled bool           `json:"model_limits_enabled" gorm:"default:false"`
-	ModelLimits        string         `json:"model_limits" gorm:"type:varchar(1024);default:''"`
-	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
-	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
-	Group              string         `json:"group" gorm:"default:''"`
-	ModelNameMapping   string         `json:"model_name_mapping" gorm:"type:varchar(1000);default:''"`
-	DeletedAt          gorm.DeletedAt `gorm:"index"`
+	Id     int `json:"id"`
+	UserId int `json:"user_id" gorm:"index"`
+	// Key 完整的令牌，不保存到数据库，只在创建时返回一次；鉴权通过后为请求中携带的令牌
+	Key       string `json:"key,omitempty" gorm:"-"`
+	KeyPrefix string `json:"key_prefix" gorm:"type:varchar(16);index;default:''"`
+	KeySalt   string `json:"-" gorm:"type:varchar(32);default:''"`
+	// KeyHash 加盐的令牌哈希，沿用原来保存明文令牌的 key 列及其唯一索引，升级前的令牌 KeySalt 为空、该列仍为明文
+	KeyHash string `json:"-" gorm:"column:key;type:varchar(64);uniqueIndex"`
+	// 轮换后旧令牌在宽限期内仍然可用，宽限期结束或再次轮换后失效
+	PreviousKeyPrefix      string `json:"previous_key_prefix" gorm:"type:varchar(16);index;default:''"`
+	PreviousKeySalt        string `json:"-" gorm:"type:varchar(32);default:''"`
+	PreviousKeyHash        string `json:"-" gorm:"type:varchar(64);index;default:''"`
+	PreviousKeyExpiredTime int64  `json:"previous_key_expired_time" gorm:"bigint;default:0"`
+	RotatedTime            int64  `json:"rotated_time" gorm:"bigint;default:0"`
+	// UsingPreviousKey 本次请求使用的是宽限期内的旧令牌
+	UsingPreviousKey   bool    `json:"-" gorm:"-"`
+	Status             int     `json:"status" gorm:"default:1"`
+	Name               string  `json:"name" gorm:"index" `
+	User               string  `json:"user"`
+	CreatedTime        int64   `json:"created_time" gorm:"bigint"`
+	AccessedTime       int64   `json:"accessed_time" gorm:"bigint"`
+	ExpiredTime        int64   `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	RemainQuota        int     `json:"remain_quota" gorm:"default:0"`
+	UnlimitedQuota     bool    `json:"unlimited_quota" gorm:"default:false"`
+	ModelLimitsEnabled bool    `json:"model_limits_enabled" gorm:"default:false"`
+	ModelLimits        string  `json:"model_limits" gorm:"type:varchar(1024);default:''"`
+	AllowIps           *string `json:"allow_ips" gorm:"default:''"`
+	DenyIps            *string `json:"deny_ips" gorm:"default:''"`
+	UsedQuota          int     `json:"used_quota" gorm:"default:0"` // used quota
+	Group              string  `json:"group" gorm:"default:''"`
+	ModelNameMapping   string  `json:"model_name_mapping" gorm:"type:varchar(1000);default:''"`
+	// Scopes 令牌可访问的接口范围，逗号分隔，为空表示不限制
+	Scopes string `json:"scopes" gorm:"type:varchar(255);default:''"`
+	// 同时进行中的请求数和 realtime 会话数上限，0 表示不限制
+	MaxConcurrentRequests int `json:"max_concurrent_requests" gorm:"default:0"`
+	MaxRealtimeSessions   int `json:"max_realtime_sessions" gorm:"default:0"`
+	// 当前进行中的请求数和 realtime 会话数，只在令牌接口中返回
+	InFlightRequests int            `json:"inflight_requests" gorm:"-"`
+	RealtimeSessions int            `json:"realtime_sessions" gorm:"-"`
+	DeletedAt        gorm.DeletedAt `gorm:"index"`
 }
 
 func (token *Token) Clean() {
 	token.Key = ""
+	token.UsingPreviousKey = false
+}
+
+func tokenKeyPrefix(key string) string {
+	if len(key) > TokenKeyPrefixLength {
+		return key[:TokenKeyPrefixLength]
+	}
+	return key
+}
+
+// hashTokenKey 令牌是 48 位随机字符，熵足够高，加盐的 SHA-256 即可，不需要 bcrypt 这类慢哈希
+func hashTokenKey(key string, salt string) string {
+	sum := sha256.Sum256([]byte(salt + key))
+	return hex.EncodeToString(sum[:])
+}
+
+func matchTokenKeyHash(key string, salt string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashTokenKey(key, salt)), []byte(hash)) == 1
+}
+
+// SetKey 设置令牌，生成明文前缀、随机盐和哈希
+func (token *Token) SetKey(key string) error {
+	salt, err := common.GenerateRandomCharsKey(16)
+	if err != nil {
+		return err
+	}
+	token.Key = key
+	token.KeyPrefix = tokenKeyPrefix(key)
+	token.KeySalt = salt
+	token.KeyHash = hashTokenKey(key, salt)
+	return nil
+}
+
+// matchKey 校验令牌，宽限期内的旧令牌同样可以通过，此时 UsingPreviousKey 为 true
+func (token *Token) matchKey(key string) bool {
+	token.UsingPreviousKey = false
+	if token.KeySalt != "" && matchTokenKeyHash(key, token.KeySalt, token.KeyHash) {
+		return true
+	}
+	if token.PreviousKeyHash != "" && token.PreviousKeyExpiredTime > common.GetTimestamp() &&
+		matchTokenKeyHash(key, token.PreviousKeySalt, token.PreviousKeyHash) {
+		token.UsingPreviousKey = true
+		return true
+	}
+	return false
+}
+
+// MaskedKey 用于日志和错误信息中展示的令牌
+func (token *Token) MaskedKey() string {
+	return "sk-" + token.KeyPrefix + "***"
 }
 
-func (token *Token) GetIpLimitsMap() map[string]any {
-	// delete empty spaces
-	//split with \n
-	ipLimitsMap := make(map[string]any)
+// GetAllowIpMatcher 允许使用令牌的 IP 和 CIDR，为空表示不限制
+func (token *Token) GetAllowIpMatcher() *common.IPMatcher {
 	if token.AllowIps == nil {
-		return ipLimitsMap
-	}
-	cleanIps := strings.ReplaceAll(*token.AllowIps, " ", "")
-	if cleanIps == "" {
-		return ipLimitsMap
-	}
-	ips := strings.Split(cleanIps, "\n")
-	for _, ip := range ips {
-		ip = strings.TrimSpace(ip)
-		ip = strings.ReplaceAll(ip, ",", "")
-		if common.IsIP(ip) {
-			ipLimitsMap[ip] = true
-		}
+		return nil
 	}
-	return ipLimitsMap
+	return common.GetIPMatcher(*token.AllowIps)
+}
+
+func (token *Token) GetDenyIpMatcher() *common.IPMatcher {
+	if token.DenyIps == nil {
+		return nil
+	}
+	return common.GetIPMatcher(*token.DenyIps)
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int) ([]*Token, error) {
@@ -84,10 +156,9 @@ func GetAllTokens(startIdx int, num int) ([]*Token, error) {
 }
 
 func SearchUserTokens(userId int, keyword string, token string) (tokens []*Token, err error) {
-	if token != "" {
-		token = strings.Trim(token, "sk-")
-	}
-	err = DB.Where("user_id = ?", userId).Where("name LIKE ?", "%"+keyword+"%").Where(keyCol+" LIKE ?", "%"+token+"%").Find(&tokens).Error
+	// 数据库中只有令牌的前缀，按前缀匹配
+	token = tokenKeyPrefix(strings.TrimPrefix(token, "sk-"))
+	err = DB.Where("user_id = ?", userId).Where("name LIKE ?", "%"+keyword+"%").Where("key_prefix LIKE ?", token+"%").Find(&tokens).Error
 	return tokens, err
 }
 
@@ -96,43 +167,61 @@ func ValidateUserToken(key string) (token *Token, err error) {
 		return nil, errors.New("未提供令牌")
 	}
 	token, err = GetTokenByKey(key, false)
-	if err == nil {
-		if token.Status == common.TokenStatusExhausted {
-			keyPrefix := key[:3]
-			keySuffix := key[len(key)-3:]
-			return token, errors.New("该令牌额度已用尽 TokenStatusExhausted[sk-" + keyPrefix + "***" + keySuffix + "]")
-		} else if token.Status == common.TokenStatusExpired {
-			return token, errors.New("该令牌已过期")
-		}
-		if token.Status != common.TokenStatusEnabled {
-			return token, errors.New("该令牌状态不可用")
-		}
-		if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
-			if !common.RedisEnabled {
-				token.Status = common.TokenStatusExpired
-				err := token.SelectUpdate()
-				if err != nil {
-					common.SysError("failed to update token status" + err.Error())
-				}
+	if err != nil {
+		return nil, errors.New("无效的令牌")
+	}
+	return token, token.validate()
+}
+
+// ValidateUserTokenById 网关内部以令牌身份执行的请求（批处理、异步请求）没有完整的令牌，按 id 校验
+func ValidateUserTokenById(id int) (token *Token, err error) {
+	token, err = GetTokenById(id)
+	if err != nil {
+		return nil, errors.New("无效的令牌")
+	}
+	return token, token.validate()
+}
+
+// ValidateUserTokenByIdWithCache 短期客户端令牌只携带父令牌的 id，优先从缓存读取父令牌
+func ValidateUserTokenByIdWithCache(id int) (token *Token, err error) {
+	token, err = GetTokenByIdWithCache(id)
+	if err != nil {
+		return nil, errors.New("无效的令牌")
+	}
+	return token, token.validate()
+}
+
+func (token *Token) validate() error {
+	if token.Status == common.TokenStatusExhausted {
+		return errors.New("该令牌额度已用尽 TokenStatusExhausted[" + token.MaskedKey() + "]")
+	} else if token.Status == common.TokenStatusExpired {
+		return errors.New("该令牌已过期")
+	}
+	if token.Status != common.TokenStatusEnabled {
+		return errors.New("该令牌状态不可用")
+	}
+	if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
+		if !common.RedisEnabled {
+			token.Status = common.TokenStatusExpired
+			err := token.SelectUpdate()
+			if err != nil {
+				common.SysError("failed to update token status" + err.Error())
 			}
-			return token, errors.New("该令牌已过期")
 		}
-		if !token.UnlimitedQuota && token.RemainQuota <= 0 {
-			if !common.RedisEnabled {
-				// in this case, we can make sure the token is exhausted
-				token.Status = common.TokenStatusExhausted
-				err := token.SelectUpdate()
-				if err != nil {
-					common.SysError("failed to update token status" + err.Error())
-				}
+		return errors.New("该令牌已过期")
+	}
+	if !token.UnlimitedQuota && token.RemainQuota <= 0 {
+		if !common.RedisEnabled {
+			// in this case, we can make sure the token is exhausted
+			token.Status = common.TokenStatusExhausted
+			err := token.SelectUpdate()
+			if err != nil {
+				common.SysError("failed to update token status" + err.Error())
 			}
-			keyPrefix := key[:3]
-			keySuffix := key[len(key)-3:]
-			return token, errors.New(fmt.Sprintf("[sk-%s***%s] 该令牌额度已用尽 !token.UnlimitedQuota && token.RemainQuota = %d", keyPrefix, keySuffix, token.RemainQuota))
 		}
-		return token, nil
+		return errors.New(fmt.Sprintf("[%s] 该令牌额度已用尽 !token.UnlimitedQuota && token.RemainQuota = %d", token.MaskedKey(), token.RemainQuota))
 	}
-	return nil, errors.New("无效的令牌")
+	return nil
 }
 
 func GetTokenByIds(id int, userId int) (*Token, error) {
@@ -162,6 +251,7 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
+// GetTokenByKey 按令牌前缀查找后校验哈希，返回的令牌 Key 为传入的完整令牌
 func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	defer func() {
 		// Update Redis cache asynchronously on successful DB read
@@ -182,10 +272,119 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 		// Don't return error - fall through to DB
 	}
 	fromDB = true
-	err = DB.Where(keyCol+" = ?", key).First(&token).Error
+	var candidates []*Token
+	prefix := tokenKeyPrefix(key)
+	err = DB.Where("(key_prefix = ? AND key_salt <> ?) OR previous_key_prefix = ?", prefix, "", prefix).Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if candidate.matchKey(key) {
+			candidate.Key = key
+			return candidate, nil
+		}
+	}
+	// 兼容尚未迁移的明文令牌，找到后立即升级为哈希
+	err = DB.Where(keyCol+" = ? AND key_salt = ?", key, "").First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	if err = token.upgradeKey(key); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetTokenByKeyHash 按令牌哈希查找，用于鉴权之后只持有哈希的场景；
+// 轮换前已通过鉴权、仍在处理中的请求持有的是旧令牌的哈希，同样可以找到
+func GetTokenByKeyHash(keyHash string, fromDB bool) (token *Token, err error) {
+	defer func() {
+		if shouldUpdateRedis(fromDB, err) && token != nil {
+			gopool.Go(func() {
+				if err := cacheSetToken(*token); err != nil {
+					common.SysError("failed to update user status cache: " + err.Error())
+				}
+			})
+		}
+	}()
+	if !fromDB && common.RedisEnabled {
+		token, err := cacheGetTokenByKeyHash(keyHash)
+		if err == nil {
+			return token, nil
+		}
+	}
+	fromDB = true
+	err = DB.Where("("+keyCol+" = ? AND key_salt <> ?) OR previous_key_hash = ?", keyHash, "", keyHash).First(&token).Error
 	return token, err
 }
 
+// RotateKey 为令牌设置新的密钥，旧密钥在 gracePeriod 秒内仍然可用，gracePeriod 为 0 时立即失效；
+// 只保留一个旧密钥，宽限期内再次轮换时之前的旧密钥立即失效
+func (token *Token) RotateKey(key string, gracePeriod int64) (err error) {
+	old := *token
+	defer func() {
+		if shouldUpdateRedis(true, err) {
+			gopool.Go(func() {
+				if err := cacheDeleteToken(old); err != nil {
+					common.SysError("failed to delete token cache: " + err.Error())
+				}
+				if err := cacheSetToken(*token); err != nil {
+					common.SysError("failed to update token cache: " + err.Error())
+				}
+			})
+		}
+	}()
+	now := common.GetTimestamp()
+	token.PreviousKeyPrefix, token.PreviousKeySalt, token.PreviousKeyHash, token.PreviousKeyExpiredTime = "", "", "", 0
+	if gracePeriod > 0 {
+		token.PreviousKeyPrefix = old.KeyPrefix
+		token.PreviousKeySalt = old.KeySalt
+		token.PreviousKeyHash = old.KeyHash
+		token.PreviousKeyExpiredTime = now + gracePeriod
+	}
+	if err = token.SetKey(key); err != nil {
+		return err
+	}
+	token.RotatedTime = now
+	// 以原来的哈希为条件，避免同时轮换时互相覆盖
+	result := DB.Model(token).Where(keyCol+" = ?", old.KeyHash).
+		Select("key_prefix", "key_salt", "key", "previous_key_prefix", "previous_key_salt", "previous_key_hash",
+			"previous_key_expired_time", "rotated_time").Updates(token)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("令牌已被轮换，请刷新后重试")
+	}
+	return nil
+}
+
+// upgradeKey 把明文保存的令牌改为保存前缀、盐和哈希，令牌本身不变
+func (token *Token) upgradeKey(key string) error {
+	if err := token.SetKey(key); err != nil {
+		return err
+	}
+	return DB.Model(&Token{}).Unscoped().Where("id = ? AND key_salt = ?", token.Id, "").Updates(map[string]interface{}{
+		"key_prefix": token.KeyPrefix,
+		"key_salt":   token.KeySalt,
+		"key":        token.KeyHash,
+	}).Error
+}
+
+// MigrateTokenKeys 把升级前明文保存的令牌全部改为哈希保存，已发放的令牌仍然可以使用
+func MigrateTokenKeys() error {
+	var tokens []*Token
+	return DB.Unscoped().Where("key_salt = ?", "").FindInBatches(&tokens, 500, func(tx *gorm.DB, batch int) error {
+		for _, token := range tokens {
+			// PostgreSQL 中原来的 char(48) 列可能带有填充的空格
+			if err := token.upgradeKey(strings.TrimSpace(token.KeyHash)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
 func (token *Token) Insert() error {
 	var err error
 	err = DB.Create(token).Error
@@ -205,7 +404,8 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "model_name_mapping").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "deny_ips", "group", "model_name_mapping", "scopes",
+		"max_concurrent_requests", "max_realtime_sessions").Updates(token).Error
 	return err
 }
 
@@ -228,7 +428,7 @@ func (token *Token) Delete() (err error) {
 	defer func() {
 		if shouldUpdateRedis(true, err) {
 			gopool.Go(func() {
-				err := cacheDeleteToken(token.Key)
+				err := cacheDeleteToken(*token)
 				if err != nil {
 					common.SysError("failed to delete token cache: " + err.Error())
 				}
@@ -259,6 +459,50 @@ func (token *Token) GetModelLimitsMap() map[string]bool {
 	return limitsMap
 }
 
+func (token *Token) GetScopes() []string {
+	if token.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(token.Scopes, ",")
+}
+
+// HasScope 令牌未设置范围或请求不需要范围时允许访问，known 为 false 表示接口未归类，设置了范围的令牌不能访问
+func (token *Token) HasScope(scope string, known bool) bool {
+	if token.Scopes == "" {
+		return true
+	}
+	if !known {
+		return false
+	}
+	if scope == "" {
+		return true
+	}
+	for _, s := range token.GetScopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeTokenScopes 校验并去重令牌范围，返回逗号分隔的字符串
+func NormalizeTokenScopes(scopes string) (string, error) {
+	normalized := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, scope := range strings.Split(scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if !constant.IsValidTokenScope(scope) {
+			return "", fmt.Errorf("无效的令牌范围：%s", scope)
+		}
+		seen[scope] = true
+		normalized = append(normalized, scope)
+	}
+	return strings.Join(normalized, ","), nil
+}
+
 func DisableModelLimits(tokenId int) error {
 	token, err := GetTokenById(tokenId)
 	if err != nil {
@@ -282,13 +526,13 @@ func DeleteTokenById(id int, userId int) (err error) {
 	return token.Delete()
 }
 
-func IncreaseTokenQuota(id int, key string, quota int) (err error) {
+func IncreaseTokenQuota(id int, keyHash string, quota int) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
 	if common.RedisEnabled {
 		gopool.Go(func() {
-			err := cacheIncrTokenQuota(key, int64(quota))
+			err := cacheIncrTokenQuota(keyHash, int64(quota))
 			if err != nil {
 				common.SysError("failed to increase token quota: " + err.Error())
 			}
@@ -312,13 +556,13 @@ func increaseTokenQuota(id int, quota int) (err error) {
 	return err
 }
 
-func DecreaseTokenQuota(id int, key string, quota int) (err error) {
+func DecreaseTokenQuota(id int, keyHash string, quota int) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
 	if common.RedisEnabled {
 		gopool.Go(func() {
-			err := cacheDecrTokenQuota(key, int64(quota))
+			err := cacheDecrTokenQuota(keyHash, int64(quota))
 			if err != nil {
 				common.SysError("failed to decrease token quota: " + err.Error())
 			}
@@ -1,64 +1,139 @@
 package model
 
 import (
+	"context"
 	"fmt"
 	"one-api/common"
 	"one-api/constant"
 	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/go-redis/redis/v8"
 )
 
+// 令牌缓存以令牌哈希为键：token:<哈希> 保存令牌，token_prefix_v2:<前缀> 保存使用该前缀的令牌哈希集合，
+// 请求中的令牌先按前缀找到缓存的令牌，再用缓存中的盐和哈希校验；轮换后宽限期内的旧令牌前缀同样指向该令牌。
+// 旧版本的 token_prefix:<前缀> 是 HASH 类型，改用新键名避免滚动升级期间出现 WRONGTYPE 错误
+func tokenPrefixCacheKey(prefix string) string {
+	return fmt.Sprintf("token_prefix_v2:%s", prefix)
+}
+
 func cacheSetToken(token Token) error {
-	key := common.GenerateHMAC(token.Key)
 	token.Clean()
-	err := common.RedisHSetObj(fmt.Sprintf("token:%s", key), &token, time.Duration(constant.TokenCacheSeconds)*time.Second)
+	expiration := time.Duration(constant.TokenCacheSeconds) * time.Second
+	err := common.RedisHSetObj(fmt.Sprintf("token:%s", token.KeyHash), &token, expiration)
 	if err != nil {
 		return err
 	}
-	return nil
+	ctx := context.Background()
+	_, err = common.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, prefix := range []string{token.KeyPrefix, token.PreviousKeyPrefix} {
+			if prefix == "" {
+				continue
+			}
+			pipe.SAdd(ctx, tokenPrefixCacheKey(prefix), token.KeyHash)
+			pipe.Expire(ctx, tokenPrefixCacheKey(prefix), expiration)
+		}
+		return nil
+	})
+	return err
 }
 
-func cacheDeleteToken(key string) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisHDelObj(fmt.Sprintf("token:%s", key))
+func cacheDeleteToken(token Token) error {
+	err := common.RedisHDelObj(fmt.Sprintf("token:%s", token.KeyHash))
 	if err != nil {
 		return err
 	}
-	return nil
+	ctx := context.Background()
+	_, err = common.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, prefix := range []string{token.KeyPrefix, token.PreviousKeyPrefix} {
+			if prefix != "" {
+				pipe.SRem(ctx, tokenPrefixCacheKey(prefix), token.KeyHash)
+			}
+		}
+		return nil
+	})
+	return err
 }
 
-func cacheIncrTokenQuota(key string, increment int64) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisHIncrBy(fmt.Sprintf("token:%s", key), constant.TokenFiledRemainQuota, increment)
+func cacheIncrTokenQuota(keyHash string, increment int64) error {
+	err := common.RedisHIncrBy(fmt.Sprintf("token:%s", keyHash), constant.TokenFiledRemainQuota, increment)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func cacheDecrTokenQuota(key string, decrement int64) error {
-	return cacheIncrTokenQuota(key, -decrement)
+func cacheDecrTokenQuota(keyHash string, decrement int64) error {
+	return cacheIncrTokenQuota(keyHash, -decrement)
 }
 
-func cacheSetTokenField(key string, field string, value string) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisHSetField(fmt.Sprintf("token:%s", key), field, value)
+func cacheSetTokenField(keyHash string, field string, value string) error {
+	err := common.RedisHSetField(fmt.Sprintf("token:%s", keyHash), field, value)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// CacheGetTokenByKey 从缓存中获取 token，如果缓存中不存在，则从数据库中获取
+// cacheGetTokenByKey 从缓存中获取 token，如果缓存中不存在，则从数据库中获取
 func cacheGetTokenByKey(key string) (*Token, error) {
-	hmacKey := common.GenerateHMAC(key)
+	if !common.RedisEnabled {
+		return nil, fmt.Errorf("redis is not enabled")
+	}
+	keyHashes, err := common.RDB.SMembers(context.Background(), tokenPrefixCacheKey(tokenKeyPrefix(key))).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, keyHash := range keyHashes {
+		token, err := cacheGetTokenByKeyHash(keyHash)
+		if err != nil || !token.matchKey(key) {
+			continue
+		}
+		token.Key = key
+		return token, nil
+	}
+	return nil, fmt.Errorf("token not found in cache")
+}
+
+func cacheGetTokenByKeyHash(keyHash string) (*Token, error) {
 	if !common.RedisEnabled {
 		return nil, fmt.Errorf("redis is not enabled")
 	}
 	var token Token
-	err := common.RedisHGetObj(fmt.Sprintf("token:%s", hmacKey), &token)
+	err := common.RedisHGetObj(fmt.Sprintf("token:%s", keyHash), &token)
 	if err != nil {
 		return nil, err
 	}
-	token.Key = key
 	return &token, nil
 }
+
+func tokenIdCacheKey(id int) string {
+	return fmt.Sprintf("token_id:%d", id)
+}
+
+// GetTokenByIdWithCache 通过 token_id:<id> 找到令牌哈希再读取缓存的令牌，缓存未命中时查询数据库
+func GetTokenByIdWithCache(id int) (*Token, error) {
+	if common.RedisEnabled {
+		if keyHash, err := common.RedisGet(tokenIdCacheKey(id)); err == nil {
+			// 令牌轮换或删除后旧哈希的缓存已被清除，读到的 id 不一致时回源
+			if token, err := cacheGetTokenByKeyHash(keyHash); err == nil && token.Id == id {
+				return token, nil
+			}
+		}
+	}
+	token, err := GetTokenById(id)
+	if err != nil {
+		return nil, err
+	}
+	if common.RedisEnabled {
+		keyHash := token.KeyHash
+		gopool.Go(func() {
+			err := common.RedisSet(tokenIdCacheKey(id), keyHash, time.Duration(constant.TokenCacheSeconds)*time.Second)
+			if err != nil {
+				common.SysError("failed to update token id cache: " + err.Error())
+			}
+		})
+	}
+	return token, nil
+}
@@ -40,6 +40,17 @@ type User struct {
 	DeletedAt        gorm.DeletedAt `gorm:"index"`
 	LinuxDOId        string         `json:"linux_do_id" gorm:"column:linux_do_id;index"`
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
+	// 用户所有令牌同时进行中的请求数和 realtime 会话数上限，0 表示不限制
+	MaxConcurrentRequests int `json:"max_concurrent_requests" gorm:"type:int;default:0"`
+	MaxRealtimeSessions   int `json:"max_realtime_sessions" gorm:"type:int;default:0"`
+	// 对用户所有令牌生效的 IP 策略，每行一个 IP 或 CIDR，为空表示不限制。
+	// AllowIps、DenyIps 由管理员设置，SelfAllowIps、SelfDenyIps 由用户自己设置，两者同时生效
+	AllowIps     string `json:"allow_ips" gorm:"type:text"`
+	DenyIps      string `json:"deny_ips" gorm:"type:text"`
+	SelfAllowIps string `json:"self_allow_ips" gorm:"type:text"`
+	SelfDenyIps  string `json:"self_deny_ips" gorm:"type:text"`
+	// 管理员的自定义角色，为 0 时管理员拥有默认的全部管理权限，见 GetUserPermissions
+	AdminRoleId int `json:"admin_role_id" gorm:"type:int;default:0;index"`
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -51,6 +62,13 @@ func (user *User) ToBaseUser() *UserBase {
 		Username: user.Username,
 		Setting:  user.Setting,
 		Email:    user.Email,
+
+		MaxConcurrentRequests: user.MaxConcurrentRequests,
+		MaxRealtimeSessions:   user.MaxRealtimeSessions,
+		AllowIps:              user.AllowIps,
+		DenyIps:               user.DenyIps,
+		SelfAllowIps:          user.SelfAllowIps,
+		SelfDenyIps:           user.SelfDenyIps,
 	}
 	return cache
 }
@@ -236,6 +254,15 @@ func GetUserIdByAffCode(affCode string) (int, error) {
 	return user.Id, err
 }
 
+func GetUserIdByUsername(username string) (int, error) {
+	if username == "" {
+		return 0, errors.New("username 为空！")
+	}
+	var user User
+	err := DB.Select("id").First(&user, "username = ?", username).Error
+	return user.Id, err
+}
+
 func DeleteUserById(id int) (err error) {
 	if id == 0 {
 		return errors.New("id 为空！")
@@ -365,6 +392,9 @@ func (user *User) Edit(updatePassword bool) error {
 		"display_name": newUser.DisplayName,
 		"group":        newUser.Group,
 		"quota":        newUser.Quota,
+
+		"max_concurrent_requests": newUser.MaxConcurrentRequests,
+		"max_realtime_sessions":   newUser.MaxRealtimeSessions,
 	}
 	if updatePassword {
 		updates["password"] = newUser.Password
@@ -379,6 +409,34 @@ func (user *User) Edit(updatePassword bool) error {
 	return updateUserCache(*user)
 }
 
+// UpdateUserIpPolicy 管理员修改用户的 IP 允许列表和禁止列表
+func UpdateUserIpPolicy(userId int, allowIps string, denyIps string) error {
+	return updateUserIpPolicy(userId, map[string]interface{}{
+		"allow_ips": allowIps,
+		"deny_ips":  denyIps,
+	})
+}
+
+// UpdateUserSelfIpPolicy 用户修改自己的 IP 允许列表和禁止列表，不影响管理员设置的列表
+func UpdateUserSelfIpPolicy(userId int, allowIps string, denyIps string) error {
+	return updateUserIpPolicy(userId, map[string]interface{}{
+		"self_allow_ips": allowIps,
+		"self_deny_ips":  denyIps,
+	})
+}
+
+func updateUserIpPolicy(userId int, updates map[string]interface{}) error {
+	user := &User{Id: userId}
+	err := DB.Model(user).Updates(updates).Error
+	if err != nil {
+		return err
+	}
+	if err = DB.First(user, userId).Error; err != nil {
+		return err
+	}
+	return updateUserCache(*user)
+}
+
 func (user *User) Delete() error {
 	if user.Id == 0 {
 		return errors.New("id 为空！")
@@ -21,6 +21,13 @@ type UserBase struct {
 	Status   int    `json:"status"`
 	Username string `json:"username"`
 	Setting  string `json:"setting"`
+
+	MaxConcurrentRequests int    `json:"max_concurrent_requests"`
+	MaxRealtimeSessions   int    `json:"max_realtime_sessions"`
+	AllowIps              string `json:"allow_ips"`
+	DenyIps               string `json:"deny_ips"`
+	SelfAllowIps          string `json:"self_allow_ips"`
+	SelfDenyIps           string `json:"self_deny_ips"`
 }
 
 func (user *UserBase) WriteContext(c *gin.Context) {
@@ -30,6 +37,24 @@ func (user *UserBase) WriteContext(c *gin.Context) {
 	c.Set(constant.ContextKeyUserEmail, user.Email)
 	c.Set(constant.ContextKeyUserName, user.Username)
 	c.Set(constant.ContextKeyUserSetting, user.GetSetting())
+	c.Set(constant.ContextKeyUserMaxConcurrentRequests, user.MaxConcurrentRequests)
+	c.Set(constant.ContextKeyUserMaxRealtimeSessions, user.MaxRealtimeSessions)
+}
+
+func (user *UserBase) GetAllowIpMatcher() *common.IPMatcher {
+	return common.GetIPMatcher(user.AllowIps)
+}
+
+func (user *UserBase) GetDenyIpMatcher() *common.IPMatcher {
+	return common.GetIPMatcher(user.DenyIps)
+}
+
+func (user *UserBase) GetSelfAllowIpMatcher() *common.IPMatcher {
+	return common.GetIPMatcher(user.SelfAllowIps)
+}
+
+func (user *UserBase) GetSelfDenyIpMatcher() *common.IPMatcher {
+	return common.GetIPMatcher(user.SelfDenyIps)
 }
 
 func (user *UserBase) GetSetting() map[string]interface{} {
@@ -103,15 +128,7 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 	}
 
 	// Create cache object from user data
-	userCache = &UserBase{
-		Id:       user.Id,
-		Group:    user.Group,
-		Quota:    user.Quota,
-		Status:   user.Status,
-		Username: user.Username,
-		Setting:  user.Setting,
-		Email:    user.Email,
-	}
+	userCache = user.ToBaseUser()
 
 	return userCache, nil
 }
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestUpdateUserIpPolicyColumns(t *testing.T) {
+	setupTestDB(t, &User{})
+	if err := DB.Create(&User{Id: 1, Username: "user", AffCode: "1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateUserIpPolicy(1, "10.0.0.0/8", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	// 用户修改自己的列表不会覆盖管理员设置的列表，反之亦然
+	if err := UpdateUserSelfIpPolicy(1, "10.1.0.0/16", "10.1.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateUserIpPolicy(1, "10.0.0.0/8", "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	var user User
+	if err := DB.First(&user, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	base := user.ToBaseUser()
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"admin allow", base.AllowIps, "10.0.0.0/8"},
+		{"admin deny", base.DenyIps, "10.0.0.2"},
+		{"self allow", base.SelfAllowIps, "10.1.0.0/16"},
+		{"self deny", base.SelfDenyIps, "10.1.0.1"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"one-api/common"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 限流等待队列：被限流的请求在队列中等待，只有队首的请求尝试获取额度，不再由轮询的时机决定谁先获得额度。
+// 交互式请求总是排在批量请求之前；同一优先级内按加权公平排队（WFQ）的虚拟完成时间排序，
+// 同一令牌的请求按到达顺序排队，不同令牌按权重轮流获得额度，请求多的令牌不会饿死请求少的令牌。
+// 启用 Redis 时队列保存在 Redis 中由所有节点共用，等待方异常退出后超过截止时间的排队记录会被自动清理。
+const (
+	WaitPriorityInteractive = 0
+	WaitPriorityBulk        = 1
+
+	waitQueueKeyPrefix = "wait_queue:"
+	// waitQueueCost 权重为 1 的请求每次获得额度后虚拟时间增加的值
+	waitQueueCost = 1000000
+)
+
+// waitQueueCleanup 清理超过截止时间的排队记录，KEYS 依次为两个优先级的队列和截止时间
+const waitQueueCleanup = `
+	local expired = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', ARGV[1])
+	for _, member in ipairs(expired) do
+		redis.call('ZREM', KEYS[1], member)
+		redis.call('ZREM', KEYS[2], member)
+	end
+	redis.call('ZREMRANGEBYSCORE', KEYS[3], '-inf', ARGV[1])
+`
+
+// waitQueueJoinScript 加入队列，虚拟完成时间为 max(队列虚拟时间, 该令牌上一次的完成时间) + 1/权重
+var waitQueueJoinScript = redis.NewScript(waitQueueCleanup + `
+	local v = tonumber(redis.call('HGET', KEYS[4], 'v') or '0')
+	local last = tonumber(redis.call('HGET', KEYS[4], ARGV[3]) or '0')
+	local finish = math.max(v, last) + tonumber(ARGV[4])
+	redis.call('HSET', KEYS[4], ARGV[3], string.format('%d', finish))
+	redis.call('ZADD', KEYS[tonumber(ARGV[5]) + 1], string.format('%d', finish), ARGV[2])
+	redis.call('ZADD', KEYS[3], ARGV[6], ARGV[2])
+	for i = 1, 4 do
+		redis.call('PEXPIRE', KEYS[i], ARGV[7])
+	end
+	return 1
+`)
+
+// waitQueueHeadScript 返回 1 表示位于队首，0 表示仍在排队，-1 表示已超过截止时间被移出队列
+var waitQueueHeadScript = redis.NewScript(waitQueueCleanup + `
+	local head = redis.call('ZRANGE', KEYS[1], 0, 0)
+	if #head == 0 then
+		head = redis.call('ZRANGE', KEYS[2], 0, 0)
+	end
+	if #head > 0 and head[1] == ARGV[2] then
+		return 1
+	end
+	if redis.call('ZSCORE', KEYS[3], ARGV[2]) == false then
+		return -1
+	end
+	return 0
+`)
+
+// waitQueueLeaveScript 离开队列，获得额度时队列的虚拟时间推进到该请求的完成时间
+var waitQueueLeaveScript = redis.NewScript(`
+	local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+	if score == false then
+		score = redis.call('ZSCORE', KEYS[2], ARGV[1])
+	end
+	redis.call('ZREM', KEYS[1], ARGV[1])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	redis.call('ZREM', KEYS[3], ARGV[1])
+	if score ~= false and ARGV[2] == '1' then
+		local v = tonumber(redis.call('HGET', KEYS[4], 'v') or '0')
+		if tonumber(score) > v then
+			redis.call('HSET', KEYS[4], 'v', score)
+		end
+	end
+	return 1
+`)
+
+func waitQueueKeys(queue string) []string {
+	prefix := waitQueueKeyPrefix + queue
+	return []string{prefix + ":0", prefix + ":1", prefix + ":deadline", prefix + ":vt"}
+}
+
+type memWaitEntry struct {
+	priority int
+	finish   int64
+	seq      uint64
+	deadline time.Time
+}
+
+type memWaitQueue struct {
+	entries     map[string]*memWaitEntry
+	virtualTime int64
+	lastFinish  map[int]int64
+}
+
+var (
+	memWaitQueues  = make(map[string]*memWaitQueue)
+	waitQueuesLock sync.Mutex
+	waitQueueSeq   atomic.Uint64
+	// waitQueueChanged 当前节点有请求离开队列时关闭并替换，用于唤醒排在后面的请求
+	waitQueueChanged = make(chan struct{})
+)
+
+// WaitTicket 一个排队中的请求，结束等待后必须调用 Leave
+type WaitTicket struct {
+	queue  string
+	member string
+	once   sync.Once
+}
+
+// JoinWaitQueue 加入限流等待队列，weight 为令牌的权重，deadline 之后排队记录会被清理
+func JoinWaitQueue(queue string, tokenId int, weight int, priority int, deadline time.Time) (*WaitTicket, error) {
+	if priority != WaitPriorityBulk {
+		priority = WaitPriorityInteractive
+	}
+	seq := waitQueueSeq.Add(1)
+	ticket := &WaitTicket{
+		queue:  queue,
+		member: fmt.Sprintf("%020d:%s", time.Now().UnixNano(), common.GetUUID()),
+	}
+	cost := int64(waitQueueCost / max(weight, 1))
+	if !common.RedisEnabled {
+		waitQueuesLock.Lock()
+		defer waitQueuesLock.Unlock()
+		q := memWaitQueues[queue]
+		if q == nil {
+			q = &memWaitQueue{entries: make(map[string]*memWaitEntry), lastFinish: make(map[int]int64)}
+			memWaitQueues[queue] = q
+		}
+		finish := max(q.virtualTime, q.lastFinish[tokenId]) + cost
+		q.lastFinish[tokenId] = finish
+		q.entries[ticket.member] = &memWaitEntry{priority: priority, finish: finish, seq: seq, deadline: deadline}
+		return ticket, nil
+	}
+	now := time.Now()
+	ttl := max(deadline.Sub(now), time.Second) + time.Minute
+	err := waitQueueJoinScript.Run(context.Background(), common.RDB, waitQueueKeys(queue),
+		now.UnixMilli(), ticket.member, "t:"+strconv.Itoa(tokenId), cost, priority, deadline.UnixMilli(), ttl.Milliseconds()).Err()
+	if err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// IsHead 是否位于队首，ok 为 false 表示已超过截止时间被移出队列
+func (ticket *WaitTicket) IsHead() (head bool, ok bool, err error) {
+	now := time.Now()
+	if !common.RedisEnabled {
+		waitQueuesLock.Lock()
+		defer waitQueuesLock.Unlock()
+		q := memWaitQueues[ticket.queue]
+		if q == nil || q.entries[ticket.member] == nil {
+			return false, false, nil
+		}
+		var headMember string
+		var headEntry *memWaitEntry
+		for member, entry := range q.entries {
+			if now.After(entry.deadline) {
+				delete(q.entries, member)
+				continue
+			}
+			if headEntry == nil || entry.priority < headEntry.priority ||
+				(entry.priority == headEntry.priority && (entry.finish < headEntry.finish ||
+					(entry.finish == headEntry.finish && entry.seq < headEntry.seq))) {
+				headMember, headEntry = member, entry
+			}
+		}
+		if q.entries[ticket.member] == nil {
+			return false, false, nil
+		}
+		return headMember == ticket.member, true, nil
+	}
+	result, err := waitQueueHeadScript.Run(context.Background(), common.RDB, waitQueueKeys(ticket.queue)[:3],
+		now.UnixMilli(), ticket.member).Int()
+	if err != nil {
+		return false, true, err
+	}
+	return result == 1, result != -1, nil
+}
+
+// Leave 离开队列并唤醒当前节点排在后面的请求，served 表示是否获得了额度，可以重复调用
+func (ticket *WaitTicket) Leave(served bool) {
+	if ticket == nil {
+		return
+	}
+	ticket.once.Do(func() {
+		if common.RedisEnabled {
+			servedArg := "0"
+			if served {
+				servedArg = "1"
+			}
+			err := waitQueueLeaveScript.Run(context.Background(), common.RDB, waitQueueKeys(ticket.queue), ticket.member, servedArg).Err()
+			if err != nil {
+				common.SysError(fmt.Sprintf("leave wait queue %s failed: %s", ticket.queue, err.Error()))
+			}
+		}
+		waitQueuesLock.Lock()
+		defer waitQueuesLock.Unlock()
+		if q := memWaitQueues[ticket.queue]; q != nil {
+			if entry := q.entries[ticket.member]; entry != nil && served && entry.finish > q.virtualTime {
+				q.virtualTime = entry.finish
+			}
+			delete(q.entries, ticket.member)
+			if len(q.entries) == 0 {
+				delete(memWaitQueues, ticket.queue)
+			}
+		}
+		close(waitQueueChanged)
+		waitQueueChanged = make(chan struct{})
+	})
+}
+
+// WaitQueueLength 返回队列中排队的请求数，可能包含已超过截止时间尚未清理的记录
+func WaitQueueLength(queue string) (int64, error) {
+	if !common.RedisEnabled {
+		waitQueuesLock.Lock()
+		defer waitQueuesLock.Unlock()
+		if q := memWaitQueues[queue]; q != nil {
+			return int64(len(q.entries)), nil
+		}
+		return 0, nil
+	}
+	keys := waitQueueKeys(queue)
+	ctx := context.Background()
+	var interactive, bulk *redis.IntCmd
+	_, err := common.RDB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		interactive = pipe.ZCard(ctx, keys[0])
+		bulk = pipe.ZCard(ctx, keys[1])
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return interactive.Val() + bulk.Val(), nil
+}
+
+// WaitQueueChanged 返回在当前节点下一次有请求离开队列时关闭的 channel，其他节点的变化需要等待方自行定期检查
+func WaitQueueChanged() <-chan struct{} {
+	waitQueuesLock.Lock()
+	defer waitQueuesLock.Unlock()
+	return waitQueueChanged
+}
@@ -0,0 +1,241 @@
+package claude
+
+import (
+	"encoding/json"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/service"
+)
+
+func toolChoiceClaude2OpenAI(toolChoice any) any {
+	choice, ok := toolChoice.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	switch choice["type"] {
+	case "auto":
+		return "auto"
+	case "any":
+		return "required"
+	case "none":
+		return "none"
+	case "tool":
+		name, _ := choice["name"].(string)
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]string{"name": name},
+		}
+	}
+	return nil
+}
+
+func stopReasonOpenAI2Claude(reason string, hasToolUse bool) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		// 部分渠道在返回工具调用时 finish_reason 仍为 stop
+		if hasToolUse {
+			return "tool_use"
+		}
+		return "end_turn"
+	}
+}
+
+// ClaudeResponseTranslator 把 chat completions 的输出转换为 Anthropic Messages 格式，
+// 用于 /v1/messages 请求转发到任意渠道的场景
+type ClaudeResponseTranslator struct {
+	info         *relaycommon.RelayInfo
+	id           string
+	started      bool
+	blockIndex   int
+	blockType    string
+	blockOpen    bool
+	toolBlocks   map[int]int
+	usage        *dto.Usage
+	finishReason string
+}
+
+func NewClaudeResponseTranslator(info *relaycommon.RelayInfo) *ClaudeResponseTranslator {
+	return &ClaudeResponseTranslator{
+		info:       info,
+		id:         "msg_" + common.GetUUID(),
+		blockIndex: -1,
+		toolBlocks: make(map[int]int),
+	}
+}
+
+func (t *ClaudeResponseTranslator) event(response *dto.ClaudeResponse) helper.StreamEvent {
+	return helper.StreamEvent{Event: response.Type, Data: response}
+}
+
+func (t *ClaudeResponseTranslator) closeBlock() []helper.StreamEvent {
+	if !t.blockOpen {
+		return nil
+	}
+	t.blockOpen = false
+	response := &dto.ClaudeResponse{Type: "content_block_stop"}
+	response.SetIndex(t.blockIndex)
+	return []helper.StreamEvent{t.event(response)}
+}
+
+func (t *ClaudeResponseTranslator) openBlock(blockType string, block *dto.ClaudeMediaMessage) []helper.StreamEvent {
+	events := t.closeBlock()
+	t.blockIndex++
+	t.blockType = blockType
+	t.blockOpen = true
+	response := &dto.ClaudeResponse{Type: "content_block_start", ContentBlock: block}
+	response.SetIndex(t.blockIndex)
+	return append(events, t.event(response))
+}
+
+func (t *ClaudeResponseTranslator) delta(index int, delta *dto.ClaudeMediaMessage) helper.StreamEvent {
+	response := &dto.ClaudeResponse{Type: "content_block_delta", Delta: delta}
+	response.SetIndex(index)
+	return t.event(response)
+}
+
+func (t *ClaudeResponseTranslator) TranslateStreamChunk(chunk *dto.ChatCompletionsStreamResponse) []helper.StreamEvent {
+	events := make([]helper.StreamEvent, 0)
+	if !t.started {
+		t.started = true
+		message := &dto.ClaudeMediaMessage{
+			Id:    t.id,
+			Type:  "message",
+			Role:  "assistant",
+			Model: t.info.OriginModelName,
+			Usage: &dto.ClaudeUsage{InputTokens: t.info.PromptTokens},
+		}
+		message.SetContent([]any{})
+		events = append(events, t.event(&dto.ClaudeResponse{Type: "message_start", Message: message}))
+	}
+	if service.ValidUsage(chunk.Usage) {
+		t.usage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			if !t.blockOpen || t.blockType != "thinking" {
+				events = append(events, t.openBlock("thinking", &dto.ClaudeMediaMessage{Type: "thinking"})...)
+			}
+			events = append(events, t.delta(t.blockIndex, &dto.ClaudeMediaMessage{Type: "thinking_delta", Thinking: reasoning}))
+		}
+		if content := choice.Delta.GetContentString(); content != "" {
+			if !t.blockOpen || t.blockType != "text" {
+				block := &dto.ClaudeMediaMessage{Type: "text"}
+				block.SetText("")
+				events = append(events, t.openBlock("text", block)...)
+			}
+			delta := &dto.ClaudeMediaMessage{Type: "text_delta"}
+			delta.SetText(content)
+			events = append(events, t.delta(t.blockIndex, delta))
+		}
+		for i, toolCall := range choice.Delta.ToolCalls {
+			index := i
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			blockIndex, ok := t.toolBlocks[index]
+			if !ok {
+				id := toolCall.ID
+				if id == "" {
+					id = "toolu_" + common.GetUUID()
+				}
+				events = append(events, t.openBlock("tool_use", &dto.ClaudeMediaMessage{
+					Type:  "tool_use",
+					Id:    id,
+					Name:  toolCall.Function.Name,
+					Input: map[string]any{},
+				})...)
+				blockIndex = t.blockIndex
+				t.toolBlocks[index] = blockIndex
+			}
+			if toolCall.Function.Arguments != "" {
+				partialJson := toolCall.Function.Arguments
+				events = append(events, t.delta(blockIndex, &dto.ClaudeMediaMessage{Type: "input_json_delta", PartialJson: &partialJson}))
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.finishReason = *choice.FinishReason
+		}
+	}
+	return events
+}
+
+func (t *ClaudeResponseTranslator) TranslateStreamEnd() []helper.StreamEvent {
+	events := make([]helper.StreamEvent, 0)
+	if !t.started {
+		// 上游没有返回任何数据，仍然补齐 message_start
+		events = append(events, t.TranslateStreamChunk(&dto.ChatCompletionsStreamResponse{})...)
+	}
+	events = append(events, t.closeBlock()...)
+	usage := &dto.ClaudeUsage{InputTokens: t.info.PromptTokens}
+	if t.usage != nil {
+		usage.InputTokens = t.usage.PromptTokens
+		usage.OutputTokens = t.usage.CompletionTokens
+		usage.CacheReadInputTokens = t.usage.PromptTokensDetails.CachedTokens
+	}
+	stopReason := stopReasonOpenAI2Claude(t.finishReason, len(t.toolBlocks) > 0)
+	events = append(events,
+		t.event(&dto.ClaudeResponse{
+			Type:  "message_delta",
+			Delta: &dto.ClaudeMediaMessage{StopReason: &stopReason},
+			Usage: usage,
+		}),
+		t.event(&dto.ClaudeResponse{Type: "message_stop"}),
+	)
+	return events
+}
+
+func (t *ClaudeResponseTranslator) TranslateResponse(response *dto.OpenAITextResponse) (any, error) {
+	choice := response.Choices[0]
+	contents := make([]dto.ClaudeMediaMessage, 0)
+	reasoning := choice.Message.ReasoningContent
+	if reasoning == "" {
+		reasoning = choice.Message.Reasoning
+	}
+	if reasoning != "" {
+		contents = append(contents, dto.ClaudeMediaMessage{Type: "thinking", Thinking: reasoning})
+	}
+	if text := choice.Message.StringContent(); text != "" {
+		block := dto.ClaudeMediaMessage{Type: "text"}
+		block.SetText(text)
+		contents = append(contents, block)
+	}
+	toolCalls := choice.Message.ParseToolCalls()
+	for _, toolCall := range toolCalls {
+		input := map[string]any{}
+		if toolCall.Function.Arguments != "" {
+			_ = json.Unmarshal([]byte(toolCall.Function.Arguments), &input)
+		}
+		contents = append(contents, dto.ClaudeMediaMessage{
+			Type:  "tool_use",
+			Id:    toolCall.ID,
+			Name:  toolCall.Function.Name,
+			Input: input,
+		})
+	}
+	model := response.Model
+	if model == "" {
+		model = t.info.OriginModelName
+	}
+	return &dto.ClaudeResponse{
+		Id:         t.id,
+		Type:       "message",
+		Role:       "assistant",
+		Model:      model,
+		Content:    contents,
+		StopReason: stopReasonOpenAI2Claude(choice.FinishReason, len(toolCalls) > 0),
+		Usage: &dto.ClaudeUsage{
+			InputTokens:          response.Usage.PromptTokens,
+			OutputTokens:         response.Usage.CompletionTokens,
+			CacheReadInputTokens: response.Usage.PromptTokensDetails.CachedTokens,
+		},
+	}, nil
+}
@@ -11,7 +11,6 @@ import (
 	"one-api/relay/helper"
 	"one-api/service"
 	"one-api/setting/model_setting"
-	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -572,7 +571,7 @@ func ClaudeHandler(c *gin.Context, resp *http.Response, requestMode int, info *r
 	return nil, &usage
 }
 
-func ClaudeMessage2OpenAIRequest(claudeReq *ClaudeRequest) (*dto.GeneralOpenAIRequest, error) {
+func ClaudeMessage2OpenAIRequest(claudeReq *dto.ClaudeRequest) (*dto.GeneralOpenAIRequest, error) {
 	openaiReq := &dto.GeneralOpenAIRequest{
 		Model:         claudeReq.Model,
 		MaxTokens:     claudeReq.MaxTokens,
@@ -593,7 +592,7 @@ func ClaudeMessage2OpenAIRequest(claudeReq *ClaudeRequest) (*dto.GeneralOpenAIRe
 		openaiTools := make([]dto.ToolCallRequest, 0)
 
 		switch tools := claudeReq.Tools.(type) {
-		case []Tool:
+		case []dto.Tool:
 			for _, claudeTool := range tools {
 				params := make(map[string]interface{}, 3)
 				for _, key := range []string{"type", "properties", "required"} {
@@ -631,9 +630,11 @@ func ClaudeMessage2OpenAIRequest(claudeReq *ClaudeRequest) (*dto.GeneralOpenAIRe
 							maxUses = int(v)
 						}
 					}
+					toolType, _ := tool["type"].(string)
+					toolName, _ := tool["name"].(string)
 					openaiTools = append(openaiTools, dto.ToolCallRequest{
-						Type:    tool["type"].(string),
-						Name:    tool["name"].(string),
+						Type:    toolType,
+						Name:    toolName,
 						MaxUses: maxUses,
 					})
 				} else {
@@ -666,71 +667,111 @@ func ClaudeMessage2OpenAIRequest(claudeReq *ClaudeRequest) (*dto.GeneralOpenAIRe
 		openaiReq.Tools = openaiTools
 	}
 
-	if claudeReq.System != "" {
-		systemMsg := dto.Message{
-			Role:    "system",
-			Content: json.RawMessage([]byte(strconv.Quote(claudeReq.System))),
+	if claudeReq.ToolChoice != nil {
+		openaiReq.ToolChoice = toolChoiceClaude2OpenAI(claudeReq.ToolChoice)
+	}
+
+	// system 既可以是字符串，也可以是 text 块数组
+	system := claudeReq.GetStringSystem()
+	if !claudeReq.IsStringSystem() {
+		systemTexts := make([]string, 0)
+		for _, block := range claudeReq.ParseSystem() {
+			if block.Type == "text" && block.GetText() != "" {
+				systemTexts = append(systemTexts, block.GetText())
+			}
 		}
+		system = strings.Join(systemTexts, "\n")
+	}
+	if system != "" {
+		systemMsg := dto.Message{Role: "system"}
+		systemMsg.SetStringContent(system)
 		openaiReq.Messages = append(openaiReq.Messages, systemMsg)
 	}
 
 	// 多模态
 	for _, claudeMsg := range claudeReq.Messages {
-		openaiMsg := dto.Message{Role: claudeMsg.Role}
-
-		switch content := claudeMsg.Content.(type) {
-		case string: // 纯文本
-			openaiMsg.SetStringContent(content)
+		if claudeMsg.IsStringContent() { // 纯文本
+			openaiMsg := dto.Message{Role: claudeMsg.Role}
+			openaiMsg.SetStringContent(claudeMsg.GetStringContent())
+			openaiReq.Messages = append(openaiReq.Messages, openaiMsg)
+			continue
+		}
 
-		case []ClaudeMediaMessage: // 复杂消息类型
-			var mediaContents []dto.MediaContent
-			var toolCalls []dto.ToolCallRequest
+		// 复杂消息类型，json 解码后 content 为 []interface{}，需要重新解析为 ClaudeMediaMessage
+		contents, err := claudeMsg.ParseContent()
+		if err != nil {
+			return nil, fmt.Errorf("invalid message content: %w", err)
+		}
+		var mediaContents []dto.MediaContent
+		var toolCalls []dto.ToolCallRequest
 
-			for _, media := range content {
-				switch media.Type {
-				case "text":
-					mediaContents = append(mediaContents, dto.MediaContent{
-						Type: dto.ContentTypeText,
-						Text: media.Text,
-					})
+		for _, media := range contents {
+			switch media.Type {
+			case "text":
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeText,
+					Text: media.GetText(),
+				})
 
-				case "image":
-					if media.Source != nil {
-						mediaContents = append(mediaContents, dto.MediaContent{
-							Type: dto.ContentTypeImageURL,
-							ImageUrl: dto.MessageImageUrl{
-								Url:    fmt.Sprintf("data:%s;base64,%s", media.Source.MediaType, media.Source.Data),
-								Detail: "auto",
-							},
-						})
+			case "image":
+				if media.Source != nil {
+					imageUrl := media.Source.Url
+					if media.Source.Type == "base64" {
+						imageUrl = fmt.Sprintf("data:%s;base64,%v", media.Source.MediaType, media.Source.Data)
 					}
-
-				case "tool_use":
-					args, _ := json.Marshal(media.Input)
-					toolCalls = append(toolCalls, dto.ToolCallRequest{
-						ID: media.Id,
-						Function: dto.FunctionRequest{
-							Name:      media.Name,
-							Arguments: string(args),
+					mediaContents = append(mediaContents, dto.MediaContent{
+						Type: dto.ContentTypeImageURL,
+						ImageUrl: dto.MessageImageUrl{
+							Url:    imageUrl,
+							Detail: "auto",
 						},
 					})
-
-				case "tool_result":
-					openaiMsg.ToolCallId = media.ToolUseId
-					openaiMsg.SetStringContent(media.Content)
 				}
-			}
 
-			if len(toolCalls) > 0 {
-				toolCallData, _ := json.Marshal(toolCalls)
-				openaiMsg.ToolCalls = toolCallData
-			}
+			case "thinking", "redacted_thinking":
+				// 历史思考内容不回传给上游，部分渠道不接受 reasoning_content 作为输入
+
+			case "tool_use":
+				args, _ := json.Marshal(media.Input)
+				toolCalls = append(toolCalls, dto.ToolCallRequest{
+					ID:   media.Id,
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:      media.Name,
+						Arguments: string(args),
+					},
+				})
 
-			if len(mediaContents) > 0 {
-				openaiMsg.SetMediaContent(mediaContents)
+			case "tool_result":
+				// tool_result 在 OpenAI 格式中是独立的 tool 消息
+				toolMsg := dto.Message{Role: "tool", ToolCallId: media.ToolUseId}
+				if media.IsStringContent() {
+					toolMsg.SetStringContent(media.GetStringContent())
+				} else {
+					var resultText strings.Builder
+					for _, part := range media.ParseMediaContent() {
+						if part.Type == "text" {
+							resultText.WriteString(part.GetText())
+						}
+					}
+					toolMsg.SetStringContent(resultText.String())
+				}
+				openaiReq.Messages = append(openaiReq.Messages, toolMsg)
 			}
 		}
 
+		if len(mediaContents) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		openaiMsg := dto.Message{Role: claudeMsg.Role}
+		if len(mediaContents) > 0 {
+			openaiMsg.SetMediaContent(mediaContents)
+		} else {
+			openaiMsg.SetStringContent("")
+		}
+		if len(toolCalls) > 0 {
+			openaiMsg.SetToolCalls(toolCalls)
+		}
 		openaiReq.Messages = append(openaiReq.Messages, openaiMsg)
 	}
 
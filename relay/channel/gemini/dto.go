@@ -1,6 +1,10 @@
 package gemini
 
-import "google.golang.org/genai"
+import (
+	"encoding/json"
+
+	"google.golang.org/genai"
+)
 
 type GeminiChatRequest struct {
 	Contents           []GeminiChatContent          `json:"contents"`
@@ -60,6 +64,7 @@ type GeminiPart struct {
 	ExecutableCode      *GeminiPartExecutableCode      `json:"executableCode,omitempty"`
 	CodeExecutionResult *GeminiPartCodeExecutionResult `json:"codeExecutionResult,omitempty"`
 	VideoMetadata       *GeminiVideoMetadata           `json:"video_metadata,omitempty"`
+	Thought             bool                           `json:"thought,omitempty"`
 }
 
 type GeminiChatContent struct {
@@ -116,6 +121,7 @@ type GeminiChatResponse struct {
 	Candidates     []GeminiChatCandidate    `json:"candidates"`
 	PromptFeedback GeminiChatPromptFeedback `json:"promptFeedback"`
 	UsageMetadata  GeminiUsageMetadata      `json:"usageMetadata"`
+	ModelVersion   string                   `json:"modelVersion,omitempty"`
 }
 
 type GeminiUsageMetadata struct {
@@ -151,3 +157,66 @@ type GeminiImagePrediction struct {
 	RaiFilteredReason  string `json:"raiFilteredReason,omitempty"`
 	SafetyAttributes   any    `json:"safetyAttributes,omitempty"`
 }
+
+// GeminiNativeRequest 是客户端直接调用 /v1beta/models/*:generateContent 时的请求体，
+// 同时兼容 camelCase 和 snake_case 两种字段写法
+type GeminiNativeRequest struct {
+	Contents               []GeminiNativeContent        `json:"contents"`
+	SystemInstruction      *GeminiNativeContent         `json:"systemInstruction,omitempty"`
+	SystemInstructionSnake *GeminiNativeContent         `json:"system_instruction,omitempty"`
+	Tools                  []GeminiChatTool             `json:"tools,omitempty"`
+	ToolConfig             *GeminiToolConfig            `json:"toolConfig,omitempty"`
+	ToolConfigSnake        *GeminiToolConfig            `json:"tool_config,omitempty"`
+	GenerationConfig       *genai.GenerateContentConfig `json:"generationConfig,omitempty"`
+	GenerationConfigSnake  *genai.GenerateContentConfig `json:"generation_config,omitempty"`
+}
+
+type GeminiNativeContent struct {
+	Role  string             `json:"role,omitempty"`
+	Parts []GeminiNativePart `json:"parts"`
+}
+
+// GeminiNativePart 的 functionResponse.response 是任意 JSON 对象，覆盖 GeminiPart 中的同名字段以保留原始内容
+type GeminiNativePart struct {
+	GeminiPart
+	FunctionResponse *GeminiNativeFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type GeminiNativeFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type GeminiToolConfig struct {
+	FunctionCallingConfig *GeminiFunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type GeminiCountTokensRequest struct {
+	Contents               []GeminiNativeContent `json:"contents,omitempty"`
+	GenerateContentRequest *GeminiNativeRequest  `json:"generateContentRequest,omitempty"`
+}
+
+type GeminiCountTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
+}
+
+type GeminiEmbedContentRequest struct {
+	Model                string              `json:"model,omitempty"`
+	Content              GeminiNativeContent `json:"content"`
+	TaskType             string              `json:"taskType,omitempty"`
+	Title                string              `json:"title,omitempty"`
+	OutputDimensionality int                 `json:"outputDimensionality,omitempty"`
+}
+
+type GeminiEmbedContentResponse struct {
+	Embedding GeminiContentEmbedding `json:"embedding"`
+}
+
+type GeminiContentEmbedding struct {
+	Values []float64 `json:"values"`
+}
@@ -0,0 +1,515 @@
+package gemini
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/service"
+	"strings"
+)
+
+// normalize 把 snake_case 写法的字段合并到 camelCase 字段上
+func (r *GeminiNativeRequest) normalize() {
+	if r.SystemInstruction == nil {
+		r.SystemInstruction = r.SystemInstructionSnake
+	}
+	if r.ToolConfig == nil {
+		r.ToolConfig = r.ToolConfigSnake
+	}
+	if r.GenerationConfig == nil {
+		r.GenerationConfig = r.GenerationConfigSnake
+	}
+}
+
+// GeminiNativeRequest2OpenAIRequest 把 Gemini 原生 generateContent 请求转换为 chat completions 请求，
+// 是 CovertGemini2OpenAI 的逆过程，用于 Gemini 原生接口转发到任意渠道的场景
+func GeminiNativeRequest2OpenAIRequest(request *GeminiNativeRequest, model string, stream bool) (*dto.GeneralOpenAIRequest, error) {
+	request.normalize()
+	textRequest := &dto.GeneralOpenAIRequest{
+		Model:  model,
+		Stream: stream,
+	}
+	if stream {
+		textRequest.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+
+	messages := make([]dto.Message, 0, len(request.Contents)+1)
+	if request.SystemInstruction != nil {
+		if system := geminiPartsText(request.SystemInstruction.Parts); system != "" {
+			message := dto.Message{Role: "system"}
+			message.SetStringContent(system)
+			messages = append(messages, message)
+		}
+	}
+	// functionResponse 没有调用 id，按函数名与之前的 functionCall 依次配对
+	pendingCalls := make(map[string][]string)
+	for _, content := range request.Contents {
+		for _, part := range content.Parts {
+			if part.VideoMetadata != nil {
+				textRequest.VideoMetadata = &dto.VideoMetadata{
+					Fps:         part.VideoMetadata.Fps,
+					StartOffset: part.VideoMetadata.StartOffset,
+					EndOffset:   part.VideoMetadata.EndOffset,
+				}
+			}
+		}
+		contentMessages, err := geminiContent2OpenAIMessages(content, pendingCalls)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, contentMessages...)
+	}
+	textRequest.Messages = messages
+
+	tools, err := geminiTools2OpenAITools(request.Tools)
+	if err != nil {
+		return nil, err
+	}
+	if len(tools) > 0 {
+		textRequest.Tools = tools
+		textRequest.ToolChoice = geminiToolConfig2ToolChoice(request.ToolConfig)
+	}
+
+	if config := request.GenerationConfig; config != nil {
+		if config.Temperature != nil {
+			temperature := float64(*config.Temperature)
+			textRequest.Temperature = &temperature
+		}
+		if config.TopP != nil {
+			textRequest.TopP = float64(*config.TopP)
+		}
+		if config.TopK != nil {
+			textRequest.TopK = int(*config.TopK)
+		}
+		if config.MaxOutputTokens > 0 {
+			textRequest.MaxTokens = uint(config.MaxOutputTokens)
+		}
+		if len(config.StopSequences) > 0 {
+			textRequest.Stop = config.StopSequences
+		}
+		if config.Seed != nil {
+			textRequest.Seed = float64(*config.Seed)
+		}
+		if config.PresencePenalty != nil {
+			textRequest.PresencePenalty = float64(*config.PresencePenalty)
+		}
+		if config.FrequencyPenalty != nil {
+			textRequest.FrequencyPenalty = float64(*config.FrequencyPenalty)
+		}
+		if config.ResponseMIMEType == "application/json" {
+			schema := config.ResponseJsonSchema
+			if schema == nil && config.ResponseSchema != nil {
+				schema = normalizeGeminiSchema(config.ResponseSchema)
+			}
+			if schema != nil {
+				textRequest.ResponseFormat = &dto.ResponseFormat{
+					Type: "json_schema",
+					JsonSchema: &dto.FormatJsonSchema{
+						Name:   "response",
+						Schema: schema,
+					},
+				}
+			} else {
+				textRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+			}
+		}
+	}
+	return textRequest, nil
+}
+
+// GeminiCountTokensRequest2OpenAIRequest 兼容 contents 和 generateContentRequest 两种写法
+func GeminiCountTokensRequest2OpenAIRequest(request *GeminiCountTokensRequest, model string) (*dto.GeneralOpenAIRequest, error) {
+	nativeRequest := request.GenerateContentRequest
+	if nativeRequest == nil {
+		nativeRequest = &GeminiNativeRequest{Contents: request.Contents}
+	}
+	return GeminiNativeRequest2OpenAIRequest(nativeRequest, model, false)
+}
+
+// GeminiEmbedContentRequest2OpenAIRequest 把 embedContent 请求转换为 embeddings 请求
+func GeminiEmbedContentRequest2OpenAIRequest(request *GeminiEmbedContentRequest, model string) (*dto.EmbeddingRequest, error) {
+	text := geminiPartsText(request.Content.Parts)
+	if text == "" {
+		return nil, errors.New("content must contain at least one text part")
+	}
+	return &dto.EmbeddingRequest{
+		Model:      model,
+		Input:      text,
+		Dimensions: request.OutputDimensionality,
+	}, nil
+}
+
+// OpenAIEmbeddingResponse2Gemini 把 embeddings 响应转换为 embedContent 的响应格式
+func OpenAIEmbeddingResponse2Gemini(body []byte) ([]byte, error) {
+	var response dto.OpenAIEmbeddingResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Data) == 0 {
+		return nil, errors.New("no embedding returned")
+	}
+	return json.Marshal(&GeminiEmbedContentResponse{
+		Embedding: GeminiContentEmbedding{Values: response.Data[0].Embedding},
+	})
+}
+
+func geminiPartsText(parts []GeminiNativePart) string {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Text != "" && !part.Thought {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func geminiContent2OpenAIMessages(content GeminiNativeContent, pendingCalls map[string][]string) ([]dto.Message, error) {
+	// there's no assistant role in gemini
+	role := "user"
+	if content.Role == "model" {
+		role = "assistant"
+	}
+	messages := make([]dto.Message, 0)
+	mediaContents := make([]dto.MediaContent, 0, len(content.Parts))
+	toolCalls := make([]dto.ToolCallRequest, 0)
+	for _, part := range content.Parts {
+		switch {
+		case part.Thought:
+			// 思考内容只对生成它的模型有意义，不再发回上游
+			continue
+		case part.FunctionCall != nil:
+			arguments := "{}"
+			if part.FunctionCall.Arguments != nil {
+				args, err := json.Marshal(part.FunctionCall.Arguments)
+				if err != nil {
+					return nil, fmt.Errorf("invalid args for function %s: %s", part.FunctionCall.FunctionName, err.Error())
+				}
+				arguments = string(args)
+			}
+			id := "call_" + common.GetUUID()
+			pendingCalls[part.FunctionCall.FunctionName] = append(pendingCalls[part.FunctionCall.FunctionName], id)
+			toolCalls = append(toolCalls, dto.ToolCallRequest{
+				ID:   id,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      part.FunctionCall.FunctionName,
+					Arguments: arguments,
+				},
+			})
+		case part.FunctionResponse != nil:
+			name := part.FunctionResponse.Name
+			id := "call_" + common.GetUUID()
+			if ids := pendingCalls[name]; len(ids) > 0 {
+				id = ids[0]
+				pendingCalls[name] = ids[1:]
+			}
+			message := dto.Message{Role: "tool", Name: &name, ToolCallId: id}
+			message.SetStringContent(string(part.FunctionResponse.Response))
+			messages = append(messages, message)
+		case part.InlineData != nil:
+			mediaContents = append(mediaContents, geminiInlineData2MediaContent(part.InlineData))
+		case part.FileData != nil:
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type:     dto.ContentTypeImageURL,
+				ImageUrl: dto.MessageImageUrl{Url: part.FileData.FileUri, Detail: "auto"},
+			})
+		case part.ExecutableCode != nil:
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: fmt.Sprintf("```%s\n%s\n```", strings.ToLower(part.ExecutableCode.Language), part.ExecutableCode.Code),
+			})
+		case part.CodeExecutionResult != nil:
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: part.CodeExecutionResult.Output,
+			})
+		case part.Text != "":
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: part.Text,
+			})
+		}
+	}
+	if len(mediaContents) == 0 && len(toolCalls) == 0 {
+		return messages, nil
+	}
+	message := dto.Message{Role: role}
+	if len(mediaContents) == 1 && mediaContents[0].Type == dto.ContentTypeText {
+		message.SetStringContent(mediaContents[0].Text)
+	} else if len(mediaContents) > 0 {
+		message.SetMediaContent(mediaContents)
+	}
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+	return append(messages, message), nil
+}
+
+func geminiInlineData2MediaContent(data *GeminiInlineData) dto.MediaContent {
+	mimeType := strings.ToLower(data.MimeType)
+	if strings.HasPrefix(mimeType, "audio/") {
+		return dto.MediaContent{
+			Type: dto.ContentTypeInputAudio,
+			InputAudio: dto.MessageInputAudio{
+				Data:   data.Data,
+				Format: strings.TrimPrefix(mimeType, "audio/"),
+			},
+		}
+	}
+	return dto.MediaContent{
+		Type: dto.ContentTypeImageURL,
+		ImageUrl: dto.MessageImageUrl{
+			Url:    fmt.Sprintf("data:%s;base64,%s", data.MimeType, data.Data),
+			Detail: "auto",
+		},
+	}
+}
+
+// geminiTools2OpenAITools googleSearch、codeExecution 按 CovertGemini2OpenAI 的约定转换为同名函数
+func geminiTools2OpenAITools(tools []GeminiChatTool) ([]dto.ToolCallRequest, error) {
+	result := make([]dto.ToolCallRequest, 0)
+	for _, tool := range tools {
+		if tool.FunctionDeclarations != nil {
+			data, err := json.Marshal(tool.FunctionDeclarations)
+			if err != nil {
+				return nil, err
+			}
+			var declarations []dto.FunctionRequest
+			if err := json.Unmarshal(data, &declarations); err != nil {
+				return nil, fmt.Errorf("invalid functionDeclarations: %s", err.Error())
+			}
+			for _, declaration := range declarations {
+				declaration.Parameters = normalizeGeminiSchema(declaration.Parameters)
+				result = append(result, dto.ToolCallRequest{
+					Type:     "function",
+					Function: declaration,
+				})
+			}
+		}
+		if tool.GoogleSearch != nil || tool.GoogleSearchRetrieval != nil {
+			result = append(result, dto.ToolCallRequest{
+				Type:     "function",
+				Function: dto.FunctionRequest{Name: "googleSearch"},
+			})
+		}
+		if tool.CodeExecution != nil {
+			result = append(result, dto.ToolCallRequest{
+				Type:     "function",
+				Function: dto.FunctionRequest{Name: "codeExecution"},
+			})
+		}
+	}
+	return result, nil
+}
+
+func geminiToolConfig2ToolChoice(config *GeminiToolConfig) any {
+	if config == nil || config.FunctionCallingConfig == nil {
+		return nil
+	}
+	switch strings.ToUpper(config.FunctionCallingConfig.Mode) {
+	case "AUTO":
+		return "auto"
+	case "ANY":
+		if len(config.FunctionCallingConfig.AllowedFunctionNames) == 1 {
+			return map[string]any{
+				"type":     "function",
+				"function": map[string]string{"name": config.FunctionCallingConfig.AllowedFunctionNames[0]},
+			}
+		}
+		return "required"
+	case "NONE":
+		return "none"
+	}
+	return nil
+}
+
+// normalizeGeminiSchema 把 Gemini Schema 中大写的 type（如 STRING、OBJECT）转换为 JSON Schema 的小写写法
+func normalizeGeminiSchema(schema any) any {
+	if schema == nil {
+		return nil
+	}
+	var value any
+	data, err := json.Marshal(schema)
+	if err != nil || json.Unmarshal(data, &value) != nil {
+		return schema
+	}
+	return lowerSchemaType(value)
+}
+
+func lowerSchemaType(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if typeName, ok := item.(string); ok && key == "type" {
+				v[key] = strings.ToLower(typeName)
+				continue
+			}
+			v[key] = lowerSchemaType(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = lowerSchemaType(item)
+		}
+	}
+	return value
+}
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func toolArguments2GeminiArgs(arguments string) any {
+	args := map[string]any{}
+	if arguments != "" {
+		_ = json.Unmarshal([]byte(arguments), &args)
+	}
+	return args
+}
+
+type geminiPendingToolCall struct {
+	name      string
+	arguments strings.Builder
+}
+
+// GeminiResponseTranslator 把 chat completions 的输出转换为 Gemini generateContent 格式，
+// 流式输出与 streamGenerateContent?alt=sse 一致，每个事件只有 data 行
+type GeminiResponseTranslator struct {
+	info         *relaycommon.RelayInfo
+	toolCalls    []*geminiPendingToolCall
+	toolIndex    map[int]int
+	usage        *dto.Usage
+	finishReason string
+}
+
+func NewGeminiResponseTranslator(info *relaycommon.RelayInfo) *GeminiResponseTranslator {
+	return &GeminiResponseTranslator{
+		info:      info,
+		toolIndex: make(map[int]int),
+	}
+}
+
+func (t *GeminiResponseTranslator) response(parts []GeminiPart, finishReason *string) *GeminiChatResponse {
+	return &GeminiChatResponse{
+		Candidates: []GeminiChatCandidate{
+			{
+				Content:      GeminiChatContent{Role: "model", Parts: parts},
+				FinishReason: finishReason,
+			},
+		},
+		ModelVersion: t.info.OriginModelName,
+	}
+}
+
+func (t *GeminiResponseTranslator) usageMetadata(usage *dto.Usage) GeminiUsageMetadata {
+	if usage == nil {
+		return GeminiUsageMetadata{
+			PromptTokenCount: t.info.PromptTokens,
+			TotalTokenCount:  t.info.PromptTokens,
+		}
+	}
+	thoughtsTokens := usage.CompletionTokenDetails.ReasoningTokens
+	return GeminiUsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens - thoughtsTokens,
+		ThoughtsTokenCount:   thoughtsTokens,
+		TotalTokenCount:      usage.PromptTokens + usage.CompletionTokens,
+	}
+}
+
+func (t *GeminiResponseTranslator) TranslateStreamChunk(chunk *dto.ChatCompletionsStreamResponse) []helper.StreamEvent {
+	if service.ValidUsage(chunk.Usage) {
+		t.usage = chunk.Usage
+	}
+	parts := make([]GeminiPart, 0)
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			parts = append(parts, GeminiPart{Text: reasoning, Thought: true})
+		}
+		if content := choice.Delta.GetContentString(); content != "" {
+			parts = append(parts, GeminiPart{Text: content})
+		}
+		// 工具调用的参数是分片返回的，Gemini 需要完整的 args，因此在结束时统一输出
+		for i, toolCall := range choice.Delta.ToolCalls {
+			index := i
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			position, ok := t.toolIndex[index]
+			if !ok {
+				position = len(t.toolCalls)
+				t.toolIndex[index] = position
+				t.toolCalls = append(t.toolCalls, &geminiPendingToolCall{})
+			}
+			if toolCall.Function.Name != "" {
+				t.toolCalls[position].name = toolCall.Function.Name
+			}
+			t.toolCalls[position].arguments.WriteString(toolCall.Function.Arguments)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.finishReason = *choice.FinishReason
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	response := t.response(parts, nil)
+	response.UsageMetadata = t.usageMetadata(t.usage)
+	return []helper.StreamEvent{{Data: response}}
+}
+
+func (t *GeminiResponseTranslator) TranslateStreamEnd() []helper.StreamEvent {
+	parts := make([]GeminiPart, 0, len(t.toolCalls))
+	for _, toolCall := range t.toolCalls {
+		parts = append(parts, GeminiPart{
+			FunctionCall: &FunctionCall{
+				FunctionName: toolCall.name,
+				Arguments:    toolArguments2GeminiArgs(toolCall.arguments.String()),
+			},
+		})
+	}
+	finishReason := finishReasonOpenAI2Gemini(t.finishReason)
+	response := t.response(parts, &finishReason)
+	response.UsageMetadata = t.usageMetadata(t.usage)
+	return []helper.StreamEvent{{Data: response}}
+}
+
+func (t *GeminiResponseTranslator) TranslateResponse(response *dto.OpenAITextResponse) (any, error) {
+	choice := response.Choices[0]
+	parts := make([]GeminiPart, 0)
+	reasoning := choice.Message.ReasoningContent
+	if reasoning == "" {
+		reasoning = choice.Message.Reasoning
+	}
+	if reasoning != "" {
+		parts = append(parts, GeminiPart{Text: reasoning, Thought: true})
+	}
+	if text := choice.Message.StringContent(); text != "" {
+		parts = append(parts, GeminiPart{Text: text})
+	}
+	for _, toolCall := range choice.Message.ParseToolCalls() {
+		parts = append(parts, GeminiPart{
+			FunctionCall: &FunctionCall{
+				FunctionName: toolCall.Function.Name,
+				Arguments:    toolArguments2GeminiArgs(toolCall.Function.Arguments),
+			},
+		})
+	}
+	finishReason := finishReasonOpenAI2Gemini(choice.FinishReason)
+	geminiResponse := t.response(parts, &finishReason)
+	geminiResponse.UsageMetadata = t.usageMetadata(&response.Usage)
+	return geminiResponse, nil
+}
@@ -50,6 +50,10 @@ func CovertGemini2OpenAI(textRequest dto.GeneralOpenAIRequest) (*GeminiChatReque
 		Contents: make([]GeminiChatContent, 0, len(textRequest.Messages)),
 		//SafetySettings: []GeminiChatSafetySettings{},
 	}
+	// 处理图片、音频时会读取 VideoMetadata，未传入时使用零值
+	if textRequest.VideoMetadata == nil {
+		textRequest.VideoMetadata = &dto.VideoMetadata{}
+	}
 
 	// 初始化GenerationConfig
 	geminiRequest.GenerationConfig = &genai.GenerateContentConfig{
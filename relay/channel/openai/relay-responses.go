@@ -0,0 +1,619 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/service"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponsesRequest2ChatRequest 将 /v1/responses 请求转换为 chat completions 请求，供不支持 Responses 接口的渠道使用
+func ResponsesRequest2ChatRequest(request *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	if request.PreviousResponseId != "" {
+		return nil, errors.New("previous_response_id is not supported by this channel")
+	}
+	chatRequest := &dto.GeneralOpenAIRequest{
+		Model:       request.Model,
+		Stream:      request.Stream,
+		MaxTokens:   request.MaxOutputTokens,
+		Temperature: request.Temperature,
+		User:        request.User,
+	}
+	if request.TopP != nil {
+		chatRequest.TopP = *request.TopP
+	}
+	if request.Stream {
+		chatRequest.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	if request.Reasoning != nil {
+		chatRequest.ReasoningEffort = request.Reasoning.Effort
+	}
+
+	messages := make([]dto.Message, 0)
+	if request.Instructions != "" {
+		message := dto.Message{Role: "system"}
+		message.SetStringContent(request.Instructions)
+		messages = append(messages, message)
+	}
+	inputMessages, err := responsesInput2Messages(request.Input)
+	if err != nil {
+		return nil, err
+	}
+	chatRequest.Messages = append(messages, inputMessages...)
+	if len(chatRequest.Messages) == 0 {
+		return nil, errors.New("field input is required")
+	}
+
+	for _, tool := range request.Tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("tool type %s is not supported by this channel", tool.Type)
+		}
+		chatRequest.Tools = append(chatRequest.Tools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if len(request.ToolChoice) > 0 {
+		chatRequest.ToolChoice = responsesToolChoice2Chat(request.ToolChoice)
+	}
+
+	if request.Text != nil && request.Text.Format != nil {
+		switch request.Text.Format.Type {
+		case "json_object":
+			chatRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+		case "json_schema":
+			chatRequest.ResponseFormat = &dto.ResponseFormat{
+				Type: "json_schema",
+				JsonSchema: &dto.FormatJsonSchema{
+					Name:        request.Text.Format.Name,
+					Description: request.Text.Format.Description,
+					Schema:      request.Text.Format.Schema,
+					Strict:      request.Text.Format.Strict,
+				},
+			}
+		}
+	}
+	return chatRequest, nil
+}
+
+func responsesInput2Messages(input json.RawMessage) ([]dto.Message, error) {
+	messages := make([]dto.Message, 0)
+	if len(input) == 0 {
+		return messages, nil
+	}
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		message := dto.Message{Role: "user"}
+		message.SetStringContent(text)
+		return append(messages, message), nil
+	}
+	var items []dto.ResponsesInputItem
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	for _, item := range items {
+		switch item.Type {
+		case "", dto.ResponsesItemTypeMessage:
+			message := dto.Message{Role: item.Role}
+			if message.Role == "developer" {
+				message.Role = "system"
+			}
+			if err := setResponsesContent(&message, item.Content); err != nil {
+				return nil, err
+			}
+			messages = append(messages, message)
+		case dto.ResponsesItemTypeFunctionCall:
+			toolCall := dto.ToolCallRequest{
+				ID:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			// 连续的 function_call 合并为同一条 assistant 消息
+			if n := len(messages); n > 0 && messages[n-1].Role == "assistant" && messages[n-1].ToolCalls != nil {
+				toolCalls := messages[n-1].ParseToolCalls()
+				messages[n-1].SetToolCalls(append(toolCalls, toolCall))
+				continue
+			}
+			message := dto.Message{Role: "assistant", Content: json.RawMessage(`""`)}
+			message.SetToolCalls([]dto.ToolCallRequest{toolCall})
+			messages = append(messages, message)
+		case dto.ResponsesItemTypeFunctionCallOutput:
+			message := dto.Message{Role: "tool", ToolCallId: item.CallId}
+			var output string
+			if err := json.Unmarshal(item.Output, &output); err != nil {
+				output = string(item.Output)
+			}
+			message.SetStringContent(output)
+			messages = append(messages, message)
+		case dto.ResponsesItemTypeReasoning:
+			// 推理内容无法回传给其他渠道，直接忽略
+		default:
+			return nil, fmt.Errorf("input item type %s is not supported by this channel", item.Type)
+		}
+	}
+	return messages, nil
+}
+
+func setResponsesContent(message *dto.Message, content json.RawMessage) error {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		message.SetStringContent(text)
+		return nil
+	}
+	var parts []dto.ResponsesInputContent
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return fmt.Errorf("invalid message content: %w", err)
+	}
+	mediaContents := make([]dto.MediaContent, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case dto.ResponsesContentTypeInputText, dto.ResponsesContentTypeOutputText:
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: part.Text,
+			})
+		case dto.ResponsesContentTypeInputImage:
+			detail := part.Detail
+			if detail == "" {
+				detail = "auto"
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeImageURL,
+				ImageUrl: dto.MessageImageUrl{
+					Url:    part.ImageUrl,
+					Detail: detail,
+				},
+			})
+		default:
+			return fmt.Errorf("content type %s is not supported by this channel", part.Type)
+		}
+	}
+	message.SetMediaContent(mediaContents)
+	return nil
+}
+
+func responsesToolChoice2Chat(toolChoice json.RawMessage) any {
+	var choice string
+	if err := json.Unmarshal(toolChoice, &choice); err == nil {
+		return choice
+	}
+	var function struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(toolChoice, &function); err == nil && function.Type == "function" {
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]string{"name": function.Name},
+		}
+	}
+	return nil
+}
+
+func chatUsage2ResponsesUsage(usage *dto.Usage) *dto.ResponsesUsage {
+	if usage == nil {
+		return nil
+	}
+	return &dto.ResponsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.TotalTokens,
+		InputTokensDetails: &dto.ResponsesInputTokensDetails{
+			CachedTokens: usage.PromptTokensDetails.CachedTokens,
+		},
+		OutputTokensDetails: &dto.ResponsesOutputTokensDetails{
+			ReasoningTokens: usage.CompletionTokenDetails.ReasoningTokens,
+		},
+	}
+}
+
+type responsesItemState struct {
+	outputIndex int
+	item        dto.ResponsesOutput
+	text        strings.Builder
+	done        bool
+}
+
+// ResponsesTranslator 把 chat completions 的输出转换为 Responses 接口的事件流和响应体
+type ResponsesTranslator struct {
+	request      *dto.OpenAIResponsesRequest
+	id           string
+	model        string
+	createdAt    int64
+	sequence     int
+	started      bool
+	items        []*responsesItemState
+	reasoning    *responsesItemState
+	message      *responsesItemState
+	toolCalls    map[int]*responsesItemState
+	usage        *dto.Usage
+	finishReason string
+}
+
+func NewResponsesTranslator(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) *ResponsesTranslator {
+	return &ResponsesTranslator{
+		request:   request,
+		id:        "resp_" + common.GetUUID(),
+		model:     info.OriginModelName,
+		createdAt: info.StartTime.Unix(),
+		toolCalls: make(map[int]*responsesItemState),
+	}
+}
+
+func (t *ResponsesTranslator) newResponse(status string) *dto.OpenAIResponsesResponse {
+	response := &dto.OpenAIResponsesResponse{
+		Id:          t.id,
+		Object:      "response",
+		CreatedAt:   t.createdAt,
+		Status:      status,
+		Model:       t.model,
+		Output:      make([]dto.ResponsesOutput, 0),
+		Temperature: t.request.Temperature,
+		TopP:        t.request.TopP,
+		Tools:       t.request.Tools,
+		ToolChoice:  t.request.ToolChoice,
+		Metadata:    t.request.Metadata,
+		User:        t.request.User,
+	}
+	if response.Tools == nil {
+		response.Tools = make([]dto.ResponsesTool, 0)
+	}
+	if t.request.Instructions != "" {
+		response.Instructions = &t.request.Instructions
+	}
+	if t.request.MaxOutputTokens != 0 {
+		response.MaxOutputTokens = &t.request.MaxOutputTokens
+	}
+	return response
+}
+
+func (t *ResponsesTranslator) event(response dto.ResponsesStreamResponse) helper.StreamEvent {
+	response.SequenceNumber = t.sequence
+	t.sequence++
+	return helper.StreamEvent{Event: response.Type, Data: response}
+}
+
+func (t *ResponsesTranslator) openItem(item dto.ResponsesOutput) (*responsesItemState, helper.StreamEvent) {
+	state := &responsesItemState{outputIndex: len(t.items), item: item}
+	t.items = append(t.items, state)
+	added := item
+	return state, t.event(dto.ResponsesStreamResponse{
+		Type:        dto.ResponsesEventOutputItemAdded,
+		OutputIndex: common.GetPointer(state.outputIndex),
+		Item:        &added,
+	})
+}
+
+func (t *ResponsesTranslator) closeItem(state *responsesItemState) []helper.StreamEvent {
+	if state == nil || state.done {
+		return nil
+	}
+	state.done = true
+	outputIndex := common.GetPointer(state.outputIndex)
+	zero := common.GetPointer(0)
+	text := state.text.String()
+	events := make([]helper.StreamEvent, 0, 4)
+	switch state.item.Type {
+	case dto.ResponsesItemTypeReasoning:
+		part := dto.ResponsesSummaryPart{Type: dto.ResponsesContentTypeSummaryText, Text: text}
+		state.item.Summary = []dto.ResponsesSummaryPart{part}
+		events = append(events,
+			t.event(dto.ResponsesStreamResponse{Type: dto.ResponsesEventReasoningSummaryDone, ItemId: state.item.Id, OutputIndex: outputIndex, SummaryIndex: zero, Text: text}),
+			t.event(dto.ResponsesStreamResponse{Type: dto.ResponsesEventReasoningSummaryPartDone, ItemId: state.item.Id, OutputIndex: outputIndex, SummaryIndex: zero, Part: part}),
+		)
+	case dto.ResponsesItemTypeMessage:
+		part := dto.ResponsesOutputContent{Type: dto.ResponsesContentTypeOutputText, Text: text, Annotations: []any{}}
+		state.item.Content = []dto.ResponsesOutputContent{part}
+		events = append(events,
+			t.event(dto.ResponsesStreamResponse{Type: dto.ResponsesEventOutputTextDone, ItemId: state.item.Id, OutputIndex: outputIndex, ContentIndex: zero, Text: text}),
+			t.event(dto.ResponsesStreamResponse{Type: dto.ResponsesEventContentPartDone, ItemId: state.item.Id, OutputIndex: outputIndex, ContentIndex: zero, Part: part}),
+		)
+	case dto.ResponsesItemTypeFunctionCall:
+		state.item.Arguments = text
+		events = append(events,
+			t.event(dto.ResponsesStreamResponse{Type: dto.ResponsesEventFunctionCallArgsDone, ItemId: state.item.Id, OutputIndex: outputIndex, Arguments: text}),
+		)
+	}
+	state.item.Status = "completed"
+	item := state.item
+	events = append(events, t.event(dto.ResponsesStreamResponse{
+		Type:        dto.ResponsesEventOutputItemDone,
+		OutputIndex: outputIndex,
+		Item:        &item,
+	}))
+	return events
+}
+
+func (t *ResponsesTranslator) TranslateStreamChunk(chunk *dto.ChatCompletionsStreamResponse) []helper.StreamEvent {
+	events := make([]helper.StreamEvent, 0)
+	if !t.started {
+		t.started = true
+		events = append(events,
+			t.event(dto.ResponsesStreamResponse{Type: dto.ResponsesEventCreated, Response: t.newResponse("in_progress")}),
+			t.event(dto.ResponsesStreamResponse{Type: dto.ResponsesEventInProgress, Response: t.newResponse("in_progress")}),
+		)
+	}
+	if service.ValidUsage(chunk.Usage) {
+		t.usage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			if t.reasoning == nil {
+				var added helper.StreamEvent
+				t.reasoning, added = t.openItem(dto.ResponsesOutput{
+					Type:    dto.ResponsesItemTypeReasoning,
+					Id:      "rs_" + common.GetUUID(),
+					Summary: []dto.ResponsesSummaryPart{},
+				})
+				events = append(events, added, t.event(dto.ResponsesStreamResponse{
+					Type:         dto.ResponsesEventReasoningSummaryPartAdded,
+					ItemId:       t.reasoning.item.Id,
+					OutputIndex:  common.GetPointer(t.reasoning.outputIndex),
+					SummaryIndex: common.GetPointer(0),
+					Part:         dto.ResponsesSummaryPart{Type: dto.ResponsesContentTypeSummaryText},
+				}))
+			}
+			t.reasoning.text.WriteString(reasoning)
+			events = append(events, t.event(dto.ResponsesStreamResponse{
+				Type:         dto.ResponsesEventReasoningSummaryDelta,
+				ItemId:       t.reasoning.item.Id,
+				OutputIndex:  common.GetPointer(t.reasoning.outputIndex),
+				SummaryIndex: common.GetPointer(0),
+				Delta:        reasoning,
+			}))
+		}
+		if content := choice.Delta.GetContentString(); content != "" {
+			events = append(events, t.closeItem(t.reasoning)...)
+			if t.message == nil {
+				var added helper.StreamEvent
+				t.message, added = t.openItem(dto.ResponsesOutput{
+					Type:    dto.ResponsesItemTypeMessage,
+					Id:      "msg_" + common.GetUUID(),
+					Status:  "in_progress",
+					Role:    "assistant",
+					Content: []dto.ResponsesOutputContent{},
+				})
+				events = append(events, added, t.event(dto.ResponsesStreamResponse{
+					Type:         dto.ResponsesEventContentPartAdded,
+					ItemId:       t.message.item.Id,
+					OutputIndex:  common.GetPointer(t.message.outputIndex),
+					ContentIndex: common.GetPointer(0),
+					Part:         dto.ResponsesOutputContent{Type: dto.ResponsesContentTypeOutputText, Annotations: []any{}},
+				}))
+			}
+			t.message.text.WriteString(content)
+			events = append(events, t.event(dto.ResponsesStreamResponse{
+				Type:         dto.ResponsesEventOutputTextDelta,
+				ItemId:       t.message.item.Id,
+				OutputIndex:  common.GetPointer(t.message.outputIndex),
+				ContentIndex: common.GetPointer(0),
+				Delta:        content,
+			}))
+		}
+		for i, toolCall := range choice.Delta.ToolCalls {
+			index := i
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			state, ok := t.toolCalls[index]
+			if !ok {
+				events = append(events, t.closeItem(t.reasoning)...)
+				events = append(events, t.closeItem(t.message)...)
+				callId := toolCall.ID
+				if callId == "" {
+					callId = "call_" + common.GetUUID()
+				}
+				var added helper.StreamEvent
+				state, added = t.openItem(dto.ResponsesOutput{
+					Type:   dto.ResponsesItemTypeFunctionCall,
+					Id:     "fc_" + common.GetUUID(),
+					Status: "in_progress",
+					CallId: callId,
+					Name:   toolCall.Function.Name,
+				})
+				t.toolCalls[index] = state
+				events = append(events, added)
+			}
+			if toolCall.Function.Arguments != "" {
+				state.text.WriteString(toolCall.Function.Arguments)
+				events = append(events, t.event(dto.ResponsesStreamResponse{
+					Type:        dto.ResponsesEventFunctionCallArgsDelta,
+					ItemId:      state.item.Id,
+					OutputIndex: common.GetPointer(state.outputIndex),
+					Delta:       toolCall.Function.Arguments,
+				}))
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.finishReason = *choice.FinishReason
+		}
+	}
+	return events
+}
+
+func (t *ResponsesTranslator) TranslateStreamEnd() []helper.StreamEvent {
+	events := make([]helper.StreamEvent, 0)
+	if !t.started {
+		t.started = true
+		events = append(events, t.event(dto.ResponsesStreamResponse{Type: dto.ResponsesEventCreated, Response: t.newResponse("in_progress")}))
+	}
+	for _, state := range t.items {
+		events = append(events, t.closeItem(state)...)
+	}
+	response := t.newResponse("completed")
+	for _, state := range t.items {
+		response.Output = append(response.Output, state.item)
+	}
+	response.Usage = chatUsage2ResponsesUsage(t.usage)
+	eventType := dto.ResponsesEventCompleted
+	if t.finishReason == "length" {
+		eventType = dto.ResponsesEventIncomplete
+		response.Status = "incomplete"
+		response.IncompleteDetails = &dto.ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	}
+	return append(events, t.event(dto.ResponsesStreamResponse{Type: eventType, Response: response}))
+}
+
+func (t *ResponsesTranslator) TranslateResponse(response *dto.OpenAITextResponse) (any, error) {
+	if response.Model != "" {
+		t.model = response.Model
+	}
+	result := t.newResponse("completed")
+	choice := response.Choices[0]
+	reasoning := choice.Message.ReasoningContent
+	if reasoning == "" {
+		reasoning = choice.Message.Reasoning
+	}
+	if reasoning != "" {
+		result.Output = append(result.Output, dto.ResponsesOutput{
+			Type:    dto.ResponsesItemTypeReasoning,
+			Id:      "rs_" + common.GetUUID(),
+			Status:  "completed",
+			Summary: []dto.ResponsesSummaryPart{{Type: dto.ResponsesContentTypeSummaryText, Text: reasoning}},
+		})
+	}
+	if content := choice.Message.StringContent(); content != "" {
+		result.Output = append(result.Output, dto.ResponsesOutput{
+			Type:    dto.ResponsesItemTypeMessage,
+			Id:      "msg_" + common.GetUUID(),
+			Status:  "completed",
+			Role:    "assistant",
+			Content: []dto.ResponsesOutputContent{{Type: dto.ResponsesContentTypeOutputText, Text: content, Annotations: []any{}}},
+		})
+	}
+	for _, toolCall := range choice.Message.ParseToolCalls() {
+		result.Output = append(result.Output, dto.ResponsesOutput{
+			Type:      dto.ResponsesItemTypeFunctionCall,
+			Id:        "fc_" + common.GetUUID(),
+			Status:    "completed",
+			CallId:    toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		})
+	}
+	if choice.FinishReason == "length" {
+		result.Status = "incomplete"
+		result.IncompleteDetails = &dto.ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	}
+	result.Usage = chatUsage2ResponsesUsage(&response.Usage)
+	return result, nil
+}
+
+// OaiResponsesStreamHandler 透传上游 Responses 事件流，并从 response.completed 事件中获取用量
+func OaiResponsesStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	if resp == nil || resp.Body == nil {
+		common.LogError(c, "invalid response or response body")
+		return service.OpenAIErrorWrapper(fmt.Errorf("invalid response"), "invalid_response", http.StatusInternalServerError), nil
+	}
+
+	var usage *dto.Usage
+	var responseTextBuilder strings.Builder
+	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		var streamResponse dto.ResponsesStreamResponse
+		if err := json.Unmarshal(common.StringToByteSlice(data), &streamResponse); err != nil {
+			common.SysError("error unmarshalling responses stream: " + err.Error())
+			return true
+		}
+		switch streamResponse.Type {
+		case dto.ResponsesEventOutputTextDelta, dto.ResponsesEventReasoningSummaryDelta, dto.ResponsesEventFunctionCallArgsDelta:
+			responseTextBuilder.WriteString(streamResponse.Delta)
+		case dto.ResponsesEventCompleted, dto.ResponsesEventIncomplete, dto.ResponsesEventFailed:
+			if streamResponse.Response != nil && streamResponse.Response.Usage != nil {
+				usage = streamResponse.Response.Usage.ToUsage()
+			}
+		}
+		if err := responsesStreamData(c, streamResponse.Type, data); err != nil {
+			common.LogError(c, "streaming error: "+err.Error())
+			return false
+		}
+		return true
+	})
+
+	if !service.ValidUsage(usage) {
+		usage, _ = service.ResponseText2Usage(responseTextBuilder.String(), info.UpstreamModelName, info.PromptTokens)
+	}
+	return nil, usage
+}
+
+func responsesStreamData(c *gin.Context, eventType string, data string) error {
+	if _, err := io.WriteString(c.Writer, "event: "+eventType+"\ndata: "+data+"\n\n"); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+func OaiResponsesHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var responsesResponse dto.OpenAIResponsesResponse
+	err = json.Unmarshal(responseBody, &responsesResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if responsesResponse.Error != nil && responsesResponse.Error.Type != "" {
+		return &dto.OpenAIErrorWithStatusCode{
+			Error:      *responsesResponse.Error,
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+
+	for k, v := range resp.Header {
+		if k == "Content-Length" {
+			c.Writer.Header().Set(k, strconv.Itoa(len(responseBody)))
+			continue
+		}
+		c.Writer.Header().Set(k, v[0])
+	}
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = io.Copy(c.Writer, bytes.NewReader(responseBody))
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	if responsesResponse.Usage != nil {
+		usage := responsesResponse.Usage.ToUsage()
+		if service.ValidUsage(usage) {
+			return nil, usage
+		}
+	}
+	var responseTextBuilder strings.Builder
+	for _, output := range responsesResponse.Output {
+		for _, content := range output.Content {
+			responseTextBuilder.WriteString(content.Text)
+		}
+		for _, summary := range output.Summary {
+			responseTextBuilder.WriteString(summary.Text)
+		}
+		responseTextBuilder.WriteString(output.Arguments)
+	}
+	usage, _ := service.ResponseText2Usage(responseTextBuilder.String(), info.UpstreamModelName, info.PromptTokens)
+	return nil, usage
+}
@@ -24,12 +24,15 @@ import (
 	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
 )
 
+// 发起批量请求的最大并发数量，可通过环境变量 VOLCENGINE_MAX_PARALLEL_REQUESTS 配置，默认 2000；
+// 需要按渠道限制并发时使用渠道设置 max_concurrency
+var MaxParallelRequests = common.GetEnvOrDefault("VOLCENGINE_MAX_PARALLEL_REQUESTS", 2000)
+
+// 限速器默认大小为 MaxParallelRequests 的 3 倍
+var RateLimiterSize = MaxParallelRequests * 3
+
 // 全局配置变量
 const (
-	MaxParallelRequests = 2000
-
-	// 限速器默认大小为 MaxParallelRequests 的 3 倍
-	RateLimiterSize = MaxParallelRequests * 3
 	// 异步调用超时时间配置
 	MinAsyncTimeout = 1 * time.Second
 	MaxAsyncTimeout = 3 * time.Second
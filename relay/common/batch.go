@@ -0,0 +1,16 @@
+package common
+
+import "context"
+
+type batchRequestKey struct{}
+
+// WithBatchRequest 标记请求来自网关执行的 /v1/batches 任务，
+// 标记保存在 request context 中，客户端无法通过请求头伪造
+func WithBatchRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, batchRequestKey{}, true)
+}
+
+func IsBatchRequest(ctx context.Context) bool {
+	isBatch, _ := ctx.Value(batchRequestKey{}).(bool)
+	return isBatch
+}
@@ -12,6 +12,14 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// RelayFormat 描述客户端使用的接口协议，决定响应需要转换成哪种格式返回
+const (
+	RelayFormatOpenAI          = "openai"
+	RelayFormatOpenAIResponses = "openai_responses"
+	RelayFormatClaude          = "claude"
+	RelayFormatGemini          = "gemini"
+)
+
 type ThinkingContentInfo struct {
 	IsFirstThinkingContent  bool
 	SendLastThinkingContent bool
@@ -23,7 +31,7 @@ type RelayInfo struct {
 	ChannelTag        string
 	ChannelName       string
 	TokenId           int
-	TokenKey          string
+	TokenKeyHash      string
 	UserId            int
 	UserName          string
 	Group             string
@@ -37,6 +45,7 @@ type RelayInfo struct {
 	IsPlayground      bool
 	UsePrice          bool
 	RelayMode         int
+	RelayFormat       string
 	UpstreamModelName string
 	OriginModelName   string
 	//RecodeModelName      string
@@ -65,6 +74,11 @@ type RelayInfo struct {
 	Direct               bool
 	RetryCount           int
 	Headers              map[string]string
+	// 使用短期客户端令牌时的 jti、额度上限（0 表示不限制）、过期时间和终端用户 id
+	ClientTokenId        string
+	ClientTokenQuota     int
+	ClientTokenExpiresAt int64
+	EndUserId            string
 	ThinkingContentInfo
 }
 
@@ -90,6 +104,20 @@ func GenRelayInfoWs(c *gin.Context, ws *websocket.Conn) *RelayInfo {
 	return info
 }
 
+// GetRelayFormat 根据请求路径判断客户端使用的接口协议
+func GetRelayFormat(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/v1/responses"):
+		return RelayFormatOpenAIResponses
+	case strings.HasPrefix(path, "/v1/messages"):
+		return RelayFormatClaude
+	case strings.HasPrefix(path, "/v1beta/models/"):
+		return RelayFormatGemini
+	default:
+		return RelayFormatOpenAI
+	}
+}
+
 func GenRelayInfo(c *gin.Context) *RelayInfo {
 	channelType := c.GetInt("channel_type")
 	channelId := c.GetInt("channel_id")
@@ -97,7 +125,7 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 	channelTag := c.GetString("channel_tag")
 	channelName := c.GetString("channel_name")
 	tokenId := c.GetInt("token_id")
-	tokenKey := c.GetString("token_key")
+	tokenKeyHash := c.GetString("token_key_hash")
 	userId := c.GetInt("id")
 	group := c.GetString("group")
 	tokenUnlimited := c.GetBool("token_unlimited_quota")
@@ -113,6 +141,7 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		UserName:          c.GetString(constant.ContextKeyUserName),
 		isFirstResponse:   true,
 		RelayMode:         relayconstant.Path2RelayMode(c.Request.URL.Path),
+		RelayFormat:       GetRelayFormat(c.Request.URL.Path),
 		BaseUrl:           c.GetString("base_url"),
 		Endpoint:          c.GetString("endpoint"),
 		RequestURLPath:    c.Request.URL.String(),
@@ -121,7 +150,7 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		ChannelTag:        channelTag,
 		ChannelName:       channelName,
 		TokenId:           tokenId,
-		TokenKey:          tokenKey,
+		TokenKeyHash:      tokenKeyHash,
 		UserId:            userId,
 		Group:             group,
 		TokenUnlimited:    tokenUnlimited,
@@ -137,6 +166,11 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		Organization:   c.GetString("channel_organization"),
 		ChannelSetting: channelSetting,
 		Headers:        make(map[string]string),
+
+		ClientTokenId:        c.GetString(constant.ContextKeyClientTokenId),
+		ClientTokenQuota:     c.GetInt(constant.ContextKeyClientTokenQuota),
+		ClientTokenExpiresAt: c.GetInt64(constant.ContextKeyClientTokenExpiresAt),
+		EndUserId:            c.GetString(constant.ContextKeyEndUserId),
 		ThinkingContentInfo: ThinkingContentInfo{
 			IsFirstThinkingContent:  true,
 			SendLastThinkingContent: false,
@@ -41,8 +41,37 @@ const (
 
 	RelayModeRealtime
 	RelayModeProxy
+
+	RelayModeResponses
+
+	RelayModeGemini
 )
 
+// geminiNativeActions 是会被解析并转换成内部请求的 Gemini 原生接口，其余 /v1beta 请求仍然透传
+var geminiNativeActions = []string{"generateContent", "streamGenerateContent", "countTokens", "embedContent"}
+
+// GeminiAction 返回 Gemini 原生路径中冒号后面的方法名，例如 generateContent
+func GeminiAction(path string) string {
+	idx := strings.LastIndex(path, ":")
+	if idx < 0 {
+		return ""
+	}
+	return path[idx+1:]
+}
+
+func isGeminiNativePath(path string) bool {
+	if !strings.HasPrefix(path, "/v1beta/models/") {
+		return false
+	}
+	action := GeminiAction(path)
+	for _, nativeAction := range geminiNativeActions {
+		if action == nativeAction {
+			return true
+		}
+	}
+	return false
+}
+
 func Path2RelayMode(path string) int {
 	relayMode := RelayModeUnknown
 	if strings.HasPrefix(path, "/v1/chat/completions") || strings.HasPrefix(path, "/pg/chat/completions") || strings.HasPrefix(path, "/v1/messages") {
@@ -70,7 +99,9 @@ func Path2RelayMode(path string) int {
 	} else if strings.HasPrefix(path, "/v1/realtime") {
 		relayMode = RelayModeRealtime
 	} else if strings.HasPrefix(path, "/v1/responses") {
-		relayMode = RelayModeChatCompletions
+		relayMode = RelayModeResponses
+	} else if isGeminiNativePath(path) {
+		relayMode = RelayModeGemini
 	} else if strings.HasPrefix(path, "/v1beta/models") || strings.HasPrefix(path, "/v1/models") {
 		relayMode = RelayModeProxy
 	}
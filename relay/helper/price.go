@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"one-api/common"
+	"one-api/constant"
 	relaycommon "one-api/relay/common"
 	"one-api/setting"
 	"one-api/setting/operation_setting"
@@ -22,6 +23,10 @@ type PriceData struct {
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, maxTokens int) (PriceData, error) {
 	modelPrice, usePrice := operation_setting.GetModelPrice(info.OriginModelName, false)
 	groupRatio := setting.GetGroupRatio(info.Group)
+	if relaycommon.IsBatchRequest(c.Request.Context()) {
+		// 批处理请求按折扣计费，折扣并入分组倍率，预扣费和后扣费都会生效
+		groupRatio *= constant.BatchPriceRatio
+	}
 	var preConsumedQuota int
 	var modelRatio float64
 	var completionRatio float64
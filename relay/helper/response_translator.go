@@ -0,0 +1,205 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamEvent 是转换后要写给客户端的一条 SSE 事件，Event 为空时只输出 data 行
+type StreamEvent struct {
+	Event string
+	Data  any
+}
+
+// ChatResponseTranslator 把渠道输出的 OpenAI chat completions 结果转换成客户端请求的协议格式
+type ChatResponseTranslator interface {
+	// TranslateStreamChunk 处理一个 chat.completion.chunk
+	TranslateStreamChunk(chunk *dto.ChatCompletionsStreamResponse) []StreamEvent
+	// TranslateStreamEnd 在收到 [DONE] 或上游结束时调用，用于补齐收尾事件
+	TranslateStreamEnd() []StreamEvent
+	// TranslateResponse 处理非流式的完整响应
+	TranslateResponse(response *dto.OpenAITextResponse) (any, error)
+}
+
+// TranslatingResponseWriter 包装 gin.ResponseWriter，拦截各渠道 handler 写出的 OpenAI 格式数据，
+// 经 ChatResponseTranslator 转换后再写给客户端，渠道 handler 本身不需要感知客户端协议
+type TranslatingResponseWriter struct {
+	gin.ResponseWriter
+	translator     ChatResponseTranslator
+	bodyTranslator func(body []byte) ([]byte, error)
+	buffer         bytes.Buffer
+	isStream       bool
+	decided        bool
+	streamDone     bool
+}
+
+// UseResponseTranslator 替换 c.Writer，返回的 finish 函数必须在 handler 结束后调用，
+// 它会输出剩余内容并恢复原始的 writer
+func UseResponseTranslator(c *gin.Context, translator ChatResponseTranslator) (finish func()) {
+	origin := c.Writer
+	writer := &TranslatingResponseWriter{
+		ResponseWriter: origin,
+		translator:     translator,
+	}
+	c.Writer = writer
+	return func() {
+		writer.finish()
+		c.Writer = origin
+	}
+}
+
+// UseResponseBodyTranslator 用于 embeddings 等非流式接口，成功响应的完整内容会交给 translate 转换后再写出
+func UseResponseBodyTranslator(c *gin.Context, translate func(body []byte) ([]byte, error)) (finish func()) {
+	origin := c.Writer
+	writer := &TranslatingResponseWriter{
+		ResponseWriter: origin,
+		bodyTranslator: translate,
+	}
+	c.Writer = writer
+	return func() {
+		writer.finish()
+		c.Writer = origin
+	}
+}
+
+func (w *TranslatingResponseWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.isStream = w.translator != nil && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func (w *TranslatingResponseWriter) Write(data []byte) (int, error) {
+	w.decide()
+	w.buffer.Write(data)
+	if w.isStream {
+		w.processStreamBuffer()
+	}
+	return len(data), nil
+}
+
+func (w *TranslatingResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *TranslatingResponseWriter) Written() bool {
+	return w.buffer.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// processStreamBuffer 按空行切分 SSE 事件，不完整的事件留在缓冲区等待后续数据
+func (w *TranslatingResponseWriter) processStreamBuffer() {
+	for {
+		data := w.buffer.Bytes()
+		idx := bytes.Index(data, []byte("\n\n"))
+		if idx < 0 {
+			return
+		}
+		block := string(data[:idx])
+		w.buffer.Next(idx + 2)
+		w.handleStreamBlock(block)
+	}
+}
+
+func (w *TranslatingResponseWriter) handleStreamBlock(block string) {
+	for _, line := range strings.Split(block, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "" {
+			continue
+		}
+		if strings.HasPrefix(payload, "[DONE]") {
+			w.endStream()
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := json.Unmarshal(common.StringToByteSlice(payload), &chunk); err != nil {
+			common.SysError("translate stream chunk failed: " + err.Error())
+			continue
+		}
+		w.writeEvents(w.translator.TranslateStreamChunk(&chunk))
+	}
+}
+
+func (w *TranslatingResponseWriter) endStream() {
+	if w.streamDone {
+		return
+	}
+	w.streamDone = true
+	w.writeEvents(w.translator.TranslateStreamEnd())
+}
+
+func (w *TranslatingResponseWriter) writeEvents(events []StreamEvent) {
+	if len(events) == 0 {
+		return
+	}
+	var out bytes.Buffer
+	for _, event := range events {
+		jsonData, err := json.Marshal(event.Data)
+		if err != nil {
+			common.SysError("marshal translated stream event failed: " + err.Error())
+			continue
+		}
+		if event.Event != "" {
+			out.WriteString("event: " + event.Event + "\n")
+		}
+		out.WriteString("data: ")
+		out.Write(jsonData)
+		out.WriteString("\n\n")
+	}
+	_, _ = w.ResponseWriter.Write(out.Bytes())
+	w.ResponseWriter.Flush()
+}
+
+func (w *TranslatingResponseWriter) finish() {
+	if !w.decided {
+		return
+	}
+	if w.isStream {
+		if w.buffer.Len() > 0 {
+			w.handleStreamBlock(w.buffer.String())
+			w.buffer.Reset()
+		}
+		w.endStream()
+		return
+	}
+	body := w.buffer.Bytes()
+	if len(body) == 0 {
+		return
+	}
+	// 上游返回的 Content-Length/Content-Encoding 已经不再适用于转换后的内容
+	w.Header().Del("Content-Length")
+	w.Header().Del("Content-Encoding")
+	if w.bodyTranslator != nil {
+		if w.Status() == http.StatusOK {
+			if translated, err := w.bodyTranslator(body); err == nil {
+				body = translated
+			} else {
+				common.SysError("translate response body failed: " + err.Error())
+			}
+		}
+		_, _ = w.ResponseWriter.Write(body)
+		return
+	}
+	var response dto.OpenAITextResponse
+	if w.Status() == http.StatusOK && json.Unmarshal(body, &response) == nil && len(response.Choices) > 0 {
+		translated, err := w.translator.TranslateResponse(&response)
+		if err == nil {
+			if jsonData, err := json.Marshal(translated); err == nil {
+				body = jsonData
+			}
+		} else {
+			common.SysError("translate response failed: " + err.Error())
+		}
+	}
+	_, _ = w.ResponseWriter.Write(body)
+}
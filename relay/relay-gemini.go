@@ -0,0 +1,103 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/relay/channel/gemini"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GeminiRelayRequest 是解析后的 Gemini 原生请求，Action 为路径中冒号后的方法名，只有对应的请求体字段不为空
+type GeminiRelayRequest struct {
+	Action      string
+	Generate    *gemini.GeminiNativeRequest
+	CountTokens *gemini.GeminiCountTokensRequest
+	Embed       *gemini.GeminiEmbedContentRequest
+}
+
+func GeminiInfo(c *gin.Context) (*relaycommon.RelayInfo, *GeminiRelayRequest, *dto.OpenAIErrorWithStatusCode) {
+	relayInfo := relaycommon.GenRelayInfo(c)
+	geminiRequest := &GeminiRelayRequest{Action: relayconstant.GeminiAction(c.Request.URL.Path)}
+	var err error
+	switch geminiRequest.Action {
+	case "countTokens":
+		geminiRequest.CountTokens = &gemini.GeminiCountTokensRequest{}
+		err = common.UnmarshalBodyReusable(c, geminiRequest.CountTokens)
+	case "embedContent":
+		geminiRequest.Embed = &gemini.GeminiEmbedContentRequest{}
+		err = common.UnmarshalBodyReusable(c, geminiRequest.Embed)
+		if err == nil && len(geminiRequest.Embed.Content.Parts) == 0 {
+			err = errors.New("field content is required")
+		}
+	default:
+		geminiRequest.Generate = &gemini.GeminiNativeRequest{}
+		err = common.UnmarshalBodyReusable(c, geminiRequest.Generate)
+		if err == nil && len(geminiRequest.Generate.Contents) == 0 {
+			err = errors.New("field contents is required")
+		}
+	}
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateGeminiRequest failed: %s", err.Error()))
+		return nil, nil, service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	relayInfo.IsStream = geminiRequest.Action == "streamGenerateContent"
+	return relayInfo, geminiRequest, nil
+}
+
+// GeminiHelper Gemini 渠道保持原有的透传方式，其他渠道把请求转换为 chat completions / embeddings 后再把结果转换回 Gemini 格式
+func GeminiHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo, geminiRequest *GeminiRelayRequest) *dto.OpenAIErrorWithStatusCode {
+	if relayInfo.ChannelType == common.ChannelTypeGemini {
+		requestBody, err := common.GetRequestBody(c)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "get_request_body_failed", http.StatusBadRequest)
+		}
+		return ProxyHelper(c, relayInfo, requestBody)
+	}
+
+	switch geminiRequest.Action {
+	case "countTokens":
+		return geminiCountTokensHelper(c, relayInfo, geminiRequest.CountTokens)
+	case "embedContent":
+		embeddingRequest, err := gemini.GeminiEmbedContentRequest2OpenAIRequest(geminiRequest.Embed, relayInfo.OriginModelName)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+		}
+		relayInfo.RelayMode = relayconstant.RelayModeEmbeddings
+		relayInfo.RequestURLPath = "/v1/embeddings"
+		finish := helper.UseResponseBodyTranslator(c, gemini.OpenAIEmbeddingResponse2Gemini)
+		defer finish()
+		return EmbeddingHelper(c, relayInfo, embeddingRequest)
+	default:
+		textRequest, err := gemini.GeminiNativeRequest2OpenAIRequest(geminiRequest.Generate, relayInfo.OriginModelName, relayInfo.IsStream)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+		}
+		relayInfo.RelayMode = relayconstant.RelayModeChatCompletions
+		relayInfo.RequestURLPath = "/v1/chat/completions"
+		finish := helper.UseResponseTranslator(c, gemini.NewGeminiResponseTranslator(relayInfo))
+		defer finish()
+		return TextHelper(c, relayInfo, textRequest)
+	}
+}
+
+// geminiCountTokensHelper 在本地计算 token 数，不请求上游也不计费
+func geminiCountTokensHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo, countRequest *gemini.GeminiCountTokensRequest) *dto.OpenAIErrorWithStatusCode {
+	textRequest, err := gemini.GeminiCountTokensRequest2OpenAIRequest(countRequest, relayInfo.OriginModelName)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	promptTokens, err := service.CountTokenChatRequest(c, relayInfo, *textRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "count_token_messages_failed", http.StatusInternalServerError)
+	}
+	c.JSON(http.StatusOK, &gemini.GeminiCountTokensResponse{TotalTokens: promptTokens})
+	return nil
+}
@@ -118,7 +118,7 @@ func ImageHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo, imageRequest
 		priceData.ModelPrice = 0.0025 * priceData.ModelRatio
 	}
 
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := model.GetBillingQuota(relayInfo.UserId)
 	if err != nil {
 		common.LogError(c, fmt.Sprintf("get_user_quota_failed: %s", err.Error()))
 	}
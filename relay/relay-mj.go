@@ -170,7 +170,7 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 	}
 	groupRatio := setting.GetGroupRatio(group)
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.GetUserQuota(userId, false)
+	userQuota, err := model.GetBillingQuota(userId)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -477,7 +477,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 	}
 	groupRatio := setting.GetGroupRatio(group)
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.GetUserQuota(userId, false)
+	userQuota, err := model.GetBillingQuota(userId)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
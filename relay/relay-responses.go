@@ -0,0 +1,194 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/metrics"
+	"one-api/relay/channel/openai"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ResponsesInfo(c *gin.Context) (*relaycommon.RelayInfo, *dto.OpenAIResponsesRequest, *dto.OpenAIErrorWithStatusCode) {
+	relayInfo := relaycommon.GenRelayInfo(c)
+	responsesRequest := &dto.OpenAIResponsesRequest{}
+	err := common.UnmarshalBodyReusable(c, responsesRequest)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateResponsesRequest failed: %s", err.Error()))
+		return nil, nil, service.OpenAIErrorWrapperLocal(err, "invalid_responses_request", http.StatusBadRequest)
+	}
+	if responsesRequest.Model == "" {
+		return nil, nil, service.OpenAIErrorWrapperLocal(errors.New("model is required"), "invalid_responses_request", http.StatusBadRequest)
+	}
+	if len(responsesRequest.Input) == 0 && responsesRequest.PreviousResponseId == "" {
+		return nil, nil, service.OpenAIErrorWrapperLocal(errors.New("field input is required"), "invalid_responses_request", http.StatusBadRequest)
+	}
+	relayInfo.IsStream = responsesRequest.Stream
+	return relayInfo, responsesRequest, nil
+}
+
+// ResponsesHelper OpenAI/Azure 渠道直接透传 Responses 请求，其他渠道转换为 chat completions 后再把结果转换回 Responses 格式
+func ResponsesHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo, responsesRequest *dto.OpenAIResponsesRequest) *dto.OpenAIErrorWithStatusCode {
+	if relayInfo.ChannelType == common.ChannelTypeOpenAI || relayInfo.ChannelType == common.ChannelTypeAzure {
+		return responsesPassthroughHelper(c, relayInfo, responsesRequest)
+	}
+
+	textRequest, err := openai.ResponsesRequest2ChatRequest(responsesRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "invalid_responses_request", http.StatusBadRequest)
+	}
+	relayInfo.RelayMode = relayconstant.RelayModeChatCompletions
+	relayInfo.RequestURLPath = "/v1/chat/completions"
+	finish := helper.UseResponseTranslator(c, openai.NewResponsesTranslator(relayInfo, responsesRequest))
+	defer finish()
+	return TextHelper(c, relayInfo, textRequest)
+}
+
+func responsesPassthroughHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo, responsesRequest *dto.OpenAIResponsesRequest) (openaiErr *dto.OpenAIErrorWithStatusCode) {
+	startTime := common.GetBeijingTime()
+	var funcErr *dto.OpenAIErrorWithStatusCode
+	var statusCode int = -1
+	metrics.IncrementRelayRequestTotalCounter(strconv.Itoa(relayInfo.ChannelId), relayInfo.ChannelName, relayInfo.ChannelTag, relayInfo.BaseUrl, responsesRequest.Model, relayInfo.Group, strconv.Itoa(relayInfo.UserId), relayInfo.UserName, 1)
+	defer func() {
+		if funcErr != nil {
+			metrics.IncrementRelayRequestFailedCounter(strconv.Itoa(relayInfo.ChannelId), relayInfo.ChannelName, relayInfo.ChannelTag, relayInfo.BaseUrl, responsesRequest.Model, relayInfo.Group, strconv.Itoa(funcErr.StatusCode), strconv.Itoa(relayInfo.UserId), relayInfo.UserName, funcErr.Error.Message, 1)
+		} else {
+			metrics.IncrementRelayRequestSuccessCounter(strconv.Itoa(relayInfo.ChannelId), relayInfo.ChannelName, relayInfo.ChannelTag, relayInfo.BaseUrl, responsesRequest.Model, relayInfo.Group, strconv.Itoa(statusCode), strconv.Itoa(relayInfo.UserId), relayInfo.UserName, 1)
+			metrics.ObserveRelayRequestDuration(strconv.Itoa(relayInfo.ChannelId), relayInfo.ChannelName, relayInfo.ChannelTag, relayInfo.BaseUrl, responsesRequest.Model, relayInfo.Group, strconv.Itoa(relayInfo.UserId), relayInfo.UserName, time.Since(startTime).Seconds())
+		}
+	}()
+
+	err := helper.ModelMappedHelper(c, relayInfo)
+	if err != nil {
+		funcErr = service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+		return funcErr
+	}
+
+	promptTokens := countResponsesPromptTokens(c, relayInfo, responsesRequest)
+	relayInfo.PromptTokens = promptTokens
+	c.Set("prompt_tokens", promptTokens)
+
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, int(responsesRequest.MaxOutputTokens))
+	if err != nil {
+		funcErr = service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+		return funcErr
+	}
+
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, relayInfo)
+	if openaiErr != nil {
+		funcErr = openaiErr
+		return openaiErr
+	}
+	defer func() {
+		if openaiErr != nil {
+			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
+		}
+	}()
+
+	// 原样透传请求体，只在模型被映射时替换 model 字段
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		funcErr = service.OpenAIErrorWrapperLocal(err, "get_request_body_failed", http.StatusInternalServerError)
+		return funcErr
+	}
+	if relayInfo.UpstreamModelName != responsesRequest.Model {
+		var bodyMap map[string]json.RawMessage
+		if err := json.Unmarshal(requestBody, &bodyMap); err != nil {
+			funcErr = service.OpenAIErrorWrapperLocal(err, "invalid_responses_request", http.StatusBadRequest)
+			return funcErr
+		}
+		bodyMap["model"], _ = json.Marshal(relayInfo.UpstreamModelName)
+		requestBody, err = json.Marshal(bodyMap)
+		if err != nil {
+			funcErr = service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+			return funcErr
+		}
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		funcErr = service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+		return funcErr
+	}
+	adaptor.Init(relayInfo)
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	resp, err := adaptor.DoRequest(c, relayInfo, bytes.NewBuffer(requestBody))
+	if err != nil {
+		funcErr = service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		return funcErr
+	}
+	if resp == nil {
+		funcErr = service.OpenAIErrorWrapperLocal(fmt.Errorf("no response received"), "no_response", http.StatusInternalServerError)
+		return funcErr
+	}
+	httpResp := resp.(*http.Response)
+	defer func() {
+		if httpResp.Body != nil {
+			httpResp.Body.Close()
+		}
+	}()
+	relayInfo.IsStream = relayInfo.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+	if httpResp.StatusCode != http.StatusOK {
+		openaiErr = service.RelayErrorHandler(httpResp)
+		funcErr = openaiErr
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+	statusCode = httpResp.StatusCode
+
+	responseHeaders, _ := json.Marshal(httpResp.Header)
+	c.Set(common.CtxResponseHeaders, string(responseHeaders))
+
+	var buf bytes.Buffer
+	httpResp.Body = io.NopCloser(io.TeeReader(httpResp.Body, &buf))
+	usage, respErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	c.Set(common.CtxResponseBody, buf.String())
+	if respErr != nil {
+		openaiErr = respErr
+		funcErr = respErr
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+	common.LogInfo(c, fmt.Sprintf("response status code: %d, Usage: %+v", httpResp.StatusCode, usage))
+
+	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "", buf.Bytes())
+	return nil
+}
+
+// countResponsesPromptTokens 借助转换后的 chat 请求计算输入 token，无法转换时按原始 input 文本估算
+func countResponsesPromptTokens(c *gin.Context, relayInfo *relaycommon.RelayInfo, responsesRequest *dto.OpenAIResponsesRequest) int {
+	countRequest := *responsesRequest
+	countRequest.PreviousResponseId = ""
+	countRequest.Tools = nil
+	for _, tool := range responsesRequest.Tools {
+		if tool.Type == "function" {
+			countRequest.Tools = append(countRequest.Tools, tool)
+		}
+	}
+	textRequest, err := openai.ResponsesRequest2ChatRequest(&countRequest)
+	if err == nil {
+		textRequest.Model = relayInfo.UpstreamModelName
+		var promptTokens int
+		promptTokens, err = service.CountTokenChatRequest(c, relayInfo, *textRequest)
+		if err == nil {
+			return promptTokens
+		}
+	}
+	common.LogWarn(c, fmt.Sprintf("count responses prompt tokens failed, fallback to raw input: %v", err))
+	promptTokens, _ := service.CountTextToken(responsesRequest.Instructions+string(responsesRequest.Input), relayInfo.UpstreamModelName)
+	return promptTokens
+}
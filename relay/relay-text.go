@@ -13,6 +13,7 @@ import (
 	"one-api/dto"
 	"one-api/metrics"
 	"one-api/model"
+	"one-api/relay/channel/claude"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
 	"one-api/relay/helper"
@@ -77,15 +78,13 @@ func TextInfo(c *gin.Context) (*relaycommon.RelayInfo, *dto.GeneralOpenAIRequest
 	relayInfo := relaycommon.GenRelayInfo(c)
 
 	if relayInfo.Direct {
-		// support claude direct
-		if strings.HasPrefix(relayInfo.OriginModelName, "claude") {
-			textRequest, err := getAndValidateDirectRequest(c, relayInfo)
-			if err != nil {
-				common.LogError(c, fmt.Sprintf("getAndValidateDirectRequest failed: %s", err.Error()))
-				return nil, nil, service.OpenAIErrorWrapperLocal(err, "invalid_text_request", http.StatusBadRequest)
-			}
-			return relayInfo, textRequest, nil
+		// Anthropic Messages 请求，任意模型都可以使用，响应在 TextHelper 中转换回 Anthropic 格式
+		textRequest, err := getAndValidateDirectRequest(c, relayInfo)
+		if err != nil {
+			common.LogError(c, fmt.Sprintf("getAndValidateDirectRequest failed: %s", err.Error()))
+			return nil, nil, service.OpenAIErrorWrapperLocal(err, "invalid_text_request", http.StatusBadRequest)
 		}
+		return relayInfo, textRequest, nil
 	}
 
 	// get & validate textRequest 获取并验证文本请求
@@ -112,6 +111,11 @@ func TextHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest *d
 		}
 	}()
 
+	if relayInfo.RelayFormat == relaycommon.RelayFormatClaude {
+		finish := helper.UseResponseTranslator(c, claude.NewClaudeResponseTranslator(relayInfo))
+		defer finish()
+	}
+
 	if setting.ShouldCheckPromptSensitive() {
 		words, err := checkRequestSensitive(textRequest, relayInfo)
 		if err != nil {
@@ -121,7 +125,14 @@ func TextHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest *d
 		}
 	}
 
-	err := helper.ModelMappedHelper(c, relayInfo)
+	// 上游不认识网关生成的文件 id，引用 /v1/files 文件的内容先替换为内联数据
+	err := service.ResolveFileReferences(c, relayInfo.UserId, relayInfo.TokenId, textRequest)
+	if err != nil {
+		funcErr = service.OpenAIErrorWrapperLocal(err, "invalid_file_reference", http.StatusBadRequest)
+		return funcErr
+	}
+
+	err = helper.ModelMappedHelper(c, relayInfo)
 	if err != nil {
 		funcErr = service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
 		return funcErr
@@ -364,6 +375,15 @@ func TextHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest *d
 		}
 	}
 
+	// 转换为 chat completions 的 Responses 请求计费日志依赖上下文中的响应数据，与 responsesPassthroughHelper 保持一致；
+	// 其他 chat 请求保持原有行为，不写入响应内容。转换时 RelayMode 已改为 chat completions，这里按客户端协议判断
+	_, exists := c.Get(common.CtxResponseBody)
+	if !exists && relayInfo.RelayFormat == relaycommon.RelayFormatOpenAIResponses {
+		responseHeaders, _ := json.Marshal(httpResp.Header)
+		c.Set(common.CtxResponseHeaders, string(responseHeaders))
+		c.Set(common.CtxResponseBody, string(responseBodyBytes))
+	}
+
 	if strings.HasPrefix(relayInfo.OriginModelName, "gpt-4o-audio") {
 		service.PostAudioConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "", responseBodyBytes)
 	} else {
@@ -416,7 +436,7 @@ func checkRequestSensitive(textRequest *dto.GeneralOpenAIRequest, info *relaycom
 
 // 预扣费并返回用户剩余配额
 func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) (int, int, *dto.OpenAIErrorWithStatusCode) {
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := model.GetBillingQuota(relayInfo.UserId)
 	if err != nil {
 		return 0, 0, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -427,6 +447,12 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		return 0, 0, service.OpenAIErrorWrapperLocal(fmt.Errorf("chat pre-consumed quota failed, user quota: %s, need quota: %s", common.FormatQuota(userQuota), common.FormatQuota(preConsumedQuota)), "insufficient_user_quota", http.StatusForbidden)
 	}
 	relayInfo.UserQuota = userQuota
+	if err := service.CheckSpendBudget(relayInfo, preConsumedQuota); err != nil {
+		return 0, 0, service.OpenAIErrorWrapperLocal(err, "insufficient_spend_budget", http.StatusForbidden)
+	}
+	if err := service.CheckClientTokenQuota(relayInfo, preConsumedQuota); err != nil {
+		return 0, 0, service.OpenAIErrorWrapperLocal(err, "insufficient_client_token_quota", http.StatusForbidden)
+	}
 	if userQuota > 100*preConsumedQuota {
 		// 用户额度充足，判断令牌额度是否充足
 		if !relayInfo.TokenUnlimited {
@@ -450,10 +476,12 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		if err != nil {
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
-		err = model.DecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
+		err = model.DecreaseBillingQuota(relayInfo.UserId, preConsumedQuota)
 		if err != nil {
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 		}
+		service.RecordSpendBudget(relayInfo, preConsumedQuota)
+		service.RecordClientTokenQuota(relayInfo, preConsumedQuota)
 	}
 	return preConsumedQuota, userQuota, nil
 }
@@ -492,6 +520,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	if usage.CompletionTokens == 0 {
 		usage.CompletionTokens = usage.OutputTokens
 	}
+	service.SettleTokenRateLimit(ctx, usage)
 
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
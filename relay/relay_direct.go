@@ -8,24 +8,25 @@ import (
 	"one-api/dto"
 	"one-api/relay/channel/claude"
 	relaycommon "one-api/relay/common"
-	"strings"
 )
 
+// getAndValidateDirectRequest 解析 Anthropic Messages 格式的请求，转换为 OpenAI 格式后可以转发到任意渠道
 func getAndValidateDirectRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
-	if strings.HasPrefix(relayInfo.OriginModelName, "claude") {
-		directRequest := &claude.ClaudeRequest{}
-		err := common.UnmarshalBodyReusable(c, directRequest)
-		if err != nil {
-			return nil, err
-		}
-		if directRequest.MaxTokens > math.MaxInt32/2 {
-			return nil, errors.New("max_tokens is invalid")
-		}
-		if directRequest.Model == "" {
-			return nil, errors.New("model is required")
-		}
-
-		return claude.ClaudeMessage2OpenAIRequest(directRequest)
+	directRequest := &dto.ClaudeRequest{}
+	err := common.UnmarshalBodyReusable(c, directRequest)
+	if err != nil {
+		return nil, err
+	}
+	if directRequest.MaxTokens > math.MaxInt32/2 {
+		return nil, errors.New("max_tokens is invalid")
+	}
+	if directRequest.Model == "" {
+		return nil, errors.New("model is required")
 	}
-	return nil, errors.New("direct model not support")
+	if len(directRequest.Messages) == 0 {
+		return nil, errors.New("field messages is required")
+	}
+	relayInfo.IsStream = directRequest.Stream
+
+	return claude.ClaudeMessage2OpenAIRequest(directRequest)
 }
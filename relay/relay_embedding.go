@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
@@ -136,6 +137,11 @@ func EmbeddingHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo, embedding
 		}
 	}
 
+	// 计费日志依赖上下文中的响应数据，与 TextHelper 保持一致
+	var responseBody bytes.Buffer
+	if httpResp != nil && httpResp.Body != nil {
+		httpResp.Body = io.NopCloser(io.TeeReader(httpResp.Body, &responseBody))
+	}
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
 	if openaiErr != nil {
 		funcErr = openaiErr
@@ -147,6 +153,12 @@ func EmbeddingHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo, embedding
 	// 设置状态码用于指标记录
 	statusCode = resp.(*http.Response).StatusCode
 
-	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "", nil)
+	if _, exists := c.Get(common.CtxResponseBody); !exists {
+		responseHeaders, _ := json.Marshal(httpResp.Header)
+		c.Set(common.CtxResponseHeaders, string(responseHeaders))
+		c.Set(common.CtxResponseBody, responseBody.String())
+	}
+
+	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "", responseBody.Bytes())
 	return nil
 }
@@ -52,7 +52,7 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 	// 预扣
 	groupRatio := setting.GetGroupRatio(relayInfo.Group)
 	ratio := modelPrice * groupRatio
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := model.GetBillingQuota(relayInfo.UserId)
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 		return
@@ -62,6 +62,14 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
 		return
 	}
+	if err := service.CheckSpendBudget(relayInfo.RelayInfo, quota); err != nil {
+		taskErr = service.TaskErrorWrapperLocal(err, "insufficient_spend_budget", http.StatusForbidden)
+		return
+	}
+	if err := service.CheckClientTokenQuota(relayInfo.RelayInfo, quota); err != nil {
+		taskErr = service.TaskErrorWrapperLocal(err, "insufficient_client_token_quota", http.StatusForbidden)
+		return
+	}
 
 	if relayInfo.OriginTaskID != "" {
 		originTask, exist, err := model.GetByTaskId(relayInfo.UserId, relayInfo.OriginTaskID)
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"one-api/constant"
 	"one-api/controller"
 	"one-api/middleware"
 
@@ -16,7 +17,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/ping", controller.Ping)
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
-		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
+		apiRouter.GET("/status/test", middleware.PermissionAuth(constant.PermissionStatusRead), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
 		apiRouter.GET("/about", controller.GetAbout)
 		//apiRouter.GET("/midjourney", controller.GetMidjourney)
@@ -58,27 +59,49 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/amount", controller.RequestAmount)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
+				selfRoute.PUT("/self/ip_policy", controller.UpdateSelfIpPolicy)
+				selfRoute.GET("/self/permissions", controller.GetSelfPermissions)
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.POST("/manage", controller.ManageUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
+				userRead := middleware.PermissionAuth(constant.PermissionUserRead, constant.PermissionUserWrite, constant.PermissionUserQuotaWrite)
+				userWrite := middleware.PermissionAuth(constant.PermissionUserWrite)
+				adminRoute.GET("/", userRead, controller.GetAllUsers)
+				adminRoute.GET("/search", userRead, controller.SearchUsers)
+				adminRoute.GET("/:id", userRead, controller.GetUser)
+				adminRoute.POST("/", userWrite, controller.CreateUser)
+				adminRoute.POST("/manage", userWrite, controller.ManageUser)
+				// 只有 user.quota.write 权限时只能修改额度，见 controller.UpdateUser
+				adminRoute.PUT("/", middleware.PermissionAuth(constant.PermissionUserWrite, constant.PermissionUserQuotaWrite), controller.UpdateUser)
+				adminRoute.PUT("/:id/ip_policy", userWrite, controller.UpdateUserIpPolicy)
+				// 管理员设置的预算用户不能修改或删除
+				adminRoute.GET("/:id/spend_budget", userRead, controller.GetUserSpendBudgets)
+				adminRoute.POST("/:id/spend_budget", middleware.PermissionAuth(constant.PermissionUserQuotaWrite), controller.AddUserSpendBudget)
+				adminRoute.PUT("/:id/spend_budget", middleware.PermissionAuth(constant.PermissionUserQuotaWrite), controller.UpdateUserSpendBudget)
+				adminRoute.DELETE("/:id/spend_budget/:budget_id", middleware.PermissionAuth(constant.PermissionUserQuotaWrite), controller.DeleteUserSpendBudget)
+				adminRoute.PUT("/:id/admin_role", middleware.RootAuth(), controller.UpdateUserAdminRole)
+				adminRoute.DELETE("/:id", userWrite, controller.DeleteUser)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
 		{
-			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
-			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
-			optionRoute.POST("/request_log", controller.ToggleRequestLog)
+			optionWrite := middleware.PermissionAuth(constant.PermissionOptionWrite)
+			optionRoute.GET("/", middleware.PermissionAuth(constant.PermissionOptionRead, constant.PermissionOptionWrite), controller.GetOptions)
+			optionRoute.PUT("/", optionWrite, controller.UpdateOption)
+			optionRoute.POST("/rest_model_ratio", optionWrite, controller.ResetModelRatio)
+			optionRoute.POST("/request_log", optionWrite, controller.ToggleRequestLog)
+		}
+
+		// 自定义管理员角色，只有超级管理员可以管理
+		adminRoleRoute := apiRouter.Group("/admin_role")
+		adminRoleRoute.Use(middleware.RootAuth())
+		{
+			adminRoleRoute.GET("/", controller.GetAllAdminRoles)
+			adminRoleRoute.GET("/permissions", controller.GetPermissions)
+			adminRoleRoute.POST("/", controller.CreateAdminRole)
+			adminRoleRoute.PUT("/", controller.UpdateAdminRole)
+			adminRoleRoute.DELETE("/:id", controller.DeleteAdminRole)
 		}
 
 		// 添加token鉴权的request_log接口
@@ -98,63 +121,117 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
-		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ChannelListModels)
-			channelRoute.GET("/models_enabled", controller.EnabledListModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.GET("/test", controller.TestAllChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.POST("/tag/disabled", controller.DisableTagChannels)
-			channelRoute.POST("/tag/enabled", controller.EnableTagChannels)
-			channelRoute.PUT("/tag", controller.EditTagChannels)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
-			channelRoute.POST("/batch", controller.DeleteChannelBatch)
-			channelRoute.POST("/fix", controller.FixChannelsAbilities)
-			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
-			channelRoute.POST("/fetch_models", controller.FetchModels)
-			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
+		{
+			channelRead := middleware.PermissionAuth(constant.PermissionChannelRead, constant.PermissionChannelWrite)
+			channelWrite := middleware.PermissionAuth(constant.PermissionChannelWrite)
+			channelRoute.GET("/", channelRead, controller.GetAllChannels)
+			channelRoute.GET("/search", channelRead, controller.SearchChannels)
+			channelRoute.GET("/models", channelRead, controller.ChannelListModels)
+			channelRoute.GET("/models_enabled", channelRead, controller.EnabledListModels)
+			channelRoute.GET("/stats", channelRead, controller.GetChannelStats)
+			channelRoute.GET("/breakers", channelRead, controller.GetChannelBreakers)
+			channelRoute.GET("/:id", channelRead, controller.GetChannel)
+			// 渠道密钥和会使用密钥请求上游的接口需要写权限
+			channelRoute.GET("/:id/keys", channelWrite, controller.GetChannelKeys)
+			channelRoute.POST("/:id/keys", channelWrite, controller.AddChannelKeys)
+			channelRoute.PUT("/:id/keys/:key_id", channelWrite, controller.UpdateChannelKey)
+			channelRoute.DELETE("/:id/keys/:key_id", channelWrite, controller.DeleteChannelKey)
+			channelRoute.GET("/test", channelWrite, controller.TestAllChannels)
+			channelRoute.GET("/test/:id", channelWrite, controller.TestChannel)
+			channelRoute.GET("/update_balance", channelWrite, controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", channelWrite, controller.UpdateChannelBalance)
+			channelRoute.POST("/", channelWrite, controller.AddChannel)
+			channelRoute.PUT("/", channelWrite, controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", channelWrite, controller.DeleteDisabledChannel)
+			channelRoute.POST("/tag/disabled", channelWrite, controller.DisableTagChannels)
+			channelRoute.POST("/tag/enabled", channelWrite, controller.EnableTagChannels)
+			channelRoute.PUT("/tag", channelWrite, controller.EditTagChannels)
+			channelRoute.DELETE("/:id", channelWrite, controller.DeleteChannel)
+			channelRoute.POST("/batch", channelWrite, controller.DeleteChannelBatch)
+			channelRoute.POST("/fix", channelWrite, controller.FixChannelsAbilities)
+			channelRoute.GET("/fetch_models/:id", channelWrite, controller.FetchUpstreamModels)
+			channelRoute.POST("/fetch_models", channelRead, controller.FetchModels)
+			channelRoute.POST("/batch/tag", channelWrite, controller.BatchSetChannelTag)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
 		{
 			tokenRoute.GET("/", controller.GetAllTokens)
 			tokenRoute.GET("/search", controller.SearchTokens)
+			tokenRoute.GET("/scopes", controller.GetTokenScopes)
 			tokenRoute.GET("/:id", controller.GetToken)
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
+			tokenRoute.POST("/:id/rotate", controller.RotateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
+		spendBudgetRoute := apiRouter.Group("/spend_budget")
+		spendBudgetRoute.Use(middleware.UserAuth())
+		{
+			spendBudgetRoute.GET("/", controller.GetSpendBudgets)
+			spendBudgetRoute.POST("/", controller.AddSpendBudget)
+			spendBudgetRoute.PUT("/", controller.UpdateSpendBudget)
+			spendBudgetRoute.DELETE("/:id", controller.DeleteSpendBudget)
+		}
+		organizationRoute := apiRouter.Group("/organization")
+		{
+			organizationWrite := middleware.PermissionAuth(constant.PermissionOrganizationWrite)
+			organizationRoute.GET("/", middleware.PermissionAuth(constant.PermissionOrganizationRead, constant.PermissionOrganizationWrite), controller.GetAllOrganizations)
+			organizationRoute.POST("/", organizationWrite, controller.CreateOrganization)
+			organizationRoute.PUT("/", organizationWrite, controller.UpdateOrganization)
+			organizationRoute.POST("/:id/quota", middleware.PermissionAuth(constant.PermissionUserQuotaWrite), controller.AdjustOrganizationQuota)
+			organizationRoute.DELETE("/:id", organizationWrite, controller.DeleteOrganization)
+
+			organizationSelfRoute := organizationRoute.Group("/self")
+			organizationSelfRoute.Use(middleware.UserAuth())
+			{
+				organizationSelfRoute.GET("", controller.GetSelfOrganization)
+				organizationSelfRoute.POST("/transfer", controller.TransferQuotaToOrganization)
+				organizationSelfRoute.GET("/members", controller.GetOrganizationMembers)
+				// 添加成员需要用户接受邀请
+				organizationSelfRoute.POST("/members", controller.InviteOrganizationMember)
+				organizationSelfRoute.GET("/invitations", controller.GetOrganizationInvitations)
+				organizationSelfRoute.DELETE("/invitations/:id", controller.CancelOrganizationInvitation)
+				organizationSelfRoute.PUT("/members", controller.UpdateOrganizationMember)
+				organizationSelfRoute.DELETE("/members/:id", controller.RemoveOrganizationMember)
+				organizationSelfRoute.GET("/logs", controller.GetOrganizationLogs)
+				organizationSelfRoute.GET("/quota_data", controller.GetOrganizationQuotaData)
+			}
+
+			invitationRoute := organizationRoute.Group("/invitation")
+			invitationRoute.Use(middleware.UserAuth())
+			{
+				invitationRoute.GET("/", controller.GetSelfOrganizationInvitations)
+				invitationRoute.POST("/:id/accept", controller.AcceptOrganizationInvitation)
+				invitationRoute.DELETE("/:id", controller.DeclineOrganizationInvitation)
+			}
+		}
 		allTokenRoute := apiRouter.Group("/alltoken")
 		allTokenRoute.Use(middleware.RootAuth())
 		{
 			allTokenRoute.GET("/", controller.RootGetAllTokens)
 		}
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
 		{
-			redemptionRoute.GET("/", controller.GetAllRedemptions)
-			redemptionRoute.GET("/search", controller.SearchRedemptions)
-			redemptionRoute.GET("/:id", controller.GetRedemption)
-			redemptionRoute.POST("/", controller.AddRedemption)
-			redemptionRoute.PUT("/", controller.UpdateRedemption)
-			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionRead := middleware.PermissionAuth(constant.PermissionRedemptionRead, constant.PermissionRedemptionWrite)
+			redemptionWrite := middleware.PermissionAuth(constant.PermissionRedemptionWrite)
+			redemptionRoute.GET("/", redemptionRead, controller.GetAllRedemptions)
+			redemptionRoute.GET("/search", redemptionRead, controller.SearchRedemptions)
+			redemptionRoute.GET("/:id", redemptionRead, controller.GetRedemption)
+			redemptionRoute.POST("/", redemptionWrite, controller.AddRedemption)
+			redemptionRoute.PUT("/", redemptionWrite, controller.UpdateRedemption)
+			redemptionRoute.DELETE("/:id", redemptionWrite, controller.DeleteRedemption)
 		}
+		billingRead := middleware.PermissionAuth(constant.PermissionBillingRead)
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", billingRead, controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(constant.PermissionLogWrite), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", billingRead, controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/search", billingRead, controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		apiRouter.GET("/audit_log/", middleware.PermissionAuth(constant.PermissionAuditRead), controller.GetAuditLogs)
 
 		// 用户限速配置接口
 		userRateLimitRoute := apiRouter.Group("/user_rate_limit")
@@ -162,10 +239,11 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			userRateLimitRoute.GET("/config", controller.GetSpecificUserRateLimitConfig)
 		}
+		apiRouter.GET("/user_rate_limit/adjustments", middleware.PermissionAuth(constant.PermissionUserRead), controller.GetUserRateLimitAdjustments)
 
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
-		dataRoute.GET("/billing", controller.ExportBillingExcel)
+		dataRoute.GET("/", billingRead, controller.GetAllQuotaDates)
+		dataRoute.GET("/billing", billingRead, controller.ExportBillingExcel)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
 		dataRoute.GET("/token", middleware.TokenAuth(), controller.GetQuotaDataByToken)
 
@@ -175,18 +253,19 @@ func SetApiRouter(router *gin.Engine) {
 
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		// 编辑渠道和用户时都需要选择分组
+		groupRoute.Use(middleware.PermissionAuth(constant.PermissionChannelRead, constant.PermissionChannelWrite, constant.PermissionUserRead, constant.PermissionUserWrite))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
-		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
+		mjRoute.GET("/", middleware.PermissionAuth(constant.PermissionTaskRead), controller.GetAllMidjourney)
 
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
-			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/", middleware.PermissionAuth(constant.PermissionTaskRead), controller.GetAllTask)
 		}
 
 		// Batch Job 相关接口
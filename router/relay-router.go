@@ -55,13 +55,33 @@ func SetRelayRouter(router *gin.Engine) {
 	{
 		// WebSocket 路由
 		wsRouter := relayV1Router.Group("")
-		wsRouter.Use(middleware.Distribute())
+		wsRouter.Use(middleware.Distribute(), middleware.RealtimeSessionLimit())
 		wsRouter.GET("/realtime", controller.WssRelay)
 	}
+	{
+		// 文件和批处理接口不需要选择渠道，不经过 Distribute
+		filesRouter := relayV1Router.Group("/files")
+		filesRouter.GET("", controller.ListFiles)
+		filesRouter.POST("", controller.UploadFile)
+		filesRouter.DELETE("/:id", controller.DeleteFile)
+		filesRouter.GET("/:id", controller.RetrieveFile)
+		filesRouter.GET("/:id/content", controller.RetrieveFileContent)
+
+		batchesRouter := relayV1Router.Group("/batches")
+		batchesRouter.GET("", controller.ListBatches)
+		batchesRouter.POST("", controller.CreateBatch)
+		batchesRouter.GET("/:id", controller.RetrieveBatch)
+		batchesRouter.POST("/:id/cancel", controller.CancelBatch)
+
+		relayV1Router.GET("/async/:id", controller.RetrieveAsyncRequest)
+
+		// 用普通令牌换取短期客户端令牌
+		relayV1Router.POST("/client_tokens", controller.CreateClientToken)
+	}
 	{
 		//http router
 		httpRouter := relayV1Router.Group("")
-		httpRouter.Use(middleware.Distribute(), middleware.UserTokenModelRateLimit())
+		httpRouter.Use(middleware.AsyncRequest(), middleware.Distribute(), middleware.UserTokenModelRateLimit(), middleware.TokenRateLimit(), middleware.ConcurrencyLimit())
 		httpRouter.POST("/completions", controller.Relay)
 		httpRouter.POST("/chat/completions", controller.Relay)
 		httpRouter.POST("/responses", controller.Relay)
@@ -74,11 +94,6 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/audio/transcriptions", controller.Relay)
 		httpRouter.POST("/audio/translations", controller.Relay)
 		httpRouter.POST("/audio/speech", controller.Relay)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -96,7 +111,7 @@ func SetRelayRouter(router *gin.Engine) {
 	relayV1BetaRouter.Use(middleware.ModelRequestRateLimit())
 	{
 		v1betaHttpRouter := relayV1BetaRouter.Group("")
-		v1betaHttpRouter.Use(middleware.Distribute(), middleware.UserTokenModelRateLimit())
+		v1betaHttpRouter.Use(middleware.AsyncRequest(), middleware.Distribute(), middleware.UserTokenModelRateLimit(), middleware.TokenRateLimit(), middleware.ConcurrencyLimit())
 
 		v1betaHttpRouter.POST("/models/*modelAndAction", controller.Relay)
 	}
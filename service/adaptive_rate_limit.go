@@ -0,0 +1,177 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 自适应限速：主节点定期汇总各用户在各分组、模型上的请求数、上游 429 次数和渠道并发已满次数，
+// 按 AIMD 调整中心控制库中启用的用户限速。分组、模型拥塞时，请求占比不低于平均值的用户限速按比例降低，
+// 请求少的用户不受影响；未拥塞且用户请求接近限速时限速逐步增加，调整结果限制在配置的上下限内并记录调整原因
+
+// RecordRateLimitStat 记录自适应限速使用的请求统计，未启用自适应限速时不记录
+func RecordRateLimitStat(username, group, modelName, stat string) {
+	if !constant.AdaptiveRateLimitEnabled || username == "" || modelName == "" {
+		return
+	}
+	gopool.Go(func() {
+		model.RecordRateLimitStat(username, group, modelName, stat)
+	})
+}
+
+// StartAdaptiveRateLimitController 在主节点启动自适应限速的调整循环
+func StartAdaptiveRateLimitController() {
+	if !constant.AdaptiveRateLimitEnabled {
+		return
+	}
+	interval := time.Duration(max(constant.AdaptiveRateLimitInterval, 10)) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			adjustUserRateLimits(interval)
+		}
+	}()
+	common.SysLog(fmt.Sprintf("adaptive rate limit controller started, site: %s, interval: %s, dry run: %t",
+		constant.CentralSiteName, interval, constant.AdaptiveRateLimitDryRun))
+}
+
+type rateLimitGroupModel struct {
+	Group string
+	Model string
+}
+
+// rateLimitLoad 一个分组、模型在统计窗口内的负载
+type rateLimitLoad struct {
+	Requests    int64
+	Throttled   int64
+	Saturated   int64
+	ActiveUsers int
+}
+
+func (load *rateLimitLoad) congestion() float64 {
+	if load.Requests == 0 {
+		return 0
+	}
+	return float64(load.Throttled+load.Saturated) / float64(load.Requests)
+}
+
+func adjustUserRateLimits(interval time.Duration) {
+	minutes := int(math.Ceil(interval.Minutes()))
+	samples, err := model.GetRateLimitSamples(minutes)
+	if err != nil {
+		common.SysError("failed to get rate limit stats: " + err.Error())
+		return
+	}
+	loads := make(map[rateLimitGroupModel]*rateLimitLoad)
+	userSamples := make(map[[3]string]*model.RateLimitSample)
+	for _, sample := range samples {
+		key := rateLimitGroupModel{Group: sample.Group, Model: sample.Model}
+		load := loads[key]
+		if load == nil {
+			load = &rateLimitLoad{}
+			loads[key] = load
+		}
+		load.Requests += sample.Requests
+		load.Throttled += sample.Throttled
+		load.Saturated += sample.Saturated
+		if sample.Requests > 0 {
+			load.ActiveUsers++
+		}
+		userSamples[[3]string{sample.Username, sample.Group, sample.Model}] = sample
+	}
+
+	configs, err := model.GetEnabledUserRateLimitConfigs()
+	if err != nil {
+		common.SysError("failed to get user rate limit configs: " + err.Error())
+		return
+	}
+	for _, config := range configs {
+		sample := userSamples[[3]string{config.Username, config.GroupName, config.ModelName}]
+		if sample == nil {
+			sample = &model.RateLimitSample{}
+		}
+		load := loads[rateLimitGroupModel{Group: config.GroupName, Model: config.ModelName}]
+		if load == nil {
+			load = &rateLimitLoad{}
+		}
+		adjustment := decideUserRateLimit(config, sample, load, minutes)
+		if adjustment == nil {
+			continue
+		}
+		if err := model.ApplyUserRateLimitAdjustment(config, adjustment); err != nil {
+			common.SysError(fmt.Sprintf("failed to adjust rate limit of %s (%s/%s): %s",
+				config.Username, config.GroupName, config.ModelName, err.Error()))
+			continue
+		}
+		common.SysLog(fmt.Sprintf("rate limit of %s (%s/%s) adjusted from %d to %d rpm: %s",
+			config.Username, config.GroupName, config.ModelName, adjustment.PreviousRateLimit, adjustment.NewRateLimit, adjustment.Reason))
+	}
+}
+
+// decideUserRateLimit 按 AIMD 计算用户新的限速，不需要调整时返回 nil
+func decideUserRateLimit(config *model.UserRateLimitConfig, sample *model.RateLimitSample, load *rateLimitLoad, minutes int) *model.UserRateLimitAdjustment {
+	// 试运行时不修改当前限速，在建议限速的基础上继续计算
+	previous := config.CurrentRateLimit
+	if constant.AdaptiveRateLimitDryRun {
+		previous = config.SuggestedRateLimit
+	}
+	lower, upper := constant.AdaptiveRateLimitMin, constant.AdaptiveRateLimitMax
+	if config.MinRateLimit > 0 {
+		lower = config.MinRateLimit
+	}
+	if config.MaxRateLimit > 0 {
+		upper = config.MaxRateLimit
+	}
+	upper = max(upper, lower)
+
+	share := 0.0
+	if load.Requests > 0 {
+		share = float64(sample.Requests) / float64(load.Requests)
+	}
+	userRPM := float64(sample.Requests) / float64(minutes)
+	congestion := load.congestion()
+
+	next := previous
+	var reason string
+	switch {
+	case congestion >= constant.AdaptiveRateLimitCongestionRatio && load.ActiveUsers > 0 && share >= 1/float64(load.ActiveUsers):
+		next = int(float64(previous) * constant.AdaptiveRateLimitDecreaseFactor)
+		reason = fmt.Sprintf("congested: %.1f%% of requests throttled or saturated, user share %.1f%% of %d active users",
+			congestion*100, share*100, load.ActiveUsers)
+	case congestion < constant.AdaptiveRateLimitCongestionRatio && userRPM >= float64(previous)/2:
+		next = previous + constant.AdaptiveRateLimitIncreaseStep
+		reason = fmt.Sprintf("not congested: %.1f%% of requests throttled or saturated, user at %.0f rpm",
+			congestion*100, userRPM)
+	}
+	if next < lower || next > upper {
+		next = min(max(next, lower), upper)
+		if reason == "" {
+			reason = fmt.Sprintf("clamped to bounds [%d, %d]", lower, upper)
+		}
+	}
+	if next == previous {
+		return nil
+	}
+	return &model.UserRateLimitAdjustment{
+		SiteName:          config.SiteName,
+		ConfigId:          config.Id,
+		Username:          config.Username,
+		GroupName:         config.GroupName,
+		ModelName:         config.ModelName,
+		PreviousRateLimit: previous,
+		NewRateLimit:      next,
+		Applied:           !constant.AdaptiveRateLimitDryRun,
+		Reason:            reason,
+		Requests:          sample.Requests,
+		Throttled:         load.Throttled,
+		Saturated:         load.Saturated,
+		Share:             share,
+	}
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	AsyncRequestIdPrefix = "async_"
+
+	// asyncQueuedGracePeriod 提交后超过该时间仍在排队的请求由主节点接手，秒
+	asyncQueuedGracePeriod = 60
+	// asyncRetryInterval 上游返回 203 时重新查询结果的默认间隔
+	asyncRetryInterval   = 5 * time.Second
+	asyncCallbackRetries = 3
+	asyncRunnerPageSize  = 100
+)
+
+// asyncForwardHeaders 提交时保存的请求头，执行时原样带上
+var asyncForwardHeaders = []string{"Content-Type", "Anthropic-Version", "Anthropic-Beta", "Openai-Beta"}
+
+var (
+	asyncSemaphore = make(chan struct{}, max(constant.AsyncRequestConcurrency, 1))
+	asyncRunning   sync.Map
+	asyncCallback  = NewPublicHttpClient(10 * time.Second)
+)
+
+func asyncStorageKey(request *model.AsyncRequest, name string) string {
+	return fmt.Sprintf("async/%d/%s/%s", request.UserId, request.Id, name)
+}
+
+// SubmitAsyncRequest 保存请求并立即在当前节点后台执行，请求只在执行时经过正常的转发流程并计费一次
+func SubmitAsyncRequest(ctx context.Context, userId int, tokenId int, clientIp string, method string, path string,
+	header http.Header, body []byte, callbackUrl string) (*model.AsyncRequest, error) {
+	forwardHeader := make(map[string]string)
+	for _, key := range asyncForwardHeaders {
+		if value := header.Get(key); value != "" {
+			forwardHeader[key] = value
+		}
+	}
+	headerData, err := json.Marshal(forwardHeader)
+	if err != nil {
+		return nil, err
+	}
+	request := &model.AsyncRequest{
+		Id:          AsyncRequestIdPrefix + common.GetUUID(),
+		UserId:      userId,
+		TokenId:     tokenId,
+		ClientIp:    clientIp,
+		Method:      method,
+		Path:        path,
+		Header:      string(headerData),
+		CallbackUrl: callbackUrl,
+		Status:      model.AsyncRequestStatusQueued,
+		CreatedAt:   time.Now().Unix(),
+	}
+	storage, err := GetFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.Put(ctx, asyncStorageKey(request, "request"), bytes.NewReader(body), int64(len(body)), forwardHeader["Content-Type"]); err != nil {
+		return nil, err
+	}
+	if err := request.Insert(); err != nil {
+		_ = storage.Delete(ctx, asyncStorageKey(request, "request"))
+		return nil, err
+	}
+	goRunAsyncRequest(request)
+	return request, nil
+}
+
+// GetAsyncRequestResult 读取已完成请求的响应体
+func GetAsyncRequestResult(ctx context.Context, request *model.AsyncRequest) ([]byte, error) {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := storage.Get(ctx, asyncStorageKey(request, "response"))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func AsyncRequest2Response(ctx context.Context, request *model.AsyncRequest) *dto.AsyncRequestResponse {
+	response := &dto.AsyncRequestResponse{
+		Id:        request.Id,
+		Object:    "async_request",
+		Status:    request.Status,
+		CreatedAt: request.CreatedAt,
+	}
+	if request.CompletedAt == 0 {
+		return response
+	}
+	completedAt := request.CompletedAt
+	response.CompletedAt = &completedAt
+	response.Response = &dto.AsyncRequestResult{StatusCode: request.StatusCode}
+	body, err := GetAsyncRequestResult(ctx, request)
+	if err != nil {
+		common.SysError(fmt.Sprintf("get async request %s result failed: %s", request.Id, err.Error()))
+		return response
+	}
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	response.Response.Body = body
+	return response
+}
+
+// StartAsyncRequestRunner 在主节点定期接手提交节点未能执行完的请求，并清理过期的结果
+func StartAsyncRequestRunner() {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			recoverAsyncRequests()
+			cleanExpiredAsyncRequests()
+			<-ticker.C
+		}
+	}()
+}
+
+func recoverAsyncRequests() {
+	now := time.Now().Unix()
+	requests, err := model.GetPendingAsyncRequests(now-asyncQueuedGracePeriod, now-int64(constant.AsyncRequestTimeout), asyncRunnerPageSize)
+	if err != nil {
+		common.SysError("get pending async requests failed: " + err.Error())
+		return
+	}
+	for _, request := range requests {
+		goRunAsyncRequest(request)
+	}
+}
+
+func cleanExpiredAsyncRequests() {
+	completedBefore := time.Now().Add(-time.Duration(constant.AsyncResultRetentionHours) * time.Hour).Unix()
+	requests, err := model.GetExpiredAsyncRequests(completedBefore, asyncRunnerPageSize)
+	if err != nil {
+		common.SysError("get expired async requests failed: " + err.Error())
+		return
+	}
+	storage, err := GetFileStorage()
+	if err != nil {
+		return
+	}
+	for _, request := range requests {
+		if err := storage.Delete(context.Background(), asyncStorageKey(request, "response")); err != nil {
+			common.SysError(fmt.Sprintf("delete async request %s result failed: %s", request.Id, err.Error()))
+			continue
+		}
+		if err := request.Delete(); err != nil {
+			common.SysError(fmt.Sprintf("delete async request %s failed: %s", request.Id, err.Error()))
+		}
+	}
+}
+
+func goRunAsyncRequest(request *model.AsyncRequest) {
+	if _, running := asyncRunning.LoadOrStore(request.Id, struct{}{}); running {
+		return
+	}
+	gopool.Go(func() {
+		defer asyncRunning.Delete(request.Id)
+		defer func() {
+			if r := recover(); r != nil {
+				common.SysError(fmt.Sprintf("async request %s panic: %v", request.Id, r))
+			}
+		}()
+		asyncSemaphore <- struct{}{}
+		defer func() { <-asyncSemaphore }()
+		runAsyncRequest(request)
+	})
+}
+
+// runAsyncRequest 标记成功后执行请求，未标记成功说明已由其他节点执行
+func runAsyncRequest(request *model.AsyncRequest) {
+	now := time.Now().Unix()
+	claimed, err := model.ClaimAsyncRequest(request.Id, now, now-int64(constant.AsyncRequestTimeout))
+	if err != nil {
+		common.SysError(fmt.Sprintf("claim async request %s failed: %s", request.Id, err.Error()))
+		return
+	}
+	if !claimed {
+		return
+	}
+	statusCode, contentType, body := executeAsyncRequest(request)
+	storage, err := GetFileStorage()
+	if err != nil {
+		common.SysError(fmt.Sprintf("save async request %s result failed: %s", request.Id, err.Error()))
+		return
+	}
+	ctx := context.Background()
+	if err := storage.Put(ctx, asyncStorageKey(request, "response"), bytes.NewReader(body), int64(len(body)), contentType); err != nil {
+		common.SysError(fmt.Sprintf("save async request %s result failed: %s", request.Id, err.Error()))
+		return
+	}
+	status := model.AsyncRequestStatusCompleted
+	if statusCode < 200 || statusCode >= 300 {
+		status = model.AsyncRequestStatusFailed
+	}
+	if err := request.Complete(status, statusCode, contentType, time.Now().Unix()); err != nil {
+		common.SysError(fmt.Sprintf("update async request %s failed: %s", request.Id, err.Error()))
+		return
+	}
+	_ = storage.Delete(ctx, asyncStorageKey(request, "request"))
+	if request.CallbackUrl != "" {
+		latest, err := model.GetAsyncRequestById(request.Id, 0, 0)
+		if err == nil {
+			notifyAsyncCallback(latest)
+		}
+	}
+}
+
+// executeAsyncRequest 以提交请求的令牌身份执行请求，上游返回 203 时按 Retry_request_id 继续查询，直到拿到结果或超时
+func executeAsyncRequest(request *model.AsyncRequest) (int, string, []byte) {
+	failed := func(err error) (int, string, []byte) {
+		body, _ := json.Marshal(map[string]any{
+			"error": dto.OpenAIError{Message: err.Error(), Type: "new_api_error", Code: "async_request_failed"},
+		})
+		return http.StatusInternalServerError, "application/json", body
+	}
+	token, err := model.GetTokenById(request.TokenId)
+	if err != nil {
+		return failed(fmt.Errorf("get token failed: %w", err))
+	}
+	storage, err := GetFileStorage()
+	if err != nil {
+		return failed(err)
+	}
+	reader, err := storage.Get(context.Background(), asyncStorageKey(request, "request"))
+	if err != nil {
+		return failed(fmt.Errorf("get request body failed: %w", err))
+	}
+	body, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return failed(fmt.Errorf("get request body failed: %w", err))
+	}
+	header := make(http.Header)
+	var forwardHeader map[string]string
+	_ = json.Unmarshal([]byte(request.Header), &forwardHeader)
+	for key, value := range forwardHeader {
+		header.Set(key, value)
+	}
+
+	deadline := time.Now().Add(time.Duration(constant.AsyncRequestTimeout) * time.Second)
+	for {
+		recorder, err := ServeInternalRelay(context.Background(), request.Method, request.Path, body, header,
+			token.Id, request.ClientIp, request.Id)
+		if err != nil {
+			return failed(err)
+		}
+		retryRequestId := recorder.Header().Get(common.RetryRequestIdKey)
+		if recorder.Code != dto.StatusNewAPIBatchSubmitted || retryRequestId == "" || time.Now().After(deadline) {
+			return recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body.Bytes()
+		}
+		// 渠道自身也是异步提交，按建议的间隔携带 Retry_request_id 重新查询
+		interval := asyncRetryInterval
+		if seconds, err := strconv.Atoi(recorder.Header().Get("X-Suggested-Retry-After")); err == nil && seconds > 0 {
+			interval = time.Duration(seconds) * time.Second
+		}
+		time.Sleep(interval)
+		header.Set(common.RetryRequestIdKey, retryRequestId)
+	}
+}
+
+func notifyAsyncCallback(request *model.AsyncRequest) {
+	payload, err := json.Marshal(AsyncRequest2Response(context.Background(), request))
+	if err != nil {
+		return
+	}
+	for attempt := 0; attempt < asyncCallbackRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(1<<attempt) * time.Second)
+		}
+		req, err := http.NewRequest(http.MethodPost, request.CallbackUrl, bytes.NewReader(payload))
+		if err != nil {
+			common.SysError(fmt.Sprintf("async request %s callback failed: %s", request.Id, err.Error()))
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(common.RetryRequestIdKey, request.Id)
+		resp, err := asyncCallback.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return
+			}
+			err = errors.New("callback status code: " + strconv.Itoa(resp.StatusCode))
+		}
+		common.SysError(fmt.Sprintf("async request %s callback failed: %s", request.Id, err.Error()))
+	}
+}
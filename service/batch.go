@@ -0,0 +1,553 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+const (
+	BatchIdPrefix        = "batch_"
+	BatchRequestIdPrefix = "batch_req_"
+	BatchOutputPurpose   = "batch_output"
+
+	// batchMaxErrors 校验输入文件时最多记录的错误数
+	batchMaxErrors = 100
+	// batchMaxRetries 请求被网关限流（429）时的最大重试次数
+	batchMaxRetries = 3
+	// batchStatusCheckInterval 执行过程中检查任务是否被取消的间隔
+	batchStatusCheckInterval = 2 * time.Second
+	batchResultPageSize      = 500
+)
+
+var (
+	batchRunning   sync.Map
+	batchWakeup    = make(chan struct{}, 1)
+	batchSemaphore chan struct{}
+)
+
+// CreateBatch 创建批处理任务，任务由主节点的 StartBatchRunner 在后台执行
+func CreateBatch(userId int, tokenId int, clientIp string, request *dto.CreateBatchRequest, window time.Duration) (*model.Batch, error) {
+	now := time.Now().Unix()
+	batch := &model.Batch{
+		Id:               BatchIdPrefix + common.GetUUID(),
+		UserId:           userId,
+		TokenId:          tokenId,
+		ClientIp:         clientIp,
+		Endpoint:         request.Endpoint,
+		InputFileId:      request.InputFileId,
+		CompletionWindow: request.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + int64(window.Seconds()),
+	}
+	if len(request.Metadata) > 0 {
+		metadata, err := json.Marshal(request.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		batch.Metadata = string(metadata)
+	}
+	if err := batch.Insert(); err != nil {
+		return nil, err
+	}
+	WakeupBatchRunner()
+	return batch, nil
+}
+
+func Batch2OpenAIBatch(batch *model.Batch) *dto.OpenAIBatch {
+	timestamp := func(t int64) *int64 {
+		if t == 0 {
+			return nil
+		}
+		return &t
+	}
+	fileId := func(id string) *string {
+		if id == "" {
+			return nil
+		}
+		return &id
+	}
+	openAIBatch := &dto.OpenAIBatch{
+		Id:               batch.Id,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     fileId(batch.OutputFileId),
+		ErrorFileId:      fileId(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     timestamp(batch.InProgressAt),
+		ExpiresAt:        timestamp(batch.ExpiresAt),
+		FinalizingAt:     timestamp(batch.FinalizingAt),
+		CompletedAt:      timestamp(batch.CompletedAt),
+		FailedAt:         timestamp(batch.FailedAt),
+		ExpiredAt:        timestamp(batch.ExpiredAt),
+		CancellingAt:     timestamp(batch.CancellingAt),
+		CancelledAt:      timestamp(batch.CancelledAt),
+		RequestCounts: dto.OpenAIBatchRequestCounts{
+			Total:     batch.RequestTotal,
+			Completed: batch.RequestCompleted,
+			Failed:    batch.RequestFailed,
+		},
+	}
+	if batch.Errors != "" {
+		var errs dto.OpenAIBatchErrors
+		if err := json.Unmarshal([]byte(batch.Errors), &errs); err == nil {
+			openAIBatch.Errors = &errs
+		}
+	}
+	if batch.Metadata != "" {
+		_ = json.Unmarshal([]byte(batch.Metadata), &openAIBatch.Metadata)
+	}
+	return openAIBatch
+}
+
+// StartBatchRunner 在主节点启动批处理执行器，每一行请求通过 ServeInternalRelay 执行
+func StartBatchRunner() {
+	batchSemaphore = make(chan struct{}, max(constant.BatchConcurrency, 1))
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			dispatchBatches()
+			select {
+			case <-ticker.C:
+			case <-batchWakeup:
+			}
+		}
+	}()
+	common.SysLog(fmt.Sprintf("batch runner started, concurrency: %d", cap(batchSemaphore)))
+}
+
+// WakeupBatchRunner 通知执行器立即检查新任务，从节点上调用时无效果，由主节点定时轮询
+func WakeupBatchRunner() {
+	select {
+	case batchWakeup <- struct{}{}:
+	default:
+	}
+}
+
+func dispatchBatches() {
+	batches, err := model.GetUnfinishedBatches()
+	if err != nil {
+		common.SysError("get unfinished batches failed: " + err.Error())
+		return
+	}
+	for _, batch := range batches {
+		if _, running := batchRunning.LoadOrStore(batch.Id, struct{}{}); running {
+			continue
+		}
+		gopool.Go(func() {
+			defer batchRunning.Delete(batch.Id)
+			defer func() {
+				if r := recover(); r != nil {
+					common.SysError(fmt.Sprintf("batch %s panic: %v", batch.Id, r))
+				}
+			}()
+			if err := runBatch(batch); err != nil {
+				common.SysError(fmt.Sprintf("run batch %s failed: %s", batch.Id, err.Error()))
+			}
+		})
+	}
+}
+
+// runBatch 按状态推进任务直到结束，出错时保留当前状态，下次轮询时继续
+func runBatch(batch *model.Batch) error {
+	for {
+		var err error
+		switch batch.Status {
+		case model.BatchStatusValidating:
+			err = validateBatch(batch)
+		case model.BatchStatusInProgress:
+			err = executeBatch(batch)
+		case model.BatchStatusFinalizing, model.BatchStatusCancelling:
+			err = finalizeBatch(batch)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// transitBatch 在任务仍处于 from 状态时更新字段，然后重新读取任务，
+// 任务在此期间被取消时更新不会生效，重新读取后按取消处理
+func transitBatch(batch *model.Batch, from string, fields map[string]interface{}) error {
+	if _, err := batch.Update(from, fields); err != nil {
+		return err
+	}
+	latest, err := model.GetBatchById(batch.Id, 0, 0)
+	if err != nil {
+		return err
+	}
+	*batch = *latest
+	return nil
+}
+
+func failBatch(batch *model.Batch, errs []*dto.OpenAIBatchError) error {
+	data, err := json.Marshal(dto.OpenAIBatchErrors{Object: "list", Data: errs})
+	if err != nil {
+		return err
+	}
+	return transitBatch(batch, batch.Status, map[string]interface{}{
+		"status":    model.BatchStatusFailed,
+		"errors":    string(data),
+		"failed_at": time.Now().Unix(),
+	})
+}
+
+// forEachBatchLine 逐行读取输入文件，跳过空行，index 从 0 开始，fn 返回 false 时停止读取
+func forEachBatchLine(batch *model.Batch, fn func(index int, line []byte) bool) error {
+	file, err := model.GetFileById(batch.InputFileId, batch.UserId, batch.TokenId)
+	if err != nil {
+		return err
+	}
+	reader, err := OpenFile(context.Background(), file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	bufReader := bufio.NewReaderSize(reader, 1024*1024)
+	index := 0
+	for {
+		line, err := bufReader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if !fn(index, bytes.TrimSpace(line)) {
+				return nil
+			}
+			index++
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func validateBatchLine(batch *model.Batch, line []byte, customIds map[string]bool) *dto.OpenAIBatchError {
+	var input dto.BatchRequestInput
+	if err := json.Unmarshal(line, &input); err != nil {
+		return &dto.OpenAIBatchError{Code: "invalid_json_line", Message: "This line is not parseable as valid JSON."}
+	}
+	if input.CustomId == "" {
+		return &dto.OpenAIBatchError{Code: "missing_required_parameter", Message: "Missing required parameter: 'custom_id'.", Param: "custom_id"}
+	}
+	if customIds[input.CustomId] {
+		return &dto.OpenAIBatchError{Code: "duplicate_custom_id", Message: fmt.Sprintf("The custom_id '%s' is duplicated.", input.CustomId), Param: "custom_id"}
+	}
+	customIds[input.CustomId] = true
+	if input.Method != http.MethodPost {
+		return &dto.OpenAIBatchError{Code: "invalid_request", Message: "Only POST method is supported.", Param: "method"}
+	}
+	if input.Url != batch.Endpoint {
+		return &dto.OpenAIBatchError{Code: "invalid_url", Message: fmt.Sprintf("The url '%s' does not match the batch endpoint '%s'.", input.Url, batch.Endpoint), Param: "url"}
+	}
+	var body struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if err := json.Unmarshal(input.Body, &body); err != nil || body.Model == "" {
+		return &dto.OpenAIBatchError{Code: "missing_required_parameter", Message: "Missing required parameter: 'body.model'.", Param: "body.model"}
+	}
+	if body.Stream {
+		return &dto.OpenAIBatchError{Code: "invalid_request", Message: "Streaming is not supported in batch requests.", Param: "body.stream"}
+	}
+	return nil
+}
+
+func validateBatch(batch *model.Batch) error {
+	var errs []*dto.OpenAIBatchError
+	customIds := make(map[string]bool)
+	total := 0
+	err := forEachBatchLine(batch, func(index int, line []byte) bool {
+		total++
+		if lineErr := validateBatchLine(batch, line, customIds); lineErr != nil {
+			lineErr.Line = index + 1
+			errs = append(errs, lineErr)
+		}
+		return len(errs) < batchMaxErrors
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ErrFileNotFound) {
+			return failBatch(batch, []*dto.OpenAIBatchError{{
+				Code: "invalid_input_file", Message: fmt.Sprintf("Input file %s not found.", batch.InputFileId), Param: "input_file_id",
+			}})
+		}
+		return err
+	}
+	if len(errs) == 0 && total == 0 {
+		errs = append(errs, &dto.OpenAIBatchError{Code: "empty_file", Message: "The input file is empty.", Param: "input_file_id"})
+	}
+	if total > constant.BatchMaxRequests {
+		errs = append(errs, &dto.OpenAIBatchError{
+			Code: "too_many_requests", Message: fmt.Sprintf("The input file contains more than %d requests.", constant.BatchMaxRequests), Param: "input_file_id",
+		})
+	}
+	if len(errs) > 0 {
+		return failBatch(batch, errs)
+	}
+	return transitBatch(batch, model.BatchStatusValidating, map[string]interface{}{
+		"status":         model.BatchStatusInProgress,
+		"request_total":  total,
+		"in_progress_at": time.Now().Unix(),
+	})
+}
+
+// executeBatch 并发执行尚未完成的行，服务重启时已保存结果的行不会重复执行，
+// 重启时正在执行、结果尚未保存的行会被再次执行
+func executeBatch(batch *model.Batch) error {
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return failBatch(batch, []*dto.OpenAIBatchError{{Code: "token_not_found", Message: "The token that created this batch no longer exists."}})
+		}
+		return err
+	}
+	doneLines, err := model.GetBatchRequestLineIndexes(batch.Id)
+	if err != nil {
+		return err
+	}
+	done := make(map[int]bool, len(doneLines))
+	for _, index := range doneLines {
+		done[index] = true
+	}
+
+	cancelled := false
+	checkedAt := time.Now()
+	isCancelled := func() bool {
+		if cancelled || time.Since(checkedAt) < batchStatusCheckInterval {
+			return cancelled
+		}
+		checkedAt = time.Now()
+		if latest, err := model.GetBatchById(batch.Id, 0, 0); err == nil && latest.Status == model.BatchStatusCancelling {
+			cancelled = true
+		}
+		return cancelled
+	}
+
+	expired := false
+	var wg sync.WaitGroup
+	err = forEachBatchLine(batch, func(index int, line []byte) bool {
+		if done[index] {
+			return true
+		}
+		if isCancelled() {
+			return false
+		}
+		var input dto.BatchRequestInput
+		_ = json.Unmarshal(line, &input)
+		if !expired && time.Now().Unix() > batch.ExpiresAt {
+			expired = true
+		}
+		if expired {
+			saveBatchResult(batch, index, &dto.BatchRequestOutput{
+				Id:       BatchRequestIdPrefix + common.GetUUID(),
+				CustomId: input.CustomId,
+				Error: &dto.OpenAIBatchError{
+					Code:    "batch_expired",
+					Message: "This request could not be executed before the completion window expired.",
+				},
+			})
+			return true
+		}
+		batchSemaphore <- struct{}{}
+		wg.Add(1)
+		gopool.Go(func() {
+			defer wg.Done()
+			defer func() { <-batchSemaphore }()
+			saveBatchResult(batch, index, executeBatchLine(batch, token.Id, &input))
+		})
+		return true
+	})
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if cancelled {
+		latest, err := model.GetBatchById(batch.Id, 0, 0)
+		if err != nil {
+			return err
+		}
+		*batch = *latest
+		return nil
+	}
+	fields := map[string]interface{}{
+		"status":        model.BatchStatusFinalizing,
+		"finalizing_at": time.Now().Unix(),
+	}
+	if expired {
+		fields["expired_at"] = time.Now().Unix()
+	}
+	return transitBatch(batch, model.BatchStatusInProgress, fields)
+}
+
+// executeBatchLine 以创建任务的令牌身份执行一行请求，
+// 请求带有批处理标记，计费时按 BATCH_PRICE_RATIO 打折
+func executeBatchLine(batch *model.Batch, tokenId int, input *dto.BatchRequestInput) *dto.BatchRequestOutput {
+	requestId := BatchRequestIdPrefix + common.GetUUID()
+	output := &dto.BatchRequestOutput{Id: requestId, CustomId: input.CustomId}
+	var recorder *httptest.ResponseRecorder
+	for attempt := 0; ; attempt++ {
+		var err error
+		recorder, err = ServeInternalRelay(relaycommon.WithBatchRequest(context.Background()), http.MethodPost, input.Url, input.Body,
+			nil, tokenId, batch.ClientIp, requestId)
+		if err != nil {
+			output.Error = &dto.OpenAIBatchError{Code: "invalid_request", Message: err.Error()}
+			return output
+		}
+		if recorder.Code != http.StatusTooManyRequests || attempt >= batchMaxRetries {
+			break
+		}
+		time.Sleep(time.Duration(1<<attempt) * time.Second)
+	}
+
+	body := recorder.Body.Bytes()
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	output.Response = &dto.BatchRequestOutputResponse{
+		StatusCode: recorder.Code,
+		RequestId:  requestId,
+		Body:       body,
+	}
+	if recorder.Code != http.StatusOK {
+		var errResponse struct {
+			Error struct {
+				Message string `json:"message"`
+				Code    any    `json:"code"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(body, &errResponse)
+		output.Error = &dto.OpenAIBatchError{Code: "request_failed", Message: errResponse.Error.Message}
+		if errResponse.Error.Code != nil {
+			output.Error.Code = fmt.Sprint(errResponse.Error.Code)
+		}
+		if output.Error.Message == "" {
+			output.Error.Message = fmt.Sprintf("request failed with status code %d", recorder.Code)
+		}
+	}
+	return output
+}
+
+func saveBatchResult(batch *model.Batch, index int, output *dto.BatchRequestOutput) {
+	result, err := json.Marshal(output)
+	if err != nil {
+		common.SysError(fmt.Sprintf("marshal batch %s line %d result failed: %s", batch.Id, index, err.Error()))
+		return
+	}
+	err = model.SaveBatchRequest(&model.BatchRequest{
+		BatchId:   batch.Id,
+		LineIndex: index,
+		Failed:    output.Error != nil,
+		Result:    string(result),
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("save batch %s line %d result failed: %s", batch.Id, index, err.Error()))
+	}
+}
+
+// finalizeBatch 把已保存的结果按行号顺序写入输出文件和错误文件，然后结束任务
+func finalizeBatch(batch *model.Batch) error {
+	outputFileId, err := writeBatchResultFile(batch, false)
+	if err != nil {
+		return err
+	}
+	errorFileId, err := writeBatchResultFile(batch, true)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	fields := map[string]interface{}{
+		"output_file_id": outputFileId,
+		"error_file_id":  errorFileId,
+	}
+	switch {
+	case batch.Status == model.BatchStatusCancelling:
+		fields["status"] = model.BatchStatusCancelled
+		fields["cancelled_at"] = now
+	case batch.ExpiredAt != 0:
+		fields["status"] = model.BatchStatusExpired
+	default:
+		fields["status"] = model.BatchStatusCompleted
+		fields["completed_at"] = now
+	}
+	if err := transitBatch(batch, batch.Status, fields); err != nil {
+		return err
+	}
+	return model.DeleteBatchRequests(batch.Id)
+}
+
+// writeBatchResultFile 先写入临时文件再保存为 batch_output 文件，没有结果时返回空 id
+func writeBatchResultFile(batch *model.Batch, failed bool) (string, error) {
+	tmpFile, err := os.CreateTemp("", "batch_result_*.jsonl")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+	}()
+	writer := bufio.NewWriter(tmpFile)
+	count := 0
+	afterLine := -1
+	for {
+		requests, err := model.GetBatchRequests(batch.Id, failed, afterLine, batchResultPageSize)
+		if err != nil {
+			return "", err
+		}
+		for _, request := range requests {
+			writer.WriteString(request.Result)
+			writer.WriteByte('\n')
+			afterLine = request.LineIndex
+			count++
+		}
+		if len(requests) < batchResultPageSize {
+			break
+		}
+	}
+	if count == 0 {
+		return "", nil
+	}
+	if err := writer.Flush(); err != nil {
+		return "", err
+	}
+	size, err := tmpFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	suffix := "output"
+	if failed {
+		suffix = "error"
+	}
+	file, err := SaveFile(context.Background(), batch.UserId, batch.TokenId, fmt.Sprintf("%s_%s.jsonl", batch.Id, suffix),
+		BatchOutputPurpose, "application/jsonl", tmpFile, size, 0)
+	if err != nil {
+		return "", err
+	}
+	return file.Id, nil
+}
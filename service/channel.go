@@ -24,6 +24,25 @@ func DisableChannel(channelId int, channelName string, reason string) {
 	}
 }
 
+// DisableChannelKey 禁用号池中的密钥，号池中已没有启用的密钥时禁用渠道
+func DisableChannelKey(channelId int, keyId int, channelName string, reason string) {
+	success, err := model.UpdateChannelKeyStatus(channelId, keyId, common.ChannelStatusAutoDisabled, reason)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to disable channel #%d key #%d: %s", channelId, keyId, err.Error()))
+		return
+	}
+	if !success {
+		return
+	}
+	subject := fmt.Sprintf("通道「%s」（#%d）的密钥 #%d 已被禁用", channelName, channelId, keyId)
+	content := fmt.Sprintf("通道「%s」（#%d）的密钥 #%d 已被禁用，原因：%s", channelName, channelId, keyId, reason)
+	NotifyRootUser(fmt.Sprintf("%s_%d_key_%d", dto.NotifyTypeChannelUpdate, channelId, keyId), subject, content)
+	_, enabled, err := model.CountEnabledChannelKeys(channelId)
+	if err == nil && enabled == 0 {
+		DisableChannel(channelId, channelName, "号池中没有可用的密钥，最后一个密钥的禁用原因："+reason)
+	}
+}
+
 func EnableChannel(channelId int, channelName string) {
 	success := model.UpdateChannelStatusById(channelId, common.ChannelStatusEnabled, "")
 	if success {
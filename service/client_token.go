@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// ClientTokenIssuer 短期客户端令牌的签发者，用于和其他系统签发的 JWT 区分
+const ClientTokenIssuer = "one-api"
+
+// ClientTokenClaims 短期客户端令牌的声明，只能收窄父令牌的权限，用量计入父令牌
+type ClientTokenClaims struct {
+	TokenId int `json:"tid"`
+	UserId  int `json:"uid"`
+	// Models 可访问的模型，为空时与父令牌相同
+	Models []string `json:"models,omitempty"`
+	// Quota 令牌有效期内可使用的额度上限，0 表示只受父令牌额度限制
+	Quota     int    `json:"quota,omitempty"`
+	EndUserId string `json:"end_user,omitempty"`
+	jwt.StandardClaims
+}
+
+// ErrClientTokenDisabled 未配置 CLIENT_TOKEN_SECRET 时不能签发和使用短期令牌
+var ErrClientTokenDisabled = errors.New("未配置 CLIENT_TOKEN_SECRET，短期令牌不可用")
+
+// ClientTokenEnabled 是否配置了短期客户端令牌的签名密钥
+func ClientTokenEnabled() bool {
+	return constant.ClientTokenSecret != ""
+}
+
+// clientTokenSecret 签名和校验都在网关内完成，使用 HMAC 即可，不需要另外管理 RSA 密钥对
+func clientTokenSecret() []byte {
+	return []byte(constant.ClientTokenSecret)
+}
+
+// IsClientToken 普通令牌是 sk- 开头的随机字符，JWT 由三段 base64url 组成且以 eyJ 开头
+func IsClientToken(key string) bool {
+	return strings.HasPrefix(key, "eyJ") && strings.Count(key, ".") == 2
+}
+
+func SignClientToken(claims *ClientTokenClaims) (string, error) {
+	if !ClientTokenEnabled() {
+		return "", ErrClientTokenDisabled
+	}
+	claims.Issuer = ClientTokenIssuer
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(clientTokenSecret())
+}
+
+// ParseClientToken 只校验签名和有效期，不查询数据库
+func ParseClientToken(tokenString string) (*ClientTokenClaims, error) {
+	if !ClientTokenEnabled() {
+		return nil, ErrClientTokenDisabled
+	}
+	claims := &ClientTokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return clientTokenSecret(), nil
+	})
+	if err != nil || !token.Valid {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, errors.New("短期令牌已过期")
+		}
+		return nil, errors.New("无效的短期令牌")
+	}
+	if claims.Issuer != ClientTokenIssuer || claims.TokenId == 0 || claims.Id == "" || claims.ExpiresAt == 0 {
+		return nil, errors.New("无效的短期令牌")
+	}
+	return claims, nil
+}
+
+// CheckClientTokenQuota 检查短期客户端令牌的额度上限是否足够本次预扣的额度
+func CheckClientTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
+	if relayInfo.ClientTokenId == "" || relayInfo.ClientTokenQuota <= 0 {
+		return nil
+	}
+	used, err := model.GetClientTokenUsedQuota(relayInfo.ClientTokenId)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get client token %s used quota: %s", relayInfo.ClientTokenId, err.Error()))
+		return nil
+	}
+	if used >= int64(relayInfo.ClientTokenQuota) || used+int64(quota) > int64(relayInfo.ClientTokenQuota) {
+		return fmt.Errorf("client token quota is not enough, used: %s, limit: %s, need quota: %s",
+			common.FormatQuota(int(used)), common.FormatQuota(relayInfo.ClientTokenQuota), common.FormatQuota(quota))
+	}
+	return nil
+}
+
+// RecordClientTokenQuota 记录短期客户端令牌已使用的额度，quota 为负数时退回
+func RecordClientTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) {
+	if quota == 0 || relayInfo.ClientTokenId == "" || relayInfo.ClientTokenQuota <= 0 {
+		return
+	}
+	if err := model.AddClientTokenUsedQuota(relayInfo.ClientTokenId, quota, relayInfo.ClientTokenExpiresAt); err != nil {
+		common.SysError(fmt.Sprintf("failed to record client token %s used quota: %s", relayInfo.ClientTokenId, err.Error()))
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"one-api/constant"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func setClientTokenSecret(t *testing.T, secret string) {
+	origin := constant.ClientTokenSecret
+	constant.ClientTokenSecret = secret
+	t.Cleanup(func() {
+		constant.ClientTokenSecret = origin
+	})
+}
+
+func newClientTokenClaims(expiresAt int64) *ClientTokenClaims {
+	return &ClientTokenClaims{
+		TokenId:   1,
+		UserId:    2,
+		Models:    []string{"gpt-4o"},
+		Quota:     1000,
+		EndUserId: "end-user",
+		StandardClaims: jwt.StandardClaims{
+			Id:        "ct-1",
+			ExpiresAt: expiresAt,
+		},
+	}
+}
+
+func TestClientTokenSignAndParse(t *testing.T) {
+	setClientTokenSecret(t, "client-token-secret")
+	signed, err := SignClientToken(newClientTokenClaims(time.Now().Add(time.Hour).Unix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsClientToken(signed) {
+		t.Fatalf("signed token %q is not recognized as a client token", signed)
+	}
+	claims, err := ParseClientToken(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.TokenId != 1 || claims.UserId != 2 || claims.Quota != 1000 || claims.EndUserId != "end-user" ||
+		len(claims.Models) != 1 || claims.Models[0] != "gpt-4o" || claims.Issuer != ClientTokenIssuer {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestParseClientTokenRejects(t *testing.T) {
+	setClientTokenSecret(t, "client-token-secret")
+	valid, err := SignClientToken(newClientTokenClaims(time.Now().Add(time.Hour).Unix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(method jwt.SigningMethod, key interface{}, claims *ClientTokenClaims) string {
+		signed, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	withIssuer := func(issuer string, claims *ClientTokenClaims) *ClientTokenClaims {
+		claims.Issuer = issuer
+		return claims
+	}
+	parts := strings.Split(valid, ".")
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"expired", sign(jwt.SigningMethodHS256, []byte("client-token-secret"),
+			withIssuer(ClientTokenIssuer, newClientTokenClaims(time.Now().Add(-time.Minute).Unix()))), "短期令牌已过期"},
+		{"signed with another secret", sign(jwt.SigningMethodHS256, []byte("another-secret"),
+			withIssuer(ClientTokenIssuer, newClientTokenClaims(time.Now().Add(time.Hour).Unix()))), "无效的短期令牌"},
+		{"unsigned", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType,
+			withIssuer(ClientTokenIssuer, newClientTokenClaims(time.Now().Add(time.Hour).Unix()))), "无效的短期令牌"},
+		{"other issuer", sign(jwt.SigningMethodHS256, []byte("client-token-secret"),
+			withIssuer("other", newClientTokenClaims(time.Now().Add(time.Hour).Unix()))), "无效的短期令牌"},
+		{"without expiry", sign(jwt.SigningMethodHS256, []byte("client-token-secret"),
+			withIssuer(ClientTokenIssuer, newClientTokenClaims(0))), "无效的短期令牌"},
+		{"tampered payload", parts[0] + "." + parts[1] + "e30." + parts[2], "无效的短期令牌"},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])), "无效的短期令牌"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseClientToken(tt.token)
+			if err == nil {
+				t.Fatalf("token accepted with claims %+v", claims)
+			}
+			if err.Error() != tt.want {
+				t.Fatalf("error = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestClientTokenRequiresSecret(t *testing.T) {
+	setClientTokenSecret(t, "client-token-secret")
+	signed, err := SignClientToken(newClientTokenClaims(time.Now().Add(time.Hour).Unix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	constant.ClientTokenSecret = ""
+	if _, err := SignClientToken(newClientTokenClaims(time.Now().Add(time.Hour).Unix())); err != ErrClientTokenDisabled {
+		t.Fatalf("sign error = %v, want %v", err, ErrClientTokenDisabled)
+	}
+	if _, err := ParseClientToken(signed); err != ErrClientTokenDisabled {
+		t.Fatalf("parse error = %v, want %v", err, ErrClientTokenDisabled)
+	}
+}
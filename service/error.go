@@ -49,6 +49,67 @@ func OpenAIErrorWrapperLocal(err error, code string, statusCode int) *dto.OpenAI
 	return openaiErr
 }
 
+// ClaudeErrorType 按状态码映射 Anthropic 的错误类型
+func ClaudeErrorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+func OpenAIErrorToClaudeError(openaiErr *dto.OpenAIErrorWithStatusCode) *dto.ClaudeErrorWithStatusCode {
+	return &dto.ClaudeErrorWithStatusCode{
+		Error: dto.ClaudeError{
+			Type:    ClaudeErrorType(openaiErr.StatusCode),
+			Message: openaiErr.Error.Message,
+		},
+		StatusCode: openaiErr.StatusCode,
+		LocalError: openaiErr.LocalError,
+	}
+}
+
+// GeminiErrorStatus 按状态码映射 Google API 的错误状态
+func GeminiErrorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "INTERNAL"
+	}
+}
+
+func OpenAIErrorToGeminiError(openaiErr *dto.OpenAIErrorWithStatusCode) *dto.GeminiError {
+	return &dto.GeminiError{
+		Code:    openaiErr.StatusCode,
+		Message: openaiErr.Error.Message,
+		Status:  GeminiErrorStatus(openaiErr.StatusCode),
+	}
+}
+
 func RelayErrorHandler(resp *http.Response) (errWithStatusCode *dto.OpenAIErrorWithStatusCode) {
 	errWithStatusCode = &dto.OpenAIErrorWithStatusCode{
 		StatusCode: resp.StatusCode,
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"strings"
+	"time"
+)
+
+const FileIdPrefix = "file-"
+
+var ErrFileStorageQuotaExceeded = model.ErrFileStorageQuotaExceeded
+
+// FileStorageQuotaBytes 返回用户的文件存储空间上限，用户设置中的 file_storage_quota_mb 优先于全局默认值
+func FileStorageQuotaBytes(userSetting map[string]interface{}) int64 {
+	quotaMB := int64(constant.FileStorageQuotaMB)
+	if value, ok := userSetting[constant.UserSettingFileStorageQuotaMB]; ok {
+		switch v := value.(type) {
+		case float64:
+			quotaMB = int64(v)
+		case int:
+			quotaMB = int64(v)
+		}
+	}
+	return quotaMB * 1024 * 1024
+}
+
+// SaveFile 保存文件内容并写入元数据，quotaBytes 小于等于 0 时不检查存储空间
+func SaveFile(ctx context.Context, userId int, tokenId int, filename string, purpose string, mimeType string,
+	reader io.Reader, size int64, quotaBytes int64) (*model.File, error) {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	file := &model.File{
+		Id:        FileIdPrefix + common.GetUUID(),
+		UserId:    userId,
+		TokenId:   tokenId,
+		Filename:  filename,
+		Purpose:   purpose,
+		Bytes:     size,
+		MimeType:  mimeType,
+		Status:    model.FileStatusUploaded,
+		CreatedAt: time.Now().Unix(),
+	}
+	file.StorageKey = fmt.Sprintf("%d/%s", userId, file.Id)
+	// 先写入元数据占用存储空间，上传失败时再释放
+	if quotaBytes > 0 {
+		err = file.InsertWithQuota(quotaBytes)
+	} else {
+		err = file.Insert()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.Put(ctx, file.StorageKey, reader, size, mimeType); err != nil {
+		_ = file.Delete()
+		return nil, err
+	}
+	if err := file.UpdateStatus(model.FileStatusProcessed); err != nil {
+		_ = storage.Delete(ctx, file.StorageKey)
+		_ = file.Delete()
+		return nil, err
+	}
+	return file, nil
+}
+
+func OpenFile(ctx context.Context, file *model.File) (io.ReadCloser, error) {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return nil, err
+	}
+	return storage.Get(ctx, file.StorageKey)
+}
+
+func DeleteFile(ctx context.Context, file *model.File) error {
+	storage, err := GetFileStorage()
+	if err != nil {
+		return err
+	}
+	if err := storage.Delete(ctx, file.StorageKey); err != nil {
+		return err
+	}
+	return file.Delete()
+}
+
+func File2OpenAIFile(file *model.File) *dto.OpenAIFile {
+	return &dto.OpenAIFile{
+		Id:        file.Id,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}
+}
+
+// ResolveFileReferences 把消息中引用网关文件 id 的 file 内容替换为内联数据，
+// 上游渠道不认识网关生成的文件 id，图片会转换为 image_url，其余文件转换为 file_data
+func ResolveFileReferences(ctx context.Context, userId int, tokenId int, request *dto.GeneralOpenAIRequest) error {
+	for i := range request.Messages {
+		message := &request.Messages[i]
+		if message.IsStringContent() || !strings.Contains(string(message.Content), FileIdPrefix) {
+			continue
+		}
+		var parts []map[string]any
+		if err := json.Unmarshal(message.Content, &parts); err != nil {
+			continue
+		}
+		changed := false
+		for j, part := range parts {
+			if part["type"] != "file" {
+				continue
+			}
+			fileInfo, _ := part["file"].(map[string]any)
+			fileId, _ := fileInfo["file_id"].(string)
+			if !strings.HasPrefix(fileId, FileIdPrefix) {
+				continue
+			}
+			file, err := model.GetFileById(fileId, userId, tokenId)
+			if err != nil {
+				return fmt.Errorf("file %s not found", fileId)
+			}
+			if file.Bytes > int64(constant.MaxFileDownloadMB)*1024*1024 {
+				return fmt.Errorf("file %s is too large to be sent inline", fileId)
+			}
+			dataURL, err := readFileAsDataURL(ctx, file)
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(file.MimeType, "image/") {
+				parts[j] = map[string]any{
+					"type":      dto.ContentTypeImageURL,
+					"image_url": map[string]any{"url": dataURL},
+				}
+			} else {
+				parts[j] = map[string]any{
+					"type": "file",
+					"file": map[string]any{"filename": file.Filename, "file_data": dataURL},
+				}
+			}
+			changed = true
+		}
+		if changed {
+			content, err := json.Marshal(parts)
+			if err != nil {
+				return err
+			}
+			message.SetRawContent(content)
+		}
+	}
+	return nil
+}
+
+func readFileAsDataURL(ctx context.Context, file *model.File) (string, error) {
+	reader, err := OpenFile(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	mimeType := file.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)), nil
+}
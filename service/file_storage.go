@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"one-api/common"
+	"one-api/constant"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileStorage 保存 /v1/files 上传的文件内容，文件元数据保存在数据库中
+type FileStorage interface {
+	Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var ErrFileNotFound = errors.New("file not found")
+
+var (
+	fileStorage     FileStorage
+	fileStorageErr  error
+	fileStorageOnce sync.Once
+)
+
+// GetFileStorage 按 FILE_STORAGE_DRIVER 初始化存储驱动，只初始化一次
+func GetFileStorage() (FileStorage, error) {
+	fileStorageOnce.Do(func() {
+		switch constant.FileStorageDriver {
+		case "s3":
+			fileStorage, fileStorageErr = NewS3FileStorage(constant.FileStorageS3Endpoint, constant.FileStorageS3Region,
+				constant.FileStorageS3Bucket, constant.FileStorageS3Prefix, constant.FileStorageS3AccessKey,
+				constant.FileStorageS3SecretKey, constant.FileStorageS3PathStyle)
+		case "local", "":
+			fileStorage, fileStorageErr = NewLocalFileStorage(constant.FileStorageLocalDir)
+		default:
+			fileStorageErr = fmt.Errorf("unknown file storage driver: %s", constant.FileStorageDriver)
+		}
+		if fileStorageErr != nil {
+			common.SysError("init file storage failed: " + fileStorageErr.Error())
+		} else {
+			common.SysLog("file storage driver: " + constant.FileStorageDriver)
+		}
+	})
+	return fileStorage, fileStorageErr
+}
+
+// LocalFileStorage 把文件保存在本地目录，适合单机部署
+type LocalFileStorage struct {
+	dir string
+}
+
+func NewLocalFileStorage(dir string) (*LocalFileStorage, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalFileStorage{dir: absDir}, nil
+}
+
+// path 拒绝越出存储目录的 key
+func (s *LocalFileStorage) path(key string) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, s.dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file key: %s", key)
+	}
+	return path, nil
+}
+
+func (s *LocalFileStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免读到写了一半的内容
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (s *LocalFileStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrFileNotFound
+	}
+	return file, err
+}
+
+func (s *LocalFileStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
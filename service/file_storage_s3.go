@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// s3UnsignedPayload 上传内容不参与签名，避免为了计算 sha256 把整个文件读进内存
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3FileStorage 通过 S3 REST 协议读写对象，兼容 AWS S3、腾讯云 COS、MinIO 等对象存储
+type S3FileStorage struct {
+	endpoint    *url.URL
+	region      string
+	bucket      string
+	prefix      string
+	pathStyle   bool
+	credentials aws.Credentials
+	signer      *v4.Signer
+	client      *http.Client
+}
+
+func NewS3FileStorage(endpoint, region, bucket, prefix, accessKey, secretKey string, pathStyle bool) (*S3FileStorage, error) {
+	if bucket == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("s3 file storage requires bucket, access key and secret key")
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %v", err)
+	}
+	return &S3FileStorage{
+		endpoint:  endpointURL,
+		region:    region,
+		bucket:    bucket,
+		prefix:    strings.Trim(prefix, "/"),
+		pathStyle: pathStyle,
+		credentials: aws.Credentials{
+			AccessKeyID:     accessKey,
+			SecretAccessKey: secretKey,
+		},
+		signer: v4.NewSigner(),
+		client: &http.Client{},
+	}, nil
+}
+
+func (s *S3FileStorage) objectURL(key string) string {
+	objectKey := key
+	if s.prefix != "" {
+		objectKey = s.prefix + "/" + key
+	}
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + objectKey
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + objectKey
+	}
+	return u.String()
+}
+
+func (s *S3FileStorage) do(ctx context.Context, method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	if err := s.signer.SignHTTP(ctx, s.credentials, req, s3UnsignedPayload, "s3", s.region, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.client.Do(req)
+}
+
+func s3ResponseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 request failed, status code: %d, body: %s", resp.StatusCode, string(body))
+}
+
+func (s *S3FileStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, reader, size, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3ResponseError(resp)
+	}
+	return nil
+}
+
+func (s *S3FileStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrFileNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3ResponseError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3FileStorage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3ResponseError(resp)
+	}
+	return nil
+}
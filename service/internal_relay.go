@@ -0,0 +1,52 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+)
+
+// internalRelayHandler 网关自身的路由，批处理和异步请求通过它执行，
+// 每个请求都会完整经过鉴权、选渠道、计费等正常的转发流程
+var internalRelayHandler http.Handler
+
+func SetInternalRelayHandler(handler http.Handler) {
+	internalRelayHandler = handler
+}
+
+type internalRelayTokenKey struct{}
+
+// InternalRelayTokenId 返回内部请求的令牌 id，只能由进程内构造的请求携带，
+// 数据库中只保存令牌的哈希，内部请求无法携带完整令牌，由 TokenAuth 按 id 鉴权
+func InternalRelayTokenId(ctx context.Context) int {
+	tokenId, _ := ctx.Value(internalRelayTokenKey{}).(int)
+	return tokenId
+}
+
+// ServeInternalRelay 以令牌身份把请求交给网关路由处理并返回完整响应，
+// clientIp 为提交请求的客户端 IP，用于令牌的 IP 限制和日志
+func ServeInternalRelay(ctx context.Context, method string, url string, body []byte, header http.Header,
+	tokenId int, clientIp string, requestId string) (*httptest.ResponseRecorder, error) {
+	ctx = context.WithValue(ctx, internalRelayTokenKey{}, tokenId)
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Del("Authorization")
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(common.RequestIdKey, requestId)
+	if clientIp != "" {
+		req.RemoteAddr = net.JoinHostPort(clientIp, "0")
+	}
+	recorder := httptest.NewRecorder()
+	internalRelayHandler.ServeHTTP(recorder, req)
+	return recorder, nil
+}
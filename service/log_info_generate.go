@@ -24,6 +24,12 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if relayInfo.ClientTokenId != "" {
+		other["client_token_id"] = relayInfo.ClientTokenId
+	}
+	if relayInfo.EndUserId != "" {
+		other["end_user"] = relayInfo.EndUserId
+	}
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
 	other["admin_info"] = adminInfo
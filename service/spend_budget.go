@@ -0,0 +1,134 @@
+package service
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// spendBudgetThresholds 预算消耗达到这些百分比时通知用户，同一窗口内每个阈值只通知一次
+var spendBudgetThresholds = []int{100, 80, 50}
+
+func getRelaySpendBudgets(relayInfo *relaycommon.RelayInfo) ([]*model.SpendBudget, error) {
+	tokenId := relayInfo.TokenId
+	if relayInfo.IsPlayground {
+		// playground 不扣令牌余额，只受用户预算限制
+		tokenId = 0
+	}
+	return model.GetSpendBudgetsWithCache(relayInfo.UserId, tokenId)
+}
+
+func spendBudgetName(budget *model.SpendBudget) string {
+	scope := "token"
+	if budget.IsUserBudget() {
+		scope = "user"
+	}
+	return fmt.Sprintf("%s %s", scope, budget.Period)
+}
+
+// CheckSpendBudget 检查令牌和用户的周期预算是否足够本次预扣的额度
+func CheckSpendBudget(relayInfo *relaycommon.RelayInfo, quota int) error {
+	budgets, err := getRelaySpendBudgets(relayInfo)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, budget := range budgets {
+		used, reset, err := budget.GetUsage(now)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get spend budget #%d usage: %s", budget.Id, err.Error()))
+			continue
+		}
+		if used >= int64(budget.Quota) || used+int64(quota) > int64(budget.Quota) {
+			return fmt.Errorf("%s spend budget is not enough, used: %s, budget: %s, need quota: %s, resets at %s",
+				spendBudgetName(budget), common.FormatQuota(int(used)), common.FormatQuota(budget.Quota), common.FormatQuota(quota),
+				reset.In(budget.Location()).Format("2006-01-02 15:04:05"))
+		}
+	}
+	return nil
+}
+
+// RecordSpendBudget 在令牌和用户的周期预算中记录消耗，quota 为负数时退回，消耗达到阈值时通知用户
+func RecordSpendBudget(relayInfo *relaycommon.RelayInfo, quota int) {
+	if quota == 0 {
+		return
+	}
+	budgets, err := getRelaySpendBudgets(relayInfo)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get spend budgets of user %d: %s", relayInfo.UserId, err.Error()))
+		return
+	}
+	if len(budgets) == 0 {
+		return
+	}
+	now := time.Now()
+	if err := model.AddSpendBudgetUsage(budgets, quota, now); err != nil {
+		common.SysError(fmt.Sprintf("failed to record spend budget usage of user %d: %s", relayInfo.UserId, err.Error()))
+		return
+	}
+	if quota < 0 {
+		return
+	}
+	userId, userEmail, userSetting := relayInfo.UserId, relayInfo.UserEmail, relayInfo.UserSetting
+	gopool.Go(func() {
+		for _, budget := range budgets {
+			checkAndSendSpendBudgetNotify(budget, userId, userEmail, userSetting, now)
+		}
+	})
+}
+
+func checkAndSendSpendBudgetNotify(budget *model.SpendBudget, userId int, userEmail string, userSetting map[string]interface{}, now time.Time) {
+	used, reset, err := budget.GetUsage(now)
+	if err != nil || budget.Quota <= 0 {
+		return
+	}
+	percent := int(used * 100 / int64(budget.Quota))
+	for i, threshold := range spendBudgetThresholds {
+		if percent < threshold {
+			continue
+		}
+		notified, err := model.MarkSpendBudgetNotified(budget, threshold, now)
+		if err != nil || !notified {
+			return
+		}
+		// 一次越过多个阈值时只通知最高的一个
+		for _, lower := range spendBudgetThresholds[i+1:] {
+			_, _ = model.MarkSpendBudgetNotified(budget, lower, now)
+		}
+		target := "您的账户"
+		if !budget.IsUserBudget() {
+			target = fmt.Sprintf("令牌 #%d", budget.TokenId)
+			if token, err := model.GetTokenById(budget.TokenId); err == nil {
+				target = fmt.Sprintf("令牌「%s」", token.Name)
+			}
+		}
+		prompt := fmt.Sprintf("预算已使用 %d%%", threshold)
+		content := "{{value}}：{{value}}的{{value}}预算已使用 {{value}} / {{value}}，预算将于 {{value}} 重置。"
+		if threshold >= 100 {
+			content += "重置前的请求将被拒绝。"
+		}
+		err = NotifyUser(userId, userEmail, userSetting, dto.NewNotify(dto.NotifyTypeSpendBudget, prompt, content,
+			[]interface{}{prompt, target, spendBudgetPeriodName(budget.Period), common.FormatQuota(int(used)), common.FormatQuota(budget.Quota),
+				reset.In(budget.Location()).Format("2006-01-02 15:04:05")}))
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to send spend budget notify to user %d: %s", userId, err.Error()))
+		}
+		return
+	}
+}
+
+func spendBudgetPeriodName(period string) string {
+	switch period {
+	case model.SpendBudgetPeriodWeek:
+		return "每周"
+	case model.SpendBudgetPeriodMonth:
+		return "每月"
+	default:
+		return "每日"
+	}
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"time"
+)
+
+// NotifyTokenRotated 通知令牌所有者令牌已轮换以及旧令牌失效的时间，通知中不包含完整的令牌
+func NotifyTokenRotated(token *model.Token, previousKey string) {
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get user %d for token rotation notify: %s", token.UserId, err.Error()))
+		return
+	}
+	expiry := "已立即失效"
+	if token.PreviousKeyExpiredTime > 0 {
+		expiry = "将于 " + time.Unix(token.PreviousKeyExpiredTime, 0).Format("2006-01-02 15:04:05") + " 失效"
+	}
+	prompt := "您的令牌已轮换"
+	content := "{{value}}：令牌「{{value}}」已更换为 {{value}}，旧令牌 {{value}} {{value}}，请尽快更新客户端中使用的令牌。"
+	err = NotifyUser(token.UserId, userCache.Email, userCache.GetSetting(), dto.NewNotify(dto.NotifyTypeTokenRotated, prompt, content,
+		[]interface{}{prompt, token.Name, token.MaskedKey(), previousKey, expiry}))
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to send token rotation notify to user %d: %s", token.UserId, err.Error()))
+	}
+}
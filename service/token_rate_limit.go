@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TPM 按自然分钟、TPD 按自然日计数，计数保存在 Redis 中，多个节点共用。
+// 请求前按 prompt tokens 加 max_tokens 预占，响应后按实际用量修正，请求失败时退回预占的 token 数
+const (
+	tokenRateLimitMinuteTTL = 2 * time.Minute
+	tokenRateLimitDayTTL    = 48 * time.Hour
+)
+
+// reserveTokenRateLimitScript 所有计数都未超过限制时才同时预占，返回 {1, 预占后的计数...}；
+// 任一计数超过限制时返回 {0, 超过限制的计数下标, 当前计数}
+const reserveTokenRateLimitScript = `
+local estimate = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[i * 2])
+	local current = tonumber(redis.call('GET', key) or '0')
+	if current >= limit or current + estimate > limit then
+		return {0, i, current}
+	end
+end
+local result = {1}
+for i, key in ipairs(KEYS) do
+	result[i + 1] = redis.call('INCRBY', key, estimate)
+	if redis.call('TTL', key) < 0 then
+		redis.call('EXPIRE', key, tonumber(ARGV[i * 2 + 1]))
+	end
+end
+return result
+`
+
+// adjustTokenRateLimitScript 修正预占的 token 数，计数窗口已过期的不再修正
+const adjustTokenRateLimitScript = `
+local delta = tonumber(ARGV[1])
+for _, key in ipairs(KEYS) do
+	if redis.call('EXISTS', key) == 1 then
+		redis.call('INCRBY', key, delta)
+	end
+end
+return 1
+`
+
+type tokenRateLimitWindow struct {
+	name  string
+	key   string
+	limit int64
+	ttl   time.Duration
+	reset time.Duration
+}
+
+// TokenRateLimitStatus 对请求最严格的一个 TPM/TPD 限制的状态，用于设置 x-ratelimit-*-tokens 响应头
+type TokenRateLimitStatus struct {
+	Name      string
+	Limit     int64
+	Used      int64
+	Remaining int64
+	Reset     time.Duration
+}
+
+func (status *TokenRateLimitStatus) SetHeaders(c *gin.Context) {
+	c.Header("x-ratelimit-limit-tokens", strconv.FormatInt(status.Limit, 10))
+	c.Header("x-ratelimit-remaining-tokens", strconv.FormatInt(max(status.Remaining, 0), 10))
+	c.Header("x-ratelimit-reset-tokens", status.Reset.String())
+}
+
+// TokenRateLimitReservation 一次请求在 TPM/TPD 计数中预占的 token 数，Settle 和 Release 只有第一次调用生效
+type TokenRateLimitReservation struct {
+	keys     []string
+	reserved int64
+	done     atomic.Bool
+}
+
+func tokenRateLimitWindows(limits []*model.Limit, now time.Time) []tokenRateLimitWindow {
+	minute := now.Truncate(time.Minute)
+	year, month, day := now.Date()
+	tomorrow := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+	var windows []tokenRateLimitWindow
+	for _, limit := range limits {
+		if limit.TPMLimitEnabled && limit.TPMLimit > 0 {
+			windows = append(windows, tokenRateLimitWindow{
+				name:  "tokens per min (TPM)",
+				key:   fmt.Sprintf("token_rate_limit:tpm:%d:%d", limit.Id, minute.Unix()/60),
+				limit: limit.TPMLimit,
+				ttl:   tokenRateLimitMinuteTTL,
+				reset: minute.Add(time.Minute).Sub(now),
+			})
+		}
+		if limit.TPDLimitEnabled && limit.TPDLimit > 0 {
+			windows = append(windows, tokenRateLimitWindow{
+				name:  "tokens per day (TPD)",
+				key:   fmt.Sprintf("token_rate_limit:tpd:%d:%s", limit.Id, now.Format("20060102")),
+				limit: limit.TPDLimit,
+				ttl:   tokenRateLimitDayTTL,
+				reset: tomorrow.Sub(now),
+			})
+		}
+	}
+	return windows
+}
+
+func newTokenRateLimitStatus(window tokenRateLimitWindow, used int64) *TokenRateLimitStatus {
+	return &TokenRateLimitStatus{
+		Name:      window.name,
+		Limit:     window.limit,
+		Used:      used,
+		Remaining: window.limit - used,
+		Reset:     window.reset.Round(time.Second),
+	}
+}
+
+// ReserveTokenRateLimit 为请求预占 estimate 个 token；超过限制时返回的 reservation 为 nil，
+// status 为超过的限制；未超过时 status 为剩余 token 数最少的限制。Redis 未启用时不限制，都返回 nil
+func ReserveTokenRateLimit(limits []*model.Limit, estimate int64) (*TokenRateLimitReservation, *TokenRateLimitStatus, error) {
+	if !common.RedisEnabled {
+		return nil, nil, nil
+	}
+	windows := tokenRateLimitWindows(limits, time.Now())
+	if len(windows) == 0 {
+		return nil, nil, nil
+	}
+	keys := make([]string, 0, len(windows))
+	args := []interface{}{estimate}
+	for _, window := range windows {
+		keys = append(keys, window.key)
+		args = append(args, window.limit, int64(window.ttl.Seconds()))
+	}
+	result, err := common.RDB.Eval(context.Background(), reserveTokenRateLimitScript, keys, args...).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	values, ok := result.([]interface{})
+	if !ok || len(values) == 0 {
+		return nil, nil, fmt.Errorf("invalid token rate limit script result: %v", result)
+	}
+	if allowed, _ := values[0].(int64); allowed == 0 {
+		if len(values) != 3 {
+			return nil, nil, fmt.Errorf("invalid token rate limit script result: %v", result)
+		}
+		index, _ := values[1].(int64)
+		current, _ := values[2].(int64)
+		if index < 1 || int(index) > len(windows) {
+			return nil, nil, fmt.Errorf("invalid token rate limit script result: %v", result)
+		}
+		return nil, newTokenRateLimitStatus(windows[index-1], current), nil
+	}
+	if len(values) != len(windows)+1 {
+		return nil, nil, fmt.Errorf("invalid token rate limit script result: %v", result)
+	}
+	var status *TokenRateLimitStatus
+	for i, window := range windows {
+		used, _ := values[i+1].(int64)
+		if status == nil || window.limit-used < status.Remaining {
+			status = newTokenRateLimitStatus(window, used)
+		}
+	}
+	return &TokenRateLimitReservation{keys: keys, reserved: estimate}, status, nil
+}
+
+func (reservation *TokenRateLimitReservation) adjust(delta int64) {
+	if delta == 0 {
+		return
+	}
+	err := common.RDB.Eval(context.Background(), adjustTokenRateLimitScript, reservation.keys, delta).Err()
+	if err != nil {
+		common.SysError("failed to adjust token rate limit: " + err.Error())
+	}
+}
+
+// Settle 按实际使用的 token 数修正预占的计数
+func (reservation *TokenRateLimitReservation) Settle(actual int64) {
+	if reservation == nil || !reservation.done.CompareAndSwap(false, true) {
+		return
+	}
+	reservation.adjust(actual - reservation.reserved)
+}
+
+// Release 退回预占的 token 数，已经 Settle 的不再退回
+func (reservation *TokenRateLimitReservation) Release() {
+	if reservation == nil || !reservation.done.CompareAndSwap(false, true) {
+		return
+	}
+	reservation.adjust(-reservation.reserved)
+}
+
+// EstimateRequestTokens 预估请求使用的 token 数：prompt tokens 加上 max_tokens，
+// 不是 OpenAI 格式的请求只计算 max_tokens，实际用量在响应后修正
+func EstimateRequestTokens(c *gin.Context, modelName string) int64 {
+	var request dto.GeneralOpenAIRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		return 0
+	}
+	if request.Model == "" {
+		request.Model = modelName
+	}
+	var promptTokens int
+	var err error
+	switch {
+	case request.Messages != nil:
+		info := &relaycommon.RelayInfo{ChannelType: c.GetInt("channel_type")}
+		promptTokens, err = CountTokenChatRequest(c, info, request)
+	case request.Prompt != nil:
+		promptTokens, err = CountTokenInput(request.Prompt, request.Model)
+	case request.Input != nil:
+		promptTokens, err = CountTokenInput(request.Input, request.Model)
+	}
+	if err != nil {
+		common.LogWarn(c, "failed to estimate tokens for rate limit: "+err.Error())
+	}
+	maxTokens := request.MaxTokens
+	if request.MaxCompletionTokens > maxTokens {
+		maxTokens = request.MaxCompletionTokens
+	}
+	return int64(promptTokens) + int64(maxTokens)
+}
+
+// SettleTokenRateLimit 按响应中的实际用量修正本次请求预占的 TPM/TPD 计数
+func SettleTokenRateLimit(c *gin.Context, usage *dto.Usage) {
+	value, ok := c.Get(constant.ContextKeyTokenRateLimit)
+	if !ok || usage == nil {
+		return
+	}
+	totalTokens := usage.TotalTokens
+	if totalTokens == 0 {
+		totalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	value.(*TokenRateLimitReservation).Settle(int64(totalTokens))
+}
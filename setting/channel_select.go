@@ -0,0 +1,51 @@
+package setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+)
+
+const (
+	// ChannelSelectStrategyWeighted 按渠道权重随机选择，默认策略
+	ChannelSelectStrategyWeighted = "weighted"
+	// ChannelSelectStrategyAdaptive 按渠道实时的延迟、首字时间和错误率调整权重
+	ChannelSelectStrategyAdaptive = "adaptive"
+)
+
+// groupChannelSelectStrategy 分组使用的渠道选择策略，未配置的分组使用 weighted
+var groupChannelSelectStrategy = map[string]string{}
+
+func GroupChannelSelectStrategy2JSONString() string {
+	jsonBytes, err := json.Marshal(groupChannelSelectStrategy)
+	if err != nil {
+		common.SysError("error marshalling group channel select strategy: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupChannelSelectStrategyByJSONString(jsonStr string) error {
+	groupChannelSelectStrategy = make(map[string]string)
+	return json.Unmarshal([]byte(jsonStr), &groupChannelSelectStrategy)
+}
+
+func GetGroupChannelSelectStrategy(group string) string {
+	if strategy, ok := groupChannelSelectStrategy[group]; ok {
+		return strategy
+	}
+	return ChannelSelectStrategyWeighted
+}
+
+func CheckGroupChannelSelectStrategy(jsonStr string) error {
+	checkStrategy := make(map[string]string)
+	err := json.Unmarshal([]byte(jsonStr), &checkStrategy)
+	if err != nil {
+		return err
+	}
+	for group, strategy := range checkStrategy {
+		if strategy != ChannelSelectStrategyWeighted && strategy != ChannelSelectStrategyAdaptive {
+			return fmt.Errorf("unknown channel select strategy %s for group %s", strategy, group)
+		}
+	}
+	return nil
+}
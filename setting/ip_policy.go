@@ -0,0 +1,10 @@
+package setting
+
+import "one-api/common"
+
+// IPDenyList 全局禁止访问的 IP 和 CIDR，每行一个，对所有用户的令牌生效
+var IPDenyList = ""
+
+func GetIPDenyListMatcher() *common.IPMatcher {
+	return common.GetIPMatcher(IPDenyList)
+}
@@ -209,7 +209,7 @@ const TokensTable = () => {
         return (
           <div>
             <Popover
-              content={'sk-' + record.key}
+              content={'sk-' + record.key_prefix + '...'}
               style={{ padding: 20 }}
               position='top'
             >
@@ -217,16 +217,6 @@ const TokensTable = () => {
                 {t('查看')}
               </Button>
             </Popover>
-            <Button
-              theme='light'
-              type='secondary'
-              style={{ marginRight: 1 }}
-              onClick={async (text) => {
-                await copyText('sk-' + record.key);
-              }}
-            >
-              {t('复制')}
-            </Button>
             <SplitButtonGroup
               style={{ marginRight: 1 }}
               aria-label={t('项目操作按钮组')}
@@ -259,6 +249,18 @@ const TokensTable = () => {
                 ></Button>
               </Dropdown>
             </SplitButtonGroup>
+            <Popconfirm
+              title={t('确定是否要轮换此令牌？')}
+              content={t('将生成新的令牌，旧令牌在宽限期内仍然可用')}
+              position={'left'}
+              onConfirm={() => {
+                rotateToken(record);
+              }}
+            >
+              <Button theme='light' type='secondary' style={{ marginRight: 1 }}>
+                {t('轮换')}
+              </Button>
+            </Popconfirm>
             <Popconfirm
               title={t('确定是否要删除此令牌？')}
               content={t('此修改将不可逆')}
@@ -266,7 +268,7 @@ const TokensTable = () => {
               position={'left'}
               onConfirm={() => {
                 manageToken(record.id, 'delete', record).then(() => {
-                  removeRecord(record.key);
+                  removeRecord(record.id);
                 });
               }}
             >
@@ -376,18 +378,6 @@ const TokensTable = () => {
     await loadTokens(activePage - 1);
   };
 
-  const copyText = async (text) => {
-    if (await copy(text)) {
-      showSuccess(t('已复制到剪贴板！'));
-    } else {
-      Modal.error({
-        title: t('无法复制到剪贴板，请手动复制'),
-        content: text,
-        size: 'large',
-      });
-    }
-  };
-
   const onOpenLink = async (type, url, record) => {
     // console.log(type, url, key);
     let status = localStorage.getItem('status');
@@ -401,7 +391,8 @@ const TokensTable = () => {
     }
     let encodedServerAddress = encodeURIComponent(serverAddress);
     url = url.replaceAll('{address}', encodedServerAddress);
-    url = url.replaceAll('{key}', 'sk-' + record.key);
+    // 令牌只在创建时显示一次，聊天页面中需要自行填写
+    url = url.replaceAll('{key}', '');
 
     window.open(url, '_blank');
   };
@@ -414,10 +405,10 @@ const TokensTable = () => {
       });
   }, [pageSize]);
 
-  const removeRecord = (key) => {
+  const removeRecord = (id) => {
     let newDataSource = [...tokens];
-    if (key != null) {
-      let idx = newDataSource.findIndex((data) => data.key === key);
+    if (id != null) {
+      let idx = newDataSource.findIndex((data) => data.id === id);
 
       if (idx > -1) {
         newDataSource.splice(idx, 1);
@@ -461,6 +452,43 @@ const TokensTable = () => {
     setLoading(false);
   };
 
+  const rotateToken = async (record) => {
+    setLoading(true);
+    const res = await API.post(`/api/token/${record.id}/rotate`, {});
+    const { success, message, data } = res.data;
+    if (success) {
+      const key = 'sk-' + data.key;
+      record.key_prefix = data.key_prefix;
+      setTokensFormat([...tokens]);
+      Modal.info({
+        title: t('令牌已轮换'),
+        content: (
+          <>
+            <p>{t('令牌只显示这一次，关闭后无法再次查看，请立即复制并妥善保存！')}</p>
+            <p>{key}</p>
+            {data.previous_key_expired_time > 0 && (
+              <p>
+                {t('旧令牌将于 {{time}} 失效', {
+                  time: timestamp2string(data.previous_key_expired_time),
+                })}
+              </p>
+            )}
+          </>
+        ),
+        okText: t('复制'),
+        onOk: async () => {
+          if (await copy(key)) {
+            showSuccess(t('已复制到剪贴板！'));
+          }
+        },
+        size: 'large',
+      });
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
   const searchTokens = async () => {
     if (searchKeyword === '' && searchToken === '') {
       // if keyword is blank, load files instead.
@@ -587,30 +615,13 @@ const TokensTable = () => {
         >
             {t('添加令牌')}
         </Button>
-        <Button
-            label={t('复制所选令牌')}
-            type='warning'
-            onClick={async () => {
-              if (selectedKeys.length === 0) {
-                showError(t('请至少选择一个令牌！'));
-                return;
-              }
-              let keys = '';
-              for (let i = 0; i < selectedKeys.length; i++) {
-                keys +=
-                    selectedKeys[i].name + '    sk-' + selectedKeys[i].key + '\n';
-              }
-              await copyText(keys);
-            }}
-        >
-          {t('复制所选令牌到剪贴板')}
-        </Button>
       </div>
 
       <Table
         style={{ marginTop: 20 }}
         columns={columns}
         dataSource={pageData}
+        rowKey='id'
         pagination={{
           currentPage: activePage,
           pageSize: pageSize,
@@ -995,7 +995,8 @@ const EditChannel = (props) => {
                     'setting',
                     JSON.stringify({
                       force_format: true,
-                      fallback_channel: false
+                      fallback_channel: false,
+                      max_concurrency: 0
                     }, null, 2)
                   );
                 }}
@@ -2,6 +2,7 @@ import React, { useEffect, useState, useContext } from 'react';
 import { useNavigate } from 'react-router-dom';
 import {
   API,
+  copy,
   isMobile,
   showError,
   showSuccess,
@@ -15,6 +16,7 @@ import {
   Checkbox,
   DatePicker,
   Input,
+  Modal,
   Select,
   SideSheet,
   Space,
@@ -252,6 +254,7 @@ const EditToken = (props) => {
 
       // 处理新增多个令牌的情况
       let successCount = 0; // 记录成功创建的令牌数量
+      let createdKeys = ''; // 令牌只在创建时返回一次
       for (let i = 0; i < tokenCount; i++) {
         let localInputs = { ...inputs };
         if (i !== 0) {
@@ -271,10 +274,11 @@ const EditToken = (props) => {
         }
         localInputs.model_limits = localInputs.model_limits.join(',');
         let res = await API.post(`/api/token/`, localInputs);
-        const { success, message } = res.data;
+        const { success, message, data } = res.data;
 
         if (success) {
           successCount++;
+          createdKeys += data.name + '    sk-' + data.key + '\n';
         } else {
           showError(t(message));
           break; // 如果创建失败，终止循环
@@ -282,9 +286,24 @@ const EditToken = (props) => {
       }
 
       if (successCount > 0) {
-        showSuccess(
-          t('令牌创建成功，请在列表页面点击复制获取令牌！')
-        );
+        Modal.info({
+          title: t('令牌创建成功'),
+          content: (
+            <>
+              <Typography.Text type='warning'>
+                {t('令牌只显示这一次，关闭后无法再次查看，请立即复制并妥善保存！')}
+              </Typography.Text>
+              <TextArea value={createdKeys} autosize readOnly style={{ marginTop: 10 }} />
+            </>
+          ),
+          okText: t('复制'),
+          onOk: async () => {
+            if (await copy(createdKeys)) {
+              showSuccess(t('已复制到剪贴板！'));
+            }
+          },
+          size: 'large',
+        });
         props.refresh();
         props.handleClose();
       }